@@ -67,19 +67,118 @@ func (*Empty) Descriptor() ([]byte, []int) {
 	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{0}
 }
 
+// packet capture configuration
+type PcapConf struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Duration   string `protobuf:"bytes,1,opt,name=duration,proto3" json:"duration,omitempty"` // capture duration (seconds)
+	Iface      string `protobuf:"bytes,2,opt,name=iface,proto3" json:"iface,omitempty"`
+	Filter     string `protobuf:"bytes,3,opt,name=filter,proto3" json:"filter,omitempty"` // tcpdump filter expression
+	Snaplen    int32  `protobuf:"varint,4,opt,name=snaplen,proto3" json:"snaplen,omitempty"`
+	MaxPackets int64  `protobuf:"varint,5,opt,name=maxPackets,proto3" json:"maxPackets,omitempty"`
+	MaxBytes   int64  `protobuf:"varint,6,opt,name=maxBytes,proto3" json:"maxBytes,omitempty"` // maximum size of the pcap file
+}
+
+func (x *PcapConf) Reset() {
+	*x = PcapConf{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PcapConf) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PcapConf) ProtoMessage() {}
+
+func (x *PcapConf) ProtoReflect() protoreflect.Message {
+	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PcapConf.ProtoReflect.Descriptor instead.
+func (*PcapConf) Descriptor() ([]byte, []int) {
+	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PcapConf) GetDuration() string {
+	if x != nil {
+		return x.Duration
+	}
+	return ""
+}
+
+func (x *PcapConf) GetIface() string {
+	if x != nil {
+		return x.Iface
+	}
+	return ""
+}
+
+func (x *PcapConf) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *PcapConf) GetSnaplen() int32 {
+	if x != nil {
+		return x.Snaplen
+	}
+	return 0
+}
+
+func (x *PcapConf) GetMaxPackets() int64 {
+	if x != nil {
+		return x.MaxPackets
+	}
+	return 0
+}
+
+func (x *PcapConf) GetMaxBytes() int64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
 type CollectionConf struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Duration     string `protobuf:"bytes,1,opt,name=duration,proto3" json:"duration,omitempty"`
-	CollectionId string `protobuf:"bytes,2,opt,name=collectionId,proto3" json:"collectionId,omitempty"`
+	Duration       string    `protobuf:"bytes,1,opt,name=duration,proto3" json:"duration,omitempty"`
+	CollectionId   string    `protobuf:"bytes,2,opt,name=collectionId,proto3" json:"collectionId,omitempty"`
+	Perf           bool      `protobuf:"varint,3,opt,name=perf,proto3" json:"perf,omitempty"`            // record a perf profile
+	Pcap           *PcapConf `protobuf:"bytes,4,opt,name=pcap,proto3" json:"pcap,omitempty"`             // packet capture (if set)
+	PerfOutput     string    `protobuf:"bytes,5,opt,name=perfOutput,proto3" json:"perfOutput,omitempty"` // perf output: perfdata (default), folded, or flamegraph
+	SsDuration     string    `protobuf:"bytes,6,opt,name=ssDuration,proto3" json:"ssDuration,omitempty"` // socket (ss) sampling duration (empty for no sampling)
+	SsIntervalMs   int32     `protobuf:"varint,7,opt,name=ssIntervalMs,proto3" json:"ssIntervalMs,omitempty"`
+	SsFilter       string    `protobuf:"bytes,8,opt,name=ssFilter,proto3" json:"ssFilter,omitempty"`              // ss filter expression
+	RdmaDuration   string    `protobuf:"bytes,9,opt,name=rdmaDuration,proto3" json:"rdmaDuration,omitempty"`      // RDMA counters collection duration (empty for none)
+	HubbleDuration string    `protobuf:"bytes,10,opt,name=hubbleDuration,proto3" json:"hubbleDuration,omitempty"` // hubble flows recording duration (empty for none)
+	HubbleLabel    string    `protobuf:"bytes,11,opt,name=hubbleLabel,proto3" json:"hubbleLabel,omitempty"`       // label (key=value) selecting the flows to record
+	CpuDuration    string    `protobuf:"bytes,12,opt,name=cpuDuration,proto3" json:"cpuDuration,omitempty"`       // CPU usage collection duration (empty for none)
+	CpuPods        string    `protobuf:"bytes,13,opt,name=cpuPods,proto3" json:"cpuPods,omitempty"`               // pods whose CPU usage is collected (name=uid,...)
 }
 
 func (x *CollectionConf) Reset() {
 	*x = CollectionConf{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[1]
+		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -92,7 +191,7 @@ func (x *CollectionConf) String() string {
 func (*CollectionConf) ProtoMessage() {}
 
 func (x *CollectionConf) ProtoReflect() protoreflect.Message {
-	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[1]
+	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -105,7 +204,7 @@ func (x *CollectionConf) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CollectionConf.ProtoReflect.Descriptor instead.
 func (*CollectionConf) Descriptor() ([]byte, []int) {
-	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{1}
+	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *CollectionConf) GetDuration() string {
@@ -122,6 +221,83 @@ func (x *CollectionConf) GetCollectionId() string {
 	return ""
 }
 
+func (x *CollectionConf) GetPerf() bool {
+	if x != nil {
+		return x.Perf
+	}
+	return false
+}
+
+func (x *CollectionConf) GetPcap() *PcapConf {
+	if x != nil {
+		return x.Pcap
+	}
+	return nil
+}
+
+func (x *CollectionConf) GetPerfOutput() string {
+	if x != nil {
+		return x.PerfOutput
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetSsDuration() string {
+	if x != nil {
+		return x.SsDuration
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetSsIntervalMs() int32 {
+	if x != nil {
+		return x.SsIntervalMs
+	}
+	return 0
+}
+
+func (x *CollectionConf) GetSsFilter() string {
+	if x != nil {
+		return x.SsFilter
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetRdmaDuration() string {
+	if x != nil {
+		return x.RdmaDuration
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetHubbleDuration() string {
+	if x != nil {
+		return x.HubbleDuration
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetHubbleLabel() string {
+	if x != nil {
+		return x.HubbleLabel
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetCpuDuration() string {
+	if x != nil {
+		return x.CpuDuration
+	}
+	return ""
+}
+
+func (x *CollectionConf) GetCpuPods() string {
+	if x != nil {
+		return x.CpuPods
+	}
+	return ""
+}
+
 type CollectionResultsConf struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -133,7 +309,7 @@ type CollectionResultsConf struct {
 func (x *CollectionResultsConf) Reset() {
 	*x = CollectionResultsConf{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[2]
+		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -146,7 +322,7 @@ func (x *CollectionResultsConf) String() string {
 func (*CollectionResultsConf) ProtoMessage() {}
 
 func (x *CollectionResultsConf) ProtoReflect() protoreflect.Message {
-	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[2]
+	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -159,7 +335,7 @@ func (x *CollectionResultsConf) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CollectionResultsConf.ProtoReflect.Descriptor instead.
 func (*CollectionResultsConf) Descriptor() ([]byte, []int) {
-	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{2}
+	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *CollectionResultsConf) GetCollectionId() string {
@@ -180,7 +356,7 @@ type File struct {
 func (x *File) Reset() {
 	*x = File{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[3]
+		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -193,7 +369,7 @@ func (x *File) String() string {
 func (*File) ProtoMessage() {}
 
 func (x *File) ProtoReflect() protoreflect.Message {
-	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[3]
+	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -206,7 +382,7 @@ func (x *File) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use File.ProtoReflect.Descriptor instead.
 func (*File) Descriptor() ([]byte, []int) {
-	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{3}
+	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *File) GetData() []byte {
@@ -216,39 +392,222 @@ func (x *File) GetData() []byte {
 	return nil
 }
 
+// a (part of a) system information section. Sections might be split into
+// multiple messages with the same name.
+type SysInfoSection struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *SysInfoSection) Reset() {
+	*x = SysInfoSection{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SysInfoSection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SysInfoSection) ProtoMessage() {}
+
+func (x *SysInfoSection) ProtoReflect() protoreflect.Message {
+	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SysInfoSection.ProtoReflect.Descriptor instead.
+func (*SysInfoSection) Descriptor() ([]byte, []int) {
+	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SysInfoSection) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SysInfoSection) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type NetStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Counters       map[string]int64 `protobuf:"bytes,1,rep,name=counters,proto3" json:"counters,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"` // nstat counters (absolute values)
+	ConntrackCount int64            `protobuf:"varint,2,opt,name=conntrackCount,proto3" json:"conntrackCount,omitempty"`
+	TimeWait       int64            `protobuf:"varint,3,opt,name=timeWait,proto3" json:"timeWait,omitempty"`  // number of TIME_WAIT sockets (ss -s)
+	SsSummary      string           `protobuf:"bytes,4,opt,name=ssSummary,proto3" json:"ssSummary,omitempty"` // raw ss -s output
+}
+
+func (x *NetStats) Reset() {
+	*x = NetStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_benchmonitor_benchmonitor_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NetStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NetStats) ProtoMessage() {}
+
+func (x *NetStats) ProtoReflect() protoreflect.Message {
+	mi := &file_benchmonitor_benchmonitor_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NetStats.ProtoReflect.Descriptor instead.
+func (*NetStats) Descriptor() ([]byte, []int) {
+	return file_benchmonitor_benchmonitor_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *NetStats) GetCounters() map[string]int64 {
+	if x != nil {
+		return x.Counters
+	}
+	return nil
+}
+
+func (x *NetStats) GetConntrackCount() int64 {
+	if x != nil {
+		return x.ConntrackCount
+	}
+	return 0
+}
+
+func (x *NetStats) GetTimeWait() int64 {
+	if x != nil {
+		return x.TimeWait
+	}
+	return 0
+}
+
+func (x *NetStats) GetSsSummary() string {
+	if x != nil {
+		return x.SsSummary
+	}
+	return ""
+}
+
 var File_benchmonitor_benchmonitor_proto protoreflect.FileDescriptor
 
 var file_benchmonitor_benchmonitor_proto_rawDesc = []byte{
 	0x0a, 0x1f, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2f, 0x62,
 	0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74,
 	0x6f, 0x12, 0x0c, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x22,
-	0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x50, 0x0a, 0x0e, 0x43, 0x6f, 0x6c, 0x6c,
-	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x75,
-	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x64, 0x75,
-	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63,
-	0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x6f,
-	0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x22, 0x3b, 0x0a, 0x15, 0x43, 0x6f,
-	0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x43,
-	0x6f, 0x6e, 0x66, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f,
-	0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x6f, 0x6c, 0x6c, 0x65,
-	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x22, 0x1a, 0x0a, 0x04, 0x46, 0x69, 0x6c, 0x65, 0x12,
-	0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64,
-	0x61, 0x74, 0x61, 0x32, 0xea, 0x01, 0x0a, 0x10, 0x4b, 0x75, 0x62, 0x65, 0x62, 0x65, 0x6e, 0x63,
-	0x68, 0x4d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x12, 0x39, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x53,
-	0x79, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x13, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f,
-	0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x12, 0x2e, 0x62, 0x65,
-	0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x22,
-	0x00, 0x30, 0x01, 0x12, 0x46, 0x0a, 0x0f, 0x53, 0x74, 0x61, 0x72, 0x74, 0x43, 0x6f, 0x6c, 0x6c,
-	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f,
-	0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e,
-	0x43, 0x6f, 0x6e, 0x66, 0x1a, 0x13, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69,
-	0x74, 0x6f, 0x72, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x53, 0x0a, 0x14, 0x47,
-	0x65, 0x74, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75,
-	0x6c, 0x74, 0x73, 0x12, 0x23, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74,
-	0x6f, 0x72, 0x2e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73,
-	0x75, 0x6c, 0x74, 0x73, 0x43, 0x6f, 0x6e, 0x66, 0x1a, 0x12, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68,
-	0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x46, 0x69, 0x6c, 0x65, 0x22, 0x00, 0x30, 0x01,
-	0x42, 0x06, 0x5a, 0x04, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0xaa, 0x01, 0x0a, 0x08, 0x50, 0x63, 0x61,
+	0x70, 0x43, 0x6f, 0x6e, 0x66, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x66, 0x61, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x69, 0x66, 0x61, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65,
+	0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12,
+	0x18, 0x0a, 0x07, 0x73, 0x6e, 0x61, 0x70, 0x6c, 0x65, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x07, 0x73, 0x6e, 0x61, 0x70, 0x6c, 0x65, 0x6e, 0x12, 0x1e, 0x0a, 0x0a, 0x6d, 0x61, 0x78,
+	0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x6d,
+	0x61, 0x78, 0x50, 0x61, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x61, 0x78,
+	0x42, 0x79, 0x74, 0x65, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x6d, 0x61, 0x78,
+	0x42, 0x79, 0x74, 0x65, 0x73, 0x22, 0x96, 0x03, 0x0a, 0x0e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x6f, 0x6c, 0x6c,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x65, 0x72, 0x66,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x70, 0x65, 0x72, 0x66, 0x12, 0x2a, 0x0a, 0x04,
+	0x70, 0x63, 0x61, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x62, 0x65, 0x6e,
+	0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x50, 0x63, 0x61, 0x70, 0x43, 0x6f,
+	0x6e, 0x66, 0x52, 0x04, 0x70, 0x63, 0x61, 0x70, 0x12, 0x1e, 0x0a, 0x0a, 0x70, 0x65, 0x72, 0x66,
+	0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x65,
+	0x72, 0x66, 0x4f, 0x75, 0x74, 0x70, 0x75, 0x74, 0x12, 0x12, 0x0a, 0x0a, 0x73, 0x73, 0x44, 0x75,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x12, 0x14, 0x0a, 0x0c,
+	0x73, 0x73, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d, 0x73, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x05, 0x12, 0x10, 0x0a, 0x08, 0x73, 0x73, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x09, 0x12, 0x22, 0x0a, 0x0c, 0x72, 0x64, 0x6d, 0x61, 0x44, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x72, 0x64, 0x6d, 0x61,
+	0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x26, 0x0a, 0x0e, 0x68, 0x75, 0x62, 0x62,
+	0x6c, 0x65, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0e, 0x68, 0x75, 0x62, 0x62, 0x6c, 0x65, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x20, 0x0a, 0x0b, 0x68, 0x75, 0x62, 0x62, 0x6c, 0x65, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x18,
+	0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x68, 0x75, 0x62, 0x62, 0x6c, 0x65, 0x4c, 0x61, 0x62,
+	0x65, 0x6c, 0x12, 0x20, 0x0a, 0x0b, 0x63, 0x70, 0x75, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x70, 0x75, 0x44, 0x75, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x70, 0x75, 0x50, 0x6f, 0x64, 0x73, 0x18,
+	0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x70, 0x75, 0x50, 0x6f, 0x64, 0x73, 0x22, 0x3b,
+	0x0a, 0x15, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x73, 0x43, 0x6f, 0x6e, 0x66, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6f, 0x6c, 0x6c, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63,
+	0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x22, 0x1a, 0x0a, 0x04, 0x46,
+	0x69, 0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x38, 0x0a, 0x0e, 0x53, 0x79, 0x73, 0x49, 0x6e,
+	0x66, 0x6f, 0x53, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61, 0x74,
+	0x61, 0x22, 0xeb, 0x01, 0x0a, 0x08, 0x4e, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x40,
+	0x0a, 0x08, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x24, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e,
+	0x4e, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x2e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72,
+	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73,
+	0x12, 0x26, 0x0a, 0x0e, 0x63, 0x6f, 0x6e, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0e, 0x63, 0x6f, 0x6e, 0x6e, 0x74, 0x72,
+	0x61, 0x63, 0x6b, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x74, 0x69, 0x6d, 0x65,
+	0x57, 0x61, 0x69, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x74, 0x69, 0x6d, 0x65,
+	0x57, 0x61, 0x69, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x73, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72,
+	0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x73, 0x53, 0x75, 0x6d, 0x6d, 0x61,
+	0x72, 0x79, 0x1a, 0x3b, 0x0a, 0x0d, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x32,
+	0xb2, 0x02, 0x0a, 0x10, 0x4b, 0x75, 0x62, 0x65, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x4d, 0x6f, 0x6e,
+	0x69, 0x74, 0x6f, 0x72, 0x12, 0x43, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x53, 0x79, 0x73, 0x49, 0x6e,
+	0x66, 0x6f, 0x12, 0x13, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f,
+	0x72, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x1c, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d,
+	0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x53, 0x79, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x53, 0x65,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x00, 0x30, 0x01, 0x12, 0x46, 0x0a, 0x0f, 0x53, 0x74, 0x61,
+	0x72, 0x74, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x2e, 0x62,
+	0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x43, 0x6f, 0x6c, 0x6c,
+	0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x1a, 0x13, 0x2e, 0x62, 0x65, 0x6e,
+	0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22,
+	0x00, 0x12, 0x53, 0x0a, 0x14, 0x47, 0x65, 0x74, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x12, 0x23, 0x2e, 0x62, 0x65, 0x6e, 0x63,
+	0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x43, 0x6f, 0x6e, 0x66, 0x1a, 0x12,
+	0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x46, 0x69,
+	0x6c, 0x65, 0x22, 0x00, 0x30, 0x01, 0x12, 0x3c, 0x0a, 0x0b, 0x47, 0x65, 0x74, 0x4e, 0x65, 0x74,
+	0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x13, 0x2e, 0x62, 0x65, 0x6e, 0x63, 0x68, 0x6d, 0x6f, 0x6e,
+	0x69, 0x74, 0x6f, 0x72, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x16, 0x2e, 0x62, 0x65, 0x6e,
+	0x63, 0x68, 0x6d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x2e, 0x4e, 0x65, 0x74, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x22, 0x00, 0x42, 0x06, 0x5a, 0x04, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -263,25 +622,33 @@ func file_benchmonitor_benchmonitor_proto_rawDescGZIP() []byte {
 	return file_benchmonitor_benchmonitor_proto_rawDescData
 }
 
-var file_benchmonitor_benchmonitor_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_benchmonitor_benchmonitor_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_benchmonitor_benchmonitor_proto_goTypes = []interface{}{
 	(*Empty)(nil),                 // 0: benchmonitor.Empty
-	(*CollectionConf)(nil),        // 1: benchmonitor.CollectionConf
-	(*CollectionResultsConf)(nil), // 2: benchmonitor.CollectionResultsConf
-	(*File)(nil),                  // 3: benchmonitor.File
+	(*PcapConf)(nil),              // 1: benchmonitor.PcapConf
+	(*CollectionConf)(nil),        // 2: benchmonitor.CollectionConf
+	(*CollectionResultsConf)(nil), // 3: benchmonitor.CollectionResultsConf
+	(*File)(nil),                  // 4: benchmonitor.File
+	(*SysInfoSection)(nil),        // 5: benchmonitor.SysInfoSection
+	(*NetStats)(nil),              // 6: benchmonitor.NetStats
+	nil,                           // 7: benchmonitor.NetStats.CountersEntry
 }
 var file_benchmonitor_benchmonitor_proto_depIdxs = []int32{
-	0, // 0: benchmonitor.KubebenchMonitor.GetSysInfo:input_type -> benchmonitor.Empty
-	1, // 1: benchmonitor.KubebenchMonitor.StartCollection:input_type -> benchmonitor.CollectionConf
-	2, // 2: benchmonitor.KubebenchMonitor.GetCollectionResults:input_type -> benchmonitor.CollectionResultsConf
-	3, // 3: benchmonitor.KubebenchMonitor.GetSysInfo:output_type -> benchmonitor.File
-	0, // 4: benchmonitor.KubebenchMonitor.StartCollection:output_type -> benchmonitor.Empty
-	3, // 5: benchmonitor.KubebenchMonitor.GetCollectionResults:output_type -> benchmonitor.File
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	1, // 0: benchmonitor.CollectionConf.pcap:type_name -> benchmonitor.PcapConf
+	7, // 1: benchmonitor.NetStats.counters:type_name -> benchmonitor.NetStats.CountersEntry
+	0, // 2: benchmonitor.KubebenchMonitor.GetSysInfo:input_type -> benchmonitor.Empty
+	2, // 3: benchmonitor.KubebenchMonitor.StartCollection:input_type -> benchmonitor.CollectionConf
+	3, // 4: benchmonitor.KubebenchMonitor.GetCollectionResults:input_type -> benchmonitor.CollectionResultsConf
+	0, // 5: benchmonitor.KubebenchMonitor.GetNetStats:input_type -> benchmonitor.Empty
+	5, // 6: benchmonitor.KubebenchMonitor.GetSysInfo:output_type -> benchmonitor.SysInfoSection
+	0, // 7: benchmonitor.KubebenchMonitor.StartCollection:output_type -> benchmonitor.Empty
+	4, // 8: benchmonitor.KubebenchMonitor.GetCollectionResults:output_type -> benchmonitor.File
+	6, // 9: benchmonitor.KubebenchMonitor.GetNetStats:output_type -> benchmonitor.NetStats
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_benchmonitor_benchmonitor_proto_init() }
@@ -303,7 +670,7 @@ func file_benchmonitor_benchmonitor_proto_init() {
 			}
 		}
 		file_benchmonitor_benchmonitor_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*CollectionConf); i {
+			switch v := v.(*PcapConf); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -315,7 +682,7 @@ func file_benchmonitor_benchmonitor_proto_init() {
 			}
 		}
 		file_benchmonitor_benchmonitor_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*CollectionResultsConf); i {
+			switch v := v.(*CollectionConf); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -327,6 +694,18 @@ func file_benchmonitor_benchmonitor_proto_init() {
 			}
 		}
 		file_benchmonitor_benchmonitor_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CollectionResultsConf); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_benchmonitor_benchmonitor_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*File); i {
 			case 0:
 				return &v.state
@@ -338,6 +717,30 @@ func file_benchmonitor_benchmonitor_proto_init() {
 				return nil
 			}
 		}
+		file_benchmonitor_benchmonitor_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SysInfoSection); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_benchmonitor_benchmonitor_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NetStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -345,7 +748,7 @@ func file_benchmonitor_benchmonitor_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_benchmonitor_benchmonitor_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -374,6 +777,7 @@ type KubebenchMonitorClient interface {
 	GetSysInfo(ctx context.Context, in *Empty, opts ...grpc.CallOption) (KubebenchMonitor_GetSysInfoClient, error)
 	StartCollection(ctx context.Context, in *CollectionConf, opts ...grpc.CallOption) (*Empty, error)
 	GetCollectionResults(ctx context.Context, in *CollectionResultsConf, opts ...grpc.CallOption) (KubebenchMonitor_GetCollectionResultsClient, error)
+	GetNetStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*NetStats, error)
 }
 
 type kubebenchMonitorClient struct {
@@ -400,7 +804,7 @@ func (c *kubebenchMonitorClient) GetSysInfo(ctx context.Context, in *Empty, opts
 }
 
 type KubebenchMonitor_GetSysInfoClient interface {
-	Recv() (*File, error)
+	Recv() (*SysInfoSection, error)
 	grpc.ClientStream
 }
 
@@ -408,8 +812,8 @@ type kubebenchMonitorGetSysInfoClient struct {
 	grpc.ClientStream
 }
 
-func (x *kubebenchMonitorGetSysInfoClient) Recv() (*File, error) {
-	m := new(File)
+func (x *kubebenchMonitorGetSysInfoClient) Recv() (*SysInfoSection, error) {
+	m := new(SysInfoSection)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
@@ -457,11 +861,21 @@ func (x *kubebenchMonitorGetCollectionResultsClient) Recv() (*File, error) {
 	return m, nil
 }
 
+func (c *kubebenchMonitorClient) GetNetStats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*NetStats, error) {
+	out := new(NetStats)
+	err := c.cc.Invoke(ctx, "/benchmonitor.KubebenchMonitor/GetNetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // KubebenchMonitorServer is the server API for KubebenchMonitor service.
 type KubebenchMonitorServer interface {
 	GetSysInfo(*Empty, KubebenchMonitor_GetSysInfoServer) error
 	StartCollection(context.Context, *CollectionConf) (*Empty, error)
 	GetCollectionResults(*CollectionResultsConf, KubebenchMonitor_GetCollectionResultsServer) error
+	GetNetStats(context.Context, *Empty) (*NetStats, error)
 }
 
 // UnimplementedKubebenchMonitorServer can be embedded to have forward compatible implementations.
@@ -477,6 +891,9 @@ func (*UnimplementedKubebenchMonitorServer) StartCollection(context.Context, *Co
 func (*UnimplementedKubebenchMonitorServer) GetCollectionResults(*CollectionResultsConf, KubebenchMonitor_GetCollectionResultsServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetCollectionResults not implemented")
 }
+func (*UnimplementedKubebenchMonitorServer) GetNetStats(context.Context, *Empty) (*NetStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNetStats not implemented")
+}
 
 func RegisterKubebenchMonitorServer(s *grpc.Server, srv KubebenchMonitorServer) {
 	s.RegisterService(&_KubebenchMonitor_serviceDesc, srv)
@@ -491,7 +908,7 @@ func _KubebenchMonitor_GetSysInfo_Handler(srv interface{}, stream grpc.ServerStr
 }
 
 type KubebenchMonitor_GetSysInfoServer interface {
-	Send(*File) error
+	Send(*SysInfoSection) error
 	grpc.ServerStream
 }
 
@@ -499,7 +916,7 @@ type kubebenchMonitorGetSysInfoServer struct {
 	grpc.ServerStream
 }
 
-func (x *kubebenchMonitorGetSysInfoServer) Send(m *File) error {
+func (x *kubebenchMonitorGetSysInfoServer) Send(m *SysInfoSection) error {
 	return x.ServerStream.SendMsg(m)
 }
 
@@ -542,6 +959,24 @@ func (x *kubebenchMonitorGetCollectionResultsServer) Send(m *File) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _KubebenchMonitor_GetNetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubebenchMonitorServer).GetNetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/benchmonitor.KubebenchMonitor/GetNetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubebenchMonitorServer).GetNetStats(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _KubebenchMonitor_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "benchmonitor.KubebenchMonitor",
 	HandlerType: (*KubebenchMonitorServer)(nil),
@@ -550,6 +985,10 @@ var _KubebenchMonitor_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StartCollection",
 			Handler:    _KubebenchMonitor_StartCollection_Handler,
 		},
+		{
+			MethodName: "GetNetStats",
+			Handler:    _KubebenchMonitor_GetNetStats_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -0,0 +1,77 @@
+// Package auth implements the (optional) bearer token authentication of the
+// monitor: kubenetbench attaches the token to every call (see Token), and the
+// monitor rejects the calls without it (see UnaryServerInterceptor and
+// StreamServerInterceptor).
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// TokenEnv is the environment variable of the token, both for
+	// kubenetbench and the monitor
+	TokenEnv = "KNB_MONITOR_TOKEN"
+
+	metadataKey  = "authorization"
+	bearerPrefix = "Bearer "
+)
+
+// Token is the per-RPC credentials of a token
+type Token string
+
+// GetRequestMetadata attaches the token to a call
+func (t Token) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{metadataKey: bearerPrefix + string(t)}, nil
+}
+
+// RequireTransportSecurity returns false: the token is also sent over
+// plaintext connections (e.g., through port-forwards)
+func (t Token) RequireTransportSecurity() bool {
+	return false
+}
+
+// check returns an error if the call (of ctx) does not carry the token
+func check(ctx context.Context, token string) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing token")
+	}
+	for _, v := range md.Get(metadataKey) {
+		if !strings.HasPrefix(v, bearerPrefix) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(v, bearerPrefix)), []byte(token)) == 1 {
+			return nil
+		}
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return status.Error(codes.Unauthenticated, "missing token")
+}
+
+// UnaryServerInterceptor rejects the unary calls without the token
+func UnaryServerInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects the streaming calls without the token
+func StreamServerInterceptor(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(ss.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
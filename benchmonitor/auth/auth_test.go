@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+func TestServerInterceptors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor("s3cret")),
+		grpc.StreamInterceptor(StreamServerInterceptor("s3cret")),
+	)
+	pb.RegisterKubebenchMonitorServer(srv, &pb.UnimplementedKubebenchMonitorServer{})
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	// calls returns the status codes of a unary and a streaming call
+	calls := func(opts ...grpc.DialOption) (codes.Code, codes.Code) {
+		conn, err := grpc.Dial(l.Addr().String(), append(opts, grpc.WithInsecure())...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		cli := pb.NewKubebenchMonitorClient(conn)
+		_, err = cli.GetNetStats(context.Background(), &pb.Empty{})
+		unary := status.Code(err)
+		stream, err := cli.GetSysInfo(context.Background(), &pb.Empty{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		return unary, status.Code(err)
+	}
+
+	for name, opts := range map[string][]grpc.DialOption{
+		"no token":    nil,
+		"wrong token": {grpc.WithPerRPCCredentials(Token("guess"))},
+	} {
+		if unary, stream := calls(opts...); unary != codes.Unauthenticated || stream != codes.Unauthenticated {
+			t.Errorf("%s: unexpected codes: %s %s", name, unary, stream)
+		}
+	}
+
+	// the calls reach the server (which does not implement them)
+	if unary, stream := calls(grpc.WithPerRPCCredentials(Token("s3cret"))); unary != codes.Unimplemented || stream != codes.Unimplemented {
+		t.Errorf("token: unexpected codes: %s %s", unary, stream)
+	}
+}
@@ -2,33 +2,115 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	// responses are compressed if kubenetbench requests it (see its
+	// --monitor-compression)
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
 
 	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/benchmonitor/auth"
 )
 
 var (
 	srvPort = flag.Int("p", 8451, "Server port")
+	// NB: gRPC's default receive limit is 4MiB (see kubenetbench's --grpc-max-msg-size)
+	maxMsgSize = flag.Int("max-msg-size", 64*1024*1024, "Maximum gRPC message size (sent and received)")
+	// TLS (see kubenetbench's --monitor-tls-*)
+	tlsCert     = flag.String("tls-cert", "", "TLS certificate (PEM): serve over TLS")
+	tlsKey      = flag.String("tls-key", "", "TLS key (PEM)")
+	tlsClientCA = flag.String("tls-client-ca", "", "CA certificate (PEM) that client certificates must be signed by (mutual TLS)")
 )
 
+// tlsCredentials returns the TLS credentials of the server, or nil to serve
+// plaintext connections
+func tlsCredentials() (credentials.TransportCredentials, error) {
+	if *tlsCert == "" {
+		if *tlsClientCA != "" {
+			return nil, fmt.Errorf("-tls-client-ca requires -tls-cert")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if *tlsClientCA != "" {
+		pem, err := os.ReadFile(*tlsClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client CA file %s", *tlsClientCA)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(conf), nil
+}
+
 type monitorSrv struct {
 	pb.UnimplementedKubebenchMonitorServer
-	pendingCmds sync.Map
+	pendingCmds sync.Map // collection id -> *pendingCmd
+	perfOutputs sync.Map // collection id -> perf output
 }
 
-type ErrCmdInProgress struct{}
+// valid perf outputs (see scripts/perf-collect.sh)
+var perfOutputs = map[string]struct{}{
+	"perfdata":   {},
+	"folded":     {},
+	"flamegraph": {},
+}
+
+// sentArchiveTTL is how long the archive of a collection is kept once sent,
+// unless another collection starts first (see removeSentArchive)
+const sentArchiveTTL = 10 * time.Minute
+
+// pendingCmd is the state of a collection: its commands, and then its
+// archive, which is kept once sent, since the client may still fail to
+// receive all of it (e.g., over a port-forward) and retry
+type pendingCmd struct {
+	done chan struct{} // closed once the commands exited
+	err  error         // error of the commands (set before done is closed)
 
-func (e *ErrCmdInProgress) Error() string {
-	return fmt.Sprintf("command still running")
+	archiveSem chan struct{} // held while the archive is packaged, sent, or removed
+	archive    string        // the archive (empty until packaged)
+	sent       bool          // the archive was sent (at least once)
+	removed    bool          // the archive was removed (see removeSentArchive)
+}
+
+// wait waits until the commands exited, and returns false if ctx is done first
+func (p *pendingCmd) wait(ctx context.Context) bool {
+	select {
+	case <-p.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func (srv *monitorSrv) StartCollection(
@@ -38,17 +120,77 @@ func (srv *monitorSrv) StartCollection(
 
 	ret := &pb.Empty{}
 	cid := arg.CollectionId
-	_, loaded := srv.pendingCmds.LoadOrStore(cid, &ErrCmdInProgress{})
+
+	perfOutput := arg.PerfOutput
+	if perfOutput == "" {
+		perfOutput = "perfdata"
+	}
+	if _, ok := perfOutputs[perfOutput]; !ok {
+		return ret, fmt.Errorf("invalid perf output: %s", perfOutput)
+	}
+
+	// the client did not retry retrieving the previous collections
+	srv.pendingCmds.Range(func(k, v any) bool {
+		srv.removeSentArchive(k.(string), v.(*pendingCmd))
+		return true
+	})
+
+	pending := &pendingCmd{done: make(chan struct{}), archiveSem: make(chan struct{}, 1)}
+	_, loaded := srv.pendingCmds.LoadOrStore(cid, pending)
 
 	if loaded {
 		return ret, fmt.Errorf(fmt.Sprintf("id %s already exists", cid))
 	}
 
+	srv.perfOutputs.Store(cid, perfOutput)
+
+	cmds := []*exec.Cmd{}
+	if arg.Perf {
+		cmds = append(cmds, exec.Command("/scripts/perf-record.sh", arg.Duration, cid))
+	}
+	if pcap := arg.Pcap; pcap != nil {
+		cmds = append(cmds, exec.Command("/scripts/pcap-record.sh",
+			pcap.Duration, cid, pcap.Iface,
+			strconv.Itoa(int(pcap.Snaplen)),
+			strconv.FormatInt(pcap.MaxPackets, 10),
+			strconv.FormatInt(pcap.MaxBytes, 10),
+			pcap.Filter))
+	}
+	if arg.SsDuration != "" {
+		cmds = append(cmds, exec.Command("/scripts/ss-sample.sh",
+			arg.SsDuration, cid,
+			strconv.Itoa(int(arg.SsIntervalMs)),
+			arg.SsFilter))
+	}
+	if arg.RdmaDuration != "" {
+		cmds = append(cmds, exec.Command("/scripts/rdma-counters.sh", arg.RdmaDuration, cid))
+	}
+	if arg.HubbleDuration != "" {
+		cmds = append(cmds, exec.Command("/scripts/hubble-observe.sh", arg.HubbleDuration, cid, arg.HubbleLabel))
+	}
+	if arg.CpuDuration != "" {
+		cmds = append(cmds, exec.Command("/scripts/cpu-usage.sh", arg.CpuDuration, cid, arg.CpuPods))
+	}
+
 	go func() {
-		t := arg.Duration
-		cmd := exec.Command("/scripts/perf-record.sh", t, cid)
-		err := cmd.Run()
-		srv.pendingCmds.Store(cid, err)
+		var wg sync.WaitGroup
+		errs := make([]error, len(cmds))
+		for i, cmd := range cmds {
+			wg.Add(1)
+			go func(i int, cmd *exec.Cmd) {
+				defer wg.Done()
+				errs[i] = cmd.Run()
+			}(i, cmd)
+		}
+		wg.Wait()
+
+		for _, e := range errs {
+			if e != nil {
+				pending.err = e
+				break
+			}
+		}
+		close(pending.done)
 	}()
 
 	return ret, nil
@@ -92,51 +234,252 @@ func (srv *monitorSrv) GetCollectionResults(
 	stream pb.KubebenchMonitor_GetCollectionResultsServer,
 ) error {
 	cid := arg.CollectionId
-	cmd_err, ok := srv.pendingCmds.Load(cid)
+	pending, ok := srv.pendingCmds.Load(cid)
 	if !ok {
 		return fmt.Errorf(fmt.Sprintf("invalid collection id %s", cid))
 	}
 
-	switch cmd_err.(type) {
-	case ErrCmdInProgress:
-		return fmt.Errorf("command still running: %w", cmd_err)
+	// the commands (e.g., perf record and its post-processing) might still be
+	// running, since kubenetbench requests the results once the traffic ends:
+	// wait for them, rather than failing the collection
+	p := pending.(*pendingCmd)
+	if !p.wait(stream.Context()) {
+		return fmt.Errorf("collection did not complete: %w", stream.Context().Err())
+	}
+
+	if p.err != nil {
+		srv.pendingCmds.Delete(cid)
+		return fmt.Errorf("command resulted in error: %w", p.err)
+	}
+
+	// the client retries if the stream fails (e.g., if it was reset), possibly
+	// while the archive is being packaged or sent: retries wait for it, and
+	// the archive is sent again, until it is removed
+	select {
+	case p.archiveSem <- struct{}{}:
+	case <-stream.Context().Done():
+		return fmt.Errorf("collection archive not sent: %w", stream.Context().Err())
+	}
+	defer func() { <-p.archiveSem }()
+	if p.removed {
+		return fmt.Errorf("the archive of collection %s was removed", cid)
+	}
+
+	if p.archive == "" {
+		perfOutput := "perfdata"
+		if v, ok := srv.perfOutputs.LoadAndDelete(cid); ok {
+			perfOutput = v.(string)
+		}
+
+		// NB: the archive includes all the collected data (perf, pcap, ss, rdma, hubble, cpu)
+		cmd := exec.Command("/scripts/perf-collect.sh", cid, perfOutput)
+		collect_err := cmd.Run()
+		if collect_err != nil {
+			srv.pendingCmds.Delete(cid)
+			return fmt.Errorf("collection (%s) command resulted in error: %w", cmd, collect_err)
+		}
+		p.archive = fmt.Sprintf("/tmp/%s-perf.data.tar.bz2", cid)
 	}
 
-	srv.pendingCmds.Delete(cid)
-	if cmd_err != nil {
-		return fmt.Errorf("command resulted in error: %w", cmd_err)
+	if err := copyFileToStream(p.archive, stream); err != nil {
+		return err
+	}
+	if !p.sent {
+		p.sent = true
+		var expire func()
+		expire = func() {
+			if !srv.removeSentArchive(cid, p) {
+				time.AfterFunc(sentArchiveTTL, expire)
+			}
+		}
+		time.AfterFunc(sentArchiveTTL, expire)
 	}
+	return nil
+}
 
-	cmd := exec.Command("/scripts/perf-collect.sh", cid)
-	collect_err := cmd.Run()
-	if collect_err != nil {
-		return fmt.Errorf("collection (%s) command resulted in error: %w", cmd, collect_err)
+// removeSentArchive removes the archive of a collection if it was sent, unless
+// it is being sent again, and returns false if it was not removed
+func (srv *monitorSrv) removeSentArchive(cid string, p *pendingCmd) bool {
+	select {
+	case p.archiveSem <- struct{}{}:
+	default:
+		return false
+	}
+	defer func() { <-p.archiveSem }()
+	if !p.sent || p.removed {
+		return p.removed
 	}
+	p.removed = true
+	srv.pendingCmds.CompareAndDelete(cid, p)
+	if err := os.Remove(p.archive); err != nil {
+		log.Printf("failed to remove collection archive %s: %v", p.archive, err)
+	}
+	return true
+}
 
-	fname := fmt.Sprintf("/tmp/%s-perf.data.tar.bz2", cid)
-	return copyFileToStream(fname, stream)
+// system information sections (see scripts/system_info.sh)
+var sysInfoSections = []string{
+	"kernel",
+	"cpu",
+	"sysctls",
+	"interfaces",
+	"offloads",
+	"routes",
+	"lsmod",
+	"cmdline",
+	"numa",
+	"firmware",
 }
 
+// maximum data size of a single SysInfoSection message
+const sysInfoChunkSize = 64 * 1024
+
 func (*monitorSrv) GetSysInfo(
 	_ *pb.Empty,
 	stream pb.KubebenchMonitor_GetSysInfoServer,
 ) error {
 
-	cmd := exec.Command("scripts/system_info.sh")
-	data, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("io error: %w", err)
-	}
-	err = stream.Send(&pb.File{
-		Data: data,
-	})
-	if err != nil {
-		return fmt.Errorf("io error: %w", err)
+	for _, section := range sysInfoSections {
+		cmd := exec.Command("scripts/system_info.sh", section)
+		data, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("io error: %w", err)
+		}
+
+		for {
+			n := len(data)
+			if n > sysInfoChunkSize {
+				n = sysInfoChunkSize
+			}
+			err = stream.Send(&pb.SysInfoSection{
+				Name: section,
+				Data: data[:n],
+			})
+			if err != nil {
+				return fmt.Errorf("io error: %w", err)
+			}
+			data = data[n:]
+			if len(data) == 0 {
+				break
+			}
+		}
 	}
 
 	return nil
 }
 
+var ssTimeWaitRegEx = regexp.MustCompile(`timewait (\d+)`)
+
+// parse nstat output (lines of: name value rate)
+func parseNstat(data []byte) map[string]int64 {
+	ret := make(map[string]int64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		ret[fields[0]] = v
+	}
+	return ret
+}
+
+// netNamespaces returns a pid in each network namespace of the node, by
+// namespace (e.g., net:[4026531840]), if the monitor can enter them (i.e., the
+// monitor daemonset, see scripts/ss-sample.sh). Otherwise (e.g., the monitor
+// sidecar), it returns nil.
+func netNamespaces(ctx context.Context) map[string]string {
+	if exec.CommandContext(ctx, "nsenter", "-t", strconv.Itoa(os.Getpid()), "-n", "true").Run() != nil {
+		return nil
+	}
+	ret := make(map[string]string)
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, d := range dirs {
+		ns, err := os.Readlink(filepath.Join(d, "ns", "net"))
+		if err != nil {
+			continue
+		}
+		if _, ok := ret[ns]; !ok {
+			ret[ns] = filepath.Base(d)
+		}
+	}
+	return ret
+}
+
+// GetNetStats samples the network statistics of every network namespace of
+// the node (the benchmark sockets are in the namespaces of the pods), or of
+// its own if it cannot enter them. The counters of each namespace are keyed
+// by <namespace>/<counter> (see kubenetbench's netStatsDeltas).
+func (*monitorSrv) GetNetStats(
+	ctx context.Context,
+	_ *pb.Empty,
+) (*pb.NetStats, error) {
+
+	ret := &pb.NetStats{Counters: make(map[string]int64)}
+
+	namespaces := netNamespaces(ctx)
+	if namespaces == nil {
+		namespaces = map[string]string{"": ""}
+	}
+	names := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	for _, ns := range names {
+		command := func(name string, args ...string) *exec.Cmd {
+			if ns == "" {
+				return exec.CommandContext(ctx, name, args...)
+			}
+			return exec.CommandContext(ctx, "nsenter", append([]string{"-t", namespaces[ns], "-n", name}, args...)...)
+		}
+
+		// -a: absolute values, -s: do not update history, -z: include zero counters
+		nstat, err := command("nstat", "-asz").Output()
+		if err != nil {
+			if ns == "" {
+				return nil, fmt.Errorf("nstat failed: %w", err)
+			}
+			// e.g., the namespace was deleted
+			continue
+		}
+		for k, v := range parseNstat(nstat) {
+			if ns != "" {
+				k = ns + "/" + k
+			}
+			ret.Counters[k] = v
+		}
+
+		ss, err := command("ss", "-s").Output()
+		if err != nil {
+			if ns == "" {
+				return nil, fmt.Errorf("ss failed: %w", err)
+			}
+			continue
+		}
+		if ns != "" {
+			ret.SsSummary += fmt.Sprintf("# %s\n", ns)
+		}
+		ret.SsSummary += string(ss)
+		if m := ssTimeWaitRegEx.FindSubmatch(ss); len(m) == 2 {
+			tw, _ := strconv.ParseInt(string(m[1]), 10, 64)
+			ret.TimeWait += tw
+		}
+	}
+
+	// NB: conntrack might not be loaded, so ignore errors
+	ct, err := ioutil.ReadFile("/proc/sys/net/netfilter/nf_conntrack_count")
+	if err == nil {
+		ret.ConntrackCount, _ = strconv.ParseInt(strings.TrimSpace(string(ct)), 10, 64)
+	}
+
+	return ret, nil
+}
+
 func newMonitorSrv() *monitorSrv {
 	return &monitorSrv{}
 }
@@ -151,7 +494,35 @@ func main() {
 		log.Fatal(fmt.Errorf("listen (%s) failed: %w", laddr, err))
 	}
 
-	grpcSrv := grpc.NewServer()
+	opts := []grpc.ServerOption{
+		grpc.MaxSendMsgSize(*maxMsgSize),
+		grpc.MaxRecvMsgSize(*maxMsgSize),
+		// accept the keepalive pings of kubenetbench (see its
+		// --monitor-keepalive), also on idle connections: by default, the
+		// server closes connections that ping more often than every 5m
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	creds, err := tlsCredentials()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if creds != nil {
+		log.Println("serving over TLS")
+		opts = append(opts, grpc.Creds(creds))
+	}
+	// the token is injected from a secret (see kubenetbench's --monitor-token)
+	if token := os.Getenv(auth.TokenEnv); token != "" {
+		log.Println("requiring token authentication")
+		opts = append(opts,
+			grpc.UnaryInterceptor(auth.UnaryServerInterceptor(token)),
+			grpc.StreamInterceptor(auth.StreamServerInterceptor(token)),
+		)
+	}
+
+	grpcSrv := grpc.NewServer(opts...)
 	pb.RegisterKubebenchMonitorServer(grpcSrv, newMonitorSrv())
 	grpcSrv.Serve(listen)
 }
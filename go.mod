@@ -1,10 +1,19 @@
 module github.com/cilium/kubenetbench
 
-go 1.14
+go 1.21
 
 require (
 	github.com/golang/protobuf v1.4.2
 	github.com/spf13/cobra v1.0.0
+	golang.org/x/net v0.0.0-20190522155817-f3200d17e092
 	google.golang.org/grpc v1.31.1
 	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/spf13/pflag v1.0.3
+	golang.org/x/sys v0.0.0-20190215142949-d0b11bdaac8a // indirect
+	golang.org/x/text v0.3.0 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
 )
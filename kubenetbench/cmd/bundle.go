@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	bundleOutput     string
+	bundleNoCompress bool
+	bundleRedact     bool
+)
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "write the session directory (manifests, logs, sysinfo, perf archives, results) as a single tarball, e.g., to share it",
+	Run: func(cmd *cobra.Command, args []string) {
+		sess := getSession()
+		if fi, err := os.Stat(sess.Dir()); err != nil || !fi.IsDir() {
+			log.Fatal("session directory not found: ", sess.Dir())
+		}
+
+		fname := bundleOutput
+		if fname == "" {
+			fname = fmt.Sprintf("%s.tar.gz", sessID)
+			if bundleNoCompress {
+				fname = fmt.Sprintf("%s.tar", sessID)
+			}
+		}
+		f, err := os.Create(fname)
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to create %s: %w", fname, err))
+		}
+		defer f.Close()
+
+		stats, err := core.WriteBundle(sess.Dir(), f, !bundleNoCompress, bundleRedact, fname)
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to bundle session: %w", err))
+		}
+		if len(stats.Excluded) > 0 {
+			slog.Warn("binary files cannot be redacted and were excluded", "files", len(stats.Excluded))
+		}
+		slog.Info("session bundle", "files", stats.Files, "bytes", stats.Bytes, "file", fname)
+	},
+}
+
+func init() {
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "output file (default: <session id>.tar.gz, or <session id>.tar with --no-compress)")
+	bundleCmd.Flags().BoolVar(&bundleNoCompress, "no-compress", false, "do not compress the tarball (gzip)")
+	bundleCmd.Flags().BoolVar(&bundleRedact, "redact", false, "replace node names and IP addresses with placeholders (binary files, e.g., perf archives and packet captures, are excluded)")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	customImage  string
+	customSrvCmd string
+	customCliCmd string
+	customPorts  []uint
+	customParser string
+
+	customIntervals string
+)
+
+func addCustomFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&customImage, "custom-image", "", "container image for the custom benchmark")
+	cmd.Flags().StringVar(&customSrvCmd, "custom-srv-cmd", "", "server command line for the custom benchmark (executed with sh -c)")
+	cmd.Flags().StringVar(&customCliCmd, "custom-cli-cmd", "", "client command line for the custom benchmark (executed with sh -c, server IP is in $KNB_SERVER_IP)")
+	cmd.Flags().UintSliceVar(&customPorts, "custom-port", []uint{}, "server port(s) of the custom benchmark")
+	cmd.Flags().StringVar(&customParser, "custom-parser", "", "command to parse the custom benchmark output (stdin: raw output, stdout: KEY=VALUE lines)")
+	cmd.Flags().StringVar(&customIntervals, "custom-intervals", "", fmt.Sprintf("format of the per-interval stats of the custom benchmark output, stored with the result (available values: %s)", strings.Join(core.IntervalFormats, ",")))
+}
+
+func getCustomBench() (core.Benchmark, error) {
+	if customImage == "" || customSrvCmd == "" || customCliCmd == "" {
+		return nil, fmt.Errorf("custom benchmark requires --custom-image, --custom-srv-cmd, and --custom-cli-cmd")
+	}
+
+	ports := make([]uint16, 0, len(customPorts))
+	for _, p := range customPorts {
+		if p == 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid custom port: %d", p)
+		}
+		ports = append(ports, uint16(p))
+	}
+
+	cnf := &core.CustomConf{
+		Timeout:   benchmarkDuration,
+		Image:     customImage,
+		SrvCmd:    customSrvCmd,
+		CliCmd:    customCliCmd,
+		Ports:     ports,
+		Parser:    customParser,
+		Intervals: customIntervals,
+	}
+	if err := cnf.ValidateIntervals(); err != nil {
+		return nil, err
+	}
+	return cnf, nil
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "diagnose the session's live resources (monitor, benchmark pods)",
+	Run: func(cmd *cobra.Command, args []string) {
+		sess := getSession()
+		findings, err := sess.Diagnose(context.Background())
+		if err != nil {
+			log.Fatal(fmt.Errorf("diagnosis failed: %w", err))
+		}
+
+		if len(findings) == 0 {
+			fmt.Println("no problems found")
+			return
+		}
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		os.Exit(1)
+	},
+}
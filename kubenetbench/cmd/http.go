@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	httpConnections int
+	httpThreads     int
+	httpTLS         string
+	httpTLSSecret   string
+	proxyProtocol   string
+)
+
+func addHTTPFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&httpConnections, "http-connections", 16, "number of HTTP connections to keep open (http benchmark)")
+	cmd.Flags().IntVar(&httpThreads, "http-threads", 2, "number of client threads (http benchmark)")
+	cmd.Flags().StringVar(&httpTLS, "http-tls", "", "use HTTPS (http benchmark): tls (server TLS termination) or mtls (mutual TLS)")
+	cmd.Flags().StringVar(&httpTLSSecret, "http-tls-secret", "", "kubernetes.io/tls secret (with ca.crt for mtls) to use for --http-tls (default: generate a self-signed one)")
+	cmd.Flags().StringVar(&proxyProtocol, "proxy-protocol", "", "send a PROXY protocol header (v1, v2) on each connection, via a local proxy of the client, to a server that expects it (http benchmark). NB: the topology differs from runs without it (nginx server and a haproxy hop), so compare with runs of the other version, not without it")
+}
+
+func getHTTPBench() (core.Benchmark, error) {
+	if httpThreads < 1 || httpConnections < httpThreads {
+		return nil, fmt.Errorf("invalid http benchmark configuration: %d connections, %d threads", httpConnections, httpThreads)
+	}
+
+	cnf := core.HTTPConfDefault()
+	cnf.Timeout = benchmarkDuration
+	cnf.Connections = httpConnections
+	cnf.Threads = httpThreads
+	cnf.TLS = httpTLS
+	cnf.TLSSecret = httpTLSSecret
+	if err := cnf.ValidateTLS(); err != nil {
+		return nil, err
+	}
+	cnf.ProxyProtocol = proxyProtocol
+	if err := cnf.ValidateProxyProtocol(); err != nil {
+		return nil, err
+	}
+	if cnf.TLS != "" {
+		cnf.Port = 8443
+	}
+	return &cnf, nil
+}
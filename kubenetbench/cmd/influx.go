@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	influxURI         string
+	influxMeasurement string
+	influxToken       string
+)
+
+func addInfluxFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&influxURI, "influx-uri", "", "InfluxDB write URL to export results to (e.g., http://influx:8086/write?db=knb or http://influx:8086/api/v2/write?org=ORG&bucket=BUCKET)")
+	cmd.Flags().StringVar(&influxMeasurement, "influx-measurement", core.DefaultInfluxMeasurement, "InfluxDB measurement of exported results")
+	cmd.Flags().StringVar(&influxToken, "influx-token", "", "InfluxDB API token (default: $INFLUX_TOKEN)")
+}
+
+// getInfluxExporter returns the exporter of the results (nil if --influx-uri
+// is not set). Points are tagged with the session id and the cluster's CNI,
+// unless the latter is given as a --tag.
+func getInfluxExporter() (*core.InfluxExporter, error) {
+	if influxURI == "" {
+		return nil, nil
+	}
+
+	// NB: not the flag default, which --help would print
+	token := influxToken
+	if token == "" {
+		token = os.Getenv("INFLUX_TOKEN")
+	}
+	exp, err := core.NewInfluxExporter(influxURI, influxMeasurement, token)
+	if err != nil {
+		return nil, err
+	}
+	exp.SetTag("session", sessID)
+
+	for _, t := range tags {
+		if strings.HasPrefix(t, "cni=") {
+			return exp, nil
+		}
+	}
+	if cni := core.DetectCNI(); cni != "" {
+		exp.SetTag("cni", cni)
+	}
+	return exp, nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	ingressClass   string
+	ingressGateway string
+	ingressHost    string
+	ingressPort    uint16
+)
+
+var ingressCmd = newIngressCmd()
+
+// newIngressCmd returns the ingress command (it is added to both the root and
+// the watch commands)
+func newIngressCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ingress",
+		Short: "ingress (north-south HTTP) benchmark run",
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if !cmd.Flags().Changed("benchmark") {
+				benchmark = "http"
+			}
+			if benchmark != "http" {
+				log.Fatal("ingress runs require the http benchmark, got: ", benchmark)
+			}
+
+			err := runBenchmark(cmd, "ingress", func(runctx *core.RunBenchCtx) error {
+				st := core.IngressSt{
+					RunBenchCtx:  runctx,
+					IngressClass: ingressClass,
+					Gateway:      ingressGateway,
+					Host:         ingressHost,
+					Port:         ingressPort,
+				}
+				return st.Execute()
+			})
+			if err != nil {
+				log.Fatal("ingress execution failed:", err)
+			}
+		},
+	}
+
+	addBenchmarkFlags(cmd)
+	cmd.Flags().StringVar(&ingressClass, "ingress-class", "", "ingress class name (default: the cluster's default class)")
+	cmd.Flags().StringVar(&ingressGateway, "gateway", "", "[namespace/]name of a Gateway: use an HTTPRoute instead of an Ingress")
+	cmd.Flags().StringVar(&ingressHost, "ingress-host", "", "host for the ingress rule (default: <runid>.kubenetbench.test)")
+	cmd.Flags().Uint16Var(&ingressPort, "ingress-port", 80, "port of the ingress address")
+	return cmd
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "manage the shared monitor daemonset, used by sessions with --use-existing-monitor",
+}
+
+var monitorDeployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "deploy (or update) the shared monitor, and wait until it is ready",
+	Run: func(cmd *cobra.Command, args []string) {
+		sess := getSharedMonitorSession()
+		setMonitorPlacement(sess)
+
+		slog.Info("deploying shared monitor")
+		err := sess.StartMonitor()
+		if err == nil {
+			err = sess.WaitMonitor()
+		}
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to deploy shared monitor: %w", err))
+		}
+	},
+}
+
+var monitorTeardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "remove the shared monitor",
+	Run: func(cmd *cobra.Command, args []string) {
+		sess := getSharedMonitorSession()
+		slog.Info("removing shared monitor")
+		if err := sess.StopMonitor(); err != nil {
+			log.Fatal(fmt.Errorf("failed to remove shared monitor: %w", err))
+		}
+	},
+}
+
+// getSharedMonitorSession returns a session that manages the shared monitor
+func getSharedMonitorSession() *core.Session {
+	sess := getSession()
+	if !sess.MonitorEnabled() || sess.MonitorSidecar() {
+		log.Fatal("the shared monitor cannot be managed with --no-monitor or --monitor-sidecar")
+	}
+	sess.SetUseExistingMonitor()
+	return sess
+}
+
+func init() {
+	monitorDeployCmd.Flags().StringArrayVar(&monitorNodeLbls, "monitor-node-label", nil, "run the shared monitor only on nodes with the label key=value (repeatable)")
+	monitorDeployCmd.Flags().StringArrayVar(&monitorTols, "monitor-node-toleration", nil, "tolerate only the given node taints in the shared monitor, instead of all taints: key[=value][:effect] (repeatable)")
+
+	monitorCmd.AddCommand(monitorDeployCmd)
+	monitorCmd.AddCommand(monitorTeardownCmd)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -14,46 +15,89 @@ var netperfTy string
 var netperfArgs []string
 var netperfBenchArgs []string
 var netperfNStreams int
+var netperfDirection string
+var socketBuf string
+var socketSendBuf string
+var socketRecvBuf string
+var congControl string
+var netperfInterval int
+
+// socketBufRe matches netperf sizes: bytes, optionally with a unit suffix
+// (K/M/G for powers of 2, k/m/g for powers of 10)
+var socketBufRe = regexp.MustCompile(`^[0-9]+[KMGkmg]?$`)
+
+// congControlRe matches TCP congestion control algorithm names
+var congControlRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// directions of stream benchmarks, and the corresponding netperf types (bidir
+// runs tcp_stream and tcp_maerts at the same time, see scripts/bidir_netperf)
+var netperfDirections = map[string]string{
+	"send":  "tcp_stream",
+	"recv":  "tcp_maerts",
+	"bidir": "tcp_stream",
+}
 
 var netperfBenchMap = map[string]func() core.Benchmark{
 	"tcp_rr": func() core.Benchmark {
-		cnf := core.NetperfRRConf{core.NetperfConfDefault("tcp_rr", netperfArgs, netperfBenchArgs)}
+		cnf := core.NetperfRRConf{NetperfConf: core.NetperfConfDefault("tcp_rr", netperfArgs, netperfBenchArgs)}
 		cnf.Timeout = benchmarkDuration
+		handle_sockbuf(&cnf.NetperfConf)
+		handle_congcontrol(&cnf.NetperfConf)
+		handle_interval(&cnf.NetperfConf)
 		handle_nstreams(&cnf.NetperfConf)
 		return &cnf
 	},
 
 	"tcp_crr": func() core.Benchmark {
-		cnf := core.NetperfRRConf{core.NetperfConfDefault("tcp_crr", netperfArgs, netperfBenchArgs)}
+		cnf := core.NetperfRRConf{NetperfConf: core.NetperfConfDefault("tcp_crr", netperfArgs, netperfBenchArgs)}
 		cnf.Timeout = benchmarkDuration
+		handle_sockbuf(&cnf.NetperfConf)
+		handle_congcontrol(&cnf.NetperfConf)
+		handle_interval(&cnf.NetperfConf)
 		handle_nstreams(&cnf.NetperfConf)
 		return &cnf
 	},
 
 	"udp_rr": func() core.Benchmark {
-		cnf := core.NetperfRRConf{core.NetperfConfDefault("udp_rr", netperfArgs, netperfBenchArgs)}
+		cnf := core.NetperfRRConf{NetperfConf: core.NetperfConfDefault("udp_rr", netperfArgs, netperfBenchArgs)}
 		cnf.Timeout = benchmarkDuration
+		handle_sockbuf(&cnf.NetperfConf)
+		handle_congcontrol(&cnf.NetperfConf)
+		handle_interval(&cnf.NetperfConf)
 		handle_nstreams(&cnf.NetperfConf)
 		return &cnf
 	},
 
 	"tcp_stream": func() core.Benchmark {
-		cnf := core.NetperfStreamConf{core.NetperfConfDefault("tcp_stream", netperfArgs, netperfBenchArgs)}
+		cnf := core.NetperfStreamConf{NetperfConf: core.NetperfConfDefault("tcp_stream", netperfArgs, netperfBenchArgs)}
 		cnf.Timeout = benchmarkDuration
-		handle_nstreams(&cnf.NetperfConf)
+		handle_sockbuf(&cnf.NetperfConf)
+		handle_congcontrol(&cnf.NetperfConf)
+		handle_interval(&cnf.NetperfConf)
+		if netperfDirection == "bidir" {
+			handle_bidir(&cnf.NetperfConf)
+		} else {
+			handle_nstreams(&cnf.NetperfConf)
+		}
 		return &cnf
 	},
 
 	"tcp_maerts": func() core.Benchmark {
-		cnf := core.NetperfStreamConf{core.NetperfConfDefault("tcp_maerts", netperfArgs, netperfBenchArgs)}
+		cnf := core.NetperfStreamConf{NetperfConf: core.NetperfConfDefault("tcp_maerts", netperfArgs, netperfBenchArgs)}
 		cnf.Timeout = benchmarkDuration
+		handle_sockbuf(&cnf.NetperfConf)
+		handle_congcontrol(&cnf.NetperfConf)
+		handle_interval(&cnf.NetperfConf)
 		handle_nstreams(&cnf.NetperfConf)
 		return &cnf
 	},
 
 	"udp_stream": func() core.Benchmark {
-		cnf := core.NetperfStreamConf{core.NetperfConfDefault("udp_stream", netperfArgs, netperfBenchArgs)}
+		cnf := core.NetperfStreamConf{NetperfConf: core.NetperfConfDefault("udp_stream", netperfArgs, netperfBenchArgs)}
 		cnf.Timeout = benchmarkDuration
+		handle_sockbuf(&cnf.NetperfConf)
+		handle_congcontrol(&cnf.NetperfConf)
+		handle_interval(&cnf.NetperfConf)
 		handle_nstreams(&cnf.NetperfConf)
 		return &cnf
 	},
@@ -71,6 +115,93 @@ func addNetperfFlags(cmd *cobra.Command) {
 	cmd.Flags().StringArrayVar(&netperfArgs, "netperf-args", []string{}, "netperf arguments")
 	cmd.Flags().StringArrayVar(&netperfBenchArgs, "netperf-bench-args", []string{}, "netperf benchmark arguments (after --)")
 	cmd.Flags().IntVar(&netperfNStreams, "netperf-nstreams", 0, ">0 value enables using duper_netperf script for multiple streams")
+	cmd.Flags().StringVar(&socketBuf, "socket-buffer", "", "socket buffer size (SO_SNDBUF and SO_RCVBUF) of both ends, e.g., 4M (default: system default, with autotuning)")
+	cmd.Flags().StringVar(&socketSendBuf, "socket-send-buffer", "", "socket send buffer size (SO_SNDBUF) of both ends (default: --socket-buffer)")
+	cmd.Flags().StringVar(&socketRecvBuf, "socket-recv-buffer", "", "socket receive buffer size (SO_RCVBUF) of both ends (default: --socket-buffer)")
+	cmd.Flags().StringVar(&congControl, "congestion-control", "", "TCP congestion control algorithm of both ends, e.g., cubic, bbr, reno (default: system default)")
+	cmd.Flags().IntVar(&netperfInterval, "netperf-interval", 0, "interval (seconds) of netperf interim results, stored as per-interval stats (stream benchmarks with a single stream, 0 for none)")
+	cmd.Flags().StringVar(&netperfDirection, "direction", "", "direction of TCP stream benchmarks: send (client to server), recv (server to client), bidir (both at the same time) (default: per --netperf-type)")
+}
+
+// netperfType returns the netperf type of the runs: --netperf-type, or the
+// stream type of --direction if given (which overrides the default tcp_rr,
+// and tcp_stream or tcp_maerts)
+func netperfType() string {
+	if netperfDirection == "" {
+		return netperfTy
+	}
+
+	ty, ok := netperfDirections[netperfDirection]
+	if !ok {
+		log.Fatalf("invalid direction: %s (available values: send,recv,bidir)", netperfDirection)
+	}
+	if netperfTy != "tcp_rr" && netperfTy != "tcp_stream" && netperfTy != "tcp_maerts" {
+		log.Fatalf("--direction is not supported with --netperf-type=%s", netperfTy)
+	}
+	return ty
+}
+
+// handle_bidir makes the client run the stream test in both directions (see
+// scripts/bidir_netperf)
+func handle_bidir(conf *core.NetperfConf) {
+	if netperfDirection != "bidir" {
+		return
+	}
+
+	nstreams := netperfNStreams
+	if nstreams == 0 {
+		nstreams = 1
+	}
+	conf.CliCommand = "scripts/bidir_netperf"
+	conf.PreArgs = append(conf.PreArgs, fmt.Sprintf("%d", nstreams))
+}
+
+// handle_sockbuf sets the socket buffer sizes based on --socket-*buffer
+func handle_sockbuf(conf *core.NetperfConf) {
+	conf.SendBuf = socketBuf
+	conf.RecvBuf = socketBuf
+	if socketSendBuf != "" {
+		conf.SendBuf = socketSendBuf
+	}
+	if socketRecvBuf != "" {
+		conf.RecvBuf = socketRecvBuf
+	}
+	for _, sz := range []string{conf.SendBuf, conf.RecvBuf} {
+		if sz != "" && !socketBufRe.MatchString(sz) {
+			log.Fatalf("invalid socket buffer size: %s (e.g., 262144, 256K, 4M)", sz)
+		}
+	}
+}
+
+// handle_congcontrol sets the congestion control algorithm based on
+// --congestion-control
+func handle_congcontrol(conf *core.NetperfConf) {
+	if congControl != "" && !congControlRe.MatchString(congControl) {
+		log.Fatalf("invalid congestion control algorithm: %s (e.g., cubic, bbr, reno)", congControl)
+	}
+	conf.CongControl = congControl
+}
+
+// handle_interval enables netperf interim results based on --netperf-interval
+func handle_interval(conf *core.NetperfConf) {
+	if netperfInterval == 0 {
+		// a measurement window is computed from the interim results of
+		// single-stream benchmarks
+		if measureWindow != "" && !strings.HasSuffix(conf.TestName, "rr") && netperfNStreams == 0 && netperfDirection != "bidir" {
+			conf.Interval = 1
+		}
+		return
+	}
+	if netperfInterval < 0 {
+		log.Fatalf("invalid netperf interval: %d", netperfInterval)
+	}
+	if strings.HasSuffix(conf.TestName, "rr") {
+		log.Fatalf("--netperf-interval is not supported with --netperf-type=%s: interim results of request/response tests are not data rates", conf.TestName)
+	}
+	if netperfNStreams > 0 || netperfDirection == "bidir" {
+		log.Fatalf("--netperf-interval is not supported with multiple streams")
+	}
+	conf.Interval = netperfInterval
 }
 
 func handle_nstreams(conf *core.NetperfConf) {
@@ -82,16 +213,16 @@ func handle_nstreams(conf *core.NetperfConf) {
 		conf.CliCommand = "scripts/duper_netperf"
 		conf.PreArgs = append(conf.PreArgs, fmt.Sprintf("%d", netperfNStreams))
 	} else {
-		log.Fatal("cannot use multiple streams with CliCommand=%s", conf.CliCommand)
+		log.Fatalf("cannot use multiple streams with CliCommand=%s", conf.CliCommand)
 	}
 }
 
 // TODO: parse options to support other netperf configurations here
 func getNetperfBench() core.Benchmark {
-
-	initFn, ok := netperfBenchMap[netperfTy]
+	ty := netperfType()
+	initFn, ok := netperfBenchMap[ty]
 	if !ok {
-		panic(fmt.Sprintf("Invalid netperf type: %s", netperfTy))
+		panic(fmt.Sprintf("Invalid netperf type: %s", ty))
 	}
 	return initFn()
 }
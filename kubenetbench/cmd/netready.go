@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var netreadyIterations int
+
+var netreadyCmd = &cobra.Command{
+	Use:   "netready",
+	Short: "pod network readiness (container start to first connection) benchmark",
+	Run: func(cmd *cobra.Command, args []string) {
+		runctx, err := getRunBenchCtx(getSession(), "netready", "", true)
+		if err != nil {
+			log.Fatal("initializing run context failed:", err)
+		}
+		st := core.NetReadySt{
+			RunBenchCtx: runctx,
+			Iterations:  netreadyIterations,
+		}
+		err = st.Execute()
+		runctx.RemoveYaml(err == nil)
+		if err != nil {
+			log.Fatal("netready execution failed:", err)
+		}
+	},
+}
+
+func init() {
+	addRunFlags(netreadyCmd)
+	netreadyCmd.Flags().IntVar(&netreadyIterations, "iterations", 20, "number of client pods to create")
+}
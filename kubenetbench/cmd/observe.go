@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	observeDuration time.Duration
+	observeNodes    []string
+)
+
+var observeCmd = &cobra.Command{
+	Use:   "observe",
+	Short: "collect node data (sysinfo, perf, network stats, etc.) for a window, without generating traffic (e.g., during a test of a real workload)",
+	Run: func(cmd *cobra.Command, args []string) {
+		runctx, err := getObserveCtx(getSession())
+		if err != nil {
+			log.Fatal("initializing run context failed:", err)
+		}
+		st := core.ObserveSt{
+			RunBenchCtx: runctx,
+			Nodes:       observeNodes,
+		}
+		if err := st.Execute(); err != nil {
+			log.Fatal("observe execution failed:", err)
+		}
+	},
+}
+
+// getObserveCtx returns the run context of an observe run
+func getObserveCtx(sess *core.Session) (*core.RunBenchCtx, error) {
+	if observeDuration < time.Second {
+		return nil, fmt.Errorf("invalid observe duration: %s", observeDuration)
+	}
+	secs := int(math.Ceil(observeDuration.Seconds()))
+
+	if runLabel == "" {
+		runLabel = "observe"
+	}
+	ctx := core.NewRunBenchCtx(
+		sess,
+		runLabel,
+		&core.ContainerSpec{},
+		&core.ContainerSpec{},
+		true,
+		&core.ObserveConf{Timeout: secs},
+		collectPerf,
+		collectNetStats)
+	if runID != "" {
+		if err := ctx.SetRunID(runID); err != nil {
+			return nil, err
+		}
+	}
+
+	// perf records for the whole window, unless specified otherwise
+	if collectionDuration != "" {
+		if err := ctx.SetCollectionDuration(collectionDuration); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.SetPerfOutput(perfOutput); err != nil {
+		return nil, err
+	}
+	ctx.SetMaxCollectionSize(maxCollectionSize)
+	if err := ctx.SetCollectionRetries(collectionRetries); err != nil {
+		return nil, err
+	}
+
+	if collectPcap {
+		err := ctx.SetPcap(core.PcapConf{
+			Iface:      pcapIface,
+			Filter:     pcapFilter,
+			Snaplen:    pcapSnaplen,
+			MaxPackets: pcapMaxPackets,
+			MaxBytes:   pcapMaxBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if collectRdma {
+		ctx.SetRdmaCounters()
+	}
+	if collectCPU {
+		ctx.SetCPUUsage()
+	}
+
+	if err := ctx.MakeDir(); err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		key, value, err := core.ParseTag(t)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.AddTag(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
+func init() {
+	observeCmd.Flags().DurationVar(&observeDuration, "duration", time.Minute, "duration of the observation window")
+	observeCmd.Flags().StringArrayVar(&observeNodes, "node", nil, "node to observe (repeatable, default: all the nodes with a monitor)")
+	observeCmd.Flags().StringVarP(&runLabel, "run-label", "l", "", "run label (default: observe)")
+	observeCmd.Flags().StringVar(&runID, "run-id", "", "run id (default: <run label>-<date>)")
+	observeCmd.Flags().StringArrayVar(&tags, "tag", []string{}, "descriptive key=value tag stored with the data (e.g., workload=checkout)")
+	addCollectionFlags(observeCmd, "the nodes", "the observation window")
+	observeCmd.Flags().BoolVar(&collectCPU, "collect-cpu", false, "collect the CPU usage of the nodes during the observation window")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var orchestrateSpec string
+
+var orchestrateCmd = &cobra.Command{
+	Use:   "orchestrate",
+	Short: "run several benchmarks concurrently (mixed load), and report their results together",
+	Run: func(cmd *cobra.Command, args []string) {
+		if orchestrateSpec == "" {
+			log.Fatal("--spec is required")
+		}
+		f, err := os.Open(orchestrateSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		specs, err := core.ParseOrchestrationSpec(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(fmt.Errorf("invalid spec %s: %w", orchestrateSpec, err))
+		}
+
+		sess := getSession()
+		id := fmt.Sprintf("orch-%s", time.Now().Format("20060102150405"))
+		slog.Info("orchestration", "id", id, "benchmarks", len(specs))
+		errs := sess.Orchestrate(context.Background(), id, specs)
+
+		var report bytes.Buffer
+		if err := core.WriteOrchestrationReport(sess.Dir(), id, specs, errs, &report); err != nil {
+			log.Fatal(fmt.Errorf("failed to write the orchestration report: %w", err))
+		}
+		fname := fmt.Sprintf("%s/%s-report.txt", sess.Dir(), id)
+		if err := os.WriteFile(fname, report.Bytes(), 0644); err != nil {
+			log.Fatal(fmt.Errorf("failed to create %s: %w", fname, err))
+		}
+		fmt.Print(report.String())
+		slog.Info("wrote orchestration report", "file", fname)
+
+		for _, err := range errs {
+			if err != nil {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	orchestrateCmd.Flags().StringVar(&orchestrateSpec, "spec", "", "orchestration spec (YAML): the benchmarks (name, command, namespace, args) to run concurrently")
+}
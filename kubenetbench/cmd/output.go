@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	outputFormat string
+	outputFile   string
+)
+
+// resultOutput is the output of the run results (nil without --output)
+var resultOutput io.Writer
+
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "output", "", "write the result of every run in this format (json: a JSON object per line, and the results of the session in <session dir>/"+core.ResultsJSONFname+"), e.g., for piping into jq")
+	cmd.Flags().StringVar(&outputFile, "output-file", "-", "file to write the results of --output to (-: standard output, which logs then avoid)")
+}
+
+// resultsToStdout returns true if the run results are written to the
+// standard output, which is then reserved for them
+func resultsToStdout() bool {
+	return outputFormat != "" && outputFile == "-"
+}
+
+// infoOutput returns the output of the logs and other informational messages
+// (e.g., the run id): the standard output, unless the results are written
+// there
+func infoOutput() io.Writer {
+	if resultsToStdout() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// openResultOutput opens the output of the run results, if any
+func openResultOutput() error {
+	switch outputFormat {
+	case "":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("invalid output format: %s (available values: json)", outputFormat)
+	}
+	if outputFile == "-" {
+		resultOutput = os.Stdout
+		return nil
+	}
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", outputFile, err)
+	}
+	// closed on exit
+	resultOutput = f
+	return nil
+}
+
+// outputResult writes the result of a run to the result output, and updates
+// the results of the session
+func outputResult(sess *core.Session, res *core.BenchResult) error {
+	if resultOutput == nil {
+		return nil
+	}
+	if err := res.WriteJSON(resultOutput); err != nil {
+		return fmt.Errorf("failed to write result of run %s: %w", res.RunID, err)
+	}
+	fname, err := sess.WriteResultsJSON()
+	if err != nil {
+		return fmt.Errorf("failed to write session results: %w", err)
+	}
+	slog.Debug("wrote session results", "file", fname)
+	return nil
+}
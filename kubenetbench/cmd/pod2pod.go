@@ -8,32 +8,49 @@ import (
 	"github.com/cilium/kubenetbench/kubenetbench/core"
 )
 
-var policyArg string
-
-var pod2podCmd = &cobra.Command{
-	Use:   "pod2pod",
-	Short: "pod-to-pod network benchmark run",
-	Run: func(cmd *cobra.Command, args []string) {
-		if policyArg != "" && policyArg != "port" {
-			log.Fatal("invalid policy: ", policyArg)
-		}
-
-		runctx, err := getRunBenchCtx("pod2pod", true)
-		if err != nil {
-			log.Fatal("initializing run context failed:", err)
-		}
-		st := core.Pod2PodSt{
-			RunBenchCtx: runctx,
-			Policy:      policyArg,
-		}
-		err = st.Execute()
-		if err != nil {
-			log.Fatal("pod2pod execution failed:", err)
-		}
-	},
-}
+var (
+	policyArg            string
+	networkAttachment    string
+	networkIface         string
+	cliNetworkAttachment string
+	srvNetworkAttachment string
+	cliNetworkIface      string
+	srvNetworkIface      string
+)
+
+var pod2podCmd = newPod2podCmd()
+
+// newPod2podCmd returns the pod2pod command (it is added to both the root and
+// the watch commands)
+func newPod2podCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pod2pod",
+		Short: "pod-to-pod network benchmark run",
+		Run: func(cmd *cobra.Command, args []string) {
+			if policyArg != "" && policyArg != "port" {
+				log.Fatal("invalid policy: ", policyArg)
+			}
+
+			err := runBenchmark(cmd, "pod2pod", func(runctx *core.RunBenchCtx) error {
+				st := core.Pod2PodSt{
+					RunBenchCtx: runctx,
+					Policy:      policyArg,
+				}
+				return st.Execute()
+			})
+			if err != nil {
+				log.Fatal("pod2pod execution failed:", err)
+			}
+		},
+	}
 
-func init() {
-	addBenchmarkFlags(pod2podCmd)
-	pod2podCmd.Flags().StringVar(&policyArg, "policy", "", "isolation policy (empty or \"port\")")
+	addBenchmarkFlags(cmd)
+	cmd.Flags().StringVar(&policyArg, "policy", "", "isolation policy (empty or \"port\")")
+	cmd.Flags().StringVar(&networkAttachment, "network-attachment", "", "multus network attachment for the benchmark pods (k8s.v1.cni.cncf.io/networks annotation)")
+	cmd.Flags().StringVar(&networkIface, "network-iface", "net1", "pod interface of the network attachment to run the benchmark over")
+	cmd.Flags().StringVar(&cliNetworkAttachment, "client-network-attachment", "", "multus network attachment for the client pod (default: --network-attachment)")
+	cmd.Flags().StringVar(&srvNetworkAttachment, "server-network-attachment", "", "multus network attachment for the server pod (default: --network-attachment)")
+	cmd.Flags().StringVar(&cliNetworkIface, "client-network-iface", "", "client pod interface of its network attachment (default: --network-iface)")
+	cmd.Flags().StringVar(&srvNetworkIface, "server-network-iface", "", "server pod interface of its network attachment (default: --network-iface)")
+	return cmd
 }
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	quicConnections  int
+	quicThreads      int
+	quicStreams      int
+	quicResponseSize int64
+	quicGSO          bool
+	quicTLSSecret    string
+)
+
+func addQUICFlags(cmd *cobra.Command) {
+	def := core.QUICConfDefault()
+	cmd.Flags().IntVar(&quicConnections, "quic-connections", def.Connections, "number of QUIC connections (quic benchmark)")
+	cmd.Flags().IntVar(&quicThreads, "quic-threads", def.Threads, "number of client threads (quic benchmark)")
+	cmd.Flags().IntVar(&quicStreams, "quic-streams", def.Streams, "maximum concurrent streams (requests) per QUIC connection (quic benchmark)")
+	cmd.Flags().Int64Var(&quicResponseSize, "quic-response-size", def.ResponseSize, "size (bytes) of the server responses (quic benchmark)")
+	cmd.Flags().BoolVar(&quicGSO, "quic-gso", false, "enable UDP generic segmentation offload (GSO) on the server, which sends the responses (quic benchmark)")
+	cmd.Flags().StringVar(&quicTLSSecret, "quic-tls-secret", "", "kubernetes.io/tls secret to use (quic benchmark, default: generate a self-signed one)")
+}
+
+func getQUICBench() (core.Benchmark, error) {
+	cnf := core.QUICConfDefault()
+	cnf.Timeout = benchmarkDuration
+	cnf.Connections = quicConnections
+	cnf.Threads = quicThreads
+	cnf.Streams = quicStreams
+	cnf.ResponseSize = quicResponseSize
+	cnf.GSO = quicGSO
+	cnf.TLSSecret = quicTLSSecret
+	if err := cnf.Validate(); err != nil {
+		return nil, err
+	}
+	return &cnf, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var reproducerPath string
+
+// reproducerSkipFlags are the flags that are not included in reproducers (and
+// in the arguments that identify a sweep, see SweepProgress): run ids must be
+// unique, resuming does not change what is run, and secrets are not written
+// to files (the InfluxDB token defaults to $INFLUX_TOKEN, and the monitor
+// token to $KNB_MONITOR_TOKEN)
+var reproducerSkipFlags = map[string]bool{
+	"help":            true,
+	"emit-reproducer": true,
+	"print-spec":      true,
+	"run-id":          true,
+	"resume":          true,
+	"influx-token":    true,
+	"monitor-token":   true,
+}
+
+// reproducerArgs returns the arguments that rerun a command: its path (e.g.,
+// watch pod2pod), and the effective value of every flag, including defaults
+// (so that the reproducer does not depend on them)
+func reproducerArgs(cmd *cobra.Command) []string {
+	// the root command is the program
+	args := strings.Fields(cmd.CommandPath())[1:]
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if reproducerSkipFlags[f.Name] || f.Deprecated != "" {
+			return
+		}
+		if f.Value.Type() == "stringArray" {
+			vals, _ := cmd.Flags().GetStringArray(f.Name)
+			for _, v := range vals {
+				args = append(args, fmt.Sprintf("--%s=%s", f.Name, v))
+			}
+			return
+		} else if strings.HasSuffix(f.Value.Type(), "Slice") {
+			// e.g., [8000,8001], which is set as 8000,8001
+			if v := strings.Trim(f.Value.String(), "[]"); v != "" {
+				args = append(args, fmt.Sprintf("--%s=%s", f.Name, v))
+			}
+			return
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	return args
+}
+
+// emitReproducer writes the reproducer script of a command (see
+// --emit-reproducer), and returns it
+func emitReproducer(cmd *cobra.Command) (string, error) {
+	script, err := core.Reproducer(reproducerArgs(cmd))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(reproducerPath, []byte(script), 0755); err != nil {
+		return "", err
+	}
+	return script, nil
+}
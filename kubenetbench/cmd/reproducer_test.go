@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReproducerArgsSecrets(t *testing.T) {
+	// the monitor token is a persistent flag of the root command
+	if err := pod2podCmd.ParseFlags([]string{"--monitor-token=s3cret", "--influx-token=t0ken"}); err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(reproducerArgs(pod2podCmd), " ")
+	for _, secret := range []string{"s3cret", "t0ken"} {
+		if strings.Contains(args, secret) {
+			t.Errorf("secret %q in reproducer args: %s", secret, args)
+		}
+	}
+	if !strings.Contains(args, "--monitor-port=") {
+		t.Errorf("persistent flags not in reproducer args: %s", args)
+	}
+}
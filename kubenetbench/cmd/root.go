@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -13,10 +15,48 @@ import (
 )
 
 var (
-	quiet           bool
-	sessID          string
-	sessDirBase     string
-	sessPortForward bool
+	quiet            bool
+	sessID           string
+	sessDirBase      string
+	sessPortForward  bool
+	sessNoMonitor    bool
+	sessLabelPrefix  string
+	maxConcWrites    int
+	sysInfoParallel  int
+	sysInfoRetries   int
+	sysInfoBackoff   time.Duration
+	monitorTLSCA     string
+	monitorTLSCert   string
+	monitorTLSKey    string
+	monitorTLSSecret string
+	insecureMonitor  bool
+	monitorToken     string
+	monitorTokenSec  string
+	monitorCompress  bool
+	monitorPort      int
+	monitorImage     string
+	monitorImageTag  string
+	benchImage       string
+	benchImageTag    string
+	logLevel         string
+	logFormat        string
+	logKubeRequests  bool
+	nodeAddrType     string
+	monitorProxy     string
+	nodeIPFamily     string
+	sysInfoBaseline  string
+	sysInfoDrift     string
+	monitorOptional  bool
+	monitorSidecar   bool
+	existingMonitor  bool
+	grpcMaxMsgSize   int
+	dialTimeout      time.Duration
+	keepaliveTime    time.Duration
+	keepaliveTimeout time.Duration
+	monitorNodeLbls  []string
+	monitorTols      []string
+	imageCheck       string
+	imagePullSecret  string
 )
 
 // var noCleanup bool
@@ -30,30 +70,128 @@ var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "initalize a seasson",
 	Run: func(cmd *cobra.Command, args []string) {
-		sess, err := core.InitSession(sessID, sessDirBase, sessPortForward)
+		if sysInfoDrift != "fail" && sysInfoDrift != "warn" {
+			log.Fatalf("invalid --sysinfo-drift: %s", sysInfoDrift)
+		}
+
+		sess, err := core.InitSession(sessID, sessDirBase, sessPortForward, sessNoMonitor, sessLabelPrefix)
 		if err != nil {
-			log.Fatal(fmt.Sprintf("error initializing session: %w", err))
+			log.Fatal(fmt.Errorf("error initializing session: %w", err))
 		}
 		InitLog(sess)
-		log.Printf("Starting session monitor")
-		err = sess.StartMonitor()
-		if err != nil {
-			log.Fatal(fmt.Errorf("failed to start monitor: %w", err))
+		configureSession(sess)
+		if (len(monitorNodeLbls) > 0 || len(monitorTols) > 0) && sess.UseExistingMonitor() {
+			slog.Warn("shared monitor: ignoring --monitor-node-label and --monitor-node-toleration (set them on monitor deploy)")
+		} else {
+			setMonitorPlacement(sess)
+		}
+		if !sess.MonitorEnabled() {
+			slog.Warn("monitor disabled: no node-level data (sysinfo, perf, network stats) will be collected")
+			if sysInfoBaseline != "" {
+				slog.Warn("monitor disabled: ignoring --sysinfo-baseline")
+			}
+			return
+		}
+		// fail before deploying the monitor
+		if err := sess.CheckMonitorTransport(); err != nil {
+			log.Fatal(err)
+		}
+		if sess.MonitorSidecar() {
+			slog.Warn("monitor runs as a sidecar of the benchmark pods: no node-level data (sysinfo, perf) will be collected")
+			if sysInfoBaseline != "" {
+				slog.Warn("monitor sidecar: ignoring --sysinfo-baseline")
+			}
+			return
+		}
+
+		if sess.UseExistingMonitor() {
+			slog.Info("using the shared monitor")
+			err = sess.WaitMonitor()
+			if err != nil {
+				err = fmt.Errorf("%w (deploy it with monitor deploy)", err)
+			}
+		} else {
+			slog.Info("starting session monitor")
+			err = sess.StartMonitor()
+			if err == nil {
+				err = sess.WaitMonitor()
+			}
+		}
+		if err != nil && monitorOptional {
+			slog.Warn("**** MONITOR UNAVAILABLE: continuing WITHOUT the monitor: no node-level data (sysinfo, perf, network stats) will be collected ****", "error", err)
+			sess.DisableMonitor()
+			if sysInfoBaseline != "" {
+				slog.Warn("monitor disabled: ignoring --sysinfo-baseline")
+			}
+			return
+		} else if err != nil {
+			log.Fatal(fmt.Errorf("failed to start monitor (use --monitor-optional to continue without it): %w", err))
 		}
 
 		err = sess.GetSysInfoNodes()
 		if err != nil {
-			log.Printf("failed to get (some) sysinfo via monitor: %s", err)
+			slog.Warn("failed to get (some) sysinfo via monitor", "error", err)
+		}
+		compareNodeEnvs(sess)
+
+		if sysInfoBaseline != "" {
+			checkSysInfoBaseline(sess)
 		}
 	},
 }
 
+// checkSysInfoBaseline compares the sysinfo of the nodes with the baseline,
+// and fails (or warns, depending on --sysinfo-drift) if they differ
+func checkSysInfoBaseline(sess *core.Session) {
+	diffs, err := sess.CheckSysInfoBaseline(sysInfoBaseline)
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to compare sysinfo with baseline: %w", err))
+	}
+	if len(diffs) == 0 {
+		slog.Info("no sysinfo drift from baseline", "baseline", sysInfoBaseline)
+		return
+	}
+
+	for _, d := range diffs {
+		slog.Warn("sysinfo drift", "node", d.Node, "key", d.Key, "baseline", d.Baseline, "current", d.Current)
+	}
+	if sysInfoDrift == "fail" {
+		log.Fatalf("sysinfo of %d setting(s) differs from baseline %s (see %s/sysinfo-drift.txt)", len(diffs), sysInfoBaseline, sess.Dir())
+	}
+}
+
+// compareNodeEnvs reports the differences of the environments of the nodes
+// (e.g., CPU model, NIC firmware), which explain different results
+func compareNodeEnvs(sess *core.Session) {
+	diffs, err := sess.CompareNodeEnvs()
+	if err != nil {
+		slog.Warn("failed to compare the environments of the nodes", "error", err)
+		return
+	}
+	if len(diffs) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		keys = append(keys, d.Key)
+	}
+	slog.Warn("nodes have different environments", "keys", strings.Join(keys, ","), "file", sess.Dir()+"/node-env.txt")
+}
+
 var doneCmd = &cobra.Command{
 	Use:   "done",
 	Short: "terminate the seasson (kill the monitor)",
 	Run: func(cmd *cobra.Command, args []string) {
 		sess := getSession()
-		log.Printf("Starting session monitor")
+		if !sess.MonitorEnabled() || sess.MonitorSidecar() {
+			return
+		}
+		if sess.UseExistingMonitor() {
+			slog.Info("not stopping the shared monitor (remove it with monitor teardown)")
+			return
+		}
+
+		slog.Info("stopping session monitor")
 		err := sess.StopMonitor()
 		if err != nil {
 			log.Fatal(fmt.Errorf("failed to stop monitor: %w", err))
@@ -65,42 +203,267 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&sessID, "session-id", "s", "", "session id")
 	rootCmd.MarkPersistentFlagRequired("session-id")
 	rootCmd.PersistentFlags().StringVarP(&sessDirBase, "session-base-dir", "d", ".", "base directory to store session data")
-	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "quiet output")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "quiet output (log only to the session log file)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format (text, json)")
+	rootCmd.PersistentFlags().BoolVar(&logKubeRequests, "log-kube-requests", false, "log every API server request of kubectl (verb, resource, response code, latency)")
 	rootCmd.PersistentFlags().BoolVarP(&sessPortForward, "port-forward", "", false, "use port-forward to connect to monitor")
+	rootCmd.PersistentFlags().BoolVarP(&sessNoMonitor, "no-monitor", "", false, "do not deploy the (privileged) monitor daemonset: no node-level data are collected")
+	rootCmd.PersistentFlags().BoolVar(&monitorSidecar, "monitor-sidecar", false, "run the monitor as an unprivileged sidecar of the benchmark pods instead of a daemonset: only pod-scoped data (packet captures, network stats) are collected")
+	rootCmd.PersistentFlags().BoolVar(&existingMonitor, "use-existing-monitor", false, "use the shared monitor daemonset (see monitor deploy) instead of deploying one for the session")
+	rootCmd.PersistentFlags().StringVar(&sessLabelPrefix, "label-prefix", core.DefaultLabelPrefix, "prefix of the label keys used to select kubenetbench resources (<prefix>-sessid, <prefix>-runid)")
+	rootCmd.PersistentFlags().StringVar(&nodeAddrType, "node-address-type", core.DefaultNodeAddressType, "node address type to connect to the monitor without --port-forward (InternalIP, ExternalIP)")
+	rootCmd.PersistentFlags().StringVar(&monitorTLSCA, "monitor-tls-ca", "", "CA certificate (PEM file) of the monitor: connect to the monitor over TLS")
+	rootCmd.PersistentFlags().StringVar(&monitorTLSCert, "monitor-tls-cert", "", "client certificate (PEM file) to authenticate to the monitor (mutual TLS)")
+	rootCmd.PersistentFlags().StringVar(&monitorTLSKey, "monitor-tls-key", "", "client key (PEM file) to authenticate to the monitor (mutual TLS)")
+	rootCmd.PersistentFlags().StringVar(&monitorTLSSecret, "monitor-tls-secret", core.DefaultMonitorTLSSecret, "kubernetes.io/tls secret with the certificate of the monitor (and, for mutual TLS, the ca.crt of the client certificates)")
+	rootCmd.PersistentFlags().BoolVar(&insecureMonitor, "insecure-monitor", false, "allow plaintext connections to the monitor at node (or pod) addresses, i.e., without TLS or --port-forward")
+	rootCmd.PersistentFlags().StringVar(&monitorToken, "monitor-token", "", "bearer token to authenticate to the monitor (default: $"+core.MonitorTokenEnv+")")
+	rootCmd.PersistentFlags().StringVar(&monitorTokenSec, "monitor-token-secret", core.DefaultMonitorTokenSecret, "secret with the token of the monitor (in its token key)")
+	rootCmd.PersistentFlags().IntVar(&monitorPort, "monitor-port", core.DefaultMonitorPort, "port of the monitor, on the nodes (the monitor daemonset uses the host network) or, with --monitor-sidecar, in the benchmark pods")
+	rootCmd.PersistentFlags().StringVar(&monitorImage, "monitor-image", core.DefaultMonitorImage, "image (registry and repository) of the monitor, e.g., a mirror in a private registry")
+	rootCmd.PersistentFlags().StringVar(&monitorImageTag, "monitor-image-tag", "", "tag of the --monitor-image")
+	rootCmd.PersistentFlags().StringVar(&benchImage, "bench-image", core.DefaultBenchImage, "image (registry and repository) of the netperf, http, quic, and ping benchmark pods")
+	rootCmd.PersistentFlags().StringVar(&benchImageTag, "bench-image-tag", "", "tag of the --bench-image")
+	rootCmd.PersistentFlags().StringVar(&monitorProxy, "monitor-proxy", "", "SOCKS5 proxy to connect to the monitor through (socks5://host:port), e.g., a bastion host")
+	rootCmd.PersistentFlags().StringVar(&nodeIPFamily, "node-ip-family", "any", "IP family of the node address to connect to the monitor (ipv4, ipv6, any)")
+	rootCmd.PersistentFlags().StringVar(&imageCheck, "image-check", "syntax", fmt.Sprintf("check of the monitor and benchmark images before creating any resources (%s)", strings.Join(core.ImageCheckModes, ", ")))
+	rootCmd.PersistentFlags().StringVar(&imagePullSecret, "image-pull-secret", "", "[namespace/]name of a kubernetes.io/dockerconfigjson secret with the registry credentials for --image-check registry")
+	rootCmd.PersistentFlags().IntVar(&grpcMaxMsgSize, "grpc-max-msg-size", core.DefaultMaxMsgSize, "maximum size (bytes) of the gRPC messages from the monitor (also configures the monitor when it is deployed)")
+	rootCmd.PersistentFlags().DurationVar(&dialTimeout, "monitor-dial-timeout", core.DefaultMonitorDialTimeout, "timeout to connect to a monitor, so that unresponsive monitors fail fast (0 to connect lazily, without a timeout)")
+	rootCmd.PersistentFlags().DurationVar(&keepaliveTime, "monitor-keepalive", core.DefaultMonitorKeepaliveTime, "interval of the keepalive pings of idle monitor connections, e.g., through port-forwards (0 to disable, min 10s; older monitors require at least 5m)")
+	rootCmd.PersistentFlags().DurationVar(&keepaliveTimeout, "monitor-keepalive-timeout", core.DefaultMonitorKeepaliveTimeout, "time to wait for a keepalive ping acknowledgment before closing a monitor connection")
+	rootCmd.PersistentFlags().IntVarP(&maxConcWrites, "max-concurrent-writes", "", 4, "maximum number of monitor streams written to disk concurrently (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&monitorCompress, "monitor-compression", false, "gzip-compress the monitor streams (sysinfo, collection results), e.g., when they compete with the benchmark traffic (collection archives are already compressed)")
+	rootCmd.PersistentFlags().IntVarP(&sysInfoParallel, "sysinfo-parallelism", "", core.DefaultSysInfoParallelism, "maximum number of nodes whose sysinfo is retrieved concurrently (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&sysInfoRetries, "sysinfo-retries", core.DefaultSysInfoRetries, "number of times retrieving the sysinfo of a node is retried (e.g., while its monitor is starting)")
+	rootCmd.PersistentFlags().DurationVar(&sysInfoBackoff, "sysinfo-backoff", core.DefaultSysInfoBackoff, "delay before the first sysinfo retry of a node, doubled on every retry (up to 30s)")
+
+	initCmd.Flags().StringVar(&sysInfoBaseline, "sysinfo-baseline", "", "compare node sysinfo (kernel, network sysctls, NIC offloads) with a baseline: a session directory, or a node's sysinfo directory")
+	initCmd.Flags().StringVar(&sysInfoDrift, "sysinfo-drift", "fail", "action when sysinfo differs from the baseline (fail, warn)")
+	initCmd.Flags().StringArrayVar(&monitorNodeLbls, "monitor-node-label", nil, "run the monitor only on nodes with the label key=value, e.g., the same as --benchmark-node-label (repeatable)")
+	initCmd.Flags().StringArrayVar(&monitorTols, "monitor-node-toleration", nil, "tolerate only the given node taints in the monitor, instead of all taints: key[=value][:effect], e.g., the same as --benchmark-node-toleration (repeatable)")
+	initCmd.Flags().BoolVar(&monitorOptional, "monitor-optional", false, "if the monitor cannot run (e.g., privileged pods are denied), continue without it instead of failing")
 
 	// session commands
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(doneCmd)
+	rootCmd.AddCommand(summarizeCmd)
+	rootCmd.AddCommand(bundleCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(monitorCmd)
+	rootCmd.AddCommand(observeCmd)
 
 	// benchmark commands
 	rootCmd.AddCommand(pod2podCmd)
 	rootCmd.AddCommand(serviceCmd)
+	rootCmd.AddCommand(netreadyCmd)
+	rootCmd.AddCommand(ingressCmd)
+	rootCmd.AddCommand(selftestCmd)
+	rootCmd.AddCommand(targetCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(orchestrateCmd)
+}
+
+// parseNodeLabels parses key=value node label arguments
+func parseNodeLabels(args []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, arg := range args {
+		k, v, err := core.ParseNodeLabel(arg)
+		if err != nil {
+			return nil, err
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// parseTolerations parses key[=value][:effect] toleration arguments
+func parseTolerations(args []string) ([]core.Toleration, error) {
+	var tolerations []core.Toleration
+	for _, arg := range args {
+		t, err := core.ParseToleration(arg)
+		if err != nil {
+			return nil, err
+		}
+		tolerations = append(tolerations, t)
+	}
+	return tolerations, nil
+}
+
+// setMonitorPlacement sets the nodes of the monitor (see
+// --monitor-node-label and --monitor-node-toleration)
+func setMonitorPlacement(sess *core.Session) {
+	if len(monitorNodeLbls) > 0 {
+		labels, err := parseNodeLabels(monitorNodeLbls)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sess.SetMonitorNodeLabels(labels)
+	}
+	if len(monitorTols) > 0 {
+		tolerations, err := parseTolerations(monitorTols)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sess.SetMonitorTolerations(tolerations)
+	}
 }
 
 // return a session based on the given flags
 func getSession() *core.Session {
-	sess, err := core.NewSession(sessID, sessDirBase, sessPortForward)
+	sess, err := core.NewSession(sessID, sessDirBase, sessPortForward, sessNoMonitor, sessLabelPrefix)
 	if err != nil {
 		log.Fatal(fmt.Errorf("error creating session: %w", err))
 	}
 
 	InitLog(sess)
+	configureSession(sess)
 	return sess
 }
 
+// configureSession applies the (non-persistent) session options of the flags
+func configureSession(sess *core.Session) {
+	sess.SetMaxConcurrentWrites(maxConcWrites)
+	sess.SetSysInfoParallelism(sysInfoParallel)
+	if err := sess.SetSysInfoRetries(sysInfoRetries, sysInfoBackoff); err != nil {
+		log.Fatal(err)
+	}
+	sess.SetStreamCompression(monitorCompress)
+	if rootCmd.PersistentFlags().Changed("monitor-port") {
+		if err := sess.SetMonitorPort(monitorPort); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if rootCmd.PersistentFlags().Changed("monitor-image") || rootCmd.PersistentFlags().Changed("monitor-image-tag") {
+		if err := sess.SetMonitorImage(monitorImage, monitorImageTag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if rootCmd.PersistentFlags().Changed("bench-image") || rootCmd.PersistentFlags().Changed("bench-image-tag") {
+		if err := sess.SetBenchImage(benchImage, benchImageTag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := sess.SetMaxMsgSize(grpcMaxMsgSize); err != nil {
+		log.Fatal(err)
+	}
+	if err := sess.SetMonitorDialTimeout(dialTimeout); err != nil {
+		log.Fatal(err)
+	}
+	if err := sess.SetMonitorKeepalive(keepaliveTime, keepaliveTimeout); err != nil {
+		log.Fatal(err)
+	}
+	if err := sess.SetImageCheck(imageCheck, imagePullSecret); err != nil {
+		log.Fatal(err)
+	}
+
+	families := map[string]int{"any": 0, "ipv4": 4, "ipv6": 6}
+	family, ok := families[nodeIPFamily]
+	if !ok {
+		log.Fatalf("invalid node IP family: %s", nodeIPFamily)
+	}
+	err := sess.SetNodeAddress(nodeAddrType, family)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if monitorProxy != "" {
+		err = sess.SetMonitorProxy(monitorProxy)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if monitorSidecar {
+		sess.SetMonitorSidecar()
+	}
+	if monitorTLSCA != "" {
+		if sess.MonitorSidecar() {
+			log.Fatal("--monitor-tls-ca cannot be used with --monitor-sidecar")
+		}
+		err := sess.SetMonitorTLS(core.MonitorTLS{
+			CA:     monitorTLSCA,
+			Cert:   monitorTLSCert,
+			Key:    monitorTLSKey,
+			Secret: monitorTLSSecret,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if monitorTLSCert != "" || monitorTLSKey != "" {
+		log.Fatal("--monitor-tls-cert and --monitor-tls-key require --monitor-tls-ca")
+	}
+	if insecureMonitor {
+		sess.SetInsecureMonitor()
+	}
+	if monitorToken == "" {
+		monitorToken = os.Getenv(core.MonitorTokenEnv)
+	}
+	if monitorToken != "" {
+		if sess.MonitorSidecar() {
+			log.Fatal("--monitor-token cannot be used with --monitor-sidecar")
+		}
+		if err := sess.SetMonitorToken(monitorToken, monitorTokenSec); err != nil {
+			log.Fatal(err)
+		}
+	} else if rootCmd.PersistentFlags().Changed("monitor-token-secret") {
+		log.Fatalf("--monitor-token-secret requires a token (--monitor-token, or $%s)", core.MonitorTokenEnv)
+	}
+	if existingMonitor {
+		if sess.MonitorSidecar() {
+			log.Fatal("--use-existing-monitor cannot be used with --monitor-sidecar")
+		}
+		sess.SetUseExistingMonitor()
+	}
+
+	// progress is displayed only interactively
+	if !quiet && core.IsTerminal(os.Stderr) {
+		sess.SetProgressOutput(os.Stderr)
+	}
+}
+
 func InitLog(sess *core.Session) {
 	f, err := sess.OpenLog()
 	if err != nil {
-		log.Fatal(fmt.Sprintf("error openning session log file: %w", err))
+		log.Fatal(fmt.Errorf("error openning session log file: %w", err))
+	}
+
+	var w io.Writer = f
+	if !quiet {
+		w = io.MultiWriter(f, infoOutput())
+	}
+
+	logger, err := newLogger(w)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// kubenetbench is the application, so it also sets the global logger
+	// (which the log package uses as well)
+	slog.SetDefault(logger)
+	core.SetLogger(logger)
+	core.LogKubeRequests(logKubeRequests)
+	slog.Info("****** " + strings.Join(os.Args, " "))
+}
+
+// newLogger returns a logger based on the --log-level and --log-format flags
+func newLogger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(logLevel))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", logLevel, err)
 	}
 
-	if quiet {
-		log.SetOutput(f)
-	} else {
-		m := io.MultiWriter(f, os.Stdout)
-		log.SetOutput(m)
+	opts := &slog.HandlerOptions{Level: level}
+	switch logFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", logFormat)
 	}
-	log.Printf("****** %s\n", strings.Join(os.Args, " "))
 }
 
 // Execute runs the main (root) command
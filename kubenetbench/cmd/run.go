@@ -1,7 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -9,37 +16,575 @@ import (
 )
 
 var (
-	benchmark         string
-	runLabel          string
-	benchmarkDuration int
-	cliAffinity       string
-	srvAffinity       string
-	noCleanup         bool
-	collectPerf       bool
-	cliHost           bool
-	srvHost           bool
+	benchmark          string
+	runLabel           string
+	runID              string
+	benchmarkDuration  int
+	trafficDuration    time.Duration
+	measureWindow      string
+	cliAffinity        string
+	zonePlacement      string
+	runtimeClass       string
+	srvAffinity        string
+	noCleanup          bool
+	collectPerf        bool
+	collectionDuration string
+	collectNetStats    bool
+	cliHost            bool
+	srvHost            bool
+	cliHostNetwork     bool
+	srvHostNetwork     bool
+	cliNamespace       string
+	srvNamespace       string
+	restricted         bool
+	runAsUser          int64
+	cliCapAdd          []string
+	podSysctls         []string
+	srvCapAdd          []string
+	repeat             int
+	resume             bool
+	repeatMaxCoV       float64
+	failOnRegression   float64
+	regressionBaseline string
+	junitPath          string
+	dnsPolicy          string
+	dnsNameservers     []string
+	dnsSearches        []string
+	cliVolumes         []string
+	srvVolumes         []string
+	tags               []string
+	configRevision     string
+	configRepo         string
+	pause              bool
+	pauseTimeout       time.Duration
+	perfOutput         string
+	collectPcap        bool
+	pcapIface          string
+	pcapFilter         string
+	pcapSnaplen        int32
+	pcapMaxPackets     int64
+	pcapMaxBytes       int64
+	collectSs          bool
+	verifyPath         bool
+	ssInterval         time.Duration
+	ssFilter           string
+	collectRdma        bool
+	collectHubble      bool
+	collectCPU         bool
+	netemSpec          string
+	netemEndpoint      string
+	netemIface         string
+	pingMode           string
+	pingCount          int
+	printSpec          bool
+	maxCollectionSize  int64
+	collectionRetries  int
+	topologyDot        string
+	keepYaml           string
+	allowZero          bool
+	noWaitServer       bool
+	srvReadyProbe      string
+	benchNodeLabels    []string
+	benchTolerations   []string
+	allowControlPlane  bool
 )
 
-// add common benchmark flags
-func addBenchmarkFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&benchmark, "benchmark", "b", "netperf", "benchmark program to use")
+// add common run flags (labeling, placement, cleanup)
+func addRunFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&runLabel, "run-label", "l", "", "benchmark run label")
-	cmd.Flags().IntVarP(&benchmarkDuration, "duration", "t", 30, "benchmark duration (sec)")
+	cmd.Flags().StringVar(&runID, "run-id", "", "run id, e.g., a CI job id (default: <run label>-<date>; with --repeat, -r<N> is appended)")
 	cmd.Flags().BoolVar(&noCleanup, "no-cleanup", false, "do not perform cleanup (delete created k8s resources, etc.)")
 	cmd.Flags().StringVar(&cliAffinity, "client-affinity", "different", "client affinity (different: different than server, same: same as server, host=XXXX)")
 	cmd.Flags().StringVar(&srvAffinity, "server-affinity", "none", "server affinity (none, host=XXXX)")
-	cmd.Flags().BoolVar(&collectPerf, "collect-perf", false, "collect performance data using perf")
+	cmd.Flags().StringVar(&zonePlacement, "zone-placement", "", "client zone relative to the server, using the topology.kubernetes.io/zone node label (same, cross) (default: any zone)")
+	cmd.Flags().StringArrayVar(&benchNodeLabels, "benchmark-node-label", nil, "run the client and server pods only on nodes with the label key=value, e.g., nodes reserved for benchmarking (repeatable)")
+	cmd.Flags().StringArrayVar(&benchTolerations, "benchmark-node-toleration", nil, "tolerate a node taint in the client and server pods: key[=value][:effect], e.g., dedicated=benchmark:NoSchedule (repeatable)")
+	cmd.Flags().BoolVar(&allowControlPlane, "allow-control-plane", false, "allow the client and server pods on control-plane nodes (excluded by default, unless placed with host=XXXX), e.g., on single-node clusters")
 	cmd.Flags().BoolVar(&cliHost, "cli-on-host", false, "run client on host (enables: HostNetwork, HostIPC, HostPID)")
 	cmd.Flags().BoolVar(&srvHost, "srv-on-host", false, "run server on host (enables: HostNetwork, HostIPC, HostPID)")
+	cmd.Flags().BoolVar(&cliHostNetwork, "client-host-network", false, "run the client in the host network namespace only (hostNetwork), e.g., to isolate the cost of the pod network on the sending side")
+	cmd.Flags().BoolVar(&srvHostNetwork, "server-host-network", false, "run the server in the host network namespace only (hostNetwork): the client targets the node IP")
+	cmd.Flags().StringVar(&runtimeClass, "runtime-class", "", "runtime class (runtimeClassName) of the client and server pods, e.g., gvisor or kata (default: the cluster default)")
+	cmd.Flags().StringVar(&cliNamespace, "client-namespace", "", "namespace for the client pod (default: kubectl's current namespace)")
+	cmd.Flags().StringVar(&srvNamespace, "server-namespace", "", "namespace for the server pods/services (default: kubectl's current namespace)")
+	cmd.Flags().BoolVar(&restricted, "restricted", false, "run pods complying with the restricted Pod Security Standard (non-root, RuntimeDefault seccomp, drop all capabilities)")
+	cmd.Flags().Int64Var(&runAsUser, "run-as-user", core.DefaultRunAsUser, "user id to run pods as (with --restricted)")
+	cmd.Flags().StringArrayVar(&cliCapAdd, "cli-cap-add", []string{}, "capability to add to the client container")
+	cmd.Flags().StringArrayVar(&srvCapAdd, "srv-cap-add", []string{}, "capability to add to the server container")
+	cmd.Flags().StringArrayVar(&podSysctls, "pod-sysctl", []string{}, "namespaced sysctl to set in the client and server pods (securityContext.sysctls), e.g., net.ipv4.tcp_rmem=\"4096 131072 6291456\" (repeatable; unsafe sysctls must be allowed by the kubelet)")
+	cmd.Flags().StringVar(&dnsPolicy, "dns-policy", "", "client pod DNS policy (ClusterFirst, ClusterFirstWithHostNet, Default, None)")
+	cmd.Flags().StringArrayVar(&dnsNameservers, "dns-nameserver", []string{}, "client pod DNS nameserver (dnsConfig)")
+	cmd.Flags().StringArrayVar(&dnsSearches, "dns-search", []string{}, "client pod DNS search domain (dnsConfig)")
+	cmd.Flags().StringArrayVar(&cliVolumes, "client-volume", []string{}, "extra volume for the client pod: type=configmap|secret|emptydir|hostpath,source=NAME|PATH,target=PATH[,readonly]")
+	cmd.Flags().StringArrayVar(&srvVolumes, "server-volume", []string{}, "extra volume for the server pod(s): type=configmap|secret|emptydir|hostpath,source=NAME|PATH,target=PATH[,readonly]")
+	cmd.Flags().StringArrayVar(&tags, "tag", []string{}, "descriptive key=value tag stored with the results (e.g., kernel=5.15)")
+	cmd.Flags().StringVar(&configRevision, "config-revision", "", "git commit of the benchmark configuration, stored with the results")
+	cmd.Flags().StringVar(&configRepo, "config-repo", "", "file or directory in the git repository of the benchmark configuration, to detect --config-revision from")
+	cmd.Flags().BoolVar(&pause, "pause", false, "pause after the measurement (and collection), before cleanup, until enter is pressed")
+	cmd.Flags().DurationVar(&pauseTimeout, "pause-timeout", 30*time.Minute, "maximum duration of --pause (0 for no limit)")
+	cmd.Flags().BoolVar(&noWaitServer, "no-wait-server", false, "create the client without waiting for the server to be ready (listening)")
+	cmd.Flags().StringVar(&srvReadyProbe, "server-ready-probe", "", "readiness probe of the server that the client waits for: tcp://:<port> (connect), or http(s)://:<port>/<path> (GET) (default: connect to the port the server listens on)")
+	cmd.Flags().StringVar(&keepYaml, "keep-yaml", "always", "retain the generated manifests in the run directory: always, on-failure (delete if the run succeeds), never")
+	cmd.Flags().StringVar(&topologyDot, "topology-dot", "", "write the run topology (pods per node, services, monitor pods, traffic) as a Graphviz DOT graph to this file")
+}
+
+// add node data collection flags (perf, packet captures, etc.), which the
+// benchmark commands share with observe. nodes are the nodes that data is
+// collected on, and window the period it covers (in the help messages).
+func addCollectionFlags(cmd *cobra.Command, nodes, window string) {
+	cmd.Flags().BoolVar(&collectPerf, "collect-perf", false, "collect performance data using perf")
+	cmd.Flags().StringVar(&collectionDuration, "collection-duration", "", "duration (seconds) of perf collection: for all nodes (e.g., 10), or per node (e.g., default=10,node-a=60) (default: "+window+")")
+	cmd.Flags().StringVar(&perfOutput, "perf-output", "perfdata", "perf output: perfdata (perf.data and symbols), folded (folded stacks), flamegraph (folded stacks and svg)")
+	cmd.Flags().BoolVar(&collectPcap, "collect-pcap", false, "capture packets (tcpdump) on "+nodes+" for "+window)
+	cmd.Flags().StringVar(&pcapIface, "pcap-iface", "any", "interface to capture packets on")
+	cmd.Flags().StringVar(&pcapFilter, "pcap-filter", "", "tcpdump filter expression (e.g., \"tcp port 8000\")")
+	cmd.Flags().Int32Var(&pcapSnaplen, "pcap-snaplen", 128, "bytes to capture per packet")
+	cmd.Flags().Int64Var(&pcapMaxPackets, "pcap-max-packets", 1000000, "maximum number of packets to capture per node")
+	cmd.Flags().Int64Var(&pcapMaxBytes, "pcap-max-bytes", 100*1024*1024, "maximum size of the capture file per node")
+	cmd.Flags().BoolVar(&collectRdma, "collect-rdma", false, "collect the RDMA device counters (/sys/class/infiniband, ibstat) of "+nodes+" at the start and the end of "+window)
+	cmd.Flags().BoolVar(&collectNetStats, "collect-netstats", true, "collect network stats (retransmits, conntrack, TIME_WAIT) via the monitor")
+	cmd.Flags().Int64Var(&maxCollectionSize, "max-collection-size", 0, "maximum size of the collection archive (perf, pcap) per node: larger archives are discarded (0 for no limit)")
+	cmd.Flags().IntVar(&collectionRetries, "collection-retries", core.DefaultCollectionRetries, "number of times retrieving the collection archive of a node is retried (from the start, over a new connection or port-forward) when the stream is reset")
+}
+
+// add common benchmark flags
+func addBenchmarkFlags(cmd *cobra.Command) {
+	addRunFlags(cmd)
+	cmd.Flags().StringVarP(&benchmark, "benchmark", "b", "netperf", "benchmark program to use (netperf, custom, http, quic)")
+	cmd.Flags().IntVarP(&benchmarkDuration, "duration", "t", 30, "benchmark duration (sec)")
+	cmd.Flags().DurationVar(&trafficDuration, "traffic-duration", 0, "duration of the benchmark traffic (e.g., 120s), as an alternative to --duration")
+	cmd.Flags().StringVar(&measureWindow, "measure-window", "", "report the results of a slice of the traffic only, and collect node data during it: <length>@<start> (e.g., 30s@45s), requires per-interval stats (enabled for netperf stream benchmarks)")
+	addCollectionFlags(cmd, "the run nodes", "the benchmark duration, or the measurement window")
+	cmd.Flags().BoolVar(&collectSs, "collect-ss", false, "sample the TCP state (cwnd, rtt, retransmits) of the benchmark connections (ss -tin) on the run nodes for the benchmark duration")
+	cmd.Flags().DurationVar(&ssInterval, "ss-interval", core.DefaultSsInterval, "interval for sampling the benchmark connections")
+	cmd.Flags().BoolVar(&verifyPath, "verify-path", false, "verify, from socket samples of the benchmark connections (enables --collect-ss), that the traffic took the path of the placement (e.g., crossed nodes), and flag runs where it did not (PATH_MISMATCH)")
+	cmd.Flags().StringVar(&ssFilter, "ss-filter", "", "ss filter expression (default: the benchmark data port, e.g., \"( sport = :8000 or dport = :8000 )\")")
+	cmd.Flags().BoolVar(&collectHubble, "collect-hubble", false, "record the hubble flows of the benchmark pods on the run nodes (Cilium clusters with hubble enabled; skipped otherwise)")
+	cmd.Flags().BoolVar(&collectCPU, "collect-cpu", false, "collect the CPU usage of the run nodes and of the benchmark pods, and compute the CPU usage per Gbit/s of throughput")
+	cmd.Flags().StringVar(&netemSpec, "netem", "", "netem options to apply on the egress interface of the --netem-endpoint node for the run (e.g., \"delay 20ms 5ms loss 0.1%\")")
+	cmd.Flags().StringVar(&netemEndpoint, "netem-endpoint", "srv", "endpoint whose node netem is applied on (srv, cli)")
+	cmd.Flags().StringVar(&netemIface, "netem-iface", "", "node interface to apply netem on (default: the interface of the default route)")
+	cmd.Flags().StringVar(&pingMode, "ping", "", "before the benchmark, measure the base RTT (and check reachability) from the client placement to the server: tcp (connect to the server port), icmp")
+	cmd.Flags().IntVar(&pingCount, "ping-count", 10, "number of --ping probes")
+	cmd.Flags().BoolVar(&printSpec, "print-spec", false, "print the effective configuration of the run (flags and defaults, e.g., images and label keys) as JSON, without running it")
+	cmd.Flags().BoolVar(&allowZero, "allow-zero", false, "accept runs that transfer no data (e.g., when testing a deny policy)")
+	cmd.Flags().IntVar(&repeat, "repeat", 1, "number of times to repeat the benchmark (results are aggregated)")
+	cmd.Flags().BoolVar(&resume, "resume", false, "resume a sweep (--repeat) with the same arguments that failed, skipping its completed runs")
+	cmd.Flags().Float64Var(&repeatMaxCoV, "repeat-max-cov", 0.05, "coefficient of variation across repeats above which the measurement is considered unstable")
+	cmd.Flags().Float64Var(&failOnRegression, "fail-on-regression", 0, "fail if throughput (or transaction rate) regresses by more than this percentage compared to the baseline (0 to disable)")
+	cmd.Flags().StringVar(&reproducerPath, "emit-reproducer", "", "write a shell script that reruns the benchmark with the effective value of every flag (also stored as reproduce.sh in the run directories)")
+	cmd.Flags().StringVar(&junitPath, "junit", "", "write a JUnit XML report of the runs to this file, e.g., for CI test dashboards (failed runs are errors, regressions failures)")
+	cmd.Flags().StringVar(&regressionBaseline, "regression-baseline", "", "run id of the baseline for --fail-on-regression (default: the latest earlier run of the session with the same parameters)")
 	addNetperfFlags(cmd)
+	addCustomFlags(cmd)
+	addHTTPFlags(cmd)
+	addQUICFlags(cmd)
+	addInfluxFlags(cmd)
+	addOutputFlags(cmd)
+}
+
+// runBenchmark executes a benchmark (of command cmd), repeating it as
+// specified by --repeat, or, under the watch command, on an interval (see
+// watchBenchmark). execFn executes a single run of the benchmark.
+func runBenchmark(cmd *cobra.Command, defaultRunLabel string, execFn func(*core.RunBenchCtx) error) error {
+	runTopology = cmd.Name()
+	if repeat < 1 {
+		return fmt.Errorf("invalid repeat count: %d", repeat)
+	}
+	if runID != "" && watching {
+		return fmt.Errorf("--run-id cannot be used with watch: every run needs its own id")
+	}
+	if junitPath != "" && watching {
+		return fmt.Errorf("--junit cannot be used with watch")
+	}
+	if resume && (watching || repeat == 1) {
+		return fmt.Errorf("--resume requires a sweep (--repeat), and cannot be used with watch")
+	}
+	if cmd.Flags().Changed("traffic-duration") {
+		if cmd.Flags().Changed("duration") {
+			return fmt.Errorf("--traffic-duration and --duration cannot be used together")
+		}
+		if trafficDuration < time.Second || trafficDuration%time.Second != 0 {
+			return fmt.Errorf("invalid traffic duration %s: it must be a whole number of seconds", trafficDuration)
+		}
+		benchmarkDuration = int(trafficDuration / time.Second)
+	}
+
+	if pause && resultsToStdout() {
+		return fmt.Errorf("--pause cannot be used with results on the standard output (--output-file -)")
+	}
+	if err := openResultOutput(); err != nil {
+		return err
+	}
+	sess := getSession()
+	exporter, err := getInfluxExporter()
+	if err != nil {
+		return err
+	}
+
+	// check the images once, before any resources are created
+	runctx, err := getRunBenchCtx(sess, defaultRunLabel, "", false)
+	if err != nil {
+		return fmt.Errorf("initializing run context failed: %w", err)
+	}
+	if printSpec {
+		return runctx.WriteSpec(os.Stdout)
+	}
+	if err := runctx.CheckImages(context.Background()); err != nil {
+		return err
+	}
+	if runtimeClass != "" {
+		runtimeHandler, err = core.KubeGetRuntimeClassHandler(context.Background(), runtimeClass)
+		if err != nil {
+			return err
+		}
+	}
+	if reproducerPath != "" {
+		// also stored in the directory of every run (see getRunBenchCtx)
+		reproducerScript, err = emitReproducer(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to write reproducer: %w", err)
+		}
+		slog.Info("wrote reproducer", "file", reproducerPath)
+	}
+	if repeat > 1 && !watching {
+		// the sweep is identified by its arguments (see SweepProgress)
+		sweepArgs = reproducerArgs(cmd)
+	}
+
+	if watching {
+		return watchBenchmark(sess, exporter, defaultRunLabel, execFn)
+	}
+	if junitPath != "" {
+		label := runLabel
+		if label == "" {
+			label = defaultRunLabel
+		}
+		junitReport = core.NewJUnitReport(sessID, label)
+	}
+	_, err = executeBenchmark(sess, exporter, defaultRunLabel, execFn)
+	if junitReport != nil {
+		// written even if the benchmark failed, so that CI reports the failure
+		if errJunit := junitReport.WriteFile(junitPath); errJunit != nil {
+			slog.Warn("failed to write JUnit report", "file", junitPath, "error", errJunit)
+		} else {
+			slog.Info("wrote JUnit report", "file", junitPath)
+		}
+	}
+	return err
+}
+
+// runTopology is the topology of the runs: the run command (e.g., pod2pod)
+var runTopology string
+
+// runtimeHandler is the handler of --runtime-class (e.g., runsc), recorded
+// with the runs
+var runtimeHandler string
+
+// sweepArgs are the arguments that identify the sweep of the runs (nil for
+// runs that are not a resumable sweep)
+var sweepArgs []string
+
+// reproducerScript is the reproducer of the runs (empty without
+// --emit-reproducer)
+var reproducerScript string
+
+// junitReport is the JUnit report of the runs (nil without --junit)
+var junitReport *core.JUnitReport
+
+// junitRun records a run in the JUnit report (if any)
+func junitRun(runctx *core.RunBenchCtx, res *core.BenchResult, err error, start time.Time) {
+	if junitReport != nil {
+		junitReport.AddRun(runctx.RunID(), res, err, time.Since(start))
+	}
+}
+
+// executeBenchmark executes a benchmark (repeating it as specified by
+// --repeat), and returns the results of its runs
+func executeBenchmark(
+	sess *core.Session,
+	exporter *core.InfluxExporter,
+	defaultRunLabel string,
+	execFn func(*core.RunBenchCtx) error,
+) ([]*core.BenchResult, error) {
+	if repeat == 1 {
+		runctx, err := getRunBenchCtx(sess, defaultRunLabel, "", true)
+		if err != nil {
+			return nil, fmt.Errorf("initializing run context failed: %w", err)
+		}
+		addRunParams(runctx, 1)
+
+		start := time.Now()
+		err = execFn(runctx)
+		if err != nil {
+			runctx.RemoveYaml(false)
+			junitRun(runctx, nil, err, start)
+			return nil, err
+		}
+
+		res, err := runctx.SaveResult()
+		failed := errors.Is(err, core.ErrNoTransfer) || errors.Is(err, core.ErrInvalidResult)
+		runctx.RemoveYaml(!failed)
+		if failed {
+			junitRun(runctx, nil, err, start)
+			return nil, err
+		} else if err != nil {
+			// returned (rather than only logged), so that watch records the
+			// run as failed
+			junitRun(runctx, nil, err, start)
+			return nil, fmt.Errorf("failed to save run results: %w", err)
+		}
+		junitRun(runctx, res, nil, start)
+		if err := outputResult(sess, res); err != nil {
+			return nil, err
+		}
+
+		if exporter != nil {
+			err = exporter.Export(res)
+			if err != nil {
+				return nil, err
+			}
+		}
+		results := []*core.BenchResult{res}
+		return results, checkRegression(sess, results)
+	}
+
+	var progress *core.SweepProgress
+	if sweepArgs != nil {
+		var err error
+		progress, err = sess.SweepProgress(sweepArgs, resume)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sweep progress: %w", err)
+		}
+	}
+
+	results := make([]*core.BenchResult, 0, repeat)
+	for i := 1; i <= repeat; i++ {
+		iter := fmt.Sprintf("r%d", i)
+		if progress != nil {
+			if res, ok := progress.Completed(iter); ok {
+				slog.Info("repeat already completed, skipping", "repeat", i, "total", repeat, "run", res.RunID)
+				results = append(results, res)
+				if err := outputResult(sess, res); err != nil {
+					return results, err
+				}
+				continue
+			}
+		}
+		if progress != nil && runID != "" {
+			// the failed run of the iteration has the same run id
+			if err := progress.DiscardIncomplete(iter, fixedRunID(iter)); err != nil {
+				return results, fmt.Errorf("failed to remove the incomplete run of repeat %d/%d: %w", i, repeat, err)
+			}
+		}
+		slog.Info("repeat", "repeat", i, "total", repeat)
+		runctx, err := getRunBenchCtx(sess, defaultRunLabel, iter, true)
+		if err != nil {
+			return results, fmt.Errorf("initializing run context failed: %w", err)
+		}
+		addRunParams(runctx, i)
+
+		start := time.Now()
+		err = execFn(runctx)
+		if err != nil {
+			runctx.RemoveYaml(false)
+			junitRun(runctx, nil, err, start)
+			return results, fmt.Errorf("repeat %d/%d failed: %w", i, repeat, err)
+		}
+
+		res, err := runctx.SaveResult()
+		failed := errors.Is(err, core.ErrNoTransfer) || errors.Is(err, core.ErrInvalidResult)
+		runctx.RemoveYaml(!failed)
+		if err != nil {
+			junitRun(runctx, nil, err, start)
+			return results, fmt.Errorf("failed to get results of repeat %d/%d: %w", i, repeat, err)
+		}
+		junitRun(runctx, res, nil, start)
+		results = append(results, res)
+		if err := outputResult(sess, res); err != nil {
+			return results, err
+		}
+
+		if exporter != nil {
+			err = exporter.Export(res)
+			if err != nil {
+				return results, fmt.Errorf("failed to export results of repeat %d/%d: %w", i, repeat, err)
+			}
+		}
+		if progress != nil {
+			if err := progress.MarkDone(iter, res.RunID); err != nil {
+				slog.Warn("failed to record sweep progress", "error", err)
+			}
+		}
+	}
+
+	agg := core.AggregateResults(results)
+	datestr := time.Now().Format("20060102150405")
+	fname := fmt.Sprintf("%s/%s-aggregate-%s.txt", sess.Dir(), runLabel, datestr)
+	err := agg.WriteFile(fname)
+	if err != nil {
+		return results, fmt.Errorf("failed to write aggregate results: %w", err)
+	}
+	slog.Info("aggregate results", "repeats", repeat, "file", fname)
+
+	unstable := agg.Unstable(repeatMaxCoV)
+	if len(unstable) > 0 {
+		slog.Warn("unstable measurement: consider increasing --repeat",
+			"max_cov", repeatMaxCoV, "metrics", strings.Join(unstable, ","))
+	}
+
+	return results, checkRegression(sess, results)
+}
+
+// checkRegression compares the results of the runs with a baseline (see
+// --fail-on-regression), and returns an error if they regressed
+func checkRegression(sess *core.Session, results []*core.BenchResult) error {
+	if failOnRegression <= 0 {
+		return nil
+	}
+
+	baseline, err := core.FindBaseline(sess.Dir(), results, regressionBaseline)
+	if err != nil {
+		return fmt.Errorf("regression check failed: %w", err)
+	}
+	if baseline == nil {
+		slog.Warn("regression check: no earlier run with the same parameters in the session, skipping")
+		return nil
+	}
+
+	check, err := core.CheckRegression(baseline, results, failOnRegression)
+	if err != nil {
+		return fmt.Errorf("regression check failed: %w", err)
+	}
+	// printed, so that it is visible in CI logs even with --quiet
+	fmt.Fprintln(infoOutput(), "regression check:", check)
+	if junitReport != nil {
+		junitReport.AddRegression(check)
+	}
+	if check.Regressed() {
+		return fmt.Errorf("%s regressed by %.2f%% (more than %.2f%%) compared to %s",
+			check.Metric, -check.Delta, failOnRegression, check.Baseline)
+	}
+	return nil
+}
+
+// addRunParams records the parameters of a run (see core.Summarize)
+func addRunParams(runctx *core.RunBenchCtx, repeatIdx int) {
+	runctx.AddParam("RUN_LABEL", runLabel)
+	runctx.AddParam("BENCHMARK", benchmark)
+	if benchmark == "netperf" {
+		runctx.AddParam("NETPERF_TYPE", netperfType())
+		runctx.AddParam("NETPERF_NSTREAMS", fmt.Sprintf("%d", netperfNStreams))
+		if netperfDirection != "" {
+			runctx.AddParam("DIRECTION", netperfDirection)
+		}
+		if socketBuf != "" || socketSendBuf != "" || socketRecvBuf != "" {
+			// the effective sizes are in the results (LSS_SIZE_END, etc.)
+			conf := core.NetperfConf{}
+			handle_sockbuf(&conf)
+			runctx.AddParam("SOCKET_SEND_BUFFER", conf.SendBuf)
+			runctx.AddParam("SOCKET_RECV_BUFFER", conf.RecvBuf)
+		}
+		if congControl != "" {
+			// the effective algorithm is in the results (LOCAL_CONG_CONTROL, etc.)
+			runctx.AddParam("CONGESTION_CONTROL", congControl)
+		}
+	}
+	if benchmark == "http" {
+		tls := httpTLS
+		if tls == "" {
+			tls = "none"
+		}
+		runctx.AddParam("HTTP_TLS", tls)
+		if proxyProtocol != "" {
+			runctx.AddParam("PROXY_PROTOCOL", proxyProtocol)
+		}
+	}
+	if benchmark == "quic" {
+		// the negotiated QUIC version is in the results (QUIC_VERSION)
+		runctx.AddParam("QUIC_GSO", fmt.Sprintf("%t", quicGSO))
+		runctx.AddParam("QUIC_RESPONSE_SIZE", fmt.Sprintf("%d", quicResponseSize))
+	}
+	// runs with different runtimes (e.g., gVisor and runc) are not comparable
+	if runtimeClass != "" {
+		runctx.AddParam("RUNTIME_CLASS", runtimeClass)
+		if runtimeHandler != "" {
+			runctx.AddParam("RUNTIME_HANDLER", runtimeHandler)
+		}
+	}
+	// the pod network is not measured on the host network side(s)
+	switch cliNet, srvNet := cliHost || cliHostNetwork, srvHost || srvHostNetwork; {
+	case cliNet && srvNet:
+		runctx.AddParam("HOST_NETWORK", "both")
+	case cliNet:
+		runctx.AddParam("HOST_NETWORK", "cli")
+	case srvNet:
+		runctx.AddParam("HOST_NETWORK", "srv")
+	}
+	if len(podSysctls) > 0 {
+		sysctls := make([]string, 0, len(podSysctls))
+		for _, arg := range podSysctls {
+			sc, _ := core.ParseSysctl(arg)
+			sysctls = append(sysctls, sc.String())
+		}
+		runctx.AddParam("POD_SYSCTLS", strings.Join(sysctls, ","))
+	}
+	if zonePlacement != "" {
+		// the effective zones are in the metadata (CLI_ZONE, SRV_ZONE)
+		runctx.AddParam("ZONE_PLACEMENT", zonePlacement)
+	}
+	runctx.AddParam("DURATION", fmt.Sprintf("%d", benchmarkDuration))
+	if measureWindow != "" {
+		runctx.AddParam("MEASURE_WINDOW", measureWindow)
+	}
+	runctx.AddParam("REPEAT", fmt.Sprintf("%d", repeatIdx))
+}
+
+// fixedRunID returns the run id given by --run-id, with the run suffix (if
+// not empty) appended
+func fixedRunID(runSuffix string) string {
+	if runSuffix == "" {
+		return runID
+	}
+	return fmt.Sprintf("%s-%s", runID, runSuffix)
 }
 
-func getRunBenchCtx(defaultRunLabel string, mkdir bool) (*core.RunBenchCtx, error) {
+// getRunBenchCtx returns a run context. If runSuffix is not empty, it is
+// appended to the run label.
+func getRunBenchCtx(sess *core.Session, defaultRunLabel string, runSuffix string, mkdir bool) (*core.RunBenchCtx, error) {
 	var bench core.Benchmark
 
+	if netperfDirection != "" && benchmark != "netperf" {
+		return nil, fmt.Errorf("--direction is only supported by the netperf benchmark")
+	}
+	if (socketBuf != "" || socketSendBuf != "" || socketRecvBuf != "") && benchmark != "netperf" {
+		return nil, fmt.Errorf("--socket-buffer options are only supported by the netperf benchmark")
+	}
+	if congControl != "" && benchmark != "netperf" {
+		return nil, fmt.Errorf("--congestion-control is only supported by the netperf benchmark")
+	}
+
 	switch benchmark {
 	case "netperf":
 		bench = getNetperfBench()
+	case "custom":
+		var err error
+		bench, err = getCustomBench()
+		if err != nil {
+			return nil, err
+		}
+	case "http":
+		var err error
+		bench, err = getHTTPBench()
+		if err != nil {
+			return nil, err
+		}
+	case "quic":
+		var err error
+		bench, err = getQUICBench()
+		if err != nil {
+			return nil, err
+		}
 	case "ipperf":
 		return nil, fmt.Errorf("benchmark NYI: %s", benchmark)
 	default:
@@ -53,29 +598,314 @@ func getRunBenchCtx(defaultRunLabel string, mkdir bool) (*core.RunBenchCtx, erro
 	var cliSpec, srvSpec core.ContainerSpec
 
 	cliSpec.Affinity = cliAffinity
+	cliSpec.ZonePlacement = zonePlacement
+	if err := cliSpec.ValidateZonePlacement(); err != nil {
+		return nil, err
+	}
+	cliSpec.Namespace = cliNamespace
 	if cliHost {
 		cliSpec.SetHostAll()
 	}
+	cliSpec.HostNetwork = cliSpec.HostNetwork || cliHostNetwork
 	srvSpec.Affinity = srvAffinity
+	srvSpec.Namespace = srvNamespace
 	if srvHost {
 		srvSpec.SetHostAll()
 	}
+	srvSpec.HostNetwork = srvSpec.HostNetwork || srvHostNetwork
+	if runtimeClass != "" {
+		if err := core.ValidateRuntimeClass(runtimeClass); err != nil {
+			return nil, err
+		}
+		cliSpec.RuntimeClass = runtimeClass
+		srvSpec.RuntimeClass = runtimeClass
+	}
+
+	if len(benchNodeLabels) > 0 {
+		labels, err := parseNodeLabels(benchNodeLabels)
+		if err != nil {
+			return nil, err
+		}
+		cliSpec.NodeLabels = labels
+		srvSpec.NodeLabels = labels
+	}
+	if len(benchTolerations) > 0 {
+		tolerations, err := parseTolerations(benchTolerations)
+		if err != nil {
+			return nil, err
+		}
+		cliSpec.Tolerations = tolerations
+		srvSpec.Tolerations = tolerations
+	}
+	cliSpec.AllowControlPlane = allowControlPlane
+	srvSpec.AllowControlPlane = allowControlPlane
+
+	cliSpec.DNSPolicy = dnsPolicy
+	cliSpec.DNSNameservers = dnsNameservers
+	cliSpec.DNSSearches = dnsSearches
+	if err := cliSpec.ValidateDNS(); err != nil {
+		return nil, err
+	}
+
+	for _, vol := range []struct {
+		spec *core.ContainerSpec
+		args []string
+	}{{&cliSpec, cliVolumes}, {&srvSpec, srvVolumes}} {
+		for _, arg := range vol.args {
+			v, err := core.ParseVolume(arg)
+			if err != nil {
+				return nil, err
+			}
+			vol.spec.Volumes = append(vol.spec.Volumes, v)
+		}
+	}
+
+	for _, arg := range podSysctls {
+		sc, err := core.ParseSysctl(arg)
+		if err != nil {
+			return nil, err
+		}
+		cliSpec.Sysctls = append(cliSpec.Sysctls, sc)
+		srvSpec.Sysctls = append(srvSpec.Sysctls, sc)
+	}
+	for _, spec := range []*core.ContainerSpec{&cliSpec, &srvSpec} {
+		if err := spec.ValidateSysctls(); err != nil {
+			return nil, err
+		}
+	}
+	if unsafe := cliSpec.UnsafeSysctls(); len(unsafe) > 0 {
+		slog.Info("unsafe sysctls: the kubelet of the nodes must allow them (--allowed-unsafe-sysctls), or the pods are rejected", "sysctls", strings.Join(unsafe, ","))
+	}
+
+	cliSpec.CapAdd = cliCapAdd
+	srvSpec.CapAdd = srvCapAdd
+	if restricted {
+		if cliSpec.HostNetwork || srvSpec.HostNetwork {
+			slog.Warn("host namespaces (--cli-on-host/--srv-on-host, --client-host-network/--server-host-network) are not allowed by the restricted Pod Security Standard")
+		}
+		if unsafe := cliSpec.UnsafeSysctls(); len(unsafe) > 0 {
+			slog.Warn("unsafe sysctls are not allowed by the restricted Pod Security Standard", "sysctls", strings.Join(unsafe, ","))
+		}
+		for _, spec := range []*core.ContainerSpec{&cliSpec, &srvSpec} {
+			for _, v := range spec.Volumes {
+				if v.Type == "hostpath" {
+					slog.Warn("hostpath volumes are not allowed by the restricted Pod Security Standard", "target", v.Target)
+				}
+			}
+		}
+		for _, spec := range []*core.ContainerSpec{&cliSpec, &srvSpec} {
+			spec.Restricted = true
+			spec.RunAsUser = runAsUser
+		}
+	}
+
+	// per-endpoint network attachments override --network-attachment, e.g.,
+	// to benchmark between pods on different CNIs
+	for _, ep := range []struct {
+		spec              *core.ContainerSpec
+		attachment, iface string
+	}{
+		{&cliSpec, cliNetworkAttachment, cliNetworkIface},
+		{&srvSpec, srvNetworkAttachment, srvNetworkIface},
+	} {
+		if ep.attachment == "" {
+			ep.attachment = networkAttachment
+		}
+		if ep.iface == "" {
+			ep.iface = networkIface
+		}
+		if ep.attachment != "" {
+			ep.spec.NetworkAttachment = ep.attachment
+			ep.spec.NetworkIface = ep.iface
+		}
+	}
+
+	label := runLabel
+	if runSuffix != "" {
+		label = fmt.Sprintf("%s-%s", runLabel, runSuffix)
+	}
 
-	sess := getSession()
 	ctx := core.NewRunBenchCtx(
 		sess,
-		runLabel,
+		label,
 		&cliSpec,
 		&srvSpec,
 		!noCleanup,
 		bench,
-		collectPerf)
+		collectPerf,
+		collectNetStats)
+
+	if runID != "" {
+		if err := ctx.SetRunID(fixedRunID(runSuffix)); err != nil {
+			return nil, err
+		}
+	}
+
+	if pause {
+		ctx.SetPause(pauseTimeout)
+	}
+
+	ctx.SetMaxCollectionSize(maxCollectionSize)
+	if err := ctx.SetCollectionRetries(collectionRetries); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.SetKeepYaml(keepYaml); err != nil {
+		return nil, err
+	}
+
+	if allowZero {
+		ctx.SetAllowZero()
+	}
+
+	if noWaitServer {
+		ctx.SetNoWaitServer()
+	}
+
+	if srvReadyProbe != "" {
+		p, err := core.ParseReadyProbe(srvReadyProbe)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.SetSrvReadyProbe(p); err != nil {
+			return nil, fmt.Errorf("--server-ready-probe cannot be used with --no-wait-server")
+		}
+	}
+
+	if topologyDot != "" {
+		// with --repeat, every run gets its own file (e.g., topo-r1.dot)
+		fname := topologyDot
+		if runSuffix != "" {
+			ext := filepath.Ext(fname)
+			fname = fmt.Sprintf("%s-%s%s", strings.TrimSuffix(fname, ext), runSuffix, ext)
+		}
+		ctx.SetTopologyDot(fname)
+	}
+
+	if measureWindow != "" {
+		w, err := core.ParseMeasureWindow(measureWindow)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.SetMeasureWindow(w); err != nil {
+			return nil, err
+		}
+	}
+
+	if collectionDuration != "" {
+		err := ctx.SetCollectionDuration(collectionDuration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// NB: perfOutput is empty for commands without benchmark flags
+	if perfOutput != "" {
+		err := ctx.SetPerfOutput(perfOutput)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if collectPcap {
+		err := ctx.SetPcap(core.PcapConf{
+			Iface:      pcapIface,
+			Filter:     pcapFilter,
+			Snaplen:    pcapSnaplen,
+			MaxPackets: pcapMaxPackets,
+			MaxBytes:   pcapMaxBytes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if collectSs {
+		err := ctx.SetSsSampling(core.SsConf{
+			Interval: ssInterval,
+			Filter:   ssFilter,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if verifyPath {
+		ctx.SetVerifyPath()
+	}
+
+	if collectRdma {
+		ctx.SetRdmaCounters()
+	}
+
+	if collectHubble {
+		ctx.SetHubble()
+	}
+
+	if collectCPU {
+		ctx.SetCPUUsage()
+	}
+
+	if pingMode != "" {
+		err := ctx.SetPing(core.PingConf{Mode: pingMode, Count: pingCount})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if netemSpec != "" {
+		err := ctx.SetNetem(core.NetemConf{
+			Spec:     netemSpec,
+			Endpoint: netemEndpoint,
+			Iface:    netemIface,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	type tag struct{ key, value string }
+	runTags := make([]tag, 0, len(tags))
+	for _, t := range tags {
+		key, value, err := core.ParseTag(t)
+		if err != nil {
+			return nil, err
+		}
+		runTags = append(runTags, tag{key, value})
+	}
+
+	if configRepo != "" && configRevision == "" {
+		// detected once, and used for all repeats
+		rev, err := core.GitRevision(configRepo)
+		if err != nil {
+			return nil, err
+		}
+		configRevision = rev
+	}
 
 	var err error = nil
 	if mkdir {
 		err = ctx.MakeDir()
 		if err != nil {
-			ctx = nil
+			return nil, err
+		}
+		// printed, so that it is visible in CI logs even with --quiet
+		fmt.Fprintln(infoOutput(), "run id:", ctx.RunID())
+		ctx.SetTopology(runTopology)
+		for _, t := range runTags {
+			if err := ctx.AddTag(t.key, t.value); err != nil {
+				return nil, fmt.Errorf("failed to record tag %s: %w", t.key, err)
+			}
+		}
+		if configRevision != "" {
+			if err := ctx.SetConfigRevision(configRevision); err != nil {
+				return nil, err
+			}
+		}
+		if reproducerScript != "" {
+			if err := ctx.SaveReproducer(reproducerScript); err != nil {
+				slog.Warn("failed to save reproducer", "error", err)
+			}
 		}
 	}
 
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var selftestCmd = newSelftestCmd()
+
+// newSelftestCmd returns the selftest command (it is added to both the root and
+// the watch commands)
+func newSelftestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "loopback benchmark run (client and server in the same pod), as a baseline for the network runs",
+		Run: func(cmd *cobra.Command, args []string) {
+			if netemSpec != "" {
+				log.Fatal("--netem is not supported by selftest: its traffic does not leave the pod")
+			}
+			if pingMode != "" {
+				log.Fatal("--ping is not supported by selftest: its client and server are in the same pod")
+			}
+
+			err := runBenchmark(cmd, "selftest", func(runctx *core.RunBenchCtx) error {
+				st := core.SelfTestSt{
+					RunBenchCtx: runctx,
+				}
+				return st.Execute()
+			})
+			if err != nil {
+				log.Fatal("selftest execution failed:", err)
+			}
+		},
+	}
+
+	addBenchmarkFlags(cmd)
+	return cmd
+}
@@ -9,32 +9,70 @@ import (
 )
 
 var serviceTypeArg string
+var serviceColocate bool
+var serviceReplicas int
+var serviceSessionAffinity string
+var serviceSessionAffinityTimeout int
 
-var serviceCmd = &cobra.Command{
-	Use:   "service",
-	Short: "service network benchmark run",
-	Run: func(cmd *cobra.Command, args []string) {
-
-		if serviceTypeArg != "ClusterIP" {
-			log.Fatal("invalid policy: ", serviceTypeArg)
-		}
-
-		runctx, err := getRunBenchCtx(serviceTypeArg, true)
-		if err != nil {
-			log.Fatal("initializing run context failed:", err)
-		}
-		st := core.ServiceSt{
-			RunBenchCtx: runctx,
-			ServiceType: serviceTypeArg,
-		}
-		err = st.Execute()
-		if err != nil {
-			log.Fatal("service execution failed:", err)
-		}
-	},
-}
+var serviceCmd = newServiceCmd()
+
+// newServiceCmd returns the service command (it is added to both the root and
+// the watch commands)
+func newServiceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "service network benchmark run",
+		Run: func(cmd *cobra.Command, args []string) {
+
+			valid := false
+			for _, t := range core.ServiceTypes {
+				valid = valid || t == serviceTypeArg
+			}
+			if !valid {
+				log.Fatal("invalid service type: ", serviceTypeArg)
+			}
+			if serviceSessionAffinity != "" {
+				valid = false
+				for _, a := range core.ServiceSessionAffinities {
+					valid = valid || a == serviceSessionAffinity
+				}
+				if !valid {
+					log.Fatal("invalid service session affinity: ", serviceSessionAffinity)
+				}
+			}
+			if serviceSessionAffinityTimeout != 0 && serviceSessionAffinity != "ClientIP" {
+				log.Fatal("--service-session-affinity-timeout requires --service-session-affinity ClientIP")
+			}
+			if serviceReplicas < 1 {
+				log.Fatal("invalid number of replicas: ", serviceReplicas)
+			}
+			if serviceColocate && cmd.Flags().Changed("client-affinity") && cliAffinity != "same" {
+				log.Fatal("--colocate places the client on the node of the backend: it cannot be used with --client-affinity ", cliAffinity)
+			}
+
+			err := runBenchmark(cmd, serviceTypeArg, func(runctx *core.RunBenchCtx) error {
+				st := core.ServiceSt{
+					RunBenchCtx: runctx,
+					ServiceType: serviceTypeArg,
+					Colocate:    serviceColocate,
+					Replicas:    serviceReplicas,
+
+					SessionAffinity:        serviceSessionAffinity,
+					SessionAffinityTimeout: serviceSessionAffinityTimeout,
+				}
+				return st.Execute()
+			})
+			if err != nil {
+				log.Fatal("service execution failed:", err)
+			}
+		},
+	}
 
-func init() {
-	addBenchmarkFlags(serviceCmd)
-	serviceCmd.Flags().StringVar(&serviceTypeArg, "type", "ClusterIP", "service type (ClusterIP)")
+	addBenchmarkFlags(cmd)
+	cmd.Flags().StringVar(&serviceTypeArg, "type", "ClusterIP", "service type (ClusterIP, Headless)")
+	cmd.Flags().BoolVar(&serviceColocate, "colocate", false, "run the client on the node of the (single) backend, to measure the same-node service path")
+	cmd.Flags().IntVar(&serviceReplicas, "replicas", 1, "number of backends (with several, netperf requires ClientIP session affinity, the default)")
+	cmd.Flags().StringVar(&serviceSessionAffinity, "service-session-affinity", "", "session affinity of the service (None, ClientIP) (default: the service default, None)")
+	cmd.Flags().IntVar(&serviceSessionAffinityTimeout, "service-session-affinity-timeout", 0, "ClientIP session affinity timeout in seconds (default: the service default, 10800)")
+	return cmd
 }
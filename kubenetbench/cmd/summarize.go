@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	summarizeOutput    string
+	summarizeFormat    string
+	summarizeExemplars bool
+)
+
+var summarizeCmd = &cobra.Command{
+	Use:   "summarize",
+	Short: "summarize the results of all session runs in a CSV (or OpenMetrics) file",
+	Run: func(cmd *cobra.Command, args []string) {
+		var ext string
+		switch summarizeFormat {
+		case "csv":
+			ext = "csv"
+			if summarizeExemplars {
+				log.Fatal("--exemplars requires --format openmetrics")
+			}
+		case "openmetrics":
+			ext = "prom"
+		default:
+			log.Fatal("invalid summary format: ", summarizeFormat)
+		}
+
+		sess := getSession()
+		fname := summarizeOutput
+		if fname == "" {
+			fname = fmt.Sprintf("%s/results.%s", sess.Dir(), ext)
+		}
+
+		f, err := os.Create(fname)
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to create %s: %w", fname, err))
+		}
+		defer f.Close()
+
+		var n int
+		if summarizeFormat == "openmetrics" {
+			n, err = core.WriteOpenMetrics(sess.Dir(), f, summarizeExemplars)
+		} else {
+			n, err = core.Summarize(sess.Dir(), f)
+		}
+		if err != nil {
+			log.Fatal(fmt.Errorf("failed to summarize session: %w", err))
+		}
+		slog.Info("session summary", "runs", n, "file", fname)
+	},
+}
+
+func init() {
+	summarizeCmd.Flags().StringVarP(&summarizeOutput, "output", "o", "", "output file (default: <session dir>/results.csv, or results.prom for openmetrics)")
+	summarizeCmd.Flags().StringVar(&summarizeFormat, "format", "csv", "output format (csv, openmetrics)")
+	summarizeCmd.Flags().BoolVar(&summarizeExemplars, "exemplars", false, "attach an exemplar with the run id (trace_id) to each OpenMetrics sample (the metrics are then counters)")
+}
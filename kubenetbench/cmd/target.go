@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	targetArg     string
+	targetPortArg string
+)
+
+var targetCmd = &cobra.Command{
+	Use:   "target",
+	Short: "benchmark run against an existing server (service or pod), with the custom benchmark",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, _, err := core.ParseTarget(targetArg); err != nil {
+			log.Fatal(err)
+		}
+		if benchmark != "custom" {
+			log.Fatal("target requires --benchmark custom")
+		}
+		if targetPortArg == "" {
+			log.Fatal("target requires --server-port")
+		}
+
+		err := runBenchmark(cmd, "target", func(runctx *core.RunBenchCtx) error {
+			st := core.TargetSt{
+				RunBenchCtx: runctx,
+				Target:      targetArg,
+				Port:        targetPortArg,
+			}
+			return st.Execute()
+		})
+		if err != nil {
+			log.Fatal("target execution failed:", err)
+		}
+	},
+}
+
+func init() {
+	addBenchmarkFlags(targetCmd)
+	targetCmd.Flags().StringVar(&targetArg, "target", "", "existing server to benchmark: service/<name> or pod/<name> (in --server-namespace)")
+	targetCmd.Flags().StringVar(&targetPortArg, "server-port", "", "port of the target, by number or by name (e.g., http), resolved from the service ports or the pod container ports (available to the client as $KNB_SERVER_PORT)")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "check the files received from the monitors (collection archives, sysinfo) against the session's integrity manifest (manifest.sha256)",
+	Run: func(cmd *cobra.Command, args []string) {
+		sess := getSession()
+		report, err := core.VerifySession(sess.Dir())
+		if err != nil {
+			log.Fatal(fmt.Errorf("verification failed: %w", err))
+		}
+
+		for _, f := range report.Missing {
+			fmt.Println("missing:", f)
+		}
+		for _, f := range report.Altered {
+			fmt.Println("altered:", f)
+		}
+		slog.Info("session verified", "files", report.Files, "missing", len(report.Missing), "altered", len(report.Altered))
+		if !report.OK() {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/kubenetbench/kubenetbench/core"
+)
+
+var (
+	watching      bool
+	watchInterval time.Duration
+	watchCount    int
+	watchDataset  string
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "rerun a benchmark on an interval, appending the results to a dataset",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		watching = true
+	},
+}
+
+func init() {
+	watchCmd.PersistentFlags().DurationVar(&watchInterval, "interval", 5*time.Minute, "interval between the starts of the benchmark runs")
+	watchCmd.PersistentFlags().IntVar(&watchCount, "count", 0, "number of benchmark runs (0 to run until interrupted)")
+	watchCmd.PersistentFlags().StringVar(&watchDataset, "dataset", "", "dataset CSV file that results are appended to (default: <session dir>/watch-<run label>.csv)")
+
+	watchCmd.AddCommand(newPod2podCmd())
+	watchCmd.AddCommand(newServiceCmd())
+	watchCmd.AddCommand(newIngressCmd())
+	watchCmd.AddCommand(newSelftestCmd())
+}
+
+// watchBenchmark executes a benchmark every --interval (--count times, or until
+// interrupted), and appends the results of each execution to the dataset.
+// Failed executions are recorded in the dataset, and do not stop the watch.
+func watchBenchmark(
+	sess *core.Session,
+	exporter *core.InfluxExporter,
+	defaultRunLabel string,
+	execFn func(*core.RunBenchCtx) error,
+) error {
+	if watchInterval <= 0 {
+		return fmt.Errorf("invalid watch interval: %s", watchInterval)
+	}
+	if watchCount < 0 {
+		return fmt.Errorf("invalid watch count: %d", watchCount)
+	}
+
+	fname := watchDataset
+	if fname == "" {
+		label := runLabel
+		if label == "" {
+			label = defaultRunLabel
+		}
+		fname = fmt.Sprintf("%s/watch-%s.csv", sess.Dir(), label)
+	}
+
+	// an interrupt stops the watch after the current execution
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := 0
+loop:
+	for i := 1; watchCount == 0 || i <= watchCount; i++ {
+		start := time.Now()
+		slog.Info("watch", "run", i, "total", watchCount, "dataset", fname)
+		results, err := executeBenchmark(sess, exporter, defaultRunLabel, execFn)
+		if err != nil {
+			failed++
+			slog.Warn("watch run failed", "run", i, "error", err)
+		}
+		if err := core.AppendDataset(fname, start, results, err); err != nil {
+			return err
+		}
+
+		if i == watchCount {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("watch interrupted", "runs", i)
+			break loop
+		case <-time.After(time.Until(start.Add(watchInterval))):
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d watch run(s) failed (see %s)", failed, fname)
+	}
+	return nil
+}
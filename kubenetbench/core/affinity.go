@@ -7,77 +7,124 @@ import (
 	"github.com/cilium/kubenetbench/utils"
 )
 
-// client on the same node as the server
-func cliAffinitySame(pw *utils.PrefixWriter) {
+// client on the same node (or zone, see topologyKey) as the server (as an item
+// of the affinity)
+func cliAffinitySame(pw *utils.PrefixWriter, srvNs string, runKey string, runid string, topologyKey string) {
 	l := func(s string) {
 		pw.AppendNewLineOrDie(s)
 	}
 
-	l(`affinity:`)
 	l(`   podAffinity:`)
 	l(`       requiredDuringSchedulingIgnoredDuringExecution:`)
 	l(`       - labelSelector:`)
 	l(`            matchExpressions:`)
-	l(`            - key: role`)
-	l(`              operator: In`)
-	l(`              values:`)
-	l(`              - srv`)
-	l(`         topologyKey: "kubernetes.io/hostname"`)
+	srvSelectorWrite(pw, runKey, runid)
+	l(fmt.Sprintf(`         topologyKey: %q`, topologyKey))
+	srvNamespaceWrite(pw, srvNs)
 }
 
-// client on the same node as the server
-func cliAffinityOther(pw *utils.PrefixWriter) {
+// client on a different node (or zone, see topologyKey) than the server (as an
+// item of the affinity)
+func cliAffinityOther(pw *utils.PrefixWriter, srvNs string, runKey string, runid string, topologyKey string) {
 	l := func(s string) {
 		pw.AppendNewLineOrDie(s)
 	}
 
-	l(`affinity:`)
 	l(`   podAntiAffinity:`)
 	l(`       requiredDuringSchedulingIgnoredDuringExecution:`)
 	l(`       - labelSelector:`)
 	l(`            matchExpressions:`)
+	srvSelectorWrite(pw, runKey, runid)
+	l(fmt.Sprintf(`         topologyKey: %q`, topologyKey))
+	srvNamespaceWrite(pw, srvNs)
+}
+
+// select the server pod(s) of the run
+func srvSelectorWrite(pw *utils.PrefixWriter, runKey string, runid string) {
+	l := func(s string) {
+		pw.AppendNewLineOrDie(s)
+	}
+
+	l(fmt.Sprintf(`            - key: %s`, runKey))
+	l(`              operator: In`)
+	l(`              values:`)
+	l(fmt.Sprintf(`              - %s`, runid))
 	l(`            - key: role`)
 	l(`              operator: In`)
 	l(`              values:`)
 	l(`              - srv`)
-	l(`         topologyKey: "kubernetes.io/hostname"`)
 }
 
-//
-func affinityHost(host string, pw *utils.PrefixWriter) {
-	pw.AppendNewLineOrDie(`nodeSelector:`)
-	pw.AppendNewLineOrDie(fmt.Sprintf(`     kubernetes.io/hostname: %s`, host))
+// the server might be on a different namespace than the client
+func srvNamespaceWrite(pw *utils.PrefixWriter, srvNs string) {
+	if srvNs != "" {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`         namespaces: [%q]`, srvNs))
+	}
 }
 
 func (c *RunBenchCtx) cliAffinityWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
 	cliAffinity := c.cliSpec.Affinity
+	host := ""
 	switch {
-	case cliAffinity == "none":
-		return
-	case cliAffinity == "same":
-		cliAffinitySame(pw)
-	case cliAffinity == "different":
-		cliAffinityOther(pw)
+	case cliAffinity == "none", cliAffinity == "same", cliAffinity == "different":
 	case strings.HasPrefix(cliAffinity, "host="):
-		host := strings.TrimPrefix(cliAffinity, "host=")
-		affinityHost(host, pw)
-
+		host = strings.TrimPrefix(cliAffinity, "host=")
 	default:
 		panic(fmt.Sprintf("Unrecognized client affinity: %s", cliAffinity))
 	}
+	c.cliSpec.nodeSelectorWrite(pw, host)
+
+	// pod (anti-)affinities to the server: on the same node, on a different
+	// node, and/or on the same or a different zone (see ZonePlacement). A
+	// different zone implies a different node, and the same node the same
+	// zone.
+	sameKey, otherKey := "", ""
+	switch cliAffinity {
+	case "same":
+		sameKey = nodeTopologyKey
+	case "different":
+		otherKey = nodeTopologyKey
+	}
+	switch c.cliSpec.ZonePlacement {
+	case "same":
+		if sameKey == "" {
+			sameKey = zoneTopologyKey
+		}
+	case "cross":
+		otherKey = zoneTopologyKey
+	}
+
+	excludeCP := c.cliSpec.excludeControlPlane(host)
+	if !excludeCP && sameKey == "" && otherKey == "" {
+		return
+	}
+	pw.AppendNewLineOrDie(`affinity:`)
+	if excludeCP {
+		controlPlaneAntiAffinityWrite(pw)
+	}
+	runKey := c.session.labelKey(runIdLabel)
+	if sameKey != "" {
+		cliAffinitySame(pw, c.srvSpec.Namespace, runKey, c.runid, sameKey)
+	}
+	if otherKey != "" {
+		cliAffinityOther(pw, c.srvSpec.Namespace, runKey, c.runid, otherKey)
+	}
 }
 
 func (c *RunBenchCtx) srvAffinityWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
 	srvAffinity := c.srvSpec.Affinity
-
+	host := ""
 	switch {
 	case srvAffinity == "none":
-		return
 	case strings.HasPrefix(srvAffinity, "host="):
-		host := strings.TrimPrefix(srvAffinity, "host=")
-		affinityHost(host, pw)
-
+		host = strings.TrimPrefix(srvAffinity, "host=")
 	default:
 		panic(fmt.Sprintf("Unrecognized server affinity: %s", srvAffinity))
 	}
+	c.srvSpec.nodeSelectorWrite(pw, host)
+
+	if c.srvSpec.excludeControlPlane(host) {
+		pw.AppendNewLineOrDie(`affinity:`)
+		controlPlaneAntiAffinityWrite(pw)
+	}
 }
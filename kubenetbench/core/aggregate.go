@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// metrics that we check for stability across repeats
+var aggregateKeyMetrics = []string{
+	"THROUGHPUT",
+	"AGGREGATE_THROUGHPUT",
+	"TX_THROUGHPUT",
+	"RX_THROUGHPUT",
+	"TRANSACTION_RATE",
+	"P50_LATENCY",
+	"P90_LATENCY",
+	"MEAN_LATENCY",
+}
+
+// Stats are summary statistics of a metric across repeats
+type Stats struct {
+	N      int
+	Mean   float64
+	Stddev float64
+	Min    float64
+	Max    float64
+	CoV    float64 // coefficient of variation (stddev/mean)
+}
+
+// ComputeStats computes the statistics of the given values
+// NB: stddev is the sample standard deviation
+func ComputeStats(vals []float64) Stats {
+	st := Stats{N: len(vals)}
+	if st.N == 0 {
+		return st
+	}
+
+	st.Min = vals[0]
+	st.Max = vals[0]
+	sum := 0.0
+	for _, v := range vals {
+		sum += v
+		st.Min = math.Min(st.Min, v)
+		st.Max = math.Max(st.Max, v)
+	}
+	st.Mean = sum / float64(st.N)
+
+	if st.N > 1 {
+		ss := 0.0
+		for _, v := range vals {
+			ss += (v - st.Mean) * (v - st.Mean)
+		}
+		st.Stddev = math.Sqrt(ss / float64(st.N-1))
+	}
+
+	if st.Mean != 0 {
+		st.CoV = st.Stddev / math.Abs(st.Mean)
+	}
+
+	return st
+}
+
+// Percentile returns the p-th percentile (0 <= p <= 100) of the given values,
+// using linear interpolation between the closest ranks
+func Percentile(vals []float64, p float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (rank-float64(lo))*(sorted[hi]-sorted[lo])
+}
+
+// AggregateResult holds the aggregated results of multiple runs
+type AggregateResult struct {
+	RunIDs  []string
+	Keys    []string // metric keys, in order
+	Metrics map[string]Stats
+}
+
+// AggregateResults aggregates numeric metrics that are present in all results
+func AggregateResults(results []*BenchResult) *AggregateResult {
+	agg := &AggregateResult{
+		Metrics: make(map[string]Stats),
+	}
+	if len(results) == 0 {
+		return agg
+	}
+
+	for _, res := range results {
+		agg.RunIDs = append(agg.RunIDs, res.RunID)
+	}
+
+	for _, key := range results[0].NumericKeys() {
+		vals := make([]float64, 0, len(results))
+		for _, res := range results {
+			v, ok := res.Float(key)
+			if !ok {
+				break
+			}
+			vals = append(vals, v)
+		}
+		if len(vals) != len(results) {
+			continue
+		}
+		agg.Keys = append(agg.Keys, key)
+		agg.Metrics[key] = ComputeStats(vals)
+	}
+
+	return agg
+}
+
+// Unstable returns the key metrics with a CoV larger than the given threshold
+func (a *AggregateResult) Unstable(maxCoV float64) []string {
+	ret := []string{}
+	for _, key := range aggregateKeyMetrics {
+		st, ok := a.Metrics[key]
+		if ok && st.CoV > maxCoV {
+			ret = append(ret, key)
+		}
+	}
+	return ret
+}
+
+// WriteFile writes the aggregate results to a file
+func (a *AggregateResult) WriteFile(fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "# runs: %s\n", strings.Join(a.RunIDs, " "))
+	fmt.Fprintf(f, "%-28s %4s %14s %14s %14s %14s %8s\n", "METRIC", "N", "MEAN", "STDDEV", "MIN", "MAX", "COV")
+	for _, key := range a.Keys {
+		st := a.Metrics[key]
+		fmt.Fprintf(f, "%-28s %4d %14.3f %14.3f %14.3f %14.3f %8.4f\n", key, st.N, st.Mean, st.Stddev, st.Min, st.Max, st.CoV)
+	}
+
+	return nil
+}
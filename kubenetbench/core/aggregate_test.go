@@ -0,0 +1,63 @@
+package core
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	st := ComputeStats([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if st.N != 8 || st.Mean != 5 || st.Min != 2 || st.Max != 9 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	// sample stddev
+	expected := math.Sqrt(32.0 / 7.0)
+	if math.Abs(st.Stddev-expected) > 1e-9 {
+		t.Errorf("got stddev %f while expected %f", st.Stddev, expected)
+	}
+	if math.Abs(st.CoV-expected/5) > 1e-9 {
+		t.Errorf("got CoV %f while expected %f", st.CoV, expected/5)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	vals := []float64{5, 1, 4, 2, 3}
+	for _, tc := range []struct{ p, expected float64 }{
+		{0, 1}, {50, 3}, {100, 5}, {90, 4.6},
+	} {
+		if v := Percentile(vals, tc.p); math.Abs(v-tc.expected) > 1e-9 {
+			t.Errorf("p%g: got %f while expected %f", tc.p, v, tc.expected)
+		}
+	}
+}
+
+func TestAggregateResults(t *testing.T) {
+	outs := []string{
+		"MIGRATED TCP REQUEST/RESPONSE TEST\nTHROUGHPUT=100\nTHROUGHPUT_UNITS=Trans/s\nP50_LATENCY=10\n",
+		"THROUGHPUT=200\nTHROUGHPUT_UNITS=Trans/s\n",
+	}
+
+	results := []*BenchResult{}
+	for i, out := range outs {
+		res, err := ParseBenchResult(string(rune('a'+i)), strings.NewReader(out))
+		if err != nil {
+			t.Fatalf("ParseBenchResult failed: %v", err)
+		}
+		results = append(results, res)
+	}
+
+	agg := AggregateResults(results)
+	if len(agg.Keys) != 1 || agg.Keys[0] != "THROUGHPUT" {
+		t.Fatalf("unexpected keys: %v", agg.Keys)
+	}
+	if agg.Metrics["THROUGHPUT"].Mean != 150 {
+		t.Errorf("unexpected mean: %f", agg.Metrics["THROUGHPUT"].Mean)
+	}
+
+	unstable := agg.Unstable(0.05)
+	if len(unstable) != 1 || unstable[0] != "THROUGHPUT" {
+		t.Errorf("unexpected unstable metrics: %v", unstable)
+	}
+}
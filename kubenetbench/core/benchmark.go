@@ -1,6 +1,8 @@
 package core
 
 import (
+	"io"
+
 	"github.com/cilium/kubenetbench/utils"
 )
 
@@ -15,3 +17,30 @@ type Benchmark interface {
 
 	GetTimeout() int
 }
+
+// ResultParser is an optional interface for benchmarks whose client output
+// requires custom parsing (the default is ParseBenchResult)
+type ResultParser interface {
+	ParseResult(runid string, rd io.Reader) (*BenchResult, error)
+}
+
+// ResultChecker is an optional interface for benchmarks that validate their
+// results (e.g., that the requested settings were effective). A failed check
+// fails the run (see SaveResult).
+type ResultChecker interface {
+	CheckResult(res *BenchResult) error
+}
+
+// RunPreparer is an optional interface for benchmarks that need to prepare
+// the run (e.g., create secrets) before its pods are created
+type RunPreparer interface {
+	PrepareRun(r *RunBenchCtx) error
+}
+
+// prepareBenchmark prepares the run for the benchmark (see RunPreparer)
+func (r *RunBenchCtx) prepareBenchmark() error {
+	if p, ok := r.benchmark.(RunPreparer); ok {
+		return p.PrepareRun(r)
+	}
+	return nil
+}
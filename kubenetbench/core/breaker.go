@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// sysInfoBreakerNodes is the number of nodes that need to fail with the same
+// (categorized) error for GetSysInfoNodes to give up on the remaining nodes
+const sysInfoBreakerNodes = 3
+
+// monitorFatalReasons are container waiting reasons that will not resolve by
+// retrying
+var monitorFatalReasons = map[string]struct{}{
+	"ErrImagePull":               {},
+	"ImagePullBackOff":           {},
+	"InvalidImageName":           {},
+	"CrashLoopBackOff":           {},
+	"CreateContainerConfigError": {},
+	"CreateContainerError":       {},
+	"RunContainerError":          {},
+}
+
+// monitorErrCategory categorizes a failure to reach the monitor of a node,
+// based on the state of the monitor pod. It returns an empty string if the
+// failure might be transient (e.g., the pod is still starting).
+func (s *Session) monitorErrCategory(ctx context.Context, node string) string {
+	labels := s.monitorLabel("=") + "," + monitorSelector
+	cmd := fmt.Sprintf(
+		`kubectl get pods -l "%s" --field-selector=spec.nodeName="%s" -o custom-columns=Phase:.status.phase,Ready:.status.containerStatuses[0].ready,Reason:.status.containerStatuses[0].state.waiting.reason --no-headers`,
+		labels, node,
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return ""
+	}
+	if len(lines) == 0 {
+		return "no monitor pod on node"
+	}
+	return categorizeMonitorPod(lines[0])
+}
+
+// categorizeMonitorPod categorizes a monitor failure given the (phase, ready,
+// waiting reason) line of its pod (see monitorErrCategory)
+func categorizeMonitorPod(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return ""
+	}
+	phase, ready, reason := fields[0], fields[1], fields[2]
+	if _, ok := monitorFatalReasons[reason]; ok {
+		return "monitor pod " + reason
+	}
+	switch {
+	case phase == "Failed":
+		return "monitor pod failed"
+	case phase == "Running" && ready == "true":
+		// the pod is up, but we cannot talk to it (e.g., firewalled node IP)
+		return "monitor unreachable"
+	}
+	return ""
+}
+
+// sysInfoBreaker stops retrying the remaining nodes if the first nodes all
+// fail with the same categorized error (e.g., the monitor image cannot be
+// pulled), instead of exhausting the retries of every node
+type sysInfoBreaker struct {
+	mu       sync.Mutex
+	nodes    int      // number of outcomes considered
+	outcomes []string // category of the first outcomes ("" for success)
+	recorded []string // nodes of the outcomes
+	tripped  error
+	cancel   context.CancelFunc
+}
+
+func newSysInfoBreaker(nodes int, cancel context.CancelFunc) *sysInfoBreaker {
+	if nodes > sysInfoBreakerNodes {
+		nodes = sysInfoBreakerNodes
+	}
+	return &sysInfoBreaker{nodes: nodes, cancel: cancel}
+}
+
+// record records the outcome for a node: an empty category for success, or
+// the category of its (first categorized) failure. Nodes should be recorded
+// at most once.
+func (b *sysInfoBreaker) record(node, category string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tripped != nil || len(b.outcomes) >= b.nodes {
+		return
+	}
+
+	b.outcomes = append(b.outcomes, category)
+	b.recorded = append(b.recorded, node)
+	if len(b.outcomes) < b.nodes {
+		return
+	}
+	for _, c := range b.outcomes {
+		if c == "" || c != b.outcomes[0] {
+			return
+		}
+	}
+
+	b.tripped = fmt.Errorf("%s on the first %d nodes (%s): not retrying the remaining nodes",
+		category, len(b.recorded), strings.Join(b.recorded, ","))
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// err returns a non-nil error if the breaker has tripped
+func (b *sysInfoBreaker) err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tripped
+}
@@ -0,0 +1,48 @@
+package core
+
+import "testing"
+
+func TestCategorizeMonitorPod(t *testing.T) {
+	for line, want := range map[string]string{
+		"Pending false ImagePullBackOff": "monitor pod ImagePullBackOff",
+		"Pending <none> <none>":          "",
+		"Running false CrashLoopBackOff": "monitor pod CrashLoopBackOff",
+		"Running true <none>":            "monitor unreachable",
+		"Failed false <none>":            "monitor pod failed",
+	} {
+		if got := categorizeMonitorPod(line); got != want {
+			t.Errorf("categorizeMonitorPod(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestSysInfoBreaker(t *testing.T) {
+	canceled := false
+	b := newSysInfoBreaker(10, func() { canceled = true })
+	b.record("n1", "monitor pod ImagePullBackOff")
+	b.record("n2", "monitor pod ImagePullBackOff")
+	if b.err() != nil {
+		t.Fatalf("breaker tripped early")
+	}
+	b.record("n3", "monitor pod ImagePullBackOff")
+	if b.err() == nil || !canceled {
+		t.Fatalf("breaker did not trip")
+	}
+
+	// a success, or a different error, keeps the breaker closed
+	b = newSysInfoBreaker(10, nil)
+	b.record("n1", "monitor pod ImagePullBackOff")
+	b.record("n2", "")
+	b.record("n3", "monitor pod ImagePullBackOff")
+	b.record("n4", "monitor pod ImagePullBackOff")
+	if b.err() != nil {
+		t.Fatalf("unexpected trip: %v", b.err())
+	}
+
+	// single node cluster
+	b = newSysInfoBreaker(1, nil)
+	b.record("n1", "monitor unreachable")
+	if b.err() == nil {
+		t.Fatalf("breaker did not trip")
+	}
+}
@@ -0,0 +1,249 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// bundleManifestFname is the name of the manifest of a session bundle
+const bundleManifestFname = "MANIFEST"
+
+var (
+	ipv4RegEx = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	ipv6RegEx = regexp.MustCompile(`\b[0-9a-fA-F]{0,4}(:[0-9a-fA-F]{0,4}){2,7}\b`)
+)
+
+// redactor replaces node names and IP addresses with placeholders (e.g.,
+// node-1, ip-1). The same name or address is always replaced with the same
+// placeholder, so that redacted data remain consistent across files.
+type redactor struct {
+	replacer *strings.Replacer // node names
+	ips      map[string]string
+}
+
+func newRedactor(nodes []string) *redactor {
+	sorted := append([]string{}, nodes...)
+	sort.Strings(sorted)
+	placeholders := make(map[string]string, len(sorted))
+	for i, n := range sorted {
+		placeholders[n] = fmt.Sprintf("node-%d", i+1)
+	}
+
+	// strings.Replacer uses the first matching pair at each position: longest
+	// names first, so that no name is replaced within a longer one
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, n := range sorted {
+		pairs = append(pairs, n, placeholders[n])
+	}
+	return &redactor{
+		replacer: strings.NewReplacer(pairs...),
+		ips:      map[string]string{},
+	}
+}
+
+func (rd *redactor) ip(s string) string {
+	if net.ParseIP(s) == nil {
+		return s
+	}
+	if _, ok := rd.ips[s]; !ok {
+		rd.ips[s] = fmt.Sprintf("ip-%d", len(rd.ips)+1)
+	}
+	return rd.ips[s]
+}
+
+// redact returns s with node names and IP addresses replaced
+func (rd *redactor) redact(s string) string {
+	s = ipv4RegEx.ReplaceAllStringFunc(s, rd.ip)
+	s = ipv6RegEx.ReplaceAllStringFunc(s, rd.ip)
+	return rd.replacer.Replace(s)
+}
+
+// isBinary returns true if data (e.g., the start of a file) are not text
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// sessionNodes returns the names of the nodes that appear in the session
+// directory: the nodes of the runs (NODES and OBSERVE_NODES metadata), and
+// the nodes with session sysinfo
+func sessionNodes(sessDir string) ([]string, error) {
+	entries, err := os.ReadDir(sessDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, e := range entries {
+		dir := filepath.Join(sessDir, e.Name())
+		if !e.IsDir() {
+			continue
+		}
+		if isSysInfoDir(dir) {
+			seen[e.Name()] = true
+			continue
+		}
+		meta, err := readKeyValueFile(filepath.Join(dir, "meta"))
+		if err != nil {
+			continue
+		}
+		for _, key := range []string{"NODES", "OBSERVE_NODES"} {
+			for _, n := range strings.Split(meta[key], ",") {
+				if n != "" && n != "<none>" {
+					seen[n] = true
+				}
+			}
+		}
+	}
+
+	ret := make([]string, 0, len(seen))
+	for n := range seen {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// BundleStats are the stats of a session bundle (see WriteBundle)
+type BundleStats struct {
+	Files    int      // files in the bundle
+	Bytes    int64    // bytes of the files (uncompressed)
+	Excluded []string // files excluded by the redaction (binary files)
+}
+
+// WriteBundle writes the session directory as a (gzip-compressed, unless
+// compress is false) tarball, so that a session can be shared as a single
+// file. The files are under the session id, and a MANIFEST lists them (path,
+// mode, and size). With redact, node names and IP addresses are replaced with
+// placeholders (in file contents and paths), and binary files (e.g., perf
+// archives and packet captures), which cannot be redacted, are excluded.
+// Files matching skip (e.g., the bundle itself) are not included.
+func WriteBundle(sessDir string, w io.Writer, compress bool, redact bool, skip string) (BundleStats, error) {
+	var stats BundleStats
+	sessID := filepath.Base(filepath.Clean(sessDir))
+
+	var rd *redactor
+	if redact {
+		nodes, err := sessionNodes(sessDir)
+		if err != nil {
+			return stats, err
+		}
+		rd = newRedactor(nodes)
+	}
+	skipAbs := ""
+	if skip != "" {
+		skipAbs, _ = filepath.Abs(skip)
+	}
+
+	out := w
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(w)
+		out = gw
+	}
+	tw := tar.NewWriter(out)
+
+	var manifest strings.Builder
+	fmt.Fprintf(&manifest, "# kubenetbench session %s (redacted: %t)\n", sessID, redact)
+	fmt.Fprintln(&manifest, "# mode size path")
+
+	err := filepath.WalkDir(sessDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// symlinks (e.g., latest) are skipped: they point to other runs
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == skipAbs {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sessDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var data []byte
+		size := fi.Size()
+		if rd != nil {
+			data, err = io.ReadAll(io.LimitReader(f, size))
+			if err != nil {
+				return err
+			}
+			if isBinary(data) {
+				stats.Excluded = append(stats.Excluded, name)
+				fmt.Fprintf(&manifest, "# excluded (binary): %s\n", rd.redact(name))
+				return nil
+			}
+			data = []byte(rd.redact(string(data)))
+			name = rd.redact(name)
+			size = int64(len(data))
+		}
+
+		hdr := &tar.Header{
+			Name:    sessID + "/" + name,
+			Mode:    int64(fi.Mode().Perm()),
+			Size:    size,
+			ModTime: fi.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if data != nil {
+			_, err = tw.Write(data)
+		} else {
+			// files might grow while they are bundled (e.g., the session log)
+			_, err = io.CopyN(tw, f, size)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to bundle %s: %w", path, err)
+		}
+		fmt.Fprintf(&manifest, "%04o %d %s\n", hdr.Mode, size, name)
+		stats.Files++
+		stats.Bytes += size
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	hdr := &tar.Header{
+		Name: sessID + "/" + bundleManifestFname,
+		Mode: 0644,
+		Size: int64(manifest.Len()),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return stats, err
+	}
+	if _, err := io.WriteString(tw, manifest.String()); err != nil {
+		return stats, err
+	}
+	if err := tw.Close(); err != nil {
+		return stats, err
+	}
+	if gw != nil {
+		return stats, gw.Close()
+	}
+	return stats, nil
+}
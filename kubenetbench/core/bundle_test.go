@@ -0,0 +1,106 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readBundle returns the files of a (gzip-compressed) bundle
+func readBundle(t *testing.T, data []byte) map[string]string {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	ret := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret[hdr.Name] = string(b)
+	}
+	return ret
+}
+
+func TestWriteBundle(t *testing.T) {
+	sessDir := filepath.Join(t.TempDir(), "sess1")
+	files := map[string]string{
+		"worker-1/kernel.txt":         "Linux worker-1 6.1.0\n",
+		"run1/meta":                   "NODES=worker-1,worker-10\n",
+		"run1/cli.log":                "connecting to 10.0.1.5 and fd00::5 from worker-10 at 12:30:01\n",
+		"run1/netstats-worker-10.txt": "TcpRetransSegs 3\n",
+		"run1/perf-worker-1.tar.bz2":  "BZh\x00\x01",
+		"run1/result":                 "THROUGHPUT=9000\n",
+		"sess1.log":                   "level=INFO node=worker-1 ip=10.0.1.5\n",
+	}
+	for name, content := range files {
+		fname := filepath.Join(sessDir, name)
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("run1", filepath.Join(sessDir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	stats, err := WriteBundle(sessDir, &buf, true, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := readBundle(t, buf.Bytes())
+	if stats.Files != len(files) || len(bundle) != len(files)+1 {
+		t.Fatalf("unexpected bundle (%d files): %v", stats.Files, bundle)
+	}
+	for name, content := range files {
+		if bundle["sess1/"+name] != content {
+			t.Errorf("%s: unexpected content %q", name, bundle["sess1/"+name])
+		}
+	}
+	if !strings.Contains(bundle["sess1/MANIFEST"], "0644 16 run1/result\n") {
+		t.Errorf("unexpected manifest:\n%s", bundle["sess1/MANIFEST"])
+	}
+
+	buf.Reset()
+	stats, err = WriteBundle(sessDir, &buf, true, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle = readBundle(t, buf.Bytes())
+	if len(stats.Excluded) != 1 || stats.Excluded[0] != "run1/perf-worker-1.tar.bz2" {
+		t.Errorf("unexpected excluded files: %v", stats.Excluded)
+	}
+	expected := map[string]string{
+		"sess1/node-1/kernel.txt":        "Linux node-1 6.1.0\n",
+		"sess1/run1/meta":                "NODES=node-1,node-2\n",
+		"sess1/run1/cli.log":             "connecting to ip-1 and ip-2 from node-2 at 12:30:01\n",
+		"sess1/run1/netstats-node-2.txt": "TcpRetransSegs 3\n",
+		"sess1/sess1.log":                "level=INFO node=node-1 ip=ip-1\n",
+	}
+	for name, content := range expected {
+		if bundle[name] != content {
+			t.Errorf("%s: expected %q, got %q", name, content, bundle[name])
+		}
+	}
+	for name, content := range bundle {
+		if strings.Contains(name, "worker") || strings.Contains(content, "worker") || strings.Contains(content, "10.0.1.5") {
+			t.Errorf("%s: not redacted:\n%s", name, content)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+// SetCPUUsage enables collecting the CPU usage of the run nodes (host-wide, by
+// category, and of the benchmark pods) during the benchmark
+func (r *RunBenchCtx) SetCPUUsage() {
+	r.cpu = true
+}
+
+// cpuPods returns the benchmark pods of the run, as name=uid pairs, so that
+// the monitor can find their cgroups
+func (r *RunBenchCtx) cpuPods() string {
+	lines, err := r.KubeGetPods__([]string{PodName, PodUID})
+	if err != nil {
+		logger().Warn("failed to get pods: not collecting their CPU usage", "error", err)
+		return ""
+	}
+	pods := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if len(l) == 2 {
+			pods = append(pods, l[0]+"="+l[1])
+		}
+	}
+	return strings.Join(pods, ",")
+}
+
+// cpuConfPb sets the CPU usage collection of a collection (if enabled)
+func (r *RunBenchCtx) cpuConfPb(conf *pb.CollectionConf, pods string) {
+	if !r.cpu {
+		return
+	}
+	conf.CpuDuration = fmt.Sprintf("%d", r.collectSeconds())
+	conf.CpuPods = pods
+}
+
+// parseCPUDeltas parses the output of scripts/cpu-usage.sh:
+// "<scope>/<counter> <before> <after> <delta>" lines, with times in usecs
+func parseCPUDeltas(r io.Reader) (map[string]float64, error) {
+	ret := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid CPU usage line: %q", line)
+		}
+		// NB: awk may print large values in exponent notation
+		delta, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU usage delta %q: %w", line, err)
+		}
+		ret[fields[0]] = delta
+	}
+	return ret, scanner.Err()
+}
+
+// cpuUsage is the CPU usage of a node during the benchmark, in cores (i.e.,
+// CPU seconds per second)
+type cpuUsage struct {
+	User    float64 // host userspace (incl. nice)
+	System  float64 // host kernel, excluding interrupts
+	Irq     float64 // host hard interrupts
+	Softirq float64 // host soft interrupts (e.g., packet processing)
+	Pods    float64 // benchmark pods on the node
+}
+
+// Busy returns the CPU usage of the host
+func (u cpuUsage) Busy() float64 {
+	return u.User + u.System + u.Irq + u.Softirq
+}
+
+// cpuNodeUsage computes the CPU usage of a node from its CPU time deltas
+func cpuNodeUsage(deltas map[string]float64) (cpuUsage, error) {
+	elapsed := deltas["host/elapsed"]
+	if elapsed <= 0 {
+		return cpuUsage{}, errors.New("no elapsed time")
+	}
+	u := cpuUsage{
+		User:    deltas["host/user"] / elapsed,
+		System:  deltas["host/system"] / elapsed,
+		Irq:     deltas["host/irq"] / elapsed,
+		Softirq: deltas["host/softirq"] / elapsed,
+	}
+	for k, v := range deltas {
+		if strings.HasPrefix(k, "pod/") && strings.HasSuffix(k, "/usage") {
+			u.Pods += v / elapsed
+		}
+	}
+	return u, nil
+}
+
+var cpuNodeKeyRegEx = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// cpuNodeKey returns the node part of the per-node CPU usage keys
+func cpuNodeKey(node string) string {
+	return strings.Trim(cpuNodeKeyRegEx.ReplaceAllString(strings.ToUpper(node), "_"), "_")
+}
+
+// cpuUsageValues returns the result values of the CPU usage of the run nodes:
+// the totals (CPU_CORES, ...), and the usage of each node
+// (NODE_<node>_CPU_CORES, ...)
+func cpuUsageValues(usage map[string]cpuUsage) map[string]string {
+	ret := make(map[string]string)
+	set := func(prefix string, u cpuUsage) {
+		ret[prefix+"CPU_CORES"] = fmt.Sprintf("%.3f", u.Busy())
+		ret[prefix+"CPU_USER_CORES"] = fmt.Sprintf("%.3f", u.User)
+		ret[prefix+"CPU_SYSTEM_CORES"] = fmt.Sprintf("%.3f", u.System)
+		ret[prefix+"CPU_IRQ_CORES"] = fmt.Sprintf("%.3f", u.Irq)
+		ret[prefix+"CPU_SOFTIRQ_CORES"] = fmt.Sprintf("%.3f", u.Softirq)
+		ret[prefix+"CPU_PODS_CORES"] = fmt.Sprintf("%.3f", u.Pods)
+	}
+
+	var total cpuUsage
+	for node, u := range usage {
+		set("NODE_"+cpuNodeKey(node)+"_", u)
+		total.User += u.User
+		total.System += u.System
+		total.Irq += u.Irq
+		total.Softirq += u.Softirq
+		total.Pods += u.Pods
+	}
+	set("", total)
+	return ret
+}
+
+// throughputGbps returns the throughput of a result in Gbit/s, if its units
+// are a data rate (e.g., 10^6bits/s for netperf streams)
+func throughputGbps(values map[string]string) (float64, bool) {
+	v, err := strconv.ParseFloat(values["THROUGHPUT"], 64)
+	if err != nil {
+		return 0, false
+	}
+	return rateGbps(v, values["THROUGHPUT_UNITS"])
+}
+
+// rateGbps converts a data rate in netperf units (e.g., 10^6bits/s) to Gbit/s
+func rateGbps(v float64, units string) (float64, bool) {
+	var exp int
+	var unit string
+	units = strings.Replace(units, "/s", "", 1)
+	if _, err := fmt.Sscanf(units, "10^%d%s", &exp, &unit); err != nil {
+		return 0, false
+	}
+	switch unit {
+	case "bits":
+	case "Bytes":
+		v *= 8
+	default:
+		return 0, false
+	}
+	for ; exp < 9; exp++ {
+		v /= 10
+	}
+	for ; exp > 9; exp-- {
+		v *= 10
+	}
+	return v, true
+}
+
+// addCPUPerGbps adds the CPU usage per Gbit/s of throughput (CPU_PER_GBPS,
+// ...) for the CPU usage values (see cpuUsageValues) of a result
+func addCPUPerGbps(values map[string]string) {
+	gbps, ok := throughputGbps(values)
+	if !ok || gbps <= 0 {
+		return
+	}
+	for k, v := range values {
+		if !strings.HasSuffix(k, "_CORES") || !strings.Contains(k, "CPU_") {
+			continue
+		}
+		cores, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(k, "_CORES")+"_PER_GBPS"] = fmt.Sprintf("%.3f", cores/gbps)
+	}
+}
+
+// processCPUUsage computes the CPU usage of the run nodes from the collection
+// archives of the run (which also include the raw before/after counters). The
+// totals and per-node usage are written in cpu.log (see GetResult), and the
+// per-node usage in cpu-nodes.csv.
+func (r *RunBenchCtx) processCPUUsage() error {
+	usage := make(map[string]cpuUsage)
+	for _, node := range r.collectNodes {
+		archive := fmt.Sprintf("%s/%s-%s.tar.bz2", r.getDir(), r.collectionName(), node)
+		data, err := readFromArchive(archive, r.runid+"-cpu.txt")
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errNotInArchive) {
+			continue
+		} else if err != nil {
+			logger().Warn("reading CPU usage failed", "node", node, "error", err)
+			continue
+		}
+
+		deltas, err := parseCPUDeltas(strings.NewReader(string(data)))
+		if err == nil {
+			usage[node], err = cpuNodeUsage(deltas)
+		}
+		if err != nil {
+			logger().Warn("parsing CPU usage failed", "node", node, "error", err)
+			continue
+		}
+	}
+	if len(usage) == 0 {
+		return nil
+	}
+
+	values := cpuUsageValues(usage)
+	f, err := os.Create(fmt.Sprintf("%s/cpu.log", r.getDir()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(f, "%s=%s\n", k, values[k])
+	}
+
+	if err := writeCPUNodes(fmt.Sprintf("%s/cpu-nodes.csv", r.getDir()), usage); err != nil {
+		return err
+	}
+
+	logger().Info("CPU usage",
+		"cores", values["CPU_CORES"],
+		"softirq_cores", values["CPU_SOFTIRQ_CORES"],
+		"pods_cores", values["CPU_PODS_CORES"])
+	return nil
+}
+
+// writeCPUNodes writes the CPU usage of each node as CSV
+func writeCPUNodes(fname string, usage map[string]cpuUsage) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	nodes := make([]string, 0, len(usage))
+	for n := range usage {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"node", "cores", "user", "system", "irq", "softirq", "pods"})
+	for _, n := range nodes {
+		u := usage[n]
+		row := []string{n}
+		for _, v := range []float64{u.Busy(), u.User, u.System, u.Irq, u.Softirq, u.Pods} {
+			row = append(row, fmt.Sprintf("%.3f", v))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
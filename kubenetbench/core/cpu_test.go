@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const cpuDeltasTest = `host/user 1000 4001000 4000000
+host/system 0 2000000 2000000
+host/idle 0 1e+07 1e+07
+host/irq 0 0 0
+host/softirq 500 3000500 3000000
+host/steal 0 0 0
+host/elapsed 100 10000100 10000000
+host/ncpus 8 8 0
+pod/knb-srv-abc/usage 0 5000000 5000000
+pod/knb-srv-abc/user 0 1000000 1000000
+`
+
+func TestCPUUsage(t *testing.T) {
+	deltas, err := parseCPUDeltas(strings.NewReader(cpuDeltasTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := cpuNodeUsage(deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f", u.User, u.System, u.Softirq, u.Pods, u.Busy()); got != "0.40 0.20 0.30 0.50 0.90" {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+
+	values := cpuUsageValues(map[string]cpuUsage{"node-1.example": u, "node-2": u})
+	values["THROUGHPUT"] = "9000.0"
+	values["THROUGHPUT_UNITS"] = "10^6bits/s"
+	addCPUPerGbps(values)
+	expected := map[string]string{
+		"CPU_CORES":                     "1.800",
+		"CPU_SOFTIRQ_CORES":             "0.600",
+		"NODE_NODE_1_EXAMPLE_CPU_CORES": "0.900",
+		"CPU_PER_GBPS":                  "0.200",
+		"CPU_SOFTIRQ_PER_GBPS":          "0.067",
+		"NODE_NODE_2_CPU_USER_PER_GBPS": "0.044",
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("%s: expected %s, got %s", k, v, values[k])
+		}
+	}
+
+	if _, err := cpuNodeUsage(map[string]float64{}); err == nil {
+		t.Errorf("expected error without elapsed time")
+	}
+}
+
+func TestThroughputGbps(t *testing.T) {
+	tests := []struct {
+		throughput, units string
+		gbps              float64
+		ok                bool
+	}{
+		{"9410.5", "10^6bits/s", 9.4105, true},
+		{"1250", "10^6Bytes/s", 10, true},
+		{"10", "10^9bits/s", 10, true},
+		{"5000", "Trans/s", 0, false},
+		{"", "10^6bits/s", 0, false},
+	}
+	for _, tc := range tests {
+		gbps, ok := throughputGbps(map[string]string{"THROUGHPUT": tc.throughput, "THROUGHPUT_UNITS": tc.units})
+		if ok != tc.ok || (ok && (gbps-tc.gbps > 1e-9 || tc.gbps-gbps > 1e-9)) {
+			t.Errorf("%s %s: got %f %t", tc.throughput, tc.units, gbps, ok)
+		}
+	}
+}
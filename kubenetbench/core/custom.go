@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// CustomConf is a user-defined benchmark: kubenetbench handles placement,
+// collection, and artifact gathering, while the user provides the image and
+// the client/server commands. The client command can use the $KNB_SERVER_IP
+// environment variable to reach the server (and, against an existing server,
+// $KNB_SERVER_PORT, see TargetSt).
+type CustomConf struct {
+	Timeout int
+	Image   string
+	SrvCmd  string
+	CliCmd  string
+	Ports   []uint16 // server ports (for services and policies)
+	Parser  string   // optional parser command (see ParseResult)
+
+	Intervals string // format of the interval stats of the output (see ParseIntervals), empty for none
+}
+
+// GetTimeout returns the benchmark timeout
+func (cnf *CustomConf) GetTimeout() int {
+	return cnf.Timeout
+}
+
+// WriteSrvContainerYaml writes the server yaml
+func (cnf *CustomConf) WriteSrvContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	pw.AppendNewLineOrDie(`name: custom-srv`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, cnf.Image))
+	pw.AppendNewLineOrDie(`command: ["sh", "-c"]`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`args: [%q]`, cnf.SrvCmd))
+}
+
+// WriteCliContainerYaml writes the client yaml
+func (cnf *CustomConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	serverIP, ok := params["serverIP"]
+	if !ok {
+		panic("serverIP undefined")
+	}
+
+	pw.AppendNewLineOrDie(`name: custom-cli`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, cnf.Image))
+	pw.AppendNewLineOrDie(`env:`)
+	pw.AppendNewLineOrDie(`- name: KNB_SERVER_IP`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  value: "%v"`, serverIP))
+	if serverPort, ok := params["serverPort"]; ok {
+		pw.AppendNewLineOrDie(`- name: KNB_SERVER_PORT`)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  value: "%v"`, serverPort))
+	}
+	pw.AppendNewLineOrDie(`command: ["sh", "-c"]`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`args: [%q]`, cnf.CliCmd))
+}
+
+// WriteSrvPortsYaml writes the ports part of yaml (e.g., for services)
+func (cnf *CustomConf) WriteSrvPortsYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	for _, port := range cnf.Ports {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`- name: custom-%d`, port))
+		pw.AppendNewLineOrDie(`  protocol: TCP`)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  port: %d`, port))
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  targetPort: %d`, port))
+	}
+}
+
+// ParseResult parses the (raw) client output. If no parser is configured, the
+// output is expected to have KEY=VALUE lines (other lines are ignored).
+// Otherwise, the parser command is executed with the raw output as its
+// standard input, and its standard output is parsed as KEY=VALUE lines.
+func (cnf *CustomConf) ParseResult(runid string, rd io.Reader) (*BenchResult, error) {
+	if cnf.Parser == "" {
+		return ParseBenchResult(runid, rd)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", cnf.Parser)
+	cmd.Stdin = rd
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("parser %q failed: %w", cnf.Parser, err)
+	}
+
+	return ParseBenchResult(runid, &out)
+}
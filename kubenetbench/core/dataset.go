@@ -0,0 +1,59 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// AppendDataset appends the results of a (watch) iteration that started at ts
+// to a CSV dataset, one row per run. The columns are fixed (the timestamp, the
+// run id, the status, and the metrics in summaryMetrics), so that the dataset
+// can grow across iterations. A failed iteration (runErr != nil) gets a row
+// with a failed status, and no metrics, in addition to the rows of the runs
+// that completed before the failure.
+func AppendDataset(fname string, ts time.Time, results []*BenchResult, runErr error) error {
+	f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(f)
+	if fi.Size() == 0 {
+		header := []string{"timestamp", "runid", "status"}
+		for _, m := range summaryMetrics {
+			header = append(header, strings.ToLower(m))
+		}
+		cw.Write(header)
+	}
+
+	tstr := ts.UTC().Format(time.RFC3339)
+	for _, res := range results {
+		row := []string{tstr, res.RunID, "ok"}
+		for _, m := range summaryMetrics {
+			row = append(row, res.Values[m])
+		}
+		cw.Write(row)
+	}
+	if runErr != nil {
+		row := []string{tstr, "", "failed"}
+		for range summaryMetrics {
+			row = append(row, "")
+		}
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing dataset %s failed: %w", fname, err)
+	}
+	return nil
+}
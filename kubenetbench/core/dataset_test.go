@@ -0,0 +1,41 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendDataset(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "watch.csv")
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	res := &BenchResult{RunID: "pod2pod-1", Values: map[string]string{"THROUGHPUT": "941.2"}}
+	if err := AppendDataset(fname, ts, []*BenchResult{res}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendDataset(fname, ts.Add(time.Minute), nil, errors.New("client failed")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got:\n%s", data)
+	}
+	if !strings.HasPrefix(lines[0], "timestamp,runid,status,throughput,") {
+		t.Errorf("unexpected header: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "2024-01-02T03:04:05Z,pod2pod-1,ok,941.2,") {
+		t.Errorf("unexpected row: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "2024-01-02T03:05:05Z,,failed,,") {
+		t.Errorf("unexpected row: %s", lines[2])
+	}
+}
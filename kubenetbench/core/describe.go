@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// podFailed returns true if a pod of the run has failed: it did not start
+// (e.g., it could not be scheduled, or its image could not be pulled), it
+// failed, or its containers restarted or exited with an error. The arguments
+// are the (kubectl custom-columns) values of the pod's phase, and of its
+// containers' restart counts, exit codes, and waiting reasons.
+func podFailed(phase, restarts, exitCodes, waiting string) bool {
+	if phase != "Running" && phase != "Succeeded" {
+		return true
+	}
+	if waiting != "<none>" && waiting != "" {
+		return true
+	}
+	for _, n := range strings.Split(restarts, ",") {
+		if n != "0" && n != "<none>" && n != "" {
+			return true
+		}
+	}
+	for _, code := range strings.Split(exitCodes, ",") {
+		if code != "0" && code != "<none>" && code != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// describeFailedPods saves the output of kubectl describe (which includes the
+// pod's events) of the failed pods of the run (see podFailed) in
+// <pod>.describe.txt, so that failures can be debugged after the pods (or the
+// cluster) are gone. It is called before the run's resources are removed (see
+// KubeCleanup).
+func (c *RunBenchCtx) describeFailedPods() {
+	podsinfo, err := c.KubeGetPods__([]string{
+		PodName,
+		".metadata.namespace",
+		PodPhase,
+		".status.containerStatuses[*].restartCount",
+		".status.containerStatuses[*].state.terminated.exitCode",
+		".status.containerStatuses[*].state.waiting.reason",
+	})
+	if err != nil {
+		logger().Warn("failed to get run pods", "error", err)
+		return
+	}
+
+	failed := []string{}
+	for _, a := range podsinfo {
+		if len(a) != 6 || !podFailed(a[2], a[3], a[4], a[5]) {
+			continue
+		}
+		failed = append(failed, a[0])
+
+		fname := fmt.Sprintf("%s/%s.describe.txt", c.getDir(), a[0])
+		cmd := fmt.Sprintf(`kubectl describe pod%s %s > %s`, nsArg(a[1]), a[0], fname)
+		logger().Debug("exec", "cmd", cmd)
+		if err := utils.ExecCmd(cmd); err != nil {
+			logger().Warn("failed to describe pod", "pod", a[0], "error", err)
+			continue
+		}
+		logger().Info("pod failed: saved its description", "pod", a[0], "phase", a[2], "file", fname)
+	}
+
+	if len(failed) > 0 {
+		c.addMeta("FAILED_PODS", strings.Join(failed, ","))
+	}
+}
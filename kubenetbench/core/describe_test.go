@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestPodFailed(t *testing.T) {
+	for _, tc := range []struct {
+		phase, restarts, exitCodes, waiting string
+		failed                              bool
+	}{
+		{"Succeeded", "0", "0", "<none>", false},
+		{"Running", "0", "<none>", "<none>", false},
+		{"Running", "0,0", "0,<none>", "<none>", false}, // sidecar
+		{"Pending", "<none>", "<none>", "<none>", true}, // unschedulable
+		{"Pending", "0", "<none>", "ErrImagePull", true},
+		{"Failed", "0", "1", "<none>", true},
+		{"Running", "3", "<none>", "CrashLoopBackOff", true},
+		{"Running", "1", "<none>", "<none>", true},
+	} {
+		if got := podFailed(tc.phase, tc.restarts, tc.exitCodes, tc.waiting); got != tc.failed {
+			t.Errorf("%+v: expected %t, got %t", tc, tc.failed, got)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// DNSPolicies are the valid pod DNS policies
+var DNSPolicies = []string{"ClusterFirst", "ClusterFirstWithHostNet", "Default", "None"}
+
+// ValidateDNS checks the DNS options of the spec
+func (s *ContainerSpec) ValidateDNS() error {
+	if s.DNSPolicy != "" {
+		valid := false
+		for _, p := range DNSPolicies {
+			valid = valid || p == s.DNSPolicy
+		}
+		if !valid {
+			return fmt.Errorf("invalid DNS policy: %s (available values: %s)", s.DNSPolicy, strings.Join(DNSPolicies, ","))
+		}
+	}
+
+	if s.DNSPolicy == "None" && len(s.DNSNameservers) == 0 {
+		return fmt.Errorf("DNS policy None requires at least one nameserver")
+	}
+
+	return nil
+}
+
+// dnsWrite writes the pod's DNS policy and configuration (if any)
+func (s *ContainerSpec) dnsWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if s.DNSPolicy != "" {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`dnsPolicy: %s`, s.DNSPolicy))
+	}
+
+	if len(s.DNSNameservers) == 0 && len(s.DNSSearches) == 0 {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`dnsConfig:`)
+	if len(s.DNSNameservers) > 0 {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  nameservers: ["%s"]`, strings.Join(s.DNSNameservers, `", "`)))
+	}
+	if len(s.DNSSearches) > 0 {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  searches: ["%s"]`, strings.Join(s.DNSSearches, `", "`)))
+	}
+}
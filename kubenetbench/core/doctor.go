@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// doctorDialTimeout bounds the time to reach a monitor (see Diagnose)
+const doctorDialTimeout = 10 * time.Second
+
+// Finding is a problem found by Diagnose
+type Finding struct {
+	Object  string // affected resource, e.g., pod/knb-cli
+	Problem string
+	Hint    string // what to check, or do, about it
+}
+
+func (f Finding) String() string {
+	if f.Hint == "" {
+		return fmt.Sprintf("%s: %s", f.Object, f.Problem)
+	}
+	return fmt.Sprintf("%s: %s\n    -> %s", f.Object, f.Problem, f.Hint)
+}
+
+// podReasonHints are hints for container waiting (or pod) reasons
+var podReasonHints = map[string]string{
+	"ErrImagePull":               "the image cannot be pulled: check its name and registry access (see --image-check registry)",
+	"ImagePullBackOff":           "the image cannot be pulled: check its name and registry access (see --image-check registry)",
+	"InvalidImageName":           "the image reference is invalid",
+	"CrashLoopBackOff":           "the container keeps exiting: check its logs (kubectl logs --previous)",
+	"CreateContainerConfigError": "check the configmaps and secrets the pod references (e.g., --volume)",
+	"CreateContainerError":       "the container could not be created: check the pod events (kubectl describe pod)",
+	"RunContainerError":          "the container could not be started: check the pod events (kubectl describe pod)",
+	"FailedScheduling":           "no node fits the pod: check the affinities (--client-affinity, --server-affinity, --benchmark-node-label, and --allow-control-plane on single-node clusters), the taints of the nodes (--benchmark-node-toleration), and their capacity",
+	"FailedCreatePodSandBox":     "the pod network could not be set up: check the CNI (and --network-attachment)",
+}
+
+// diagnosePod returns the problem of a pod, given its (kubectl custom-columns)
+// phase, ready state, container restart counts, exit codes, and waiting
+// reasons, and its latest warning event ("<reason> <message>", empty for
+// none). It returns nil if the pod is fine.
+func diagnosePod(object, phase, ready, restarts, exitCodes, waiting, event string) *Finding {
+	if phase == "Succeeded" || (phase == "Running" && ready == "true" && !podFailed(phase, restarts, exitCodes, waiting)) {
+		return nil
+	}
+
+	evReason, evMsg, _ := strings.Cut(event, " ")
+	reason := ""
+	for _, r := range strings.Split(waiting, ",") {
+		if r != "<none>" && r != "" {
+			reason = r
+			break
+		}
+	}
+	if reason == "" {
+		reason = evReason
+	}
+
+	problem := fmt.Sprintf("pod is %s", phase)
+	switch {
+	case phase == "Running" && ready != "true" && reason == "":
+		problem = "pod is running, but not ready"
+	case reason != "":
+		problem = fmt.Sprintf("pod is %s (%s)", phase, reason)
+	}
+	if evMsg != "" {
+		problem = fmt.Sprintf("%s: %s", problem, evMsg)
+	}
+
+	hint, ok := podReasonHints[reason]
+	if !ok {
+		hint = "check the pod events (kubectl describe pod)"
+		if phase == "Failed" || podFailed(phase, restarts, exitCodes, waiting) {
+			hint = "the pod failed: check its logs (kubectl logs)"
+		}
+	}
+	return &Finding{Object: object, Problem: problem, Hint: hint}
+}
+
+// latestWarningEvent returns the latest warning event of a pod, as
+// "<reason> <message>" (empty for none)
+func latestWarningEvent(ctx context.Context, ns, pod string) string {
+	cmd := fmt.Sprintf(
+		`kubectl get events%s --field-selector involvedObject.kind=Pod,involvedObject.name=%s,type=Warning --sort-by=.lastTimestamp -o custom-columns=Reason:.reason,Msg:.message --no-headers`,
+		nsArg(ns), pod,
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(strings.Fields(lines[len(lines)-1]), " ")
+}
+
+// podStatusColumns are the columns used to diagnose a pod (see diagnosePod)
+var podStatusColumns = strings.Join([]string{
+	"NS:.metadata.namespace",
+	"Name:.metadata.name",
+	"Node:.spec.nodeName",
+	"Phase:.status.phase",
+	"Ready:.status.containerStatuses[0].ready",
+	"Restarts:.status.containerStatuses[*].restartCount",
+	"Exit:.status.containerStatuses[*].state.terminated.exitCode",
+	"Waiting:.status.containerStatuses[*].state.waiting.reason",
+}, ",")
+
+// diagnosedPod is a pod checked by diagnosePods
+type diagnosedPod struct {
+	object string // pod/<namespace>/<name>
+	node   string
+	failed bool
+}
+
+// diagnosePods diagnoses the pods selected by a label selector (in all
+// namespaces), and returns their problems
+func diagnosePods(ctx context.Context, selector string) ([]Finding, []diagnosedPod, error) {
+	cmd := fmt.Sprintf(`kubectl get pods -A -l "%s" -o custom-columns=%s --no-headers`, selector, podStatusColumns)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("command %q failed: %w", cmd, err)
+	}
+
+	findings := []Finding{}
+	pods := []diagnosedPod{}
+	for _, line := range lines {
+		a := strings.Fields(line)
+		if len(a) != 8 {
+			continue
+		}
+		ns, name, phase := a[0], a[1], a[3]
+		pod := diagnosedPod{object: fmt.Sprintf("pod/%s/%s", ns, name), node: a[2]}
+		event := ""
+		if phase != "Succeeded" && (phase != "Running" || a[4] != "true") {
+			event = latestWarningEvent(ctx, ns, name)
+		}
+		if f := diagnosePod(pod.object, phase, a[4], a[5], a[6], a[7], event); f != nil {
+			findings = append(findings, *f)
+			pod.failed = true
+		}
+		pods = append(pods, pod)
+	}
+	return findings, pods, nil
+}
+
+// diagnoseMonitor checks that the monitor daemonset runs, that its pods are
+// ready, and that they can be reached (via port-forwarding, the proxy, or
+// the node address, depending on the session)
+func (s *Session) diagnoseMonitor(ctx context.Context) ([]Finding, error) {
+	errs, err := s.monitorAdmissionErrors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		hint := "the monitor pods are rejected: check the admission policies (privileged pods), or use --monitor-sidecar or --monitor-optional"
+		if errs[0] == "monitor daemonset not found" {
+			hint = "the monitor is not deployed: run init (or use --no-monitor)"
+			if s.UseExistingMonitor() {
+				hint = "the shared monitor is not deployed: run monitor deploy"
+			}
+		}
+		return []Finding{{Object: "daemonset/" + s.monitorDaemonset(), Problem: errs[len(errs)-1], Hint: hint}}, nil
+	}
+
+	findings, pods, err := diagnosePods(ctx, s.monitorLabel("=")+","+monitorSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		if pod.failed || pod.node == "<none>" {
+			continue
+		}
+		if err := s.pingMonitor(ctx, pod.node); err != nil {
+			f := Finding{Object: "node/" + pod.node, Problem: fmt.Sprintf("monitor unreachable: %s", err)}
+			switch {
+			case s.portForward:
+				f.Hint = "port-forwarding to the monitor pod failed: check kubectl port-forward access"
+			case s.monitorProxy != nil:
+				f.Hint = "check that the monitor proxy (--monitor-proxy) can reach the node address"
+			default:
+				f.Hint = fmt.Sprintf("the node address (%s) is not reachable from here: use --port-forward, --monitor-proxy, or a different --node-address-type", s.nodeAddrType)
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+// pingMonitor checks that the monitor of a node answers (a GetNetStats call)
+func (s *Session) pingMonitor(ctx context.Context, node string) error {
+	ctx, cancel := context.WithTimeout(ctx, doctorDialTimeout)
+	defer cancel()
+
+	conn, err := s.DialMonitor(ctx, node)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = pb.NewKubebenchMonitorClient(conn).GetNetStats(ctx, &pb.Empty{})
+	return err
+}
+
+// sessionRuns returns the run ids of the session (its run directories)
+func (s *Session) sessionRuns() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, e := range entries {
+		// NB: the latest symlink (see updateLatest) is not a directory entry
+		if e.IsDir() && labelNameRegEx.MatchString(e.Name()) {
+			ret = append(ret, e.Name())
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Diagnose inspects the live resources of the session, and returns their
+// problems: monitor pods that are not ready (and why), monitors that cannot
+// be reached, and benchmark pods that are pending or failing (with the reason
+// from their container states or events).
+func (s *Session) Diagnose(ctx context.Context) ([]Finding, error) {
+	findings := []Finding{}
+	if s.MonitorEnabled() && !s.monitorSidecar {
+		fs, err := s.diagnoseMonitor(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("diagnosing the monitor failed: %w", err)
+		}
+		findings = append(findings, fs...)
+	}
+
+	runs, err := s.sessionRuns()
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return findings, nil
+	}
+	selector := fmt.Sprintf("%s in (%s)", s.labelKey(runIdLabel), strings.Join(runs, ","))
+	fs, pods, err := diagnosePods(ctx, selector)
+	if err != nil {
+		return nil, fmt.Errorf("diagnosing the benchmark pods failed: %w", err)
+	}
+	logger().Info("diagnosed benchmark pods", "pods", len(pods))
+	return append(findings, fs...), nil
+}
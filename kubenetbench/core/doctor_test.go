@@ -0,0 +1,32 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnosePod(t *testing.T) {
+	if f := diagnosePod("pod/ns/cli", "Running", "true", "0", "<none>", "<none>", ""); f != nil {
+		t.Errorf("unexpected finding for a running pod: %s", f)
+	}
+	if f := diagnosePod("pod/ns/cli", "Succeeded", "false", "0", "0", "<none>", ""); f != nil {
+		t.Errorf("unexpected finding for a completed pod: %s", f)
+	}
+
+	f := diagnosePod("pod/ns/srv", "Pending", "<none>", "<none>", "<none>", "<none>",
+		"FailedScheduling 0/3 nodes are available: 3 node(s) had untolerated taint")
+	if f == nil {
+		t.Fatal("expected a finding for an unschedulable pod")
+	}
+	if f.Problem != "pod is Pending (FailedScheduling): 0/3 nodes are available: 3 node(s) had untolerated taint" {
+		t.Errorf("unexpected problem: %s", f.Problem)
+	}
+	if !strings.Contains(f.Hint, "--benchmark-node-toleration") {
+		t.Errorf("unexpected hint: %s", f.Hint)
+	}
+
+	f = diagnosePod("pod/ns/cli", "Running", "false", "4", "<none>", "CrashLoopBackOff", "BackOff Back-off restarting failed container")
+	if f == nil || f.Hint != podReasonHints["CrashLoopBackOff"] {
+		t.Errorf("unexpected finding for a crashing pod: %v", f)
+	}
+}
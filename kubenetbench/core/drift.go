@@ -0,0 +1,261 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// driftSysctlPrefixes are the sysctls that are compared against the baseline
+// (see CompareSysInfo)
+var driftSysctlPrefixes = []string{
+	"net.core.",
+	"net.ipv4.tcp_",
+	"net.ipv4.udp_",
+	"net.ipv4.ip_",
+	"net.ipv6.ip_",
+	"net.netfilter.nf_conntrack_max",
+	"net.netfilter.nf_conntrack_buckets",
+}
+
+// driftSysctlIgnore are sysctls that match driftSysctlPrefixes, but change
+// without a configuration change (e.g., random keys)
+var driftSysctlIgnore = map[string]struct{}{
+	"net.core.netdev_rss_key":   {},
+	"net.ipv4.tcp_fastopen_key": {},
+}
+
+// SysInfoDiff is a difference between the system information of a node and
+// its baseline
+type SysInfoDiff struct {
+	Node     string
+	Key      string // e.g., kernel.release, sysctl.net.core.rmem_max, offload.eth0.tso
+	Baseline string // empty if missing
+	Current  string // empty if missing
+}
+
+func (d SysInfoDiff) String() string {
+	return fmt.Sprintf("%s: %s: baseline=%q current=%q", d.Node, d.Key, d.Baseline, d.Current)
+}
+
+// parseKernelRelease returns the kernel release from the kernel section
+// (uname -a output)
+func parseKernelRelease(rd io.Reader) (map[string]string, error) {
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[0] == "Linux" {
+			ret["kernel.release"] = fields[2]
+			break
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// parseSysctls returns the network tunables from the sysctls section
+// (sysctl -a output)
+func parseSysctls(rd io.Reader) (map[string]string, error) {
+	ret := make(map[string]string)
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), " = ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := kv[0]
+		if _, ok := driftSysctlIgnore[key]; ok {
+			continue
+		}
+		for _, p := range driftSysctlPrefixes {
+			if strings.HasPrefix(key, p) {
+				ret["sysctl."+key] = strings.Join(strings.Fields(kv[1]), " ")
+				break
+			}
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// parseOffloads returns the NIC offload settings from the offloads section
+// (ethtool -k output)
+func parseOffloads(rd io.Reader) (map[string]string, error) {
+	ret := make(map[string]string)
+	dev := ""
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Features for ") {
+			dev = strings.TrimSuffix(strings.TrimPrefix(line, "Features for "), ":")
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(line), ": ", 2)
+		if dev == "" || len(kv) != 2 || strings.HasPrefix(line, "+") {
+			continue
+		}
+		// ignore annotations such as [fixed]
+		val := strings.Fields(kv[1])
+		if len(val) == 0 {
+			continue
+		}
+		ret[fmt.Sprintf("offload.%s.%s", dev, kv[0])] = val[0]
+	}
+	return ret, scanner.Err()
+}
+
+// sysInfoDriftParsers are the sysinfo sections that are compared against the
+// baseline, and their parsers
+var sysInfoDriftParsers = map[string]func(io.Reader) (map[string]string, error){
+	"kernel":   parseKernelRelease,
+	"sysctls":  parseSysctls,
+	"offloads": parseOffloads,
+}
+
+// loadSysInfoKeys loads the compared values from a node's sysinfo directory
+func loadSysInfoKeys(dir string) (map[string]string, error) {
+	return loadSysInfoSections(dir, sysInfoDriftParsers)
+}
+
+// loadSysInfoSections parses the sections of a node's sysinfo directory
+// (missing sections are skipped)
+func loadSysInfoSections(dir string, parsers map[string]func(io.Reader) (map[string]string, error)) (map[string]string, error) {
+	ret := make(map[string]string)
+	for section, parse := range parsers {
+		f, err := os.Open(filepath.Join(dir, section+".txt"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		vals, err := parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s section in %s: %w", section, dir, err)
+		}
+		for k, v := range vals {
+			ret[k] = v
+		}
+	}
+	return ret, nil
+}
+
+// CompareSysInfo compares the system information of a node (directory with
+// per-section files, see GetSysInfoNode) with a baseline. Offloads are only
+// compared for devices that exist in both (e.g., pod veths have random
+// names).
+func CompareSysInfo(node, baselineDir, dir string) ([]SysInfoDiff, error) {
+	base, err := loadSysInfoKeys(baselineDir)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := loadSysInfoKeys(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	devs := func(m map[string]string) map[string]struct{} {
+		ret := make(map[string]struct{})
+		for k := range m {
+			if strings.HasPrefix(k, "offload.") {
+				ret[strings.SplitN(k, ".", 3)[1]] = struct{}{}
+			}
+		}
+		return ret
+	}
+	baseDevs, curDevs := devs(base), devs(cur)
+	skip := func(k string) bool {
+		if !strings.HasPrefix(k, "offload.") {
+			return false
+		}
+		dev := strings.SplitN(k, ".", 3)[1]
+		_, inBase := baseDevs[dev]
+		_, inCur := curDevs[dev]
+		return !inBase || !inCur
+	}
+
+	keys := make(map[string]struct{})
+	for k := range base {
+		keys[k] = struct{}{}
+	}
+	for k := range cur {
+		keys[k] = struct{}{}
+	}
+
+	ret := []SysInfoDiff{}
+	for k := range keys {
+		if skip(k) || base[k] == cur[k] {
+			continue
+		}
+		ret = append(ret, SysInfoDiff{Node: node, Key: k, Baseline: base[k], Current: cur[k]})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret, nil
+}
+
+// isSysInfoDir returns true if dir contains (sectioned) node system information
+func isSysInfoDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "kernel.txt"))
+	return err == nil
+}
+
+// CheckSysInfoBaseline compares the system information of the session's
+// nodes with a baseline, which is either a session directory (nodes are
+// compared with the node of the same name) or the sysinfo directory of a
+// single node (all nodes are compared with it). The differences are also
+// written to sysinfo-drift.txt in the session directory.
+func (s *Session) CheckSysInfoBaseline(baseline string) ([]SysInfoDiff, error) {
+	single := isSysInfoDir(baseline)
+	if !single {
+		if fi, err := os.Stat(baseline); err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("invalid sysinfo baseline %q: not a directory", baseline)
+		}
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []SysInfoDiff{}
+	nodes := 0
+	for _, e := range entries {
+		dir := filepath.Join(s.dir, e.Name())
+		if !e.IsDir() || !isSysInfoDir(dir) {
+			continue
+		}
+		nodes++
+
+		baseDir := baseline
+		if !single {
+			baseDir = filepath.Join(baseline, e.Name())
+			if !isSysInfoDir(baseDir) {
+				logger().Warn("node not in sysinfo baseline", "node", e.Name(), "baseline", baseline)
+				continue
+			}
+		}
+
+		nodeDiffs, err := CompareSysInfo(e.Name(), baseDir, dir)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, nodeDiffs...)
+	}
+	if nodes == 0 {
+		return nil, fmt.Errorf("no node sysinfo in session directory %s", s.dir)
+	}
+
+	fname := filepath.Join(s.dir, "sysinfo-drift.txt")
+	f, err := os.Create(fname)
+	if err != nil {
+		return diffs, err
+	}
+	defer f.Close()
+	for _, d := range diffs {
+		fmt.Fprintln(f, d)
+	}
+	return diffs, nil
+}
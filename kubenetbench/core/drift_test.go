@@ -0,0 +1,53 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSysInfo(t *testing.T, dir string, sections map[string]string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range sections {
+		if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompareSysInfo(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "base")
+	cur := filepath.Join(t.TempDir(), "cur")
+	writeSysInfo(t, base, map[string]string{
+		"kernel":   "+ uname -a\nLinux k8s1 5.15.0-1 #1 SMP x86_64 GNU/Linux\n",
+		"sysctls":  "+ sysctl -a\nnet.core.rmem_max = 212992\nnet.ipv4.tcp_rmem = 4096\t131072\t6291456\nnet.core.netdev_rss_key = aa:bb\nvm.swappiness = 60\n",
+		"offloads": "Features for eth0:\nrx-checksumming: on\ntcp-segmentation-offload: on\n\ttx-tcp-segmentation: on\nFeatures for lxc123:\ngro: on\n",
+	})
+	writeSysInfo(t, cur, map[string]string{
+		"kernel":   "+ uname -a\nLinux k8s1 6.1.0-1 #1 SMP x86_64 GNU/Linux\n",
+		"sysctls":  "+ sysctl -a\nnet.core.rmem_max = 212992\nnet.ipv4.tcp_rmem = 4096 131072 6291456\nnet.core.netdev_rss_key = cc:dd\nvm.swappiness = 10\nnet.ipv4.tcp_congestion_control = bbr\n",
+		"offloads": "Features for eth0:\nrx-checksumming: on\ntcp-segmentation-offload: off\n\ttx-tcp-segmentation: off [requested on]\nFeatures for lxc456:\ngro: off\n",
+	})
+
+	diffs, err := CompareSysInfo("k8s1", base, cur)
+	if err != nil {
+		t.Fatalf("CompareSysInfo failed: %s", err)
+	}
+
+	expected := []string{
+		"kernel.release",
+		"offload.eth0.tcp-segmentation-offload",
+		"offload.eth0.tx-tcp-segmentation",
+		"sysctl.net.ipv4.tcp_congestion_control",
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("got diffs %v while expected keys %v", diffs, expected)
+	}
+	for i, d := range diffs {
+		if d.Key != expected[i] {
+			t.Errorf("got diff %s while expected key %s", d, expected[i])
+		}
+	}
+}
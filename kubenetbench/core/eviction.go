@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// ErrEndpointEvicted is returned (wrapped) by runs whose client or server pods
+// were evicted or deleted during the measurement window (e.g., because their
+// node was drained by the cluster autoscaler, or a spot instance was
+// reclaimed). The results of such runs are partial, and are not recorded.
+var ErrEndpointEvicted = errors.New("endpoint evicted during measurement")
+
+// evictionPollInterval is the interval at which the run pods are checked for
+// evictions during the measurement window
+var evictionPollInterval = 10 * time.Second
+
+// evictionLogFname is the file that the events of evicted pods (and of their
+// nodes) are stored in
+const evictionLogFname = "eviction.log"
+
+// runPod is a pod of the run, as recorded at the start of the measurement
+type runPod struct {
+	Name      string
+	Namespace string
+	UID       string
+	Node      string
+}
+
+// evictionFields are the pod fields used to detect evictions (see evictedPods)
+var evictionFields = []string{PodName, PodNamespace, PodUID, PodNodeName, PodPhase, PodReason, PodDeletionTimestamp}
+
+// getRunPods returns the current pods of the run, as (name, namespace, uid,
+// node, phase, reason, deletion timestamp) fields
+func (r *RunBenchCtx) getRunPods() ([][]string, error) {
+	lines, err := r.KubeGetPods__(evictionFields)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([][]string, 0, len(lines))
+	for _, l := range lines {
+		if len(l) == len(evictionFields) {
+			ret = append(ret, l)
+		}
+	}
+	return ret, nil
+}
+
+// evictionPods returns the pods to watch for evictions, given the lines of
+// getRunPods
+func evictionPods(lines [][]string) []runPod {
+	pods := make([]runPod, 0, len(lines))
+	for _, l := range lines {
+		pods = append(pods, runPod{Name: l[0], Namespace: l[1], UID: l[2], Node: l[3]})
+	}
+	return pods
+}
+
+// evictedPods returns the pods (of the start of the measurement) that were
+// evicted, given the current lines of getRunPods. A pod was evicted if it no
+// longer exists (e.g., it was deleted, or replaced by its deployment), if it
+// is being deleted (e.g., kubectl drain), or if it failed for a pod-level
+// reason (e.g., Evicted on node pressure, or NodeShutdown). Pods whose
+// containers fail have no such reason.
+func evictedPods(pods []runPod, lines [][]string) []runPod {
+	current := make(map[string][]string, len(lines))
+	for _, l := range lines {
+		current[l[2]] = l
+	}
+
+	evicted := []runPod{}
+	for _, p := range pods {
+		l, ok := current[p.UID]
+		switch {
+		case !ok:
+		case l[6] != "<none>":
+		case l[4] == "Failed" && l[5] != "<none>":
+		default:
+			continue
+		}
+		evicted = append(evicted, p)
+	}
+	return evicted
+}
+
+// evictionError returns the error of a run whose pods were evicted
+func evictionError(evicted []runPod) error {
+	names := make([]string, 0, len(evicted))
+	for _, p := range evicted {
+		names = append(names, fmt.Sprintf("%s (node %s)", p.Name, p.Node))
+	}
+	return fmt.Errorf("%w: %s", ErrEndpointEvicted, strings.Join(names, ", "))
+}
+
+// checkEvictions checks the pods for evictions. It returns an
+// ErrEndpointEvicted error, after recording the evicted pods, if any pod was
+// evicted.
+func (r *RunBenchCtx) checkEvictions(pods []runPod) error {
+	lines, err := r.getRunPods()
+	if err != nil {
+		// e.g., the API server is unreachable: retried on the next check
+		logger().Debug("failed to get the run pods", "error", err)
+		return nil
+	}
+	evicted := evictedPods(pods, lines)
+	if len(evicted) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for _, p := range evicted {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	r.addMeta("EVICTED", strings.Join(names, ","))
+	if err := r.saveEvictionEvents(evicted); err != nil {
+		logger().Warn("failed to save the eviction events", "error", err)
+	}
+	return evictionError(evicted)
+}
+
+// saveEvictionEvents stores the events of evicted pods, and of their nodes
+// (e.g., the node being cordoned or removed), in the run directory
+func (r *RunBenchCtx) saveEvictionEvents(evicted []runPod) error {
+	f, err := os.Create(fmt.Sprintf("%s/%s", r.getDir(), evictionLogFname))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	nodes := map[string]bool{}
+	cmds := []string{}
+	for _, p := range evicted {
+		cmds = append(cmds, fmt.Sprintf(
+			"kubectl get events%s --field-selector involvedObject.kind=Pod,involvedObject.name=%s -o wide",
+			nsArg(p.Namespace), p.Name,
+		))
+		if p.Node != "<none>" && !nodes[p.Node] {
+			nodes[p.Node] = true
+			cmds = append(cmds, fmt.Sprintf(
+				"kubectl get events -A --field-selector involvedObject.kind=Node,involvedObject.name=%s -o wide",
+				p.Node,
+			))
+		}
+	}
+	for _, cmd := range cmds {
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLines(cmd)
+		fmt.Fprintf(f, "$ %s\n", cmd)
+		if err != nil {
+			fmt.Fprintf(f, "error: %s\n", err)
+		}
+		for _, l := range lines {
+			fmt.Fprintln(f, l)
+		}
+		fmt.Fprintln(f)
+	}
+	return nil
+}
+
+// watchEvictions watches the run pods for evictions during the measurement.
+// On an eviction, abort is called with the ErrEndpointEvicted error, so that
+// the measurement is aborted. The returned function stops watching, and
+// returns the eviction error, if any (checking the pods a last time, e.g., for
+// a client that was evicted just before it was found to have failed).
+func (r *RunBenchCtx) watchEvictions(abort context.CancelCauseFunc) func() error {
+	lines, err := r.getRunPods()
+	if err != nil {
+		logger().Warn("failed to get the run pods: not watching for evictions", "error", err)
+		return func() error { return nil }
+	}
+	pods := evictionPods(lines)
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				done <- r.checkEvictions(pods)
+				return
+			case <-time.After(evictionPollInterval):
+			}
+			if err := r.checkEvictions(pods); err != nil {
+				logger().Warn("aborting run", "error", err)
+				abort(err)
+				done <- err
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(stop)
+		return <-done
+	}
+}
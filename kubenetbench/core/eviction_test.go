@@ -0,0 +1,59 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvictedPods(t *testing.T) {
+	start := [][]string{
+		{"knb-cli", "default", "uid-cli", "node-a", "Running", "<none>", "<none>"},
+		{"knb-srv-1", "default", "uid-srv-1", "node-b", "Running", "<none>", "<none>"},
+		{"knb-srv-2", "default", "uid-srv-2", "node-c", "Running", "<none>", "<none>"},
+	}
+	pods := evictionPods(start)
+
+	if evicted := evictedPods(pods, start); len(evicted) != 0 {
+		t.Errorf("unexpected evictions: %v", evicted)
+	}
+
+	// the client failing (or completing) is not an eviction
+	failed := [][]string{
+		{"knb-cli", "default", "uid-cli", "node-a", "Failed", "<none>", "<none>"},
+		start[1], start[2],
+	}
+	if evicted := evictedPods(pods, failed); len(evicted) != 0 {
+		t.Errorf("unexpected evictions: %v", evicted)
+	}
+
+	cases := map[string][][]string{
+		"node pressure": {
+			{"knb-cli", "default", "uid-cli", "node-a", "Failed", "Evicted", "<none>"},
+			start[1], start[2],
+		},
+		"drain": {
+			{"knb-cli", "default", "uid-cli", "node-a", "Running", "<none>", "2024-01-01T00:00:00Z"},
+			start[1], start[2],
+		},
+		"deleted": {start[1], start[2]},
+		"replaced": {
+			{"knb-cli", "default", "uid-cli-2", "node-d", "Pending", "<none>", "<none>"},
+			start[1], start[2],
+		},
+	}
+	for name, lines := range cases {
+		evicted := evictedPods(pods, lines)
+		if len(evicted) != 1 || evicted[0].Name != "knb-cli" || evicted[0].Node != "node-a" {
+			t.Errorf("%s: unexpected evictions: %v", name, evicted)
+		}
+	}
+
+	err := evictionError(evictedPods(pods, [][]string{start[0]}))
+	if !errors.Is(err, ErrEndpointEvicted) {
+		t.Errorf("expected ErrEndpointEvicted, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "knb-srv-1 (node node-b), knb-srv-2 (node node-c)") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
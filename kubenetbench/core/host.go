@@ -1,14 +1,22 @@
 package core
 
 import (
+	"fmt"
+
 	"github.com/cilium/kubenetbench/utils"
 )
 
+// hostOptsWrite writes the host options of a pod: host namespaces, and the
+// runtime class (i.e., how the pod is hosted, e.g., sandboxed by gVisor)
 func (s *ContainerSpec) hostOptsWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
 	l := func(s string) {
 		pw.AppendNewLineOrDie(s)
 	}
 
+	if s.RuntimeClass != "" {
+		l(fmt.Sprintf(`runtimeClassName: %s`, s.RuntimeClass))
+	}
+
 	if s.HostNetwork {
 		l(`hostNetwork: true`)
 	}
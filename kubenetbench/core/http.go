@@ -0,0 +1,244 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// HTTPConf is an HTTP benchmark: the server is a minimal HTTP server
+// (http-echo) and the client uses wrk to measure request rate and latency.
+//
+// With TLS, the server is nginx terminating TLS (HTTPS). With mTLS, the
+// server also verifies client certificates, and, since wrk does not support
+// them, the client sends its requests via a local nginx proxy that originates
+// mTLS (similarly to a service mesh sidecar).
+//
+// With the PROXY protocol, the server is nginx expecting a PROXY protocol
+// header on each connection, and the client connects via a local HAProxy
+// that prepends it (similarly to an L4 load balancer).
+type HTTPConf struct {
+	Timeout       int
+	Port          uint16 // server port
+	Connections   int    // wrk connections
+	Threads       int    // wrk threads
+	TLS           string // TLS mode (empty for plaintext, see TLSModes)
+	TLSSecret     string // kubernetes.io/tls secret to use (empty to generate one)
+	ProxyProtocol string // PROXY protocol version (empty for none, see ProxyProtocolVersions)
+}
+
+// HTTPConfDefault returns an HTTPConf with the default values
+func HTTPConfDefault() HTTPConf {
+	return HTTPConf{
+		Timeout:     60,
+		Port:        8080,
+		Connections: 16,
+		Threads:     2,
+	}
+}
+
+// prefix of the client output lines that contain the response headers
+const httpHeaderPrefix = "KNB_HDR "
+
+// GetTimeout returns the benchmark timeout
+func (cnf *HTTPConf) GetTimeout() int {
+	return cnf.Timeout
+}
+
+// WriteSrvContainerYaml writes the server yaml
+func (cnf *HTTPConf) WriteSrvContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if cnf.TLS != "" || cnf.ProxyProtocol != "" {
+		cnf.writeNginxSrvContainerYaml(pw)
+		return
+	}
+
+	pw.AppendNewLineOrDie(`name: http-srv`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, httpEchoImage))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`args: ["-listen=:%d", "-text=kubenetbench"]`, cnf.Port))
+}
+
+// WriteCliContainerYaml writes the client yaml.
+// Besides serverIP, params may include httpPort (the port to connect to, if
+// different than the server port) and httpHost (the Host header to use).
+func (cnf *HTTPConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	serverIP, ok := params["serverIP"]
+	if !ok {
+		panic("serverIP undefined")
+	}
+
+	port := fmt.Sprintf("%d", cnf.Port)
+	if p, ok := params["httpPort"]; ok {
+		port = fmt.Sprintf("%v", p)
+	}
+
+	hostArg := ""
+	if h, ok := params["httpHost"]; ok && h != "" {
+		hostArg = fmt.Sprintf(` -H "Host: %v"`, h)
+	}
+
+	pw.AppendNewLineOrDie(`name: http-cli`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, paramBenchImage(params)))
+	pw.AppendNewLineOrDie(`command: ["bash", "-c"]`)
+	pw.AppendNewLineOrDie(`args:`)
+	pw.AppendNewLineOrDie(`- |`)
+	pw.PushPrefix("  ")
+	addr := fmt.Sprintf("%v:%s", serverIP, port)
+	if cnf.ProxyProtocol != "" {
+		// wrk -> local proxy -> (PROXY protocol header) -> server
+		writeProxyProtocolProxy(pw, addr, cnf.ProxyProtocol)
+		addr = fmt.Sprintf("127.0.0.1:%d", proxyProtocolPort)
+	}
+	switch cnf.TLS {
+	case "":
+		pw.AppendNewLineOrDie(fmt.Sprintf(`url=http://%s/`, addr))
+	case "tls":
+		pw.AppendNewLineOrDie(fmt.Sprintf(`url=https://%s/`, addr))
+	case "mtls":
+		// wrk -> local proxy -> (mTLS) -> server
+		writeMTLSProxy(pw, addr)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`url=http://127.0.0.1:%d/`, mtlsProxyPort))
+	}
+	// wait until the server (e.g., via the ingress) is reachable
+	pw.AppendNewLineOrDie(`ready=0`)
+	pw.AppendNewLineOrDie(`for i in $(seq 1 60); do`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  if curl -k -s -o /dev/null -D /tmp/hdrs%s "$url" && head -1 /tmp/hdrs | grep -q " 200"; then`, hostArg))
+	pw.AppendNewLineOrDie(`    ready=1; break`)
+	pw.AppendNewLineOrDie(`  fi`)
+	pw.AppendNewLineOrDie(`  sleep 1`)
+	pw.AppendNewLineOrDie(`done`)
+	pw.AppendNewLineOrDie(`if [ $ready = 0 ]; then echo "$url not reachable"; exit 1; fi`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`tr -d '\r' < /tmp/hdrs | sed 's/^/%s/'`, httpHeaderPrefix))
+	if cnf.TLS != "" {
+		writeTLSInfo(pw, addr, cnf.TLS == "mtls")
+	}
+	pw.AppendNewLineOrDie(fmt.Sprintf(`wrk -t %d -c %d -d %ds --latency%s "$url"`, cnf.Threads, cnf.Connections, cnf.Timeout, hostArg))
+	pw.PopPrefix()
+}
+
+// WriteSrvPortsYaml writes the ports part of yaml (e.g., for services)
+func (cnf *HTTPConf) WriteSrvPortsYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	pw.AppendNewLineOrDie(`- name: http`)
+	pw.AppendNewLineOrDie(`  protocol: TCP`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  port: %d`, cnf.Port))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  targetPort: %d`, cnf.Port))
+}
+
+var (
+	wrkLatencyRegEx   = regexp.MustCompile(`^\s*Latency\s+([\d.]+\w+)\s+([\d.]+\w+)\s+([\d.]+\w+)`)
+	wrkPercentRegEx   = regexp.MustCompile(`^\s*(50|75|90|99)(?:\.0+)?%\s+([\d.]+\w+)`)
+	wrkRequestsRegEx  = regexp.MustCompile(`^\s*(\d+) requests in`)
+	wrkSockErrRegEx   = regexp.MustCompile(`^\s*Socket errors: connect (\d+), read (\d+), write (\d+), timeout (\d+)`)
+	wrkNon2xxRegEx    = regexp.MustCompile(`^\s*Non-2xx or 3xx responses: (\d+)`)
+	wrkReqPerSecRegEx = regexp.MustCompile(`^Requests/sec:\s+([\d.]+)`)
+	tlsInfoRegEx      = regexp.MustCompile(`^(TLS_VERSION|TLS_CIPHER)=(.+)$`)
+)
+
+// wrkDurationUs converts a wrk duration (e.g., 1.23ms) to microseconds
+func wrkDurationUs(s string) (float64, error) {
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"us", 1},
+		{"ms", 1e3},
+		{"m", 60e6},
+		{"s", 1e6},
+		{"h", 3600e6},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+			return v * u.mult, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown duration: %s", s)
+}
+
+// ParseResult parses the wrk output of the client. Latencies are in
+// microseconds, and TRANSACTION_RATE is in requests/sec. For TLS, TLS_VERSION
+// and TLS_CIPHER are the negotiated version and cipher suite. For the PROXY
+// protocol, PROXY_HEADER_BYTES_ESTIMATE is the per-connection overhead of its
+// header, computed (not measured) from the expected header.
+func (cnf *HTTPConf) ParseResult(runid string, rd io.Reader) (*BenchResult, error) {
+	res := &BenchResult{
+		RunID:  runid,
+		Values: make(map[string]string),
+		Meta:   make(map[string]string),
+		Tags:   make(map[string]string),
+	}
+
+	setUs := func(key, val string) {
+		us, err := wrkDurationUs(val)
+		if err == nil {
+			res.Values[key] = fmt.Sprintf("%.2f", us)
+		}
+	}
+
+	var errors uint64
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := wrkLatencyRegEx.FindStringSubmatch(line); m != nil {
+			setUs("MEAN_LATENCY", m[1])
+			setUs("STDDEV_LATENCY", m[2])
+			setUs("MAX_LATENCY", m[3])
+		} else if m := wrkPercentRegEx.FindStringSubmatch(line); m != nil {
+			setUs(fmt.Sprintf("P%s_LATENCY", m[1]), m[2])
+		} else if m := wrkRequestsRegEx.FindStringSubmatch(line); m != nil {
+			res.Values["HTTP_REQUESTS"] = m[1]
+		} else if m := wrkSockErrRegEx.FindStringSubmatch(line); m != nil {
+			for _, s := range m[1:] {
+				n, _ := strconv.ParseUint(s, 10, 64)
+				errors += n
+			}
+		} else if m := wrkNon2xxRegEx.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.ParseUint(m[1], 10, 64)
+			errors += n
+		} else if m := wrkReqPerSecRegEx.FindStringSubmatch(line); m != nil {
+			res.Values["TRANSACTION_RATE"] = m[1]
+		} else if m := tlsInfoRegEx.FindStringSubmatch(line); m != nil {
+			res.Values[m[1]] = m[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := res.Values["TRANSACTION_RATE"]; !ok {
+		return nil, fmt.Errorf("no wrk results found")
+	}
+	res.Values["HTTP_ERRORS"] = fmt.Sprintf("%d", errors)
+	if cnf.ProxyProtocol != "" {
+		res.Values["PROXY_HEADER_BYTES_ESTIMATE"] = fmt.Sprintf("%d", proxyProtocolHeaderLen(cnf.ProxyProtocol))
+	}
+	return res, nil
+}
+
+// parseHTTPHeaders returns the response headers in the client output
+func parseHTTPHeaders(rd io.Reader) (http.Header, error) {
+	hdrs := make(http.Header)
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, httpHeaderPrefix) {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(line, httpHeaderPrefix), ":", 2)
+		if len(kv) != 2 {
+			continue // status line
+		}
+		key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(kv[0]))
+		hdrs.Add(key, strings.TrimSpace(kv[1]))
+	}
+	return hdrs, scanner.Err()
+}
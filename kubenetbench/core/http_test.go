@@ -0,0 +1,104 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+var wrkTestOutput = `KNB_HDR HTTP/1.1 200 OK
+TLS_VERSION=TLSv1.3
+TLS_CIPHER=TLS_AES_256_GCM_SHA384
+KNB_HDR server: envoy
+KNB_HDR x-envoy-upstream-service-time: 1
+Running 30s test @ http://10.0.0.1:80/
+  2 threads and 16 connections
+  Thread Stats   Avg      Stdev     Max   +/- Stdev
+    Latency     1.50ms  500.00us  20.00ms   90.00%
+    Req/Sec     5.00k   300.00     7.00k    70.00%
+  Latency Distribution
+     50%    1.20ms
+     75%    1.60ms
+     90%    2.00ms
+     99%    4.00ms
+  300000 requests in 30.00s, 40.00MB read
+  Socket errors: connect 0, read 1, write 0, timeout 2
+  Non-2xx or 3xx responses: 3
+Requests/sec:  10000.00
+Transfer/sec:      1.33MB
+`
+
+func TestHTTPParseResult(t *testing.T) {
+	cnf := HTTPConfDefault()
+	res, err := cnf.ParseResult("test", strings.NewReader(wrkTestOutput))
+	if err != nil {
+		t.Fatalf("ParseResult failed: %s", err)
+	}
+
+	for key, expected := range map[string]float64{
+		"MEAN_LATENCY":     1500,
+		"STDDEV_LATENCY":   500,
+		"MAX_LATENCY":      20000,
+		"P50_LATENCY":      1200,
+		"P99_LATENCY":      4000,
+		"HTTP_REQUESTS":    300000,
+		"HTTP_ERRORS":      6,
+		"TRANSACTION_RATE": 10000,
+	} {
+		if v, ok := res.Float(key); !ok || v != expected {
+			t.Errorf("%s: got %s while expected %g", key, res.Values[key], expected)
+		}
+	}
+	if res.Values["TLS_VERSION"] != "TLSv1.3" || res.Values["TLS_CIPHER"] != "TLS_AES_256_GCM_SHA384" {
+		t.Errorf("unexpected TLS info: %q %q", res.Values["TLS_VERSION"], res.Values["TLS_CIPHER"])
+	}
+
+	hdrs, err := parseHTTPHeaders(strings.NewReader(wrkTestOutput))
+	if err != nil {
+		t.Fatalf("parseHTTPHeaders failed: %s", err)
+	}
+	if c := ingressControllerFromHeaders(hdrs); c != "envoy" {
+		t.Errorf("got controller %q while expected envoy", c)
+	}
+}
+
+func TestHTTPProxyProtocol(t *testing.T) {
+	cnf := HTTPConfDefault()
+	cnf.ProxyProtocol = "v3"
+	if err := cnf.ValidateProxyProtocol(); err == nil {
+		t.Errorf("expected an error for an invalid version")
+	}
+	cnf.ProxyProtocol = "v2"
+	if err := cnf.ValidateProxyProtocol(); err != nil {
+		t.Fatal(err)
+	}
+
+	var srv, cli strings.Builder
+	srvPw := utils.NewPrefixWriter(&srv, false)
+	cnf.WriteSrvContainerYaml(srvPw, nil)
+	srvPw.Flush()
+	if !strings.Contains(srv.String(), "listen 8080 proxy_protocol;") {
+		t.Errorf("server does not expect the PROXY protocol:\n%s", srv.String())
+	}
+
+	cliPw := utils.NewPrefixWriter(&cli, false)
+	cnf.WriteCliContainerYaml(cliPw, map[string]interface{}{"serverIP": "10.0.0.1"})
+	cliPw.Flush()
+	for _, s := range []string{"server srv 10.0.0.1:8080 send-proxy-v2", "url=http://127.0.0.1:8081/"} {
+		if !strings.Contains(cli.String(), s) {
+			t.Errorf("client does not include %q:\n%s", s, cli.String())
+		}
+	}
+
+	res, err := cnf.ParseResult("test", strings.NewReader(wrkTestOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Values["PROXY_HEADER_BYTES_ESTIMATE"] != "28" {
+		t.Errorf("unexpected header size: %s", res.Values["PROXY_HEADER_BYTES_ESTIMATE"])
+	}
+	if n := proxyProtocolHeaderLen("v1"); n != 43 {
+		t.Errorf("unexpected v1 header size: %d", n)
+	}
+}
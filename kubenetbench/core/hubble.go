@@ -0,0 +1,162 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// SetHubble enables recording the Hubble flows of the benchmark pods on the
+// run nodes for the benchmark duration (on Cilium clusters with Hubble)
+func (r *RunBenchCtx) SetHubble() {
+	r.hubble = true
+}
+
+// hubbleUnavailable returns why Hubble cannot be used on the cluster (empty
+// if it can): the CNI is not Cilium, or Hubble is not enabled in its
+// configuration
+func hubbleUnavailable() string {
+	if cni := DetectCNI(); cni != "cilium" {
+		if cni == "" {
+			cni = "unknown"
+		}
+		return fmt.Sprintf("the CNI is not cilium (%s)", cni)
+	}
+
+	cmd := "kubectl get configmap -n kube-system cilium-config -o jsonpath='{.data.enable-hubble}'"
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLines(cmd)
+	if err != nil {
+		return fmt.Sprintf("failed to read the cilium configuration: %s", err)
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "true" {
+		return "hubble is not enabled in the cilium configuration"
+	}
+	return ""
+}
+
+// hubbleConfPb sets the hubble flows recording of a collection (if enabled).
+// Flows are selected by the run label, i.e., flows from or to the benchmark
+// pods.
+func (r *RunBenchCtx) hubbleConfPb(conf *pb.CollectionConf) {
+	if !r.hubble {
+		return
+	}
+	conf.HubbleDuration = fmt.Sprintf("%d", r.collectSeconds())
+	conf.HubbleLabel = r.getRunLabel("=")
+}
+
+// hubbleFlow is the part of a flow (as printed by hubble observe -o jsonpb)
+// that is summarized
+type hubbleFlow struct {
+	Flow struct {
+		Verdict        string `json:"verdict"`
+		DropReasonDesc string `json:"drop_reason_desc"`
+	} `json:"flow"`
+}
+
+// hubbleCounts are the number of flows per verdict, and of dropped flows per
+// drop reason
+type hubbleCounts struct {
+	verdicts    map[string]int64
+	dropReasons map[string]int64
+}
+
+// parseHubbleFlows parses the output of scripts/hubble-observe.sh: a JSON
+// object per flow, and "#" lines for notes (e.g., hubble not available on the
+// node), which are returned
+func parseHubbleFlows(r io.Reader, counts *hubbleCounts) ([]string, error) {
+	notes := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			notes = append(notes, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+			continue
+		}
+
+		var f hubbleFlow
+		if err := json.Unmarshal([]byte(line), &f); err != nil {
+			return nil, fmt.Errorf("invalid hubble flow %q: %w", line, err)
+		}
+		if f.Flow.Verdict == "" {
+			// e.g., lost events
+			continue
+		}
+		counts.verdicts[f.Flow.Verdict]++
+		if f.Flow.Verdict == "DROPPED" && f.Flow.DropReasonDesc != "" {
+			counts.dropReasons[f.Flow.DropReasonDesc]++
+		}
+	}
+	return notes, scanner.Err()
+}
+
+// processHubbleFlows summarizes the hubble flows of the collection archives
+// of the run (which include the flows as <runid>-hubble.json): the number of
+// flows per verdict is written in hubble.log (see GetResult), and the drop
+// reasons are logged
+func (r *RunBenchCtx) processHubbleFlows() error {
+	counts := &hubbleCounts{
+		verdicts:    make(map[string]int64),
+		dropReasons: make(map[string]int64),
+	}
+	found := false
+	for _, node := range r.collectNodes {
+		archive := fmt.Sprintf("%s/%s-%s.tar.bz2", r.getDir(), r.collectionName(), node)
+		data, err := readFromArchive(archive, r.runid+"-hubble.json")
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errNotInArchive) {
+			continue
+		} else if err != nil {
+			logger().Warn("reading hubble flows failed", "node", node, "error", err)
+			continue
+		}
+
+		notes, err := parseHubbleFlows(strings.NewReader(string(data)), counts)
+		if err != nil {
+			logger().Warn("parsing hubble flows failed", "node", node, "error", err)
+			continue
+		}
+		for _, n := range notes {
+			logger().Warn("hubble flows", "node", node, "note", n)
+		}
+		found = found || len(notes) == 0
+	}
+	if !found {
+		return nil
+	}
+
+	f, err := os.Create(fmt.Sprintf("%s/hubble.log", r.getDir()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var total int64
+	verdicts := make([]string, 0, len(counts.verdicts))
+	for v, n := range counts.verdicts {
+		verdicts = append(verdicts, v)
+		total += n
+	}
+	sort.Strings(verdicts)
+	fmt.Fprintf(f, "HUBBLE_FLOWS=%d\n", total)
+	for _, v := range verdicts {
+		fmt.Fprintf(f, "HUBBLE_%s=%d\n", v, counts.verdicts[v])
+	}
+
+	for reason, n := range counts.dropReasons {
+		logger().Warn("hubble dropped flows", "reason", reason, "flows", n)
+	}
+	logger().Info("hubble flows", "flows", total, "dropped", counts.verdicts["DROPPED"])
+	return nil
+}
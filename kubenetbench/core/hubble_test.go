@@ -0,0 +1,33 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHubbleFlows(t *testing.T) {
+	out := `{"flow":{"verdict":"FORWARDED","IP":{"source":"10.0.1.2","destination":"10.0.2.3"}},"node_name":"k8s1"}
+{"flow":{"verdict":"FORWARDED"},"node_name":"k8s1"}
+{"flow":{"verdict":"DROPPED","drop_reason_desc":"POLICY_DENIED"},"node_name":"k8s1"}
+{"lost_events":{"num_events_lost":"3"}}
+# hubble observe failed: connection closed
+`
+	counts := &hubbleCounts{verdicts: make(map[string]int64), dropReasons: make(map[string]int64)}
+	notes, err := parseHubbleFlows(strings.NewReader(out), counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.verdicts["FORWARDED"] != 2 || counts.verdicts["DROPPED"] != 1 || len(counts.verdicts) != 2 {
+		t.Errorf("unexpected verdicts: %v", counts.verdicts)
+	}
+	if counts.dropReasons["POLICY_DENIED"] != 1 {
+		t.Errorf("unexpected drop reasons: %v", counts.dropReasons)
+	}
+	if len(notes) != 1 || notes[0] != "hubble observe failed: connection closed" {
+		t.Errorf("unexpected notes: %q", notes)
+	}
+
+	if _, err := parseHubbleFlows(strings.NewReader("{flow"), counts); err == nil {
+		t.Errorf("expected an error for an invalid flow")
+	}
+}
@@ -0,0 +1,468 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// images of the benchmark and monitor pods
+const (
+	benchImage    = "cilium/kubenetbench"
+	monitorImage  = "docker.io/cilium/kubenetbench-monitor"
+	httpEchoImage = "hashicorp/http-echo"
+	tlsProxyImage = "nginx:alpine"
+)
+
+// default images of the monitor and of the benchmark pods (see
+// SetMonitorImage and SetBenchImage)
+const (
+	DefaultMonitorImage = monitorImage
+	DefaultBenchImage   = benchImage
+)
+
+// imageWithTag returns the reference of an image given its name (repository)
+// and tag (empty for none), and validates it
+func imageWithTag(name, tag string) (string, error) {
+	image := name
+	if tag != "" {
+		image = name + ":" + tag
+	}
+	if _, err := parseImageRef(image); err != nil {
+		return "", fmt.Errorf("invalid image %q: %w", image, err)
+	}
+	return image, nil
+}
+
+// SetMonitorImage overrides the image of the monitor, e.g., to use a mirror
+// in a private registry, or to pin a version. name is the repository
+// (including the registry), and tag its tag (empty for none). The wrapper
+// script passes the image on, so that the later runs of the session deploy it
+// too.
+func (s *Session) SetMonitorImage(name, tag string) error {
+	if _, err := imageWithTag(name, tag); err != nil {
+		return err
+	}
+	s.monitorImageName, s.monitorImageTag = name, tag
+	s.writeScript(s.id, s.dirBase)
+	return nil
+}
+
+// SetBenchImage overrides the image of the benchmark pods (netperf, http,
+// quic, and ping), as SetMonitorImage does for the monitor. Images of
+// third-party servers (e.g., nginx) and of custom benchmarks are not
+// affected.
+func (s *Session) SetBenchImage(name, tag string) error {
+	if _, err := imageWithTag(name, tag); err != nil {
+		return err
+	}
+	s.benchImageName, s.benchImageTag = name, tag
+	s.writeScript(s.id, s.dirBase)
+	return nil
+}
+
+// monitorImageRef returns the image of the monitor (see SetMonitorImage)
+func (s *Session) monitorImageRef() string {
+	if s.monitorImageName == "" {
+		return monitorImage
+	}
+	image, _ := imageWithTag(s.monitorImageName, s.monitorImageTag)
+	return image
+}
+
+// benchImageRef returns the image of the benchmark pods (see SetBenchImage)
+func (s *Session) benchImageRef() string {
+	if s.benchImageName == "" {
+		return benchImage
+	}
+	image, _ := imageWithTag(s.benchImageName, s.benchImageTag)
+	return image
+}
+
+// benchImageParam is the parameter of the container renderers with the image
+// of the benchmark pods (see withBenchImage)
+const benchImageParam = "benchImage"
+
+// withBenchImage returns a copy of the parameters of a container renderer
+// with the image of the benchmark pods
+func (r *RunBenchCtx) withBenchImage(params map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{benchImageParam: r.session.benchImageRef()}
+	for k, v := range params {
+		ret[k] = v
+	}
+	return ret
+}
+
+// paramBenchImage returns the image of the benchmark pods of the parameters
+// of a container renderer (see withBenchImage), or the default image
+func paramBenchImage(params map[string]interface{}) string {
+	if image, ok := params[benchImageParam].(string); ok && image != "" {
+		return image
+	}
+	return benchImage
+}
+
+// ImageLister is an optional interface for benchmarks that report the images
+// of their pods, so that they can be checked before the run (see CheckImages)
+type ImageLister interface {
+	Images() []string
+}
+
+// Images returns the images of the netperf benchmark
+func (cnf *NetperfConf) Images() []string {
+	return []string{benchImage}
+}
+
+// Images returns the images of the HTTP benchmark
+func (cnf *HTTPConf) Images() []string {
+	if cnf.TLS != "" || cnf.ProxyProtocol != "" {
+		return []string{benchImage, tlsProxyImage}
+	}
+	return []string{benchImage, httpEchoImage}
+}
+
+// Images returns the image of the custom benchmark
+func (cnf *CustomConf) Images() []string {
+	return []string{cnf.Image}
+}
+
+// ImageCheckModes are the supported checks of the pod images before creating
+// any resources: syntax (validate the references), registry (also check that
+// the images exist in their registries), or none
+var ImageCheckModes = []string{"syntax", "registry", "none"}
+
+// imageCheckTimeout bounds the time to check an image in its registry
+const imageCheckTimeout = 15 * time.Second
+
+// SetImageCheck sets how the images are checked (see ImageCheckModes).
+// pullSecret ([namespace/]name) is a kubernetes.io/dockerconfigjson secret
+// with the registry credentials used by registry checks (empty for anonymous
+// access).
+func (s *Session) SetImageCheck(mode, pullSecret string) error {
+	for _, m := range ImageCheckModes {
+		if m == mode {
+			s.imageCheck = mode
+			s.imagePullSecret = pullSecret
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid image check: %s (available values: %s)", mode, strings.Join(ImageCheckModes, ","))
+}
+
+// imageRef is a parsed image reference
+type imageRef struct {
+	registry string // registry host (e.g., docker.io)
+	repo     string // repository (e.g., library/nginx)
+	ref      string // tag or digest
+}
+
+var (
+	imageDomainRe    = regexp.MustCompile(`^(localhost|[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+|[a-zA-Z0-9-]+)(:[0-9]+)?$`)
+	imageComponentRe = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*$`)
+	imageTagRe       = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+	imageDigestRe    = regexp.MustCompile(`^[a-z0-9]+([+._-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// parseImageRef parses (and validates) an image reference, e.g., nginx:alpine,
+// or registry.local:5000/team/bench@sha256:...
+func parseImageRef(image string) (*imageRef, error) {
+	name, ref := image, "latest"
+	if n, digest, ok := strings.Cut(image, "@"); ok {
+		if !imageDigestRe.MatchString(digest) {
+			return nil, fmt.Errorf("invalid digest %q", digest)
+		}
+		name, ref = n, digest
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, ref = image[:i], image[i+1:]
+		if !imageTagRe.MatchString(ref) {
+			return nil, fmt.Errorf("invalid tag %q", ref)
+		}
+	}
+
+	ret := &imageRef{registry: "docker.io", ref: ref}
+	components := strings.Split(name, "/")
+	if len(components) > 1 && (strings.ContainsAny(components[0], ".:") || components[0] == "localhost") {
+		if !imageDomainRe.MatchString(components[0]) {
+			return nil, fmt.Errorf("invalid registry %q", components[0])
+		}
+		ret.registry, components = components[0], components[1:]
+	}
+	for _, c := range components {
+		if !imageComponentRe.MatchString(c) {
+			return nil, fmt.Errorf("invalid repository name %q", strings.Join(components, "/"))
+		}
+	}
+	if ret.registry == "docker.io" && len(components) == 1 {
+		components = append([]string{"library"}, components...)
+	}
+	ret.repo = strings.Join(components, "/")
+	return ret, nil
+}
+
+// registryHost returns the host of the registry API
+func (i *imageRef) registryHost() string {
+	if i.registry == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return i.registry
+}
+
+// registryAuth are the credentials of a registry
+type registryAuth struct {
+	username, password string
+}
+
+// parseDockerConfig returns the credentials (by registry) of a
+// .dockerconfigjson
+func parseDockerConfig(data []byte) (map[string]registryAuth, error) {
+	var conf struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]registryAuth)
+	for server, a := range conf.Auths {
+		auth := registryAuth{a.Username, a.Password}
+		if a.Auth != "" {
+			dec, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of %s: %w", server, err)
+			}
+			auth.username, auth.password, _ = strings.Cut(string(dec), ":")
+		}
+		// servers are hosts, or URLs (e.g., https://index.docker.io/v1/)
+		if u, err := url.Parse(server); err == nil && u.Host != "" {
+			server = u.Host
+		}
+		if server == "index.docker.io" || server == "registry-1.docker.io" {
+			server = "docker.io"
+		}
+		ret[server] = auth
+	}
+	return ret, nil
+}
+
+// loadPullSecret returns the registry credentials of the pull secret
+func (s *Session) loadPullSecret(ctx context.Context) (map[string]registryAuth, error) {
+	ns, name, ok := strings.Cut(s.imagePullSecret, "/")
+	if !ok {
+		ns, name = "", s.imagePullSecret
+	}
+	cmd := fmt.Sprintf(`kubectl get secret%s %s -o jsonpath='{.data.\.dockerconfigjson}'`, nsArg(ns), name)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull secret %s: %w", s.imagePullSecret, err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("pull secret %s has no .dockerconfigjson", s.imagePullSecret)
+	}
+	data, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull secret %s: %w", s.imagePullSecret, err)
+	}
+	return parseDockerConfig(data)
+}
+
+var authParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryToken requests a token from the registry's token service, as
+// directed by a (Bearer) WWW-Authenticate challenge
+func registryToken(ctx context.Context, client *http.Client, challenge string, auth *registryAuth) (string, error) {
+	params := make(map[string]string)
+	for _, m := range authParamRe.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("invalid auth challenge: %s", challenge)
+	}
+
+	q := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if auth != nil {
+		req.SetBasicAuth(auth.username, auth.password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&tok); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	return tok.Token, nil
+}
+
+// errImageUnavailable is returned by checkRegistry if the registry reports
+// that the image does not exist, or that it cannot be accessed
+var errImageUnavailable = errors.New("image not pullable")
+
+// checkRegistry checks that an image's manifest exists in its registry
+func checkRegistry(ctx context.Context, client *http.Client, img *imageRef, auth *registryAuth) error {
+	uri := fmt.Sprintf("https://%s/v2/%s/manifests/%s", img.registryHost(), img.repo, img.ref)
+	head := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join([]string{
+			"application/vnd.oci.image.index.v1+json",
+			"application/vnd.oci.image.manifest.v1+json",
+			"application/vnd.docker.distribution.manifest.list.v2+json",
+			"application/vnd.docker.distribution.manifest.v2+json",
+		}, ","))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return resp, nil
+	}
+
+	resp, err := head("")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		authorization := ""
+		switch {
+		case strings.HasPrefix(strings.ToLower(challenge), "bearer "):
+			tok, err := registryToken(ctx, client, challenge, auth)
+			if err != nil {
+				return err
+			}
+			authorization = "Bearer " + tok
+		case strings.HasPrefix(strings.ToLower(challenge), "basic") && auth != nil:
+			authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.username+":"+auth.password))
+		}
+		if authorization != "" {
+			if resp, err = head(authorization); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: not found in %s", errImageUnavailable, img.registry)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: access to %s denied (%s): check the pull secret", errImageUnavailable, img.registry, resp.Status)
+	default:
+		return fmt.Errorf("registry %s returned %s", img.registry, resp.Status)
+	}
+}
+
+// checkImages checks the images (see SetImageCheck). Invalid references, and
+// images that their registry reports as missing or inaccessible, fail the
+// check. Registries that cannot be reached (e.g., only from the cluster) are
+// only warned about.
+func (s *Session) checkImages(ctx context.Context, images []string) error {
+	if s.imageCheck == "none" {
+		return nil
+	}
+
+	var auths map[string]registryAuth
+	if s.imageCheck == "registry" && s.imagePullSecret != "" {
+		var err error
+		auths, err = s.loadPullSecret(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	client := &http.Client{Timeout: imageCheckTimeout}
+	checked := make(map[string]struct{})
+	for _, image := range images {
+		if _, ok := checked[image]; ok {
+			continue
+		}
+		checked[image] = struct{}{}
+
+		img, err := parseImageRef(image)
+		if err != nil {
+			return fmt.Errorf("invalid image %q: %w", image, err)
+		}
+		if s.imageCheck != "registry" {
+			continue
+		}
+
+		var auth *registryAuth
+		if a, ok := auths[img.registry]; ok {
+			auth = &a
+		}
+		err = checkRegistry(ctx, client, img, auth)
+		if errors.Is(err, errImageUnavailable) {
+			return fmt.Errorf("image %q: %w", image, err)
+		} else if err != nil {
+			logger().Warn("failed to check image in its registry", "image", image, "error", err)
+			continue
+		}
+		logger().Debug("image available", "image", image)
+	}
+	return nil
+}
+
+// images returns the images of the run's pods
+func (r *RunBenchCtx) images() []string {
+	ret := []string{}
+	if l, ok := r.benchmark.(ImageLister); ok {
+		for _, image := range l.Images() {
+			if image == benchImage {
+				image = r.session.benchImageRef()
+			}
+			ret = append(ret, image)
+		}
+	}
+	if r.session.MonitorSidecar() {
+		ret = append(ret, r.session.monitorImageRef())
+	}
+	return ret
+}
+
+// CheckImages checks the images of the run's pods (see SetImageCheck), before
+// any resources are created, so that a bad image fails the run early instead
+// of after the pods time out pulling it
+func (r *RunBenchCtx) CheckImages(ctx context.Context) error {
+	return r.session.checkImages(ctx, r.images())
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+func TestParseImageRef(t *testing.T) {
+	tests := []struct {
+		image               string
+		registry, repo, ref string
+	}{
+		{"cilium/kubenetbench", "docker.io", "cilium/kubenetbench", "latest"},
+		{"nginx:alpine", "docker.io", "library/nginx", "alpine"},
+		{"docker.io/cilium/kubenetbench-monitor", "docker.io", "cilium/kubenetbench-monitor", "latest"},
+		{"registry.local:5000/team/bench:v1.2", "registry.local:5000", "team/bench", "v1.2"},
+		{"localhost/bench@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", "localhost", "bench", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+	}
+	for _, tt := range tests {
+		img, err := parseImageRef(tt.image)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.image, err)
+			continue
+		}
+		if img.registry != tt.registry || img.repo != tt.repo || img.ref != tt.ref {
+			t.Errorf("%s: got %+v", tt.image, img)
+		}
+	}
+
+	for _, image := range []string{"Cilium/kubenetbench", "cilium/kubenetbench:", "cilium//kubenetbench", "nginx@sha256:xyz", "nginx:al pine"} {
+		if _, err := parseImageRef(image); err == nil {
+			t.Errorf("%s: expected an error", image)
+		}
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	// auth is base64("user:pass")
+	data := `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"},"registry.local:5000":{"username":"u","password":"p"}}}`
+	auths, err := parseDockerConfig([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := auths["docker.io"]; a.username != "user" || a.password != "pass" {
+		t.Errorf("unexpected docker.io auth: %+v", a)
+	}
+	if a := auths["registry.local:5000"]; a.username != "u" || a.password != "p" {
+		t.Errorf("unexpected registry.local auth: %+v", a)
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	var srvURL string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			w.Write([]byte(`{"token":"tok"}`))
+		case r.Header.Get("Authorization") != "Bearer tok":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srvURL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/team/bench/manifests/v1":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+	registry := strings.TrimPrefix(srv.URL, "https://")
+
+	img := &imageRef{registry: registry, repo: "team/bench", ref: "v1"}
+	if err := checkRegistry(context.Background(), srv.Client(), img, nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	img.ref = "v2"
+	if err := checkRegistry(context.Background(), srv.Client(), img, nil); !errors.Is(err, errImageUnavailable) {
+		t.Errorf("expected errImageUnavailable, got %v", err)
+	}
+}
+
+func TestImageOverrides(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMonitorImage("registry.local:5000/Mirror", "v1"); err == nil {
+		t.Errorf("expected error for an invalid image")
+	}
+	if err := s.SetMonitorImage("registry.local:5000/mirror/knb-monitor", "v1.2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetBenchImage("registry.local:5000/mirror/knb", "v1.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	yaml, _ := checkMonitorSession(t, s,
+		[]string{"image: registry.local:5000/mirror/knb-monitor:v1.2\n"},
+		[]string{
+			"--monitor-image=registry.local:5000/mirror/knb-monitor --monitor-image-tag=v1.2",
+			"--bench-image=registry.local:5000/mirror/knb --bench-image-tag=v1.2",
+		})
+	if strings.Contains(yaml, monitorImage) {
+		t.Errorf("default monitor image in monitor yaml:\n%s", yaml)
+	}
+
+	r := &RunBenchCtx{
+		session:   s,
+		benchmark: &NetperfStreamConf{NetperfConf: NetperfConf{Timeout: 10, TestName: "tcp_stream"}},
+		cliSpec:   &ContainerSpec{},
+	}
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	r.cliContainerWrite(pw, map[string]interface{}{"serverIP": "10.0.0.1"})
+	pw.Done()
+	if !strings.Contains(buf.String(), "image: registry.local:5000/mirror/knb:v1.2\n") {
+		t.Errorf("unexpected client container:\n%s", buf.String())
+	}
+	if images := r.images(); len(images) != 1 || images[0] != "registry.local:5000/mirror/knb:v1.2" {
+		t.Errorf("unexpected images: %v", images)
+	}
+
+	r.runid = "netready"
+	r.cliSpec.Affinity = "none"
+	r.srvSpec = &ContainerSpec{}
+	if err := r.MakeDir(); err != nil {
+		t.Fatal(err)
+	}
+	fname, err := (&NetReadySt{RunBenchCtx: r}).genCliYaml("10.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "image: registry.local:5000/mirror/knb:v1.2\n") || strings.Contains(string(data), benchImage) {
+		t.Errorf("unexpected netready yaml:\n%s", data)
+	}
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// DefaultInfluxMeasurement is the default measurement of exported results
+const DefaultInfluxMeasurement = "kubenetbench"
+
+// influxTimeout bounds the time to write results to the endpoint
+const influxTimeout = 30 * time.Second
+
+// InfluxExporter writes run results to an InfluxDB endpoint using the line
+// protocol. Each result is a single point: its numeric values are fields, and
+// the run parameters (see AddParam), the run tags (see AddTag), and the
+// exporter's tags are tags.
+type InfluxExporter struct {
+	uri         string
+	measurement string
+	token       string
+	tags        map[string]string
+	client      *http.Client
+}
+
+// NewInfluxExporter creates an exporter writing to uri, which is the full
+// write URL of the endpoint, e.g., http://influx:8086/write?db=knb (v1) or
+// http://influx:8086/api/v2/write?org=o&bucket=b (v2). If token is not empty,
+// it is passed in the Authorization header.
+func NewInfluxExporter(uri, measurement, token string) (*InfluxExporter, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid influx URI %q: %w", uri, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid influx URI %q: expecting http(s)://host[:port]/path", uri)
+	}
+	if measurement == "" {
+		measurement = DefaultInfluxMeasurement
+	}
+	return &InfluxExporter{
+		uri:         uri,
+		measurement: measurement,
+		token:       token,
+		tags:        make(map[string]string),
+		client:      &http.Client{Timeout: influxTimeout},
+	}, nil
+}
+
+// SetTag sets a tag of all the exported points (e.g., the session id)
+func (e *InfluxExporter) SetTag(key, value string) {
+	e.tags[key] = value
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	influxStringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// influxLine returns the line protocol point of a result
+func (e *InfluxExporter) influxLine(res *BenchResult, ts time.Time) (string, error) {
+	tags := make(map[string]string)
+	for k, v := range e.tags {
+		tags[k] = v
+	}
+	for k, v := range res.Meta {
+		if strings.HasPrefix(k, paramPrefix) {
+			tags[strings.ToLower(strings.TrimPrefix(k, paramPrefix))] = v
+		}
+	}
+	for k, v := range res.Tags {
+		tags[k] = v
+	}
+
+	keys := res.NumericKeys()
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no numeric values in the result of %s", res.RunID)
+	}
+
+	var b strings.Builder
+	b.WriteString(influxMeasurementEscaper.Replace(e.measurement))
+	tagKeys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		// empty tag values are not allowed
+		if k != "" && v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(k), influxTagEscaper.Replace(tags[k]))
+	}
+
+	fmt.Fprintf(&b, " run_id=\"%s\"", influxStringEscaper.Replace(res.RunID))
+	for _, k := range keys {
+		f, _ := res.Float(k)
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(strings.ToLower(k)), strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	fmt.Fprintf(&b, " %d", ts.UnixNano())
+	return b.String(), nil
+}
+
+// Export writes a result to the endpoint
+func (e *InfluxExporter) Export(res *BenchResult) error {
+	line, err := e.influxLine(res, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.uri, bytes.NewBufferString(line+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+
+	logger().Debug("influx write", "uri", e.uri, "line", line)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write results to %s: %w", e.uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to write results to %s: %s: %s", e.uri, resp.Status, strings.TrimSpace(string(body)))
+	}
+	logger().Info("exported results", "uri", e.uri, "run", res.RunID)
+	return nil
+}
+
+// knownCNIs maps the names of CNI daemonsets to the CNI
+var knownCNIs = []struct{ prefix, cni string }{
+	{"cilium", "cilium"},
+	{"calico-node", "calico"},
+	{"kube-flannel", "flannel"},
+	{"weave-net", "weave"},
+	{"antrea-agent", "antrea"},
+	{"kube-router", "kube-router"},
+	{"aws-node", "aws-vpc-cni"},
+	{"azure-cni", "azure-cni"},
+	{"kindnet", "kindnet"},
+	{"ovnkube-node", "ovn-kubernetes"},
+}
+
+// DetectCNI returns the CNI of the cluster, based on the names of the
+// daemonsets in kube-system (empty if unknown)
+func DetectCNI() string {
+	cmd := "kubectl get daemonset -n kube-system -o custom-columns=Name:.metadata.name --no-headers"
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLines(cmd)
+	if err != nil {
+		logger().Warn("failed to detect CNI", "error", err)
+		return ""
+	}
+	for _, c := range knownCNIs {
+		for _, name := range lines {
+			if strings.HasPrefix(name, c.prefix) {
+				return c.cni
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	exp, err := NewInfluxExporter("http://localhost:8086/write?db=knb", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetTag("session", "test")
+	exp.SetTag("cni", "")
+
+	res := &BenchResult{
+		RunID:  "foo-r1",
+		Values: map[string]string{"THROUGHPUT": "941.5", "THROUGHPUT_UNITS": "10^6bits/s", "P50_LATENCY": "10"},
+		Meta:   map[string]string{"PARAM_BENCHMARK": "netperf", "NET_IFACE": "eth0"},
+		Tags:   map[string]string{"kernel": "5.15 rc1", "tuning": "a=b,c"},
+	}
+	line, err := exp.influxLine(res, time.Unix(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `kubenetbench,benchmark=netperf,kernel=5.15\ rc1,session=test,tuning=a\=b\,c run_id="foo-r1",p50_latency=10,throughput=941.5 1000000000`
+	if line != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", line, expected)
+	}
+
+	if _, err := exp.influxLine(&BenchResult{RunID: "bar"}, time.Now()); err == nil {
+		t.Errorf("expected error for result without values")
+	}
+}
+
+func TestInfluxExport(t *testing.T) {
+	var body, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body, auth = string(b), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	exp, err := NewInfluxExporter(srv.URL+"/api/v2/write?org=o&bucket=b", "knb", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exp.Export(&BenchResult{RunID: "foo", Values: map[string]string{"THROUGHPUT": "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body, `knb run_id="foo",throughput=1 `) || auth != "Token secret" {
+		t.Errorf("unexpected request: body=%q auth=%q", body, auth)
+	}
+
+	if _, err := NewInfluxExporter("influx:8086", "", ""); err == nil {
+		t.Errorf("expected error for URI without scheme")
+	}
+}
@@ -0,0 +1,325 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// IngressSt is the state for an ingress (north-south) run: the server is
+// exposed via a service and an Ingress (or a Gateway API HTTPRoute), and the
+// client benchmarks HTTP through the ingress address.
+type IngressSt struct {
+	RunBenchCtx  *RunBenchCtx
+	IngressClass string // ingress class (empty for the cluster default)
+	Gateway      string // [namespace/]name of a Gateway to use an HTTPRoute instead of an Ingress
+	Host         string // host for the ingress rule (empty for a run-specific one)
+	Port         uint16 // port of the ingress address
+}
+
+var ingressYamlTemplate = template.Must(template.New("ingress").Parse(`apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: knb-ingress
+  {{if .srvNamespace}}namespace: {{.srvNamespace}}{{end}}
+  labels:
+    {{.sessLabel}}
+    {{.runLabel}}
+    role: srv
+spec:
+  {{if .ingressClass}}ingressClassName: {{.ingressClass}}{{end}}
+  rules:
+  - host: {{.host}}
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: knb-service
+            port:
+              number: {{.port}}
+`))
+
+var httpRouteYamlTemplate = template.Must(template.New("httproute").Parse(`apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: knb-httproute
+  {{if .srvNamespace}}namespace: {{.srvNamespace}}{{end}}
+  labels:
+    {{.sessLabel}}
+    {{.runLabel}}
+    role: srv
+spec:
+  parentRefs:
+  - name: {{.gwName}}
+    {{if .gwNamespace}}namespace: {{.gwNamespace}}{{end}}
+  hostnames: ["{{.host}}"]
+  rules:
+  - backendRefs:
+    - name: knb-service
+      port: {{.port}}
+`))
+
+// gateway returns the namespace and name of the gateway
+func (s *IngressSt) gateway() (string, string) {
+	if i := strings.Index(s.Gateway, "/"); i >= 0 {
+		return s.Gateway[:i], s.Gateway[i+1:]
+	}
+	return "", s.Gateway
+}
+
+func (s *IngressSt) host() string {
+	if s.Host != "" {
+		return s.Host
+	}
+	return fmt.Sprintf("%s.kubenetbench.test", s.RunBenchCtx.runid)
+}
+
+func (s *IngressSt) genIngressYaml() (string, error) {
+	r := s.RunBenchCtx
+	httpConf, ok := r.benchmark.(*HTTPConf)
+	if !ok {
+		return "", fmt.Errorf("ingress runs require the http benchmark")
+	}
+
+	gwNamespace, gwName := s.gateway()
+	vals := map[string]interface{}{
+		"sessLabel":    r.session.getSessionLabel(": "),
+		"runLabel":     r.getRunLabel(": "),
+		"srvNamespace": r.srvSpec.Namespace,
+		"ingressClass": s.IngressClass,
+		"gwName":       gwName,
+		"gwNamespace":  gwNamespace,
+		"host":         s.host(),
+		"port":         httpConf.Port,
+	}
+
+	tmpl := ingressYamlTemplate
+	yaml := fmt.Sprintf("%s/ingress.yaml", r.getDir())
+	if s.Gateway != "" {
+		tmpl = httpRouteYamlTemplate
+		yaml = fmt.Sprintf("%s/httproute.yaml", r.getDir())
+	}
+
+	logger().Info("generating yaml", "file", yaml)
+	f, err := os.Create(yaml)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = tmpl.Execute(f, vals)
+	return yaml, err
+}
+
+// waitForOutput executes cmd until check succeeds for its output
+func waitForOutput(
+	ctx context.Context,
+	cmd string,
+	check func(string) bool,
+	retries uint,
+	st time.Duration,
+) (string, error) {
+	retriesOrig := retries
+	for {
+		logger().Debug("exec", "cmd", cmd, "remaining_retries", retries)
+		lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+		if err == nil {
+			out := strings.TrimSpace(strings.Join(lines, "\n"))
+			if check(out) {
+				return out, nil
+			}
+		}
+
+		if retries == 0 {
+			return "", fmt.Errorf("Error waiting for %s after %d retries (last error:%v)", cmd, retriesOrig, err)
+		}
+
+		retries--
+		if err := sleepContext(ctx, st); err != nil {
+			return "", err
+		}
+	}
+}
+
+// waitForIngressAddr waits until the ingress (or the HTTPRoute) is programmed
+// and returns the address that the client should use
+func (s *IngressSt) waitForIngressAddr(ctx context.Context) (string, error) {
+	r := s.RunBenchCtx
+	nonEmpty := func(out string) bool { return out != "" }
+
+	if s.Gateway == "" {
+		cmd := fmt.Sprintf(
+			"kubectl get ingress%s -l '%s' -o jsonpath='{.items[0].status.loadBalancer.ingress[0].ip}{.items[0].status.loadBalancer.ingress[0].hostname}'",
+			nsArg(r.srvSpec.Namespace), r.getRunLabel("="),
+		)
+		return waitForOutput(ctx, cmd, nonEmpty, 60, 5*time.Second)
+	}
+
+	cmd := fmt.Sprintf(
+		`kubectl get httproute%s -l '%s' -o jsonpath='{.items[0].status.parents[0].conditions[?(@.type=="Accepted")].status}'`,
+		nsArg(r.srvSpec.Namespace), r.getRunLabel("="),
+	)
+	_, err := waitForOutput(ctx, cmd, func(out string) bool { return out == "True" }, 60, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+
+	gwNamespace, gwName := s.gateway()
+	if gwNamespace == "" {
+		gwNamespace = r.srvSpec.Namespace
+	}
+	cmd = fmt.Sprintf(
+		"kubectl get gateway%s %s -o jsonpath='{.status.addresses[0].value}'",
+		nsArg(gwNamespace), gwName,
+	)
+	return waitForOutput(ctx, cmd, nonEmpty, 60, 5*time.Second)
+}
+
+// ingressControllerFromHeaders guesses the controller (proxy) that served a
+// request based on the response headers. The http benchmark server does not
+// set a Server header, so any such header comes from the proxy.
+func ingressControllerFromHeaders(hdrs http.Header) string {
+	server := strings.ToLower(hdrs.Get("Server"))
+	for k := range hdrs {
+		if strings.HasPrefix(k, "X-Envoy-") {
+			return "envoy"
+		}
+	}
+
+	switch {
+	case strings.Contains(server, "envoy"):
+		return "envoy"
+	case strings.Contains(server, "nginx"), strings.Contains(server, "openresty"):
+		return "nginx"
+	case strings.Contains(server, "haproxy"):
+		return "haproxy"
+	case strings.Contains(server, "traefik"):
+		return "traefik"
+	case server != "":
+		return server
+	case hdrs.Get("Via") != "":
+		return hdrs.Get("Via")
+	}
+	return "unknown"
+}
+
+// recordIngressController records the controller that served the client's
+// requests in the run metadata
+func (s *IngressSt) recordIngressController(cliLog string) {
+	f, err := os.Open(cliLog)
+	if err != nil {
+		logger().Warn("failed to open client log", "error", err)
+		return
+	}
+	defer f.Close()
+
+	hdrs, err := parseHTTPHeaders(f)
+	if err != nil {
+		logger().Warn("failed to parse response headers", "error", err)
+		return
+	}
+
+	controller := ingressControllerFromHeaders(hdrs)
+	logger().Info("ingress controller", "controller", controller)
+	s.RunBenchCtx.addMeta("INGRESS_CONTROLLER", controller)
+	if server := hdrs.Get("Server"); server != "" {
+		s.RunBenchCtx.addMeta("INGRESS_SERVER_HEADER", server)
+	}
+}
+
+// Execute ingress run
+func (s IngressSt) Execute() error {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the run, bounded by ctx
+func (s IngressSt) ExecuteContext(ctx context.Context) error {
+	r := s.RunBenchCtx
+	if httpConf, ok := r.benchmark.(*HTTPConf); ok && httpConf.TLS != "" {
+		return fmt.Errorf("TLS is not supported for ingress runs")
+	} else if ok && httpConf.ProxyProtocol != "" {
+		return fmt.Errorf("the PROXY protocol is not supported for ingress runs")
+	}
+
+	// start backend (deployment + service)
+	srv := ServiceSt{RunBenchCtx: r}
+	srvYamlFname, err := srv.genSrvYaml()
+	if err != nil {
+		return err
+	}
+	err = r.KubeApply(srvYamlFname)
+	if err != nil {
+		return err
+	}
+
+	srvSelector := fmt.Sprintf("%s,role=srv", r.getRunLabel("="))
+	defer func() {
+		// attempt to save server logs
+		r.KubeSaveLogs(r.srvSpec.Namespace, srvSelector, fmt.Sprintf("%s/srv.log", r.getDir()))
+		r.KubeCleanup()
+		if s.Gateway != "" && r.cleanup {
+			cmd := fmt.Sprintf("kubectl delete%s httproute -l \"%s\"", nsArg(r.srvSpec.Namespace), r.getRunLabel("="))
+			logger().Debug("exec", "cmd", cmd)
+			utils.ExecCmd(cmd)
+		}
+	}()
+
+	ingressYamlFname, err := s.genIngressYaml()
+	if err != nil {
+		return err
+	}
+	err = r.KubeApply(ingressYamlFname)
+	if err != nil {
+		return err
+	}
+
+	addr, err := s.waitForIngressAddr(ctx)
+	if err != nil {
+		return fmt.Errorf("ingress was not programmed: %w", err)
+	}
+	logger().Info("ingress address", "ingress_addr", addr, "host", s.host())
+
+	err = r.applyNetem(ctx, srvSelector)
+	if err != nil {
+		return err
+	}
+
+	err = r.preflightPing(ctx, addr, s.Port)
+	if err != nil {
+		return err
+	}
+
+	// start HTTP client
+	cliYamlFname, err := r.genCliYamlParams(map[string]interface{}{
+		"serverIP": addr,
+		"httpPort": s.Port,
+		"httpHost": s.host(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.KubeApply(cliYamlFname)
+	if err != nil {
+		return fmt.Errorf("failed to initiate client: %w", err)
+	}
+
+	err = r.finalizeAndWait(ctx)
+
+	cliSelector := fmt.Sprintf("%s,role=cli", r.getRunLabel("="))
+	cliLog := fmt.Sprintf("%s/cli.log", r.getDir())
+	if errLog := r.KubeSaveLogs(r.cliSpec.Namespace, cliSelector, cliLog); errLog != nil {
+		logger().Warn("failed to save client logs", "error", errLog)
+	} else {
+		s.recordIngressController(cliLog)
+	}
+
+	return err
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sha256ManifestFname is the integrity manifest of a session: the SHA-256
+// digests of the files received from the monitors (collection archives, and
+// sysinfo sections), in the format of sha256sum (<digest>  <path>), so that
+// it can also be checked with sha256sum -c
+const sha256ManifestFname = "manifest.sha256"
+
+// recordSha256 records the SHA-256 digest (hex) of a file of the session in
+// the manifest. Files that are written again (e.g., the sysinfo of a node
+// that is retrieved again) are recorded again: the last digest of a file is
+// the one that is verified.
+func (s *Session) recordSha256(fname string, digest string) {
+	rel, err := filepath.Rel(s.dir, fname)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		logger().Warn("file is not in the session directory: not recording its digest", "file", fname)
+		return
+	}
+
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(s.dir, sha256ManifestFname), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger().Warn("failed to record file digest", "file", fname, "error", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s  %s\n", digest, filepath.ToSlash(rel))
+}
+
+// readSha256Manifest reads a manifest (see sha256ManifestFname), and returns
+// the (last) digest of each file
+func readSha256Manifest(fname string) (map[string]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		digest, path, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(digest) != 2*sha256.Size {
+			continue
+		}
+		ret[path] = digest
+	}
+	return ret, scanner.Err()
+}
+
+// fileSha256 returns the SHA-256 digest (hex) of a file
+func fileSha256(fname string) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// IntegrityReport is the result of verifying the files of a session against
+// its manifest (see VerifySession)
+type IntegrityReport struct {
+	Files   int      // files in the manifest
+	Missing []string // files that no longer exist
+	Altered []string // files whose digest differs
+}
+
+// OK returns true if all the files of the manifest are intact
+func (r *IntegrityReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Altered) == 0
+}
+
+// VerifySession checks every file of the integrity manifest of a session
+// directory (see sha256ManifestFname) against its digest, and reports the
+// missing and altered files
+func VerifySession(sessDir string) (*IntegrityReport, error) {
+	digests, err := readSha256Manifest(filepath.Join(sessDir, sha256ManifestFname))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no integrity manifest (%s) in session directory %s", sha256ManifestFname, sessDir)
+	} else if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(digests))
+	for p := range digests {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	report := &IntegrityReport{Files: len(paths)}
+	for _, p := range paths {
+		digest, err := fileSha256(filepath.Join(sessDir, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, p)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if digest != digests[p] {
+			report.Altered = append(report.Altered, p)
+		}
+	}
+	return report, nil
+}
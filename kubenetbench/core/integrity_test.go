@@ -0,0 +1,66 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifySession(t *testing.T) {
+	sess, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySession(sess.dir); err == nil {
+		t.Errorf("no manifest: expected error")
+	}
+
+	runDir := filepath.Join(sess.dir, "run")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*fakeFileStream{
+		filepath.Join(runDir, "perf-k8s1.tar.bz2"): {n: 3, size: 1000},
+		filepath.Join(runDir, "perf-k8s2.tar.bz2"): {n: 2, size: 100},
+		filepath.Join(runDir, "perf-k8s3.tar.bz2"): {n: 1, size: 10},
+	}
+	for fname, stream := range files {
+		digest, err := copyStreamToFile(fname, stream, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, err := fileSha256(fname); err != nil || d != digest {
+			t.Errorf("%s: digest %s while expected %s (%v)", fname, digest, d, err)
+		}
+		sess.recordSha256(fname, digest)
+	}
+	// files written again are verified against their last digest
+	fname := filepath.Join(runDir, "perf-k8s3.tar.bz2")
+	digest, err := copyStreamToFile(fname, &fakeFileStream{n: 2, size: 10}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.recordSha256(fname, digest)
+
+	report, err := VerifySession(sess.dir)
+	if err != nil || report.Files != 3 || !report.OK() {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(runDir, "perf-k8s1.tar.bz2"), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(runDir, "perf-k8s2.tar.bz2")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = VerifySession(sess.dir)
+	if err != nil || report.OK() {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+	if len(report.Altered) != 1 || report.Altered[0] != "run/perf-k8s1.tar.bz2" {
+		t.Errorf("unexpected altered files: %v", report.Altered)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "run/perf-k8s2.tar.bz2" {
+		t.Errorf("unexpected missing files: %v", report.Missing)
+	}
+}
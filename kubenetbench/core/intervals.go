@@ -0,0 +1,258 @@
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResultInterval are the stats of an interval of the measurement, as
+// reported by the benchmark client (e.g., netperf interim results, or iperf3
+// intervals)
+type ResultInterval struct {
+	Index       int
+	Start       float64 // start of the interval (seconds since the first interval)
+	Seconds     float64 // duration of the interval
+	Bytes       int64
+	Mbps        float64
+	Retransmits int64 // -1 if not reported
+	Cwnd        int64 // congestion window in bytes (of all streams), -1 if not reported
+}
+
+// IntervalParser is an optional interface for benchmarks whose client output
+// includes per-interval stats. HasIntervals returns true if the benchmark is
+// configured to report them; otherwise ParseIntervals returns no intervals
+// (and no error).
+type IntervalParser interface {
+	HasIntervals() bool
+	ParseIntervals(rd io.Reader) ([]ResultInterval, error)
+}
+
+// IntervalFormats are the supported interval formats of custom benchmarks
+var IntervalFormats = []string{"iperf3"}
+
+// intervalsFname is the file that the intervals of a run are stored in (see
+// SaveResult)
+const intervalsFname = "intervals.csv"
+
+var errNoIntervals = errors.New("no interval stats in the client output")
+
+// e.g., Interim result: 9386.52 10^6bits/s over 1.000 seconds ending at 1490822735.396
+var netperfInterimRegEx = regexp.MustCompile(`^Interim result:\s+([0-9.]+)\s+(\S+) over ([0-9.]+) seconds ending at ([0-9.]+)`)
+
+// HasIntervals returns true if netperf reports interim results
+func (cnf *NetperfConf) HasIntervals() bool {
+	return cnf.Interval > 0
+}
+
+// ParseIntervals parses the interim results of netperf (see Interval)
+func (cnf *NetperfConf) ParseIntervals(rd io.Reader) ([]ResultInterval, error) {
+	if cnf.Interval == 0 {
+		return nil, nil
+	}
+
+	ret := []ResultInterval{}
+	var first float64
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		m := netperfInterimRegEx.FindStringSubmatch(scanner.Text())
+		if len(m) != 5 {
+			continue
+		}
+		rate, err1 := strconv.ParseFloat(m[1], 64)
+		secs, err2 := strconv.ParseFloat(m[3], 64)
+		end, err3 := strconv.ParseFloat(m[4], 64)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, fmt.Errorf("invalid interim result %q: %w", m[0], err)
+		}
+		gbps, ok := rateGbps(rate, m[2])
+		if !ok {
+			return nil, fmt.Errorf("interim result %q is not a data rate", m[0])
+		}
+		if len(ret) == 0 {
+			first = end - secs
+		}
+		ret = append(ret, ResultInterval{
+			Index:       len(ret),
+			Start:       end - secs - first,
+			Seconds:     secs,
+			Bytes:       int64(gbps * 1e9 / 8 * secs),
+			Mbps:        gbps * 1000,
+			Retransmits: -1,
+			Cwnd:        -1,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%w: netperf interim results require netperf built with --enable-demo", errNoIntervals)
+	}
+	return ret, nil
+}
+
+// iperf3 JSON output (iperf3 -J), only the fields of the intervals
+type iperf3Output struct {
+	Intervals []struct {
+		Streams []struct {
+			SndCwnd *int64 `json:"snd_cwnd"`
+		} `json:"streams"`
+		Sum struct {
+			Start         float64 `json:"start"`
+			Seconds       float64 `json:"seconds"`
+			Bytes         int64   `json:"bytes"`
+			BitsPerSecond float64 `json:"bits_per_second"`
+			Retransmits   *int64  `json:"retransmits"`
+		} `json:"sum"`
+	} `json:"intervals"`
+}
+
+// parseIperf3Intervals parses the intervals of iperf3 JSON output (iperf3 -J).
+// The output might have other lines before the JSON object (e.g., of the
+// client command). Retransmits and congestion windows are only reported by
+// TCP senders.
+func parseIperf3Intervals(rd io.Reader) ([]ResultInterval, error) {
+	brd := bufio.NewReader(rd)
+	for {
+		b, err := brd.Peek(1)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no iperf3 JSON output (iperf3 -J)", errNoIntervals)
+		}
+		if b[0] == '{' {
+			break
+		}
+		if _, err := brd.ReadString('\n'); err != nil {
+			return nil, fmt.Errorf("%w: no iperf3 JSON output (iperf3 -J)", errNoIntervals)
+		}
+	}
+
+	var out iperf3Output
+	if err := json.NewDecoder(brd).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to parse iperf3 output: %w", err)
+	}
+	if len(out.Intervals) == 0 {
+		return nil, fmt.Errorf("%w: no intervals in iperf3 output", errNoIntervals)
+	}
+
+	ret := make([]ResultInterval, 0, len(out.Intervals))
+	for i, intv := range out.Intervals {
+		ri := ResultInterval{
+			Index:       i,
+			Start:       intv.Sum.Start,
+			Seconds:     intv.Sum.Seconds,
+			Bytes:       intv.Sum.Bytes,
+			Mbps:        intv.Sum.BitsPerSecond / 1e6,
+			Retransmits: -1,
+			Cwnd:        -1,
+		}
+		if intv.Sum.Retransmits != nil {
+			ri.Retransmits = *intv.Sum.Retransmits
+		}
+		for _, s := range intv.Streams {
+			if s.SndCwnd == nil {
+				continue
+			}
+			if ri.Cwnd < 0 {
+				ri.Cwnd = 0
+			}
+			ri.Cwnd += *s.SndCwnd
+		}
+		ret = append(ret, ri)
+	}
+	return ret, nil
+}
+
+// HasIntervals returns true if an interval format is configured
+func (cnf *CustomConf) HasIntervals() bool {
+	return cnf.Intervals != ""
+}
+
+// ParseIntervals parses the intervals of the client output, if an interval
+// format is configured (see IntervalFormats)
+func (cnf *CustomConf) ParseIntervals(rd io.Reader) ([]ResultInterval, error) {
+	switch cnf.Intervals {
+	case "":
+		return nil, nil
+	case "iperf3":
+		return parseIperf3Intervals(rd)
+	}
+	return nil, fmt.Errorf("invalid interval format: %s", cnf.Intervals)
+}
+
+// ValidateIntervals checks the interval format of the benchmark
+func (cnf *CustomConf) ValidateIntervals() error {
+	if cnf.Intervals == "" {
+		return nil
+	}
+	for _, f := range IntervalFormats {
+		if f == cnf.Intervals {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid interval format: %s (available values: %s)", cnf.Intervals, strings.Join(IntervalFormats, ","))
+}
+
+// intervalValues returns the summary values of the intervals of a result:
+// the number of intervals, the minimum and maximum throughput of an interval
+// (which the average hides), and the maximum retransmits of an interval (if
+// reported)
+func intervalValues(intervals []ResultInterval) map[string]string {
+	ret := map[string]string{}
+	if len(intervals) == 0 {
+		return ret
+	}
+
+	minMbps, maxMbps := intervals[0].Mbps, intervals[0].Mbps
+	maxRetrans := int64(-1)
+	for _, intv := range intervals {
+		minMbps = min(minMbps, intv.Mbps)
+		maxMbps = max(maxMbps, intv.Mbps)
+		maxRetrans = max(maxRetrans, intv.Retransmits)
+	}
+	ret["INTERVALS"] = fmt.Sprintf("%d", len(intervals))
+	ret["INTERVAL_MBPS_MIN"] = fmt.Sprintf("%.2f", minMbps)
+	ret["INTERVAL_MBPS_MAX"] = fmt.Sprintf("%.2f", maxMbps)
+	if maxRetrans >= 0 {
+		ret["INTERVAL_RETRANS_MAX"] = fmt.Sprintf("%d", maxRetrans)
+	}
+	return ret
+}
+
+// writeIntervals writes the intervals of a result as CSV (unreported values
+// are empty)
+func writeIntervals(fname string, intervals []ResultInterval) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	optional := func(v int64) string {
+		if v < 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d", v)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"index", "start", "seconds", "bytes", "mbps", "retransmits", "cwnd"})
+	for _, intv := range intervals {
+		w.Write([]string{
+			fmt.Sprintf("%d", intv.Index),
+			fmt.Sprintf("%.3f", intv.Start),
+			fmt.Sprintf("%.3f", intv.Seconds),
+			fmt.Sprintf("%d", intv.Bytes),
+			fmt.Sprintf("%.2f", intv.Mbps),
+			optional(intv.Retransmits),
+			optional(intv.Cwnd),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
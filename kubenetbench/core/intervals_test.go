@@ -0,0 +1,108 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const netperfInterimTest = `MIGRATED TCP STREAM TEST from 0.0.0.0 (0.0.0.0) port 0 AF_INET to 10.0.0.2 () port 8000 AF_INET : demo
+Interim result: 9000.00 10^6bits/s over 1.000 seconds ending at 1700000001.000
+Interim result: 1000.00 10^6bits/s over 2.000 seconds ending at 1700000003.000
+THROUGHPUT=5000.00
+THROUGHPUT_UNITS=10^6bits/s
+`
+
+func TestNetperfIntervals(t *testing.T) {
+	cnf := NetperfConf{Interval: 1}
+	intervals, err := cnf.ParseIntervals(strings.NewReader(netperfInterimTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 2 {
+		t.Fatalf("expected 2 intervals, got %v", intervals)
+	}
+	second := intervals[1]
+	if second.Index != 1 || second.Start != 1 || second.Seconds != 2 || second.Mbps != 1000 || second.Bytes != 250000000 || second.Retransmits != -1 {
+		t.Errorf("unexpected interval: %+v", second)
+	}
+
+	values := intervalValues(intervals)
+	expected := map[string]string{
+		"INTERVALS":         "2",
+		"INTERVAL_MBPS_MIN": "1000.00",
+		"INTERVAL_MBPS_MAX": "9000.00",
+	}
+	if len(values) != len(expected) {
+		t.Errorf("unexpected values: %v", values)
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("%s: expected %s, got %s", k, v, values[k])
+		}
+	}
+
+	// netperf without demo mode support
+	if _, err := cnf.ParseIntervals(strings.NewReader("THROUGHPUT=5000.00\n")); !errors.Is(err, errNoIntervals) {
+		t.Errorf("expected errNoIntervals, got %v", err)
+	}
+	cnf.Interval = 0
+	if intervals, err := cnf.ParseIntervals(strings.NewReader(netperfInterimTest)); err != nil || intervals != nil {
+		t.Errorf("expected no intervals, got %v (error: %v)", intervals, err)
+	}
+}
+
+const iperf3Test = `Connecting to host 10.0.0.2
+{
+	"start": {},
+	"intervals": [{
+		"streams": [{"socket": 5, "snd_cwnd": 1000}, {"socket": 7, "snd_cwnd": 500}],
+		"sum": {"start": 0, "end": 1.0, "seconds": 1.0, "bytes": 125000000, "bits_per_second": 1e9, "retransmits": 0}
+	}, {
+		"streams": [{"socket": 5, "snd_cwnd": 200}, {"socket": 7, "snd_cwnd": 100}],
+		"sum": {"start": 1.0, "end": 2.0, "seconds": 1.0, "bytes": 62500000, "bits_per_second": 5e8, "retransmits": 42}
+	}],
+	"end": {}
+}
+`
+
+func TestIperf3Intervals(t *testing.T) {
+	cnf := CustomConf{Intervals: "iperf3"}
+	if err := cnf.ValidateIntervals(); err != nil {
+		t.Fatal(err)
+	}
+	intervals, err := cnf.ParseIntervals(strings.NewReader(iperf3Test))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 2 {
+		t.Fatalf("expected 2 intervals, got %v", intervals)
+	}
+	second := intervals[1]
+	if second.Start != 1 || second.Bytes != 62500000 || second.Mbps != 500 || second.Retransmits != 42 || second.Cwnd != 300 {
+		t.Errorf("unexpected interval: %+v", second)
+	}
+	if v := intervalValues(intervals)["INTERVAL_RETRANS_MAX"]; v != "42" {
+		t.Errorf("unexpected INTERVAL_RETRANS_MAX: %s", v)
+	}
+
+	// receiver (or UDP) output: no retransmits or congestion window
+	udp := `{"intervals": [{"streams": [{"socket": 5}], "sum": {"start": 0, "seconds": 1.0, "bytes": 1000, "bits_per_second": 8000}}]}`
+	intervals, err = cnf.ParseIntervals(strings.NewReader(udp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intervals[0].Retransmits != -1 || intervals[0].Cwnd != -1 {
+		t.Errorf("unexpected interval: %+v", intervals[0])
+	}
+	if _, ok := intervalValues(intervals)["INTERVAL_RETRANS_MAX"]; ok {
+		t.Errorf("unexpected INTERVAL_RETRANS_MAX")
+	}
+
+	if _, err := cnf.ParseIntervals(strings.NewReader("iperf3: error - unable to connect\n")); !errors.Is(err, errNoIntervals) {
+		t.Errorf("expected errNoIntervals, got %v", err)
+	}
+	if err := (&CustomConf{Intervals: "iperf2"}).ValidateIntervals(); err == nil {
+		t.Errorf("expected invalid interval format")
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JUnitReport is a JUnit XML report of benchmark runs, for CI systems: each
+// run is a testcase, which errors if the run failed, and fails if it
+// regressed (see AddRegression). The results of the runs are included as the
+// output of their testcases.
+type JUnitReport struct {
+	name      string // test suite name
+	classname string // testcase class name (e.g., the benchmark)
+	timestamp time.Time
+	cases     []junitCase
+}
+
+type junitCase struct {
+	name     string
+	res      *BenchResult // nil if the run failed
+	err      error        // run error
+	failure  string       // regression (empty for none)
+	duration time.Duration
+}
+
+// NewJUnitReport creates a JUnit report of a test suite (e.g., the session),
+// whose testcases are runs of the given class (e.g., the run label)
+func NewJUnitReport(name, classname string) *JUnitReport {
+	return &JUnitReport{
+		name:      name,
+		classname: classname,
+		timestamp: time.Now(),
+	}
+}
+
+// AddRun adds a run (by name, e.g., its run id) as a testcase: res are its
+// results, or err its error
+func (j *JUnitReport) AddRun(name string, res *BenchResult, err error, duration time.Duration) {
+	j.cases = append(j.cases, junitCase{name: name, res: res, err: err, duration: duration})
+}
+
+// AddRegression records the regression check of the runs. A single run fails
+// if it regressed. For several runs (i.e., repeats), whose mean is checked, an
+// aggregate testcase is added instead.
+func (j *JUnitReport) AddRegression(check *RegressionCheck) {
+	failure := ""
+	if check.Regressed() {
+		failure = check.String()
+	}
+	if len(j.cases) == 1 {
+		j.cases[0].failure = failure
+		return
+	}
+	j.cases = append(j.cases, junitCase{
+		name:    j.classname + "-aggregate",
+		res:     &BenchResult{Values: map[string]string{check.Metric: fmt.Sprintf("%.3f", check.CurVal)}},
+		failure: failure,
+	})
+}
+
+type junitXMLSuites struct {
+	XMLName xml.Name        `xml:"testsuites"`
+	Suites  []junitXMLSuite `xml:"testsuite"`
+}
+
+type junitXMLSuite struct {
+	Name      string         `xml:"name,attr"`
+	Tests     int            `xml:"tests,attr"`
+	Failures  int            `xml:"failures,attr"`
+	Errors    int            `xml:"errors,attr"`
+	Time      string         `xml:"time,attr"`
+	Timestamp string         `xml:"timestamp,attr"`
+	Cases     []junitXMLCase `xml:"testcase"`
+}
+
+type junitXMLCase struct {
+	Name      string           `xml:"name,attr"`
+	Classname string           `xml:"classname,attr"`
+	Time      string           `xml:"time,attr"`
+	Failure   *junitXMLMessage `xml:"failure,omitempty"`
+	Error     *junitXMLMessage `xml:"error,omitempty"`
+	SystemOut string           `xml:"system-out,omitempty"`
+}
+
+type junitXMLMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSeconds formats a duration as JUnit seconds
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// Write writes the report as JUnit XML
+func (j *JUnitReport) Write(w io.Writer) error {
+	suite := junitXMLSuite{
+		Name:      j.name,
+		Timestamp: j.timestamp.UTC().Format("2006-01-02T15:04:05"),
+	}
+	var total time.Duration
+	for _, c := range j.cases {
+		xc := junitXMLCase{
+			Name:      c.name,
+			Classname: j.classname,
+			Time:      junitSeconds(c.duration),
+		}
+		total += c.duration
+
+		if c.err != nil {
+			xc.Error = &junitXMLMessage{Message: "run failed", Type: "error", Text: c.err.Error()}
+			suite.Errors++
+		} else if c.failure != "" {
+			xc.Failure = &junitXMLMessage{Message: "regression", Type: "regression", Text: c.failure}
+			suite.Failures++
+		}
+
+		if c.res != nil {
+			keys := make([]string, 0, len(c.res.Values))
+			for k := range c.res.Values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var out strings.Builder
+			for _, k := range keys {
+				fmt.Fprintf(&out, "%s=%s\n", k, c.res.Values[k])
+			}
+			xc.SystemOut = out.String()
+		}
+		suite.Cases = append(suite.Cases, xc)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitXMLSuites{Suites: []junitXMLSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFile writes the report as JUnit XML to a file
+func (j *JUnitReport) WriteFile(fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	if err := j.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
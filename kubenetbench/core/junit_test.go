@@ -0,0 +1,49 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJUnitReport(t *testing.T) {
+	j := NewJUnitReport("test", "pod2pod")
+	j.AddRun("pod2pod-r1", &BenchResult{Values: map[string]string{"THROUGHPUT": "9410.2", "THROUGHPUT_UNITS": "10^6bits/s"}}, nil, 12*time.Second)
+	j.AddRun("pod2pod-r2", nil, errors.New("client failed <exit 1>"), 3*time.Second)
+	j.AddRegression(&RegressionCheck{Metric: "THROUGHPUT", Baseline: "b", BaseVal: 100, CurVal: 90, Delta: -10, MaxPct: 5})
+
+	var buf bytes.Buffer
+	if err := j.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	var suites junitXMLSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, out)
+	}
+	s := suites.Suites[0]
+	if s.Tests != 3 || s.Errors != 1 || s.Failures != 1 || s.Time != "15.000" {
+		t.Errorf("unexpected suite: %+v", s)
+	}
+	if s.Cases[0].Error != nil || s.Cases[0].Failure != nil || !strings.Contains(s.Cases[0].SystemOut, "THROUGHPUT=9410.2\n") {
+		t.Errorf("unexpected testcase: %+v", s.Cases[0])
+	}
+	if s.Cases[1].Error == nil || s.Cases[1].Error.Text != "client failed <exit 1>" {
+		t.Errorf("unexpected failed testcase: %+v", s.Cases[1])
+	}
+	if s.Cases[2].Name != "pod2pod-aggregate" || s.Cases[2].Failure == nil || !strings.Contains(s.Cases[2].Failure.Text, "REGRESSION") {
+		t.Errorf("unexpected regression testcase: %+v", s.Cases[2])
+	}
+
+	// a single run fails itself
+	j = NewJUnitReport("test", "pod2pod")
+	j.AddRun("pod2pod-1", &BenchResult{Values: map[string]string{"THROUGHPUT": "90"}}, nil, time.Second)
+	j.AddRegression(&RegressionCheck{Metric: "THROUGHPUT", BaseVal: 100, CurVal: 90, Delta: -10, MaxPct: 5})
+	if len(j.cases) != 1 || j.cases[0].failure == "" {
+		t.Errorf("regression not recorded on the run: %+v", j.cases)
+	}
+}
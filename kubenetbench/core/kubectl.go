@@ -4,9 +4,10 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"log"
+	"net"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,8 +16,17 @@ import (
 
 var portForwardRegEx = regexp.MustCompile(`:(\d+) -> \d+`)
 
+// nsArg returns the kubectl namespace argument (empty for the default namespace)
+func nsArg(ns string) string {
+	if ns == "" {
+		return ""
+	}
+	return fmt.Sprintf(" -n %s", ns)
+}
+
 // KubeGetPodIP returns the IP address of a pod using a provided selector
 func (c *RunBenchCtx) KubeGetPodIP(
+	ns string,
 	selector string,
 	retries uint,
 	st time.Duration,
@@ -24,11 +34,11 @@ func (c *RunBenchCtx) KubeGetPodIP(
 
 	retriesOrig := retries
 	cmd := fmt.Sprintf(
-		"kubectl get pod -l \"%s\" -o custom-columns=IP:.status.podIP --no-headers",
-		selector,
+		"kubectl get pod%s -l \"%s\" -o custom-columns=IP:.status.podIP --no-headers",
+		nsArg(ns), selector,
 	)
 	for {
-		log.Printf("$ %s # (remaining retries: %d)", cmd, retries)
+		logger().Debug("exec", "cmd", cmd, "remaining_retries", retries)
 		lines, err := utils.ExecCmdLines(cmd)
 		if err == nil && len(lines) == 1 && lines[0] != "<none>" {
 			return lines[0], nil
@@ -47,6 +57,12 @@ var (
 	PodName     = ".metadata.name"
 	PodNodeName = ".spec.nodeName"
 	PodPhase    = ".status.phase"
+	PodUID      = ".metadata.uid"
+	PodRole     = ".metadata.labels.role"
+
+	PodNamespace         = ".metadata.namespace"
+	PodReason            = ".status.reason"
+	PodDeletionTimestamp = ".metadata.deletionTimestamp"
 )
 
 func (c *RunBenchCtx) KubeGetPods__(fields []string) ([][]string, error) {
@@ -56,21 +72,24 @@ func (c *RunBenchCtx) KubeGetPods__(fields []string) ([][]string, error) {
 		columns = append(columns, fmt.Sprintf("F%d:%s", c_idx, c_field))
 	}
 
-	cmd := fmt.Sprintf(
-		"kubectl get pod -l \"%s\" -o custom-columns=%s --no-headers",
-		c.getRunLabel("="),
-		strings.Join(columns, ","),
-	)
-
-	log.Printf("$ %s ", cmd)
-	lines, err := utils.ExecCmdLines(cmd)
 	ret := [][]string{}
-	if err != nil {
-		return ret, err
-	}
+	for _, ns := range c.namespaces() {
+		cmd := fmt.Sprintf(
+			"kubectl get pod%s -l \"%s\" -o custom-columns=%s --no-headers",
+			nsArg(ns),
+			c.getRunLabel("="),
+			strings.Join(columns, ","),
+		)
+
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLines(cmd)
+		if err != nil {
+			return ret, err
+		}
 
-	for _, line := range lines {
-		ret = append(ret, strings.Fields(line))
+		for _, line := range lines {
+			ret = append(ret, strings.Fields(line))
+		}
 	}
 
 	return ret, nil
@@ -81,19 +100,12 @@ func (c *RunBenchCtx) KubeGetPodNodes() ([]string, []string, error) {
 	pods := []string{}
 	nodes := []string{}
 
-	cmd := fmt.Sprintf(
-		"kubectl get pod -l \"%s\" -o custom-columns=Name:.metadata.name,Node:.spec.nodeName --no-headers",
-		c.getRunLabel("="),
-	)
-
-	log.Printf("$ %s ", cmd)
-	lines, err := utils.ExecCmdLines(cmd)
+	lines, err := c.KubeGetPods__([]string{PodName, PodNodeName})
 	if err != nil {
 		return pods, nodes, err
 	}
 
-	for _, line := range lines {
-		s := strings.Fields(line)
+	for _, s := range lines {
 		pods = append(pods, s[0])
 		nodes = append(nodes, s[1])
 	}
@@ -101,11 +113,30 @@ func (c *RunBenchCtx) KubeGetPodNodes() ([]string, []string, error) {
 	return pods, nodes, nil
 }
 
+// recordNodes records the nodes of the run pods, as the NODES metadata
+func (c *RunBenchCtx) recordNodes() {
+	_, nodes, err := c.KubeGetPodNodes()
+	if err != nil {
+		logger().Warn("failed to get the nodes of the run pods", "error", err)
+		return
+	}
+	seen := make(map[string]bool)
+	uniq := []string{}
+	for _, n := range nodes {
+		if n != "<none>" && !seen[n] {
+			seen[n] = true
+			uniq = append(uniq, n)
+		}
+	}
+	sort.Strings(uniq)
+	c.addMeta("NODES", strings.Join(uniq, ","))
+}
+
 // KubeGetPodPhase returns the phase of a pod
-func (c *RunBenchCtx) KubeGetPodPhase(selector string) (string, error) {
+func (c *RunBenchCtx) KubeGetPodPhase(ns string, selector string) (string, error) {
 	cmd := fmt.Sprintf(
-		"kubectl get pod -l \"%s\" -o custom-columns=Status:.status.phase --no-headers",
-		selector,
+		"kubectl get pod%s -l \"%s\" -o custom-columns=Status:.status.phase --no-headers",
+		nsArg(ns), selector,
 	)
 
 	lines, err := utils.ExecCmdLines(cmd)
@@ -114,7 +145,7 @@ func (c *RunBenchCtx) KubeGetPodPhase(selector string) (string, error) {
 	}
 
 	if len(lines) != 1 {
-		log.Fatal("Selector did not provide single result cmd:", cmd, "result:", lines)
+		fatal("selector did not provide single result", "cmd", cmd, "result", lines)
 		return "", fmt.Errorf("selector %s did not provide single result: command: %s; result: %s", selector, cmd, lines)
 	}
 
@@ -122,10 +153,10 @@ func (c *RunBenchCtx) KubeGetPodPhase(selector string) (string, error) {
 }
 
 // KubeGetPodName returns the name of a pod
-func (c *RunBenchCtx) KubeGetPodName(selector string) (string, error) {
+func (c *RunBenchCtx) KubeGetPodName(ns string, selector string) (string, error) {
 	cmd := fmt.Sprintf(
-		`kubectl get pod -l "%s"  -o custom-columns=Name:.metadata.name --no-headers`,
-		selector,
+		`kubectl get pod%s -l "%s"  -o custom-columns=Name:.metadata.name --no-headers`,
+		nsArg(ns), selector,
 	)
 
 	lines, err := utils.ExecCmdLines(cmd)
@@ -134,7 +165,7 @@ func (c *RunBenchCtx) KubeGetPodName(selector string) (string, error) {
 	}
 
 	if len(lines) != 1 {
-		log.Fatal("Selector did not provide single result cmd:", cmd, "result:", lines)
+		fatal("selector did not provide single result", "cmd", cmd, "result", lines)
 		return "", fmt.Errorf("selector %s did not provide single result: command: %s; result: %s", selector, cmd, lines)
 	}
 
@@ -143,19 +174,20 @@ func (c *RunBenchCtx) KubeGetPodName(selector string) (string, error) {
 
 // KubeSaveLogs saves logs using a selector
 // NB: for whaterver reason, kubecutl logs -l ??? truncates the logs
-func (c *RunBenchCtx) KubeSaveLogs(selector string, logfile string) error {
-	podname, err := c.KubeGetPodName(selector)
+func (c *RunBenchCtx) KubeSaveLogs(ns string, selector string, logfile string) error {
+	podname, err := c.KubeGetPodName(ns, selector)
 	if err != nil {
 		return fmt.Errorf("Failed to get pod name: %w", err)
 	}
-	argcmd := fmt.Sprintf(`kubectl logs %s > %s`, podname, logfile)
-	log.Printf("$ %s ", argcmd)
+	argcmd := fmt.Sprintf(`kubectl logs%s %s > %s`, nsArg(ns), podname, logfile)
+	logger().Debug("exec", "cmd", argcmd)
 	return utils.ExecCmd(argcmd)
 }
 
 // KubeGetServiceIP returns the ip of a service
 // NB: probably a better option to use DNS
 func (c *RunBenchCtx) KubeGetServiceIP(
+	ns string,
 	selector string,
 	retries uint,
 	st time.Duration,
@@ -163,12 +195,12 @@ func (c *RunBenchCtx) KubeGetServiceIP(
 
 	retriesOrig := retries
 	cmd := fmt.Sprintf(
-		"kubectl get service -l '%s' -o custom-columns=IP:.spec.clusterIP --no-headers",
-		selector,
+		"kubectl get service%s -l '%s' -o custom-columns=IP:.spec.clusterIP --no-headers",
+		nsArg(ns), selector,
 	)
 
 	for {
-		log.Printf("$ %s # (remaining retries: %d)", cmd, retries)
+		logger().Debug("exec", "cmd", cmd, "remaining_retries", retries)
 		lines, err := utils.ExecCmdLines(cmd)
 		if err == nil && len(lines) == 1 && lines[0] != "<none>" {
 			return lines[0], nil
@@ -183,41 +215,74 @@ func (c *RunBenchCtx) KubeGetServiceIP(
 	}
 }
 
-// KubeApply calls kubectl apply -f
+// KubeApply calls kubectl apply -f, and tracks the manifest (see RemoveYaml)
 func (c *RunBenchCtx) KubeApply(fname string) error {
+	c.yamls = append(c.yamls, fname)
 	cmd := fmt.Sprintf("kubectl apply -f %s", fname)
-	log.Printf("$ %s ", cmd)
+	logger().Debug("exec", "cmd", cmd)
 	return utils.ExecCmd(cmd)
 }
 
 // KubeApply calls kubectl apply -f
 func (c *Session) KubeApply(fname string) error {
+	return c.KubeApplyContext(context.Background(), fname)
+}
+
+// KubeApplyContext calls kubectl apply -f
+func (c *Session) KubeApplyContext(ctx context.Context, fname string) error {
 	cmd := fmt.Sprintf("kubectl apply -f %s", fname)
-	log.Printf("$ %s ", cmd)
-	return utils.ExecCmd(cmd)
+	logger().Debug("exec", "cmd", cmd)
+	return utils.ExecCmdContext(ctx, cmd)
 }
 
 // KubeCleanup deletes pods and networkpolicies from our run
 // NB: this matches on the runid, so objectgs that have a session label and not
 // a runid label (e.g., the monitor) do not match
 func (c *RunBenchCtx) KubeCleanup() error {
-	cmd := fmt.Sprintf("kubectl delete pod,deployment,service,networkpolicy -l \"%s\"", c.getRunLabel("="))
-	log.Printf("$ %s ", cmd)
+	// the description of failed pods is lost once they are removed
+	c.describeFailedPods()
+
+	// the netem qdiscs are on the nodes: never leave them behind
+	c.removeNetem()
 
-	if c.cleanup {
-		return utils.ExecCmd(cmd)
-	} else {
-		log.Printf("Cleanup disabled")
+	if !c.cleanup {
+		logger().Info("cleanup disabled")
+		return nil
 	}
 
-	return nil
+	// never use an empty selector value: it would match resources that we
+	// did not create
+	if c.runid == "" {
+		return fmt.Errorf("refusing to cleanup run with an empty id")
+	}
+
+	var err error
+	for _, ns := range c.namespaces() {
+		cmd := fmt.Sprintf("kubectl delete%s pod,deployment,statefulset,service,ingress,networkpolicy,secret -l \"%s\"", nsArg(ns), c.getRunLabel("="))
+		logger().Debug("exec", "cmd", cmd)
+		if nsErr := utils.ExecCmd(cmd); nsErr != nil {
+			err = nsErr
+		}
+	}
+
+	return err
 }
 
+// KubeGetPodForNode returns the session pod (matching podLabels) on the given node
 func (s *Session) KubeGetPodForNode(node string, podLabels ...string) (string, error) {
-	labels := strings.Join(append(podLabels, s.getSessionLabel("=")), ",")
+	return s.KubeGetPodForNodeContext(context.Background(), node, podLabels...)
+}
+
+// KubeGetPodForNodeContext returns the session pod (matching podLabels) on the given node
+func (s *Session) KubeGetPodForNodeContext(ctx context.Context, node string, podLabels ...string) (string, error) {
+	return kubeGetPodForNode(ctx, node, strings.Join(append(podLabels, s.getSessionLabel("=")), ","))
+}
+
+// kubeGetPodForNode returns the (first) pod matching labels on the given node
+func kubeGetPodForNode(ctx context.Context, node string, labels string) (string, error) {
 	cmd := fmt.Sprintf(`kubectl get pods -l "%s" --field-selector=spec.nodeName="%s" -o custom-columns=Name:'.metadata.name' --no-headers`, labels, node)
-	log.Printf("$ %s ", cmd)
-	lines, err := utils.ExecCmdLines(cmd)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
 	if err != nil {
 		return "", fmt.Errorf("command %q failed: %w", cmd, err)
 	}
@@ -231,9 +296,20 @@ func (s *Session) KubeGetPodForNode(node string, podLabels ...string) (string, e
 
 // deletes the monitor
 func (s *Session) KubeCleanup() error {
-	cmd := fmt.Sprintf("kubectl delete daemonset -l \"%s\"", s.getSessionLabel("="))
-	log.Printf("$ %s ", cmd)
-	return utils.ExecCmd(cmd)
+	return s.KubeCleanupContext(context.Background())
+}
+
+// KubeCleanupContext deletes the monitor
+func (s *Session) KubeCleanupContext(ctx context.Context) error {
+	if s.id == "" {
+		return fmt.Errorf("refusing to cleanup session with an empty id")
+	}
+	cmd := fmt.Sprintf(
+		"kubectl delete daemonset -l \"%s,%s\" --field-selector metadata.name=%s",
+		s.monitorLabel("="), monitorSelector, s.monitorDaemonset(),
+	)
+	logger().Debug("exec", "cmd", cmd)
+	return utils.ExecCmdContext(ctx, cmd)
 }
 
 func KubeGetNodes() ([]string, error) {
@@ -257,8 +333,12 @@ func KubeGetNodeIps() ([]string, error) {
 }
 
 func KubeGetNodeIP(nodeName string) (string, error) {
+	return KubeGetNodeIPContext(context.Background(), nodeName)
+}
+
+func KubeGetNodeIPContext(ctx context.Context, nodeName string) (string, error) {
 	cmd := fmt.Sprintf("kubectl get node -o custom-columns=Addr:'.status.addresses[0].address' --no-headers %q", nodeName)
-	lines, err := utils.ExecCmdLines(cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
 	if err != nil {
 		return "", fmt.Errorf("command %q failed: %w", cmd, err)
 	}
@@ -267,12 +347,128 @@ func KubeGetNodeIP(nodeName string) (string, error) {
 		return "", fmt.Errorf("missing node address in command %q", cmd)
 	}
 
+	// custom-columns prints <none> for a node without addresses
+	if addr := strings.TrimSpace(lines[0]); addr == "" || addr == "<none>" {
+		return "", &NoNodeAddressError{Node: nodeName}
+	}
+
 	return lines[0], nil
 }
 
+// NodeAddress is an address of a node (see the node's .status.addresses)
+type NodeAddress struct {
+	Type    string // InternalIP, ExternalIP, Hostname, etc.
+	Address string
+}
+
+// Family returns the IP family of the address (4 or 6), or 0 if it is not an IP
+func (a NodeAddress) Family() int {
+	ip := net.ParseIP(a.Address)
+	switch {
+	case ip == nil:
+		return 0
+	case ip.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// KubeGetNodeAddressesContext returns all the addresses of a node
+func KubeGetNodeAddressesContext(ctx context.Context, nodeName string) ([]NodeAddress, error) {
+	cmd := fmt.Sprintf(`kubectl get node %q -o jsonpath='{range .status.addresses[*]}{.type}{" "}{.address}{"\n"}{end}'`, nodeName)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		if exists, errE := kubeNodeExistsContext(ctx, nodeName); errE == nil && !exists {
+			return nil, &NodeNotFoundError{Node: nodeName}
+		}
+		return nil, fmt.Errorf("command %q failed: %w", cmd, err)
+	}
+
+	ret := []NodeAddress{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		ret = append(ret, NodeAddress{Type: fields[0], Address: fields[1]})
+	}
+	return ret, nil
+}
+
+// kubeNodeExistsContext returns whether a node exists
+func kubeNodeExistsContext(ctx context.Context, nodeName string) (bool, error) {
+	cmd := fmt.Sprintf(`kubectl get node %q --ignore-not-found -o name`, nodeName)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return false, fmt.Errorf("command %q failed: %w", cmd, err)
+	}
+	return len(lines) > 0, nil
+}
+
+// NodeNotFoundError is returned when a node does not exist (e.g., it was
+// removed from the cluster)
+type NodeNotFoundError struct {
+	Node string
+}
+
+func (e *NodeNotFoundError) Error() string {
+	return fmt.Sprintf("node %s not found", e.Node)
+}
+
+// NoNodeAddressError is returned when a node has no usable address to reach
+// its monitor (e.g., nodes of managed clusters with only an ExternalIP)
+type NoNodeAddressError struct {
+	Node     string        // empty if unknown
+	AddrType string        // requested address type (empty for any)
+	Family   int           // requested IP family (0 for any)
+	Addrs    []NodeAddress // addresses of the node
+}
+
+func (e *NoNodeAddressError) Error() string {
+	what := "address"
+	if e.AddrType != "" {
+		what = e.AddrType + " address"
+	}
+	if e.Family != 0 {
+		what = fmt.Sprintf("%s of IPv%d family", what, e.Family)
+	}
+	node := "node"
+	if e.Node != "" {
+		node = fmt.Sprintf("node %s", e.Node)
+	}
+	return fmt.Sprintf("%s has no reachable address: no valid %s in %v", node, what, e.Addrs)
+}
+
+// selectNodeAddress returns the first address of the given type and IP family
+// (0 for any family). IP address types (e.g., InternalIP) need to have a valid
+// IP. It returns a *NoNodeAddressError if there is no such address.
+func selectNodeAddress(addrs []NodeAddress, addrType string, family int) (string, error) {
+	for _, a := range addrs {
+		if a.Type != addrType || a.Address == "" {
+			continue
+		}
+		if strings.HasSuffix(a.Type, "IP") && a.Family() == 0 {
+			continue
+		}
+		if family != 0 && a.Family() != family {
+			continue
+		}
+		return a.Address, nil
+	}
+
+	return "", &NoNodeAddressError{AddrType: addrType, Family: family, Addrs: addrs}
+}
+
 func KubeGetNodesAndIps() ([]string, error) {
+	return KubeGetNodesAndIpsContext(context.Background())
+}
+
+func KubeGetNodesAndIpsContext(ctx context.Context) ([]string, error) {
 	cmd := "kubectl get nodes -o custom-columns=Name:'.metadata.name',Addr:'.status.addresses[0].address' --no-headers"
-	lines, err := utils.ExecCmdLines(cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
 	if err != nil {
 		return nil, fmt.Errorf("command %s failed: %w", cmd, err)
 	}
@@ -282,9 +478,15 @@ func KubeGetNodesAndIps() ([]string, error) {
 
 func KubePortForward(ctx context.Context, target string, targetPort string) (localPort string, err error) {
 	args := fmt.Sprintf("kubectl port-forward %s :%s", target, targetPort)
-	log.Printf("$ %s ", args)
+	logger().Debug("exec", "cmd", args)
 
+	// the port-forward lives as long as the parent context, unless we fail
 	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
 	cmd := exec.CommandContext(ctx, "sh", "-c", args)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -311,7 +513,6 @@ func KubePortForward(ctx context.Context, target string, targetPort string) (loc
 
 	select {
 	case <-time.After(10 * time.Second):
-		cancel()
 		return "", fmt.Errorf("timed out waiting for port-forward on %s:%s", target, targetPort)
 	case port := <-localPortChan:
 		return port, nil
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// kubeRequestVerbosity is the kubectl verbosity at which the API requests are
+// logged (method, URL, response code, and latency)
+const kubeRequestVerbosity = 6
+
+var (
+	// invocations of kubectl in a shell command (e.g., kubectl get ... | kubectl apply -f -)
+	kubectlCmdRegEx = regexp.MustCompile(`(^|[|;&(]\s*)kubectl\s`)
+	// e.g., round_trippers.go:553] GET https://10.0.0.1:6443/api/v1/nodes 200 OK in 5 milliseconds
+	kubeRequestRegEx = regexp.MustCompile(`round_trippers\.go:\d+\] (\w+) (\S+) (\d{3})\b.* in (\d+) milliseconds`)
+	// e.g., round_trippers.go:632] "Response" verb="GET" url="https://10.0.0.1:6443/api/v1/nodes" status="200 OK" milliseconds=5
+	kubeResponseRegEx = regexp.MustCompile(`round_trippers\.go:\d+\] "Response" verb="(\w+)" url="([^"]+)" status="(\d{3})[^"]*" milliseconds=(\d+)`)
+	// e.g., request.go:697] Waited for 1.19s due to client-side throttling, not priority and fairness, request: GET:https://...
+	kubeThrottleRegEx = regexp.MustCompile(`\] Waited for (\S+) due to client-side throttling.*request: (\w+):(\S+)`)
+)
+
+// KubeRequest is an API server request of kubectl
+type KubeRequest struct {
+	Verb      string
+	Resource  string // e.g., pods, or pods/log for subresources
+	Namespace string
+	Name      string
+	Code      int
+	Latency   time.Duration
+}
+
+// kubeResource returns the (resource, namespace, name) of the path of an API
+// request, e.g., /api/v1/namespaces/default/pods/foo/log is (pods/log,
+// default, foo). Non-resource paths (e.g., /version) are returned as is.
+func kubeResource(path string) (string, string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return path, "", ""
+	}
+
+	ns := ""
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		ns, parts = parts[1], parts[2:]
+	}
+	resource, name := parts[0], ""
+	if len(parts) >= 2 {
+		name = parts[1]
+	}
+	if len(parts) >= 3 {
+		resource += "/" + parts[2]
+	}
+	return resource, ns, name
+}
+
+// parseKubeRequest parses a kubectl log line of an API request
+func parseKubeRequest(line string) (KubeRequest, bool) {
+	m := kubeRequestRegEx.FindStringSubmatch(line)
+	if m == nil {
+		m = kubeResponseRegEx.FindStringSubmatch(line)
+	}
+	if m == nil {
+		return KubeRequest{}, false
+	}
+	u, err := url.Parse(m[2])
+	if err != nil {
+		return KubeRequest{}, false
+	}
+	code, _ := strconv.Atoi(m[3])
+	ms, _ := strconv.Atoi(m[4])
+	req := KubeRequest{
+		Verb:    m[1],
+		Code:    code,
+		Latency: time.Duration(ms) * time.Millisecond,
+	}
+	req.Resource, req.Namespace, req.Name = kubeResource(u.Path)
+	return req, true
+}
+
+// kubeRequestLog is the command hook of LogKubeRequests
+type kubeRequestLog struct{}
+
+// Rewrite increases the verbosity of the kubectl invocations of the command
+func (kubeRequestLog) Rewrite(argcmd string) string {
+	return kubectlCmdRegEx.ReplaceAllString(argcmd, "${1}kubectl -v="+strconv.Itoa(kubeRequestVerbosity)+" ")
+}
+
+// Done logs the API requests of the command. Failed requests (e.g., RBAC
+// denials, or 429 throttling by the API server) and client-side throttling
+// are logged as warnings.
+func (kubeRequestLog) Done(argcmd string, stderr []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := kubeThrottleRegEx.FindStringSubmatch(line); m != nil {
+			logger().Warn("kube client-side throttling", "wait", m[1], "verb", m[2], "url", m[3])
+			continue
+		}
+		req, ok := parseKubeRequest(line)
+		if !ok {
+			continue
+		}
+		args := []any{"verb", req.Verb, "resource", req.Resource}
+		if req.Namespace != "" {
+			args = append(args, "namespace", req.Namespace)
+		}
+		if req.Name != "" {
+			args = append(args, "name", req.Name)
+		}
+		args = append(args, "code", req.Code, "latency", req.Latency)
+		if req.Code >= 400 {
+			logger().Warn("kube request", append(args, "cmd", argcmd)...)
+		} else {
+			logger().Info("kube request", args...)
+		}
+	}
+}
+
+// LogKubeRequests logs every API server request of the kubectl commands
+// (verb, resource, response code, and latency), so that RBAC denials,
+// throttling, and slow API servers can be diagnosed from the session log.
+// The requests are logged from the verbose output of kubectl (-v=6).
+func LogKubeRequests(enable bool) {
+	if enable {
+		utils.SetCmdHook(kubeRequestLog{})
+	} else {
+		utils.SetCmdHook(nil)
+	}
+}
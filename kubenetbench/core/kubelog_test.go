@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKubeResource(t *testing.T) {
+	tests := []struct {
+		path, resource, ns, name string
+	}{
+		{"/api/v1/nodes", "nodes", "", ""},
+		{"/api/v1/namespaces/default/pods", "pods", "default", ""},
+		{"/api/v1/namespaces/default/pods/foo/log", "pods/log", "default", "foo"},
+		{"/apis/apps/v1/namespaces/knb/daemonsets/mon", "daemonsets", "knb", "mon"},
+		{"/api/v1/namespaces/knb", "namespaces", "", "knb"},
+		{"/version", "/version", "", ""},
+	}
+	for _, tt := range tests {
+		resource, ns, name := kubeResource(tt.path)
+		if resource != tt.resource || ns != tt.ns || name != tt.name {
+			t.Errorf("%s: got (%s, %s, %s)", tt.path, resource, ns, name)
+		}
+	}
+}
+
+func TestParseKubeRequest(t *testing.T) {
+	lines := []string{
+		`I0512 10:00:00.000000   1234 round_trippers.go:553] GET https://10.0.0.1:6443/api/v1/namespaces/default/pods?labelSelector=knb 403 Forbidden in 12 milliseconds`,
+		`I0512 10:00:00.000000   1234 round_trippers.go:632] "Response" verb="GET" url="https://10.0.0.1:6443/api/v1/namespaces/default/pods?labelSelector=knb" status="403 Forbidden" milliseconds=12`,
+	}
+	for _, l := range lines {
+		req, ok := parseKubeRequest(l)
+		if !ok {
+			t.Fatalf("failed to parse %q", l)
+		}
+		expected := KubeRequest{Verb: "GET", Resource: "pods", Namespace: "default", Code: 403, Latency: 12 * time.Millisecond}
+		if req != expected {
+			t.Errorf("got %+v while expected %+v", req, expected)
+		}
+	}
+	if _, ok := parseKubeRequest(`I0512 10:00:00.000000   1234 loader.go:395] Config loaded from file`); ok {
+		t.Errorf("parsed a line that is not a request")
+	}
+}
+
+func TestKubeRequestRewrite(t *testing.T) {
+	got := kubeRequestLog{}.Rewrite("kubectl get pods -o yaml | kubectl apply -f -")
+	expected := "kubectl -v=6 get pods -o yaml | kubectl -v=6 apply -f -"
+	if got != expected {
+		t.Errorf("got %q while expected %q", got, expected)
+	}
+}
@@ -1,6 +1,53 @@
 package core
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultLabelPrefix is the default prefix of the label keys that
+// kubenetbench uses to select the resources it creates
+const DefaultLabelPrefix = "knb"
+
+// label key names (the keys are <prefix>-<name>, see Session.labelKey)
+const (
+	runIdLabel  = "runid"
+	sessIdLabel = "sessid"
+	iterLabel   = "iter"
+)
+
 var (
-	runIdLabel  = "knb-runid"
-	sessIdLabel = "knb-sessid"
+	labelNameRegEx   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	labelDomainRegEx = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
 )
+
+// ValidateLabelPrefix checks that the label keys for the given prefix (e.g.,
+// "knb" or "example.com/knb") are valid kubernetes label keys
+func ValidateLabelPrefix(prefix string) error {
+	name := prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		domain := prefix[:i]
+		name = prefix[i+1:]
+		if len(domain) > 253 || !labelDomainRegEx.MatchString(domain) {
+			return fmt.Errorf("invalid label prefix %q: %q is not a valid DNS subdomain", prefix, domain)
+		}
+	}
+
+	for _, l := range []string{runIdLabel, sessIdLabel, iterLabel} {
+		key := fmt.Sprintf("%s-%s", name, l)
+		if len(key) > 63 || !labelNameRegEx.MatchString(key) {
+			return fmt.Errorf("invalid label prefix %q: %q is not a valid label name", prefix, key)
+		}
+	}
+	return nil
+}
+
+// labelKey returns the label key for the given name
+func (s *Session) labelKey(name string) string {
+	prefix := s.labelPrefix
+	if prefix == "" {
+		prefix = DefaultLabelPrefix
+	}
+	return fmt.Sprintf("%s-%s", prefix, name)
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// pkgLogger is the logger set via SetLogger (nil for slog's default logger)
+var pkgLogger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger that the package uses. By default, the package
+// uses slog's default logger, and it never modifies the global logger.
+func SetLogger(l *slog.Logger) {
+	pkgLogger.Store(l)
+}
+
+// logger returns the package logger
+func logger() *slog.Logger {
+	if l := pkgLogger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	logger().Error(msg, args...)
+	os.Exit(1)
+}
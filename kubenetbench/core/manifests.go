@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeepYamlPolicies are the supported policies for retaining the generated
+// manifests of a run: always, on-failure (deleted if the run succeeds), or
+// never (deleted after the run)
+var KeepYamlPolicies = []string{"always", "on-failure", "never"}
+
+// SetKeepYaml sets the policy for retaining the generated manifests of the run
+// (see KeepYamlPolicies)
+func (r *RunBenchCtx) SetKeepYaml(policy string) error {
+	for _, p := range KeepYamlPolicies {
+		if p == policy {
+			r.keepYaml = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid yaml retention policy: %s (available values: %s)", policy, strings.Join(KeepYamlPolicies, ","))
+}
+
+// RemoveYaml removes the manifests applied by the run, depending on the
+// retention policy (see SetKeepYaml) and whether the run succeeded
+func (r *RunBenchCtx) RemoveYaml(success bool) {
+	switch {
+	case r.keepYaml == "never":
+	case r.keepYaml == "on-failure" && success:
+	default:
+		return
+	}
+
+	for _, fname := range r.yamls {
+		err := os.Remove(fname)
+		if err != nil && !os.IsNotExist(err) {
+			logger().Warn("failed to remove manifest", "file", fname, "error", err)
+		}
+	}
+	r.yamls = nil
+}
@@ -1,30 +1,42 @@
 package core
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 
 	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/benchmonitor/auth"
+	"github.com/cilium/kubenetbench/utils"
 )
 
 const (
-	monitorPort     = "8451"
 	monitorSelector = "role=monitor"
+	monitorName     = "knb-monitor"
 )
 
 var monitorTemplate = template.Must(template.New("monitor").Parse(`apiVersion: apps/v1
 kind: DaemonSet
 metadata:
-  name: knb-monitor
+  name: {{.name}}
   labels:
     {{.sessLabel}}
     role: monitor
@@ -39,21 +51,30 @@ spec:
         {{.sessLabel}}
         role: monitor
     spec:
-      tolerations:
-      - operator: Exists
-      # # this toleration is to have the daemonset runnable on master nodes
-      # # remove it if your masters can't run pods
-      # - key: node-role.kubernetes.io/master
-      #   effect: NoSchedule
-
-      #
+      {{.tolerations}}
       hostNetwork: true
       hostPID: true
       hostIPC: true
+      {{- if .nodeSelector}}
+
+      nodeSelector:
+      {{- range $k, $v := .nodeSelector}}
+        {{$k}}: {{printf "%q" $v}}
+      {{- end}}
+      {{- end}}
 
       containers:
       - name: kubenetbench-monitor
-        image: docker.io/cilium/kubenetbench-monitor
+        image: {{.image}}
+        command: ["/monitor-srv", "-p={{.port}}"{{range .maxMsgSizeArgs}}, "{{.}}"{{end}}{{range .tlsArgs}}, "{{.}}"{{end}}]
+        {{- if .tokenSecret}}
+        env:
+        - name: {{.tokenEnv}}
+          valueFrom:
+            secretKeyRef:
+              name: {{.tokenSecret}}
+              key: token
+        {{- end}}
         securityContext:
            privileged: true
            capabilities:
@@ -61,30 +82,64 @@ spec:
                  # - NET_ADMIN
                  - SYS_ADMIN
         ports:
-           - containerPort: 8451
-             hostPort: 8451
+           - containerPort: {{.port}}
+             hostPort: {{.port}}
         volumeMounts:
         - name: host
           mountPath: /host
           readOnly: true
+        {{- if .tlsSecret}}
+        - name: tls
+          mountPath: {{.tlsMountPath}}
+          readOnly: true
+        {{- end}}
       volumes:
       - name: host
         hostPath:
           path: /
+      {{- if .tlsSecret}}
+      - name: tls
+        secret:
+          secretName: {{.tlsSecret}}
+      {{- end}}
 `))
 
 func (s *Session) genMonitorYaml() (string, error) {
 	yaml := fmt.Sprintf("%s/monitor.yaml", s.dir)
-	log.Printf("Generating %s", yaml)
+	logger().Info("generating yaml", "file", yaml)
 	f, err := os.Create(yaml)
 	if err != nil {
 		return "", err
 	}
 
 	vals := map[string]interface{}{
-		"sessLabel": s.getSessionLabel(": "),
+		"name":      s.monitorDaemonset(),
+		"image":     s.monitorImageRef(),
+		"sessLabel": s.monitorLabel(": "),
+		"port":      s.monitorPort(),
+
+		"maxMsgSizeArgs": s.monitorMaxMsgSizeArgs(),
+
+		"nodeSelector": s.monitorNodeLabels,
+		"tolerations":  "{{template \"tolerations\"}}",
+
+		"tlsArgs":      s.monitorTLSArgs(),
+		"tlsSecret":    "",
+		"tlsMountPath": monitorTLSMountPath,
+
+		"tokenEnv":    auth.TokenEnv,
+		"tokenSecret": "",
+	}
+	if s.monitorToken != "" {
+		vals["tokenSecret"] = s.monitorTokenSecret
+	}
+	if s.monitorTLS != nil {
+		vals["tlsSecret"] = s.monitorTLS.Secret
 	}
-	err = monitorTemplate.Execute(f, vals)
+	templates := map[string]utils.PrefixRenderer{
+		"tolerations": s.monitorTolerationsWrite,
+	}
+	err = utils.RenderTemplate(monitorTemplate, vals, templates, f)
 	if err != nil {
 		return "", err
 	}
@@ -92,52 +147,167 @@ func (s *Session) genMonitorYaml() (string, error) {
 	return yaml, nil
 }
 
+// buffer size for writing monitor streams to disk
+const streamWriteBufSize = 256 * 1024
+
 type FileReceiver interface {
 	Recv() (*pb.File, error)
 }
 
-func copyStreamToFile(fname string, stream FileReceiver) error {
-
-	f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// errStreamTooLarge is returned by copyStreamToFile when the stream exceeds
+// the size limit
+var errStreamTooLarge = errors.New("stream exceeds size limit")
+
+// copyStreamToFile writes a stream to a file.
+// Data are received only as fast as they can be written, so that grpc flow
+// control slows down the sender if the disk is slow.
+// If maxSize > 0 and the stream exceeds it, the (partial) file is removed and
+// errStreamTooLarge is returned. The caller is expected to cancel the stream.
+// If progress is not nil, it is called with the size of each received chunk.
+// An existing file (e.g., of a failed attempt) is truncated.
+// It returns the SHA-256 digest (hex) of the data.
+func copyStreamToFile(fname string, stream FileReceiver, maxSize int64, progress func(n int64)) (string, error) {
+
+	f, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer f.Close()
+	w := bufio.NewWriterSize(f, streamWriteBufSize)
+	h := sha256.New()
+	var written int64
 	for {
 		data, err := stream.Recv()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("io error: %w", err)
+			return "", recvError(err)
 		}
 
-		_, err = f.Write(data.Data)
+		written += int64(len(data.Data))
+		if progress != nil {
+			progress(int64(len(data.Data)))
+		}
+		if maxSize > 0 && written > maxSize {
+			f.Close()
+			if errRm := os.Remove(fname); errRm != nil {
+				logger().Warn("failed to remove partial file", "file", fname, "error", errRm)
+			}
+			return "", fmt.Errorf("%w (%d bytes)", errStreamTooLarge, maxSize)
+		}
+
+		_, err = w.Write(data.Data)
 		if err != nil {
-			return fmt.Errorf("Error writing data: %w", err)
+			return "", fmt.Errorf("Error writing data: %w", err)
 		}
+		h.Write(data.Data)
 	}
 
-	return nil
+	err = w.Flush()
+	if err != nil {
+		return "", fmt.Errorf("Error writing data: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recvError wraps an error receiving a monitor stream. Messages larger than
+// the maximum message size (see SetMaxMsgSize) fail with ResourceExhausted,
+// which is otherwise an opaque mid-stream error.
+func recvError(err error) error {
+	if status.Code(err) == codes.ResourceExhausted {
+		return fmt.Errorf("io error: %w (the monitor sent a message larger than the maximum message size: consider increasing --grpc-max-msg-size)", err)
+	}
+	return fmt.Errorf("io error: %w", err)
+}
+
+type SectionReceiver interface {
+	Recv() (*pb.SysInfoSection, error)
+}
+
+// copySectionsToDir writes each received section to <dir>/<section>.txt, and
+// returns the SHA-256 digests (hex) of the files, by file name
+func copySectionsToDir(dir string, stream SectionReceiver) (map[string]string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	type sectionFile struct {
+		f *os.File
+		w *bufio.Writer
+		h hash.Hash
+	}
+	files := make(map[string]*sectionFile)
+	defer func() {
+		for _, sf := range files {
+			sf.f.Close()
+		}
+	}()
+
+	for {
+		section, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, recvError(err)
+		}
+
+		name := filepath.Base(section.Name)
+		sf, ok := files[name]
+		if !ok {
+			f, err := os.Create(fmt.Sprintf("%s/%s.txt", dir, name))
+			if err != nil {
+				return nil, err
+			}
+			sf = &sectionFile{f: f, w: bufio.NewWriterSize(f, streamWriteBufSize), h: sha256.New()}
+			files[name] = sf
+		}
+
+		_, err = sf.w.Write(section.Data)
+		if err != nil {
+			return nil, fmt.Errorf("Error writing data: %w", err)
+		}
+		sf.h.Write(section.Data)
+	}
+
+	digests := make(map[string]string, len(files))
+	for _, sf := range files {
+		err = sf.w.Flush()
+		if err != nil {
+			return nil, fmt.Errorf("Error writing data: %w", err)
+		}
+		digests[sf.f.Name()] = hex.EncodeToString(sf.h.Sum(nil))
+	}
+	return digests, nil
 }
 
 func (s *Session) srvAddrForNode(ctx context.Context, nodeName string) (string, error) {
 	var host, port string
 	if !s.portForward {
 		// directly connect to node IP if port-forwarding is disabled
-		nodeIP, err := KubeGetNodeIP(nodeName)
+		addrs, err := KubeGetNodeAddressesContext(ctx, nodeName)
 		if err != nil {
 			return "", err
 		}
+		nodeIP, err := selectNodeAddress(addrs, s.nodeAddrType, s.nodeIPFamily)
+		var noAddr *NoNodeAddressError
+		if errors.As(err, &noAddr) {
+			noAddr.Node = nodeName
+			return "", noAddr
+		} else if err != nil {
+			return "", err
+		}
 		host = nodeIP
-		port = monitorPort
+		port = strconv.Itoa(s.monitorPort())
 	} else {
-		monitorPod, err := s.KubeGetPodForNode(nodeName, monitorSelector)
+		monitorPod, err := s.KubeGetMonitorPodForNodeContext(ctx, nodeName)
 		if err != nil {
 			return "", err
 		}
 
-		port, err = KubePortForward(ctx, monitorPod, monitorPort)
+		port, err = KubePortForward(ctx, monitorPod, strconv.Itoa(s.monitorPort()))
 		if err != nil {
 			return "", err
 		}
@@ -149,23 +319,109 @@ func (s *Session) srvAddrForNode(ctx context.Context, nodeName string) (string,
 }
 
 func (s *Session) DialMonitor(ctx context.Context, nodeName string) (*grpc.ClientConn, error) {
+	if s.noMonitor {
+		return nil, fmt.Errorf("monitor is disabled for session %s", s.id)
+	}
+
 	srvAddr, err := s.srvAddrForNode(ctx, nodeName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to obtain monitor address of node %s: %w", nodeName, err)
 	}
+	return s.dialMonitorAddr(ctx, srvAddr)
+}
+
+// monitorDialOptions returns the base options of the connections to the
+// monitor: transport security (see monitorCredentials), message size, and
+// token (see SetMonitorToken)
+func (s *Session) monitorDialOptions() ([]grpc.DialOption, error) {
+	creds, err := s.monitorCredentials()
+	if err != nil {
+		return nil, err
+	}
+	security := grpc.WithInsecure()
+	if creds != nil {
+		security = grpc.WithTransportCredentials(creds)
+	}
+	opts := []grpc.DialOption{
+		security,
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(s.maxMsgSize())),
+	}
+	if s.monitorToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.Token(s.monitorToken)))
+	}
+	return opts, nil
+}
 
-	conn, err := grpc.Dial(srvAddr, grpc.WithInsecure())
+// dialMonitorAddr connects to the monitor at the given address (through the
+// monitor proxy, if any). With a dial timeout, it waits until the connection
+// is established (see SetMonitorDialTimeout).
+func (s *Session) dialMonitorAddr(ctx context.Context, srvAddr string) (*grpc.ClientConn, error) {
+	opts, err := s.monitorDialOptions()
 	if err != nil {
+		return nil, err
+	}
+	if s.monitorProxy != nil {
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return s.monitorProxy.DialContext(ctx, "tcp", addr)
+		}))
+	}
+	if s.keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                s.keepaliveTime,
+			Timeout:             s.keepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	if s.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.dialTimeout)
+		defer cancel()
+		// NB: errors such as refused connections fail at once, as without
+		// the timeout (e.g., so that monitors that are starting are retried)
+		opts = append(opts, grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
+	}
+	conn, err := grpc.DialContext(ctx, srvAddr, opts...)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("failed to connect to monitor %s: no connection within %s (see --monitor-dial-timeout): %w", srvAddr, s.dialTimeout, err)
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to connect to monitor %s: %w", srvAddr, err)
 	}
 
 	return conn, err
 }
 
+// GetSysInfoNode retrieves the system information of a node from its monitor
 func (s *Session) GetSysInfoNode(node_name, node_ip string) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	return s.GetSysInfoNodeContext(context.Background(), node_name, node_ip)
+}
+
+// GetSysInfoNodeContext retrieves the system information of a node from its monitor
+func (s *Session) GetSysInfoNodeContext(ctx context.Context, node_name, node_ip string) error {
+	dir := fmt.Sprintf("%s/%s", s.dir, node_name)
+	if err := s.getSysInfoNodeDir(ctx, node_name, dir); err != nil {
+		return err
+	}
+	// the node labels are not known to the monitor
+	if err := saveNodeLabels(node_name, dir); err != nil {
+		logger().Warn("failed to save the node labels", "node", node_name, "error", err)
+	}
+	return nil
+}
+
+// getSysInfoNodeDir retrieves the system information of a node from its
+// monitor into dir
+func (s *Session) getSysInfoNodeDir(ctx context.Context, node_name, dir string) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// the slot is acquired before connecting, so that waiting for it does
+	// not hold idle monitor connections (and port-forwards) open
+	err := s.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.releaseWrite()
+
 	conn, err := s.DialMonitor(ctx, node_name)
 	if err != nil {
 		return err
@@ -173,48 +429,62 @@ func (s *Session) GetSysInfoNode(node_name, node_ip string) error {
 	defer conn.Close()
 
 	cli := pb.NewKubebenchMonitorClient(conn)
-	stream, err := cli.GetSysInfo(ctx, &pb.Empty{})
+	stream, err := cli.GetSysInfo(ctx, &pb.Empty{}, s.streamCallOptions()...)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve sysinfo from monitor on %q: %w", node_name, err)
 	}
 
-	fname := fmt.Sprintf("%s/%s.sysinfo", s.dir, node_name)
-	return copyStreamToFile(fname, stream)
+	digests, err := copySectionsToDir(dir, stream)
+	if err != nil {
+		return err
+	}
+	for fname, digest := range digests {
+		s.recordSha256(fname, digest)
+	}
+	return nil
 }
 
+// GetSysInfoNodes retrieves the system information of all nodes
 func (s *Session) GetSysInfoNodes() error {
+	return s.GetSysInfoNodesContext(context.Background())
+}
+
+// GetSysInfoNodesContext retrieves the system information of all nodes
+func (s *Session) GetSysInfoNodesContext(ctx context.Context) error {
 
-	lines, err := KubeGetNodesAndIps()
+	lines, err := KubeGetNodesAndIpsContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	errstr := ""
-	retriesOrig := 10
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	breaker := newSysInfoBreaker(len(lines), cancel)
+
+	nodeIPs := make(map[string]string, len(lines))
+	nodes := make([]string, 0, len(lines))
 	for _, line := range lines {
 		fields := strings.Fields(line)
 		if len(fields) != 2 {
-			log.Fatal("filed to parse  line %s", line)
-		}
-		node_name := fields[0]
-		node_ip := fields[1]
-		retries := retriesOrig
-		for {
-			log.Printf("calling GetSysInfoNode on %s/%s (remaining retries: %d)", node_name, node_ip, retries)
-			err = s.GetSysInfoNode(node_name, node_ip)
-			if err == nil {
-				break
-			}
+			fatal("failed to parse node line", "line", line)
+		}
+		nodes = append(nodes, fields[0])
+		nodeIPs[fields[0]] = fields[1]
+	}
 
-			if retries == 0 {
-				err := fmt.Sprintf("Error calling GetSysInfoNode %s after %d retries (last error:%w)", node_name, retriesOrig, err)
-				errstr = errstr + "\n" + err
-				break
-			}
+	// nodes are queried in parallel, by at most sysInfoParallelism workers
+	// (each retrying its node, see getSysInfoNodeRetry); the number of
+	// concurrent streams is also bounded (see SetMaxConcurrentWrites)
+	errstr := forEachNode(nodes, s.sysInfoParallelism, func(node string) error {
+		return s.getSysInfoNodeRetry(ctx, breaker, node, nodeIPs[node])
+	})
 
-			retries--
-			time.Sleep(4 * time.Second)
-		}
+	if err := breaker.err(); err != nil {
+		return fmt.Errorf("GetSysInfoNodes() aborted: %w", err)
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("GetSysInfoNodes() interrupted: %w", ctx.Err())
 	}
 
 	if len(errstr) == 0 {
@@ -224,76 +494,453 @@ func (s *Session) GetSysInfoNodes() error {
 	}
 }
 
-func (r *RunBenchCtx) endCollection() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// forEachNode calls fn for every node, with at most parallelism concurrent
+// calls (no limit if parallelism <= 0), and returns the errors, one per line
+// and prefixed with their node, in the order of the nodes (an empty string if
+// all calls succeeded)
+func forEachNode(nodes []string, parallelism int, fn func(node string) error) string {
+	if parallelism <= 0 || parallelism > len(nodes) {
+		parallelism = len(nodes)
+	}
 
-	var err error = nil
+	errs := make([]error, len(nodes))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				errs[i] = fn(nodes[i])
+			}
+		}()
+	}
+	for i := range nodes {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
 
-	for _, node := range r.collectNodes {
-		conn, err := r.session.DialMonitor(ctx, node)
+	errstr := ""
+	for i, err := range errs {
 		if err != nil {
-			return err
+			errstr = errstr + "\n" + nodes[i] + ": " + err.Error()
 		}
-		defer conn.Close()
-		cli := pb.NewKubebenchMonitorClient(conn)
-		conf := &pb.CollectionResultsConf{
-			CollectionId: r.runid,
+	}
+	return errstr
+}
+
+// getSysInfoNodeRetry retrieves the system information of a node, retrying
+// on failures (see retrySysInfoNode)
+func (s *Session) getSysInfoNodeRetry(ctx context.Context, breaker *sysInfoBreaker, node_name, node_ip string) error {
+	return s.retrySysInfoNode(ctx, breaker, node_name, func(ctx context.Context) error {
+		logger().Debug("calling GetSysInfoNode", "node", node_name, "node_ip", node_ip)
+		return s.GetSysInfoNodeContext(ctx, node_name, node_ip)
+	})
+}
+
+// isPermanentSysInfoError returns true if a failure to retrieve the system
+// information of a node will not resolve by retrying: the node does not
+// exist, or the monitor rejected the call (e.g., a wrong token)
+func isPermanentSysInfoError(err error) bool {
+	var notFound *NodeNotFoundError
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.GRPCStatus().Code() {
+	case codes.Unauthenticated, codes.PermissionDenied, codes.Unimplemented, codes.InvalidArgument:
+		return true
+	}
+	return false
+}
+
+// retrySysInfoNode calls get until it succeeds, retrying failures at most
+// sysInfoRetries times with an exponential backoff (see SetSysInfoRetries),
+// unless they are permanent (see isPermanentSysInfoError). Failures are
+// categorized (see monitorErrCategory) starting from the first retry, so that
+// pods that are still starting do not count, and recorded in the breaker.
+func (s *Session) retrySysInfoNode(ctx context.Context, breaker *sysInfoBreaker, node_name string, get func(ctx context.Context) error) error {
+	retriesOrig := s.sysInfoRetries
+	retries := retriesOrig
+	backoff := s.sysInfoBackoff
+	recorded := false
+	for {
+		err := get(ctx)
+		if err == nil {
+			if !recorded {
+				breaker.record(node_name, "")
+			}
+			return nil
 		}
 
-		stream, err := cli.GetCollectionResults(ctx, conf)
-		if err != nil {
-			log.Printf("collection on monitor %s failed: %s\n", node, err)
+		// retrying does not help: skip the node (it is not a monitor failure)
+		var noAddr *NoNodeAddressError
+		if errors.As(err, &noAddr) {
+			logger().Warn("skipping sysinfo of node: node has no reachable address (see --node-address-type, or use --port-forward)", "node", node_name, "error", err)
+			if !recorded {
+				breaker.record(node_name, "")
+			}
+			return nil
 		}
 
-		fname := fmt.Sprintf("%s/perf-%s.tar.bz2", r.getDir(), node)
-		err = copyStreamToFile(fname, stream)
-		if err != nil {
-			log.Printf("writing collection data from node %s failed: %s\n", node, err)
-		} else {
-			log.Printf("perf data for %s can be found in: %s\n", node, fname)
+		if errB := breaker.err(); errB != nil {
+			return errB
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if isPermanentSysInfoError(err) {
+			return fmt.Errorf("GetSysInfoNode failed (not retrying): %w", err)
+		}
+
+		if !recorded && retries < retriesOrig {
+			if category := s.monitorErrCategory(ctx, node_name); category != "" {
+				logger().Warn("monitor failure", "node", node_name, "category", category, "error", err)
+				recorded = true
+				breaker.record(node_name, category)
+				if errB := breaker.err(); errB != nil {
+					return errB
+				}
+			}
 		}
+
+		if retries == 0 {
+			return fmt.Errorf("GetSysInfoNode failed after %d retries (last error: %w)", retriesOrig, err)
+		}
+
+		retries--
+		logger().Debug("retrying GetSysInfoNode", "node", node_name, "remaining_retries", retries, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, sysInfoMaxBackoff)
+	}
+}
+
+// endCollection retrieves the collection results of all nodes in parallel
+// (the number of concurrent writes is bounded, see SetMaxConcurrentWrites)
+func (r *RunBenchCtx) endCollection(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r.collectProgress = newCollectProgress(r.session.progress, r.collectNodes)
+	var wg sync.WaitGroup
+	for _, node := range r.collectNodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			defer r.collectProgress.nodeDone(node)
+			err := r.endCollectionNodeRetry(ctx, node)
+			if errors.Is(err, errStreamTooLarge) {
+				logger().Warn("collection too large, discarded", "node", node, "error", err)
+				r.collectMu.Lock()
+				r.collectTooLarge = append(r.collectTooLarge, node)
+				r.collectMu.Unlock()
+			} else if err != nil {
+				r.collectionFailed(node, err)
+			}
+		}(node)
+	}
+	wg.Wait()
+	r.collectProgress.finish()
+	r.collectProgress = nil
+
+	if len(r.collectTooLarge) > 0 {
+		r.addMeta("COLLECTION_TOO_LARGE_NODES", strings.Join(r.collectTooLarge, ","))
+		logger().Warn("collection too large: consider narrowing its scope (e.g., --perf-output folded, --pcap-filter, --pcap-max-bytes) or increasing --max-collection-size",
+			"nodes", strings.Join(r.collectTooLarge, ","), "max_collection_size", r.maxCollectionSize)
 	}
 
-	return err
+	if len(r.collectFailed) > 0 {
+		r.addMeta("COLLECTION_FAILED_NODES", strings.Join(r.collectFailed, ","))
+		return fmt.Errorf("collection failed on nodes: %s", strings.Join(r.collectFailed, ","))
+	}
+	if len(r.collectTooLarge) > 0 {
+		return fmt.Errorf("collection too large on nodes: %s", strings.Join(r.collectTooLarge, ","))
+	}
+	return nil
+}
+
+// DefaultCollectionRetries is the default number of times that retrieving
+// the collection results of a node is retried after a transport error
+const DefaultCollectionRetries = 2
+
+// collectionRetryDelay is the delay before retrying to retrieve the
+// collection results of a node
+const collectionRetryDelay = 2 * time.Second
+
+// SetCollectionRetries sets the number of times that retrieving the
+// collection results of a node is retried (from the start, over a new
+// connection) when the stream fails on a transport error, e.g., when the
+// connection of a port-forward is reset
+func (r *RunBenchCtx) SetCollectionRetries(retries int) error {
+	if retries < 0 {
+		return fmt.Errorf("invalid number of collection retries: %d", retries)
+	}
+	r.collectRetries = retries
+	return nil
+}
+
+// isTransportError returns true if err (possibly wrapped) is a transport
+// failure of a gRPC call (e.g., a connection reset mid-stream), rather than an
+// error returned by the monitor
+func isTransportError(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.GRPCStatus().Code() {
+	case codes.Unavailable, codes.Internal:
+		return true
+	}
+	return false
+}
+
+// endCollectionNodeRetry retrieves the collection results of a node, retrying
+// on transport errors (see SetCollectionRetries). Every attempt uses a new
+// connection to the monitor, and thus a new port-forward if port-forwarding.
+func (r *RunBenchCtx) endCollectionNodeRetry(ctx context.Context, node string) error {
+	for attempt := 1; ; attempt++ {
+		err := r.endCollectionNodeConn(ctx, node)
+		if err == nil || !isTransportError(err) || attempt > r.collectRetries {
+			return err
+		}
+		logger().Warn("retrieving collection results failed: retrying over a new connection",
+			"node", node, "attempt", attempt, "retries", r.collectRetries, "error", err)
+		r.collectProgress.restart(node)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(collectionRetryDelay):
+		}
+	}
+}
+
+// endCollectionNodeConn retrieves the collection results of a node over a new
+// connection to its monitor
+func (r *RunBenchCtx) endCollectionNodeConn(ctx context.Context, node string) error {
+	// the port-forward (if any) lives as long as the context
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, err := r.dialMonitor(ctx, node)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return r.endCollectionNode(ctx, pb.NewKubebenchMonitorClient(conn), node)
 }
 
-func (r *RunBenchCtx) startCollection() error {
-	ctx, cancel := context.WithCancel(context.Background())
+// endCollectionNode retrieves the collection results of a node. If the
+// collection archive is too large (see SetMaxCollectionSize), errStreamTooLarge
+// is returned.
+func (r *RunBenchCtx) endCollectionNode(ctx context.Context, cli pb.KubebenchMonitorClient, node string) error {
+	// cancelling the context stops the stream (e.g., if it is too large)
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	err := r.session.acquireWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.session.releaseWrite()
+
+	conf := &pb.CollectionResultsConf{
+		CollectionId: r.runid,
+	}
+	stream, err := cli.GetCollectionResults(ctx, conf, r.session.streamCallOptions()...)
+	if err != nil {
+		return err
+	} else if stream == nil {
+		return fmt.Errorf("no collection results stream")
+	}
+
+	fname := fmt.Sprintf("%s/%s-%s.tar.bz2", r.getDir(), r.collectionName(), node)
+	progress := func(n int64) { r.collectProgress.add(node, n) }
+	digest, err := copyStreamToFile(fname, stream, r.maxCollectionSize, progress)
+	if errors.Is(err, errStreamTooLarge) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("writing collection data failed: %w", err)
+	}
+	r.session.recordSha256(fname, digest)
+	logger().Info("collection data", "node", node, "file", fname)
+	return nil
+}
+
+// collectionFailed records that retrieving the collection results of a node failed
+func (r *RunBenchCtx) collectionFailed(node string, err error) {
+	logger().Warn("collection on monitor failed", "node", node, "error", err)
+	r.collectMu.Lock()
+	r.collectFailed = append(r.collectFailed, node)
+	r.collectMu.Unlock()
+}
+
+// getRunNodes returns the nodes that the pods of the run are scheduled on
+func (r *RunBenchCtx) getRunNodes() ([]string, error) {
 	labels := [...]string{PodName, PodNodeName, PodPhase}
 	podsinfo, err := r.KubeGetPods__(labels[:])
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	nodes := make(map[string]struct{})
-	log.Printf("Pods: \n")
+	nodesMap := make(map[string]struct{})
+	nodes := []string{}
 	for _, a := range podsinfo {
-		log.Printf(" %v\n", a)
-		nodes[a[1]] = struct{}{}
+		logger().Debug("pod", "name", a[0], "node", a[1], "phase", a[2])
+		if _, ok := nodesMap[a[1]]; !ok {
+			nodesMap[a[1]] = struct{}{}
+			nodes = append(nodes, a[1])
+		}
+	}
+
+	return nodes, nil
+}
+
+// SetMaxCollectionSize limits the size of the collection archive of each node
+// (0 for no limit). Larger archives are discarded, and the nodes are recorded
+// in the COLLECTION_TOO_LARGE_NODES metadata.
+func (r *RunBenchCtx) SetMaxCollectionSize(size int64) {
+	r.maxCollectionSize = size
+}
+
+// PerfOutputs are the supported perf outputs
+var PerfOutputs = []string{"perfdata", "folded", "flamegraph"}
+
+// SetPerfOutput sets the output of perf collection: perfdata (perf.data and
+// symbols via perf archive), folded (folded stacks), or flamegraph (folded
+// stacks and flamegraph svg). Folded stacks are produced on the node, where
+// symbols match.
+func (r *RunBenchCtx) SetPerfOutput(output string) error {
+	for _, o := range PerfOutputs {
+		if o == output {
+			r.perfOutput = output
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid perf output: %s (available values: %s)", output, strings.Join(PerfOutputs, ","))
+}
+
+// parseCollectionDuration parses a collection duration spec: either a
+// duration for all nodes (e.g., 10), or a comma-separated list of node=duration
+// overrides, where "default" sets the duration of the remaining nodes (e.g.,
+// default=10,node-a=60). The returned default is 0 if the spec has none.
+func parseCollectionDuration(spec string) (int, map[string]int, error) {
+	def := 0
+	nodes := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		node, val := "default", item
+		if i := strings.Index(item, "="); i >= 0 {
+			node, val = strings.TrimSpace(item[:i]), item[i+1:]
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil || d <= 0 {
+			return 0, nil, fmt.Errorf("invalid collection duration %q: expecting a positive number of seconds", item)
+		}
+		if node == "" {
+			return 0, nil, fmt.Errorf("invalid collection duration %q: no node", item)
+		}
+		if node == "default" {
+			def = d
+		} else {
+			nodes[node] = d
+		}
 	}
+	return def, nodes, nil
+}
+
+// SetCollectionDuration sets the duration (in seconds) of the collection on
+// each node. spec is either a duration for all nodes (e.g., 10), or per-node
+// overrides (e.g., default=10,node-a=60).
+func (r *RunBenchCtx) SetCollectionDuration(spec string) error {
+	def, nodes, err := parseCollectionDuration(spec)
+	if err != nil {
+		return err
+	}
+	r.collectDuration = def
+	r.collectDurationNodes = nodes
+	return nil
+}
+
+// collectionDuration returns the collection duration of a node: by default,
+// perf records for the whole traffic (or the measurement window)
+func (r *RunBenchCtx) collectionDuration(node string) int {
+	if d, ok := r.collectDurationNodes[node]; ok {
+		return d
+	}
+	if r.collectDuration > 0 {
+		return r.collectDuration
+	}
+	return max(r.collectSeconds(), 1)
+}
+
+// collectionName returns the (file) name of the collection archive
+func (r *RunBenchCtx) collectionName() string {
+	switch r.perfOutput {
+	case "", "perfdata":
+		return "perf"
+	default:
+		return "perf-" + r.perfOutput
+	}
+}
 
-	for node, _ := range nodes {
-		conn, err := r.session.DialMonitor(ctx, node)
+// collectionConf returns the collection configuration of a node
+func (r *RunBenchCtx) collectionConf(node string, ssFilter string, cpuPods string) *pb.CollectionConf {
+	conf := &pb.CollectionConf{
+		Duration:     fmt.Sprintf("%d", r.collectionDuration(node)),
+		CollectionId: r.runid,
+		Perf:         r.collectPerf,
+		PerfOutput:   r.perfOutput,
+		Pcap:         r.pcap.toPb(r.collectSeconds()),
+	}
+	r.ssConfPb(conf, ssFilter)
+	r.rdmaConfPb(conf)
+	r.hubbleConfPb(conf)
+	r.cpuConfPb(conf, cpuPods)
+	return conf
+}
+
+func (r *RunBenchCtx) startCollection(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	nodes, err := r.monitorTargets()
+	if err != nil {
+		return err
+	}
+
+	ssFilter := ""
+	if r.ss != nil {
+		ssFilter = r.ssFilter()
+	}
+	cpuPods := ""
+	if r.cpu {
+		cpuPods = r.cpuPods()
+	}
+
+	for _, node := range nodes {
+		conn, err := r.dialMonitor(ctx, node)
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
-		//log.Printf("connected to monitor on %s\n", node)
+		//logger().Debug("connected to monitor", "node", node)
 		cli := pb.NewKubebenchMonitorClient(conn)
-		conf := &pb.CollectionConf{
-			Duration:     "5",
-			CollectionId: r.runid,
-		}
-
-		_, err = cli.StartCollection(context.Background(), conf)
+		conf := r.collectionConf(node, ssFilter, cpuPods)
+		_, err = cli.StartCollection(ctx, conf)
 		if err == nil {
-			log.Printf("started collection on monitor %s\n", node)
+			logger().Info("started collection on monitor", "node", node, "duration", conf.Duration)
 			r.collectNodes = append(r.collectNodes, node)
 		} else {
-			log.Printf("started collection on monitor %s failed: %s\n", node, err)
+			logger().Warn("starting collection on monitor failed", "node", node, "error", err)
 		}
 	}
 
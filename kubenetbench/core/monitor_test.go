@@ -0,0 +1,543 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// fakeMonitorClient is a monitor client whose GetCollectionResults fails
+type fakeMonitorClient struct {
+	pb.KubebenchMonitorClient
+	err error
+}
+
+func (c *fakeMonitorClient) GetCollectionResults(
+	ctx context.Context,
+	in *pb.CollectionResultsConf,
+	opts ...grpc.CallOption,
+) (pb.KubebenchMonitor_GetCollectionResultsClient, error) {
+	return nil, c.err
+}
+
+func TestEndCollectionNodeNilStream(t *testing.T) {
+	sess := &Session{id: "test", dir: t.TempDir()}
+	r := &RunBenchCtx{session: sess, runid: "run"}
+	if err := r.MakeDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cli := range []*fakeMonitorClient{
+		{err: errors.New("transient error")},
+		{err: nil}, // nil stream without an error
+	} {
+		if err := r.endCollectionNode(context.Background(), cli, "k8s1"); err == nil {
+			t.Errorf("no error for client %+v", cli)
+		}
+	}
+
+	files, _ := os.ReadDir(r.getDir())
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".tar.bz2") {
+			t.Errorf("unexpected collection file: %s", f.Name())
+		}
+	}
+}
+
+// fakeFileStream is a FileReceiver that sends n chunks of the given size
+type fakeFileStream struct {
+	n, size int
+}
+
+func (s *fakeFileStream) Recv() (*pb.File, error) {
+	if s.n == 0 {
+		return nil, io.EOF
+	}
+	s.n--
+	return &pb.File{Data: make([]byte, s.size)}, nil
+}
+
+func TestCopyStreamToFileMaxSize(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "data")
+	_, err := copyStreamToFile(fname, &fakeFileStream{n: 4, size: 1024}, 4096, nil)
+	if err != nil {
+		t.Fatalf("copyStreamToFile failed: %s", err)
+	}
+	if fi, err := os.Stat(fname); err != nil || fi.Size() != 4096 {
+		t.Errorf("unexpected file: %v %v", fi, err)
+	}
+
+	fname = filepath.Join(t.TempDir(), "data")
+	_, err = copyStreamToFile(fname, &fakeFileStream{n: 5, size: 1024}, 4096, nil)
+	if !errors.Is(err, errStreamTooLarge) {
+		t.Errorf("got error %v while expected errStreamTooLarge", err)
+	}
+	if _, err := os.Stat(fname); !os.IsNotExist(err) {
+		t.Errorf("partial file was not removed: %v", err)
+	}
+}
+
+// fakeErrStream is a file stream that fails
+type fakeErrStream struct {
+	err error
+}
+
+func (s *fakeErrStream) Recv() (*pb.File, error) {
+	return nil, s.err
+}
+
+func TestCopyStreamToFileMsgTooLarge(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "data")
+	tooLarge := status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000000 vs. 4194304)")
+	_, err := copyStreamToFile(fname, &fakeErrStream{err: tooLarge}, 0, nil)
+	if status.Code(errors.Unwrap(err)) != codes.ResourceExhausted || !strings.Contains(err.Error(), "--grpc-max-msg-size") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCopyStreamToFileTruncate(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "data")
+	// a partial file of a failed attempt
+	if err := os.WriteFile(fname, bytes.Repeat([]byte{0xff}, 3000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copyStreamToFile(fname, &fakeFileStream{n: 2, size: 1024}, 0, nil); err != nil {
+		t.Fatalf("copyStreamToFile failed: %s", err)
+	}
+	// only the (zeroed) data of the latest stream
+	data, err := os.ReadFile(fname)
+	if err != nil || !bytes.Equal(data, make([]byte, 2048)) {
+		t.Errorf("unexpected file: %d bytes %v", len(data), err)
+	}
+}
+
+func TestIsTransportError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.Unavailable, "transport is closing"), true},
+		{status.Error(codes.Internal, "stream terminated by RST_STREAM with error code: PROTOCOL_ERROR"), true},
+		{recvError(status.Error(codes.Unavailable, "error reading from server: EOF")), true},
+		{status.Error(codes.Unknown, "invalid collection id run"), false},
+		{recvError(status.Error(codes.ResourceExhausted, "grpc: received message larger than max")), false},
+		{errStreamTooLarge, false},
+		{errors.New("failed to obtain monitor address"), false},
+	} {
+		if got := isTransportError(tt.err); got != tt.want {
+			t.Errorf("isTransportError(%v): got %t, expected %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+// sysInfoSrv is a monitor whose sysinfo is a large (compressible) section
+type sysInfoSrv struct {
+	pb.UnimplementedKubebenchMonitorServer
+}
+
+func (s *sysInfoSrv) GetSysInfo(_ *pb.Empty, stream pb.KubebenchMonitor_GetSysInfoServer) error {
+	return stream.Send(&pb.SysInfoSection{Name: "sysctl", Data: make([]byte, 1024*1024)})
+}
+
+// wireStats records the wire length of the messages sent by the server
+type wireStats struct {
+	length, wireLength int64
+}
+
+func (w *wireStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (w *wireStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (w *wireStats) HandleConn(context.Context, stats.ConnStats)                       {}
+func (w *wireStats) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if out, ok := s.(*stats.OutPayload); ok {
+		atomic.AddInt64(&w.length, int64(out.Length))
+		atomic.AddInt64(&w.wireLength, int64(out.WireLength))
+	}
+}
+
+func TestStreamCompression(t *testing.T) {
+	s := &Session{insecureMonitor: true}
+	if opts := s.streamCallOptions(); len(opts) != 0 {
+		t.Errorf("unexpected call options without compression: %v", opts)
+	}
+	s.SetStreamCompression(true)
+	opts := s.streamCallOptions()
+	if len(opts) != 1 {
+		t.Fatalf("unexpected call options: %v", opts)
+	}
+	if c, ok := opts[0].(grpc.CompressorCallOption); !ok || c.CompressorType != "gzip" {
+		t.Errorf("unexpected call option: %#v", opts[0])
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := &wireStats{}
+	srv := grpc.NewServer(grpc.StatsHandler(ws))
+	pb.RegisterKubebenchMonitorServer(srv, &sysInfoSrv{})
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	getSysInfo := func() (int64, int64) {
+		atomic.StoreInt64(&ws.length, 0)
+		atomic.StoreInt64(&ws.wireLength, 0)
+		conn, err := s.dialMonitorAddr(context.Background(), l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		stream, err := pb.NewKubebenchMonitorClient(conn).GetSysInfo(context.Background(), &pb.Empty{}, s.streamCallOptions()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests, err := copySectionsToDir(t.TempDir(), stream)
+		if err != nil || len(digests) != 1 {
+			t.Fatalf("unexpected result: %v %v", digests, err)
+		}
+		return atomic.LoadInt64(&ws.length), atomic.LoadInt64(&ws.wireLength)
+	}
+
+	// the monitor compresses the section with the compressor of the request
+	if length, wire := getSysInfo(); wire*10 > length {
+		t.Errorf("compression: %d bytes on the wire for %d bytes", wire, length)
+	}
+	s.SetStreamCompression(false)
+	if length, wire := getSysInfo(); wire < length {
+		t.Errorf("no compression: %d bytes on the wire for %d bytes", wire, length)
+	}
+}
+
+// checkMonitorSession generates the monitor yaml of the session, and checks
+// that it contains the yaml strings, and that the wrapper script contains the
+// script strings. It returns the monitor yaml and the wrapper script, for
+// further checks.
+func checkMonitorSession(t *testing.T, s *Session, yaml, script []string) (string, string) {
+	t.Helper()
+	fname, err := s.genMonitorYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlData, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range yaml {
+		if !strings.Contains(string(yamlData), expected) {
+			t.Errorf("%q not in monitor yaml:\n%s", expected, yamlData)
+		}
+	}
+	scriptData, err := os.ReadFile(filepath.Join(s.dir, "knb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range script {
+		if !strings.Contains(string(scriptData), expected) {
+			t.Errorf("%q not in wrapper script:\n%s", expected, scriptData)
+		}
+	}
+	return string(yamlData), string(scriptData)
+}
+
+func TestMonitorPort(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMonitorPort(70000); err == nil {
+		t.Errorf("expected error for an invalid port")
+	}
+	if err := s.SetMonitorPort(9451); err != nil {
+		t.Fatal(err)
+	}
+
+	yaml, _ := checkMonitorSession(t, s,
+		[]string{`"/monitor-srv", "-p=9451"`, "- containerPort: 9451\n             hostPort: 9451\n"},
+		[]string{"--monitor-port=9451"})
+	if strings.Contains(yaml, "8451") {
+		t.Errorf("default port in monitor yaml:\n%s", yaml)
+	}
+
+	// the sidecar listens on the same port
+	s.SetMonitorSidecar()
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	(&ContainerSpec{}).monitorSidecarWrite(s)(pw, nil)
+	pw.Done()
+	if !strings.Contains(buf.String(), `"-p=9451"`) || !strings.Contains(buf.String(), "containerPort: 9451") {
+		t.Errorf("unexpected sidecar:\n%s", buf.String())
+	}
+}
+
+func TestMonitorMaxMsgSize(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetMonitorSidecar()
+	// the commands of the monitor daemonset and of the sidecar
+	command := func() (string, string) {
+		fname, err := s.genMonitorYaml()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		pw := utils.NewPrefixWriter(&buf, false)
+		(&ContainerSpec{}).monitorSidecarWrite(s)(pw, nil)
+		pw.Done()
+		return string(data), buf.String()
+	}
+
+	// the default is not passed, since older monitors do not have the flag
+	monitor, sidecar := command()
+	if strings.Contains(monitor, "-max-msg-size") || strings.Contains(sidecar, "-max-msg-size") {
+		t.Errorf("default maximum message size passed to the monitor:\n%s\n%s", monitor, sidecar)
+	}
+
+	if err := s.SetMaxMsgSize(128 * 1024 * 1024); err != nil {
+		t.Fatal(err)
+	}
+	monitor, sidecar = command()
+	for _, yaml := range []string{monitor, sidecar} {
+		if !strings.Contains(yaml, `"-max-msg-size=134217728"`) {
+			t.Errorf("maximum message size not passed to the monitor:\n%s", yaml)
+		}
+	}
+}
+
+func TestForEachNode(t *testing.T) {
+	nodes := []string{"k8s1", "k8s2", "k8s3", "k8s4", "k8s5", "k8s6"}
+	var running, peak int32
+	errstr := forEachNode(nodes, 2, func(node string) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if node == "k8s2" || node == "k8s5" {
+			return errors.New("monitor unreachable")
+		}
+		return nil
+	})
+	if peak != 2 {
+		t.Errorf("%d concurrent calls while expected 2", peak)
+	}
+	if errstr != "\nk8s2: monitor unreachable\nk8s5: monitor unreachable" {
+		t.Errorf("unexpected errors: %q", errstr)
+	}
+
+	// no limit
+	var calls int32
+	errstr = forEachNode(nodes, 0, func(node string) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	if errstr != "" || calls != int32(len(nodes)) {
+		t.Errorf("unexpected result: %d calls, errors: %q", calls, errstr)
+	}
+}
+
+func TestRetrySysInfoNode(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSysInfoRetries(-1, time.Millisecond); err == nil {
+		t.Errorf("expected error for invalid retries")
+	}
+	if err := s.SetSysInfoRetries(3, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// get fails n times with err, and then succeeds
+	calls := 0
+	get := func(n int, err error) func(ctx context.Context) error {
+		calls = 0
+		return func(ctx context.Context) error {
+			calls++
+			if calls <= n {
+				return err
+			}
+			return nil
+		}
+	}
+	refused := status.Error(codes.Unavailable, "connection refused")
+	breaker := func() *sysInfoBreaker { return newSysInfoBreaker(sysInfoBreakerNodes, nil) }
+
+	if err := s.retrySysInfoNode(context.Background(), breaker(), "n1", get(3, refused)); err != nil || calls != 4 {
+		t.Errorf("unexpected result: %v after %d calls", err, calls)
+	}
+	if err := s.retrySysInfoNode(context.Background(), breaker(), "n1", get(4, refused)); !errors.Is(err, refused) || calls != 4 {
+		t.Errorf("unexpected result: %v after %d calls", err, calls)
+	}
+
+	// permanent errors are not retried
+	for _, perm := range []error{
+		&NodeNotFoundError{Node: "n1"},
+		fmt.Errorf("failed to retrieve sysinfo: %w", status.Error(codes.Unauthenticated, "invalid token")),
+	} {
+		if err := s.retrySysInfoNode(context.Background(), breaker(), "n1", get(1, perm)); !errors.Is(err, perm) || calls != 1 {
+			t.Errorf("unexpected result: %v after %d calls", err, calls)
+		}
+	}
+
+	// the backoff is exponential
+	if err := s.SetSysInfoRetries(3, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := s.retrySysInfoNode(context.Background(), breaker(), "n1", get(3, refused)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 140*time.Millisecond {
+		t.Errorf("retries took %s, expected at least 140ms (20+40+80)", d)
+	}
+}
+
+func TestParseCollectionDuration(t *testing.T) {
+	def, nodes, err := parseCollectionDuration("default=10,node-a=60")
+	if err != nil || def != 10 || len(nodes) != 1 || nodes["node-a"] != 60 {
+		t.Errorf("unexpected result: %d %v %v", def, nodes, err)
+	}
+
+	def, nodes, err = parseCollectionDuration("20")
+	if err != nil || def != 20 || len(nodes) != 0 {
+		t.Errorf("unexpected result: %d %v %v", def, nodes, err)
+	}
+
+	def, _, err = parseCollectionDuration("node-a=60")
+	if err != nil || def != 0 {
+		t.Errorf("unexpected result: %d %v", def, err)
+	}
+
+	for _, spec := range []string{"", "0", "node-a=x", "=10", "default=-1"} {
+		if _, _, err := parseCollectionDuration(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestCollectionConfDuration(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cnf := &NetperfStreamConf{NetperfConf: NetperfConf{Timeout: 120, TestName: "tcp_stream"}}
+	r := NewRunBenchCtx(s, "pod2pod", &ContainerSpec{}, &ContainerSpec{}, true, cnf, true, false)
+
+	// perf records for the whole benchmark by default
+	if conf := r.collectionConf("node-a", "", ""); conf.Duration != "120" || !conf.Perf {
+		t.Errorf("unexpected collection conf: %+v", conf)
+	}
+
+	if err := r.SetCollectionDuration("default=30,node-a=60"); err != nil {
+		t.Fatal(err)
+	}
+	if d := r.collectionConf("node-a", "", "").Duration; d != "60" {
+		t.Errorf("node-a: duration %s while expected 60", d)
+	}
+	if d := r.collectionConf("node-b", "", "").Duration; d != "30" {
+		t.Errorf("node-b: duration %s while expected 30", d)
+	}
+
+	// nodes without an override record for the whole benchmark
+	if err := r.SetCollectionDuration("node-a=60"); err != nil {
+		t.Fatal(err)
+	}
+	if d := r.collectionConf("node-b", "", "").Duration; d != "120" {
+		t.Errorf("node-b: duration %s while expected 120", d)
+	}
+
+	if err := r.SetCollectionDuration("5s"); err == nil {
+		t.Errorf("expected error for an invalid duration")
+	}
+}
+
+func TestSelectNodeAddress(t *testing.T) {
+	addrs := []NodeAddress{
+		{Type: "InternalIP", Address: "<none>"},
+		{Type: "ExternalIP", Address: "203.0.113.7"},
+		{Type: "InternalIP", Address: "fd00::7"},
+		{Type: "Hostname", Address: "node-a"},
+	}
+	if addr, err := selectNodeAddress(addrs, "InternalIP", 0); err != nil || addr != "fd00::7" {
+		t.Errorf("InternalIP: got %q, %v", addr, err)
+	}
+	if addr, err := selectNodeAddress(addrs, "ExternalIP", 4); err != nil || addr != "203.0.113.7" {
+		t.Errorf("ExternalIP: got %q, %v", addr, err)
+	}
+
+	_, err := selectNodeAddress(addrs, "InternalIP", 4)
+	var noAddr *NoNodeAddressError
+	if !errors.As(err, &noAddr) {
+		t.Fatalf("expected NoNodeAddressError, got %v", err)
+	}
+	if noAddr.AddrType != "InternalIP" || noAddr.Family != 4 {
+		t.Errorf("unexpected error: %+v", noAddr)
+	}
+	if !strings.Contains(err.Error(), "no reachable address") {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func TestDialMonitorTimeout(t *testing.T) {
+	// a monitor that accepts connections, but does not respond
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	s := &Session{insecureMonitor: true}
+	if err := s.SetMonitorDialTimeout(200 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = s.dialMonitorAddr(context.Background(), l.Addr().String())
+	if err == nil || !strings.Contains(err.Error(), "--monitor-dial-timeout") {
+		t.Errorf("expected a dial timeout error, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("dial took %s", d)
+	}
+
+	if err := s.SetMonitorKeepalive(30*time.Second, 0); err == nil {
+		t.Errorf("expected an error for a keepalive without timeout")
+	}
+	if err := s.SetMonitorKeepalive(0, 0); err != nil {
+		t.Errorf("disabling keepalive failed: %v", err)
+	}
+}
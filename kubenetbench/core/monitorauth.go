@@ -0,0 +1,34 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/cilium/kubenetbench/benchmonitor/auth"
+)
+
+const (
+	// DefaultMonitorTokenSecret is the default name of the secret with the
+	// token of the monitor (in its token key)
+	DefaultMonitorTokenSecret = "knb-monitor-token"
+	// MonitorTokenEnv is the environment variable of the token of the
+	// monitor
+	MonitorTokenEnv = auth.TokenEnv
+)
+
+// SetMonitorToken makes kubenetbench authenticate to the monitor with a
+// bearer token, which the monitor daemonset reads from the token key of the
+// given secret (that must exist before the monitor is deployed). The wrapper
+// script only records the name of the secret: later commands of the session
+// read the token from the MonitorTokenEnv environment variable.
+func (s *Session) SetMonitorToken(token, secret string) error {
+	if token == "" {
+		return fmt.Errorf("empty monitor token")
+	}
+	if secret == "" {
+		secret = DefaultMonitorTokenSecret
+	}
+	s.monitorToken = token
+	s.monitorTokenSecret = secret
+	s.writeScript(s.id, s.dirBase)
+	return nil
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/benchmonitor/auth"
+)
+
+func TestMonitorToken(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(auth.UnaryServerInterceptor("s3cret")))
+	pb.RegisterKubebenchMonitorServer(srv, &pb.UnimplementedKubebenchMonitorServer{})
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	call := func(s *Session) error {
+		conn, err := s.dialMonitorAddr(context.Background(), l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = pb.NewKubebenchMonitorClient(conn).GetNetStats(context.Background(), &pb.Empty{})
+		return err
+	}
+
+	s, err := NewSession("test", t.TempDir(), true, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := call(s); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: unexpected error: %v", err)
+	}
+	if err := s.SetMonitorToken("s3cret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(s); status.Code(err) != codes.Unimplemented {
+		t.Errorf("token: unexpected error: %v", err)
+	}
+
+	yaml, script := checkMonitorSession(t, s,
+		[]string{"- name: " + MonitorTokenEnv, "name: " + DefaultMonitorTokenSecret, "key: token"},
+		[]string{"--monitor-token-secret=" + DefaultMonitorTokenSecret})
+
+	// the token is not stored in the session directory
+	if strings.Contains(yaml, "s3cret") || strings.Contains(script, "s3cret") {
+		t.Errorf("token in the session directory:\n%s\n%s", yaml, script)
+	}
+}
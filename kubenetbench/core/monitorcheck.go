@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// monitorReadyTimeout is the time the monitor pods have to become ready (see
+// WaitMonitorContext)
+const monitorReadyTimeout = 2 * time.Minute
+
+// monitorAdmissionErrors returns the reasons the monitor pods could not be
+// created (e.g., rejected by admission control), as reported by the
+// FailedCreate events of the monitor daemonset
+func (s *Session) monitorAdmissionErrors(ctx context.Context) ([]string, error) {
+	cmd := fmt.Sprintf(
+		"kubectl get daemonset -l \"%s,%s\" --field-selector metadata.name=%s -o custom-columns=UID:.metadata.uid --no-headers",
+		s.monitorLabel("="), monitorSelector, s.monitorDaemonset(),
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return []string{"monitor daemonset not found"}, nil
+	}
+
+	cmd = fmt.Sprintf(
+		"kubectl get events --field-selector involvedObject.uid=%s,reason=FailedCreate -o custom-columns=Msg:.message --no-headers",
+		lines[0],
+	)
+	logger().Debug("exec", "cmd", cmd)
+	return utils.ExecCmdLinesContext(ctx, cmd)
+}
+
+// monitorPodErrors returns the (non-transient) failures of the monitor pods
+// (see categorizeMonitorPod)
+func (s *Session) monitorPodErrors(ctx context.Context) ([]string, error) {
+	cmd := fmt.Sprintf(
+		`kubectl get pods -l "%s,%s" -o custom-columns=Phase:.status.phase,Ready:.status.containerStatuses[0].ready,Reason:.status.containerStatuses[0].state.waiting.reason --no-headers`,
+		s.monitorLabel("="), monitorSelector,
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, line := range lines {
+		// pods that run, but are unreachable, are not a pod failure
+		if c := categorizeMonitorPod(line); strings.HasPrefix(c, "monitor pod") {
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// WaitMonitor waits until the monitor pods are ready on all the nodes they
+// are scheduled on
+func (s *Session) WaitMonitor() error {
+	return s.WaitMonitorContext(context.Background())
+}
+
+// WaitMonitorContext waits until the monitor pods are ready on all the nodes
+// they are scheduled on. It fails early if the pods cannot be created (e.g.,
+// admission control rejects privileged pods) or fail (e.g., the image cannot
+// be pulled).
+func (s *Session) WaitMonitorContext(ctx context.Context) error {
+	cmd := fmt.Sprintf(
+		"kubectl get daemonset -l \"%s,%s\" --field-selector metadata.name=%s -o custom-columns=Desired:.status.desiredNumberScheduled,Ready:.status.numberReady --no-headers",
+		s.monitorLabel("="), monitorSelector, s.monitorDaemonset(),
+	)
+
+	start := time.Now()
+	status := "unknown"
+	for time.Since(start) < monitorReadyTimeout {
+		if err := sleepContext(ctx, 2*time.Second); err != nil {
+			return err
+		}
+
+		if errs, err := s.monitorAdmissionErrors(ctx); err == nil && len(errs) > 0 {
+			return fmt.Errorf("monitor pods could not be created: %s", errs[len(errs)-1])
+		}
+		if errs, err := s.monitorPodErrors(ctx); err == nil && len(errs) > 0 {
+			return fmt.Errorf("monitor pods failed: %s", errs[0])
+		}
+
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+		if err != nil || len(lines) == 0 {
+			continue
+		}
+		fields := strings.Fields(lines[0])
+		if len(fields) != 2 {
+			continue
+		}
+		status = fmt.Sprintf("%s/%s ready", fields[1], fields[0])
+		desired, err1 := strconv.Atoi(fields[0])
+		ready, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil && desired > 0 && ready == desired {
+			logger().Info("monitor ready", "pods", desired, "duration", time.Since(start).Round(time.Second))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("monitor not ready after %s (%s)", monitorReadyTimeout, status)
+}
+
+// DisableMonitor removes the monitor of the session (unless it is the shared
+// monitor), and switches it to running without the monitor (the wrapper
+// script passes --no-monitor from then on). It is used when the monitor cannot
+// run, but the benchmarks still can.
+func (s *Session) DisableMonitor() {
+	// the shared monitor is used by other sessions
+	if !s.UseExistingMonitor() {
+		err := s.KubeCleanup()
+		if err != nil {
+			logger().Warn("failed to remove monitor", "error", err)
+		}
+	}
+	s.noMonitor = true
+	s.writeScript(s.id, s.dirBase)
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// DefaultMonitorTLSSecret is the default name of the kubernetes.io/tls
+	// secret with the certificate of the monitor
+	DefaultMonitorTLSSecret = "knb-monitor-tls"
+	// mount path of the TLS secret in the monitor containers
+	monitorTLSMountPath = "/etc/knb-monitor-tls"
+	// name that the certificate of the monitor is verified against: the
+	// monitors are reached at node addresses, so one certificate (with this
+	// DNS name) is used by the monitors of all the nodes
+	monitorTLSServerName = "knb-monitor"
+)
+
+// MonitorTLS is the TLS configuration of the connections to the monitor
+type MonitorTLS struct {
+	CA     string // path of the CA certificate that signs the certificate of the monitor
+	Cert   string // path of the client certificate (empty for no client authentication)
+	Key    string // path of the client key
+	Secret string // kubernetes.io/tls secret of the monitor (see genMonitorYaml)
+}
+
+// mTLS returns true if the monitor authenticates the clients
+func (c *MonitorTLS) mTLS() bool {
+	return c.Cert != ""
+}
+
+// clientConfig returns the TLS configuration of the connections to the monitor
+func (c *MonitorTLS) clientConfig() (*tls.Config, error) {
+	pem, err := os.ReadFile(c.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read monitor CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in monitor CA file %s", c.CA)
+	}
+
+	conf := &tls.Config{
+		RootCAs:    pool,
+		ServerName: monitorTLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.mTLS() {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load monitor client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// SetMonitorTLS encrypts the connections to the monitor with TLS (see
+// MonitorTLS). The certificate of the monitor must be valid for the
+// knb-monitor DNS name, and be in the (kubernetes.io/tls) secret of the
+// configuration, which the monitor daemonset mounts. With a client
+// certificate, the monitor also authenticates kubenetbench (the ca.crt of
+// the secret must then sign the client certificate). The wrapper script
+// records the paths of the certificate files (not their contents), so they
+// must still exist when later commands of the session run.
+func (s *Session) SetMonitorTLS(c MonitorTLS) error {
+	if c.CA == "" {
+		return fmt.Errorf("monitor TLS requires a CA certificate")
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("monitor TLS client authentication requires both a certificate and a key")
+	}
+	if c.Secret == "" {
+		c.Secret = DefaultMonitorTLSSecret
+	}
+	// the wrapper script may run from another directory
+	for _, path := range []*string{&c.CA, &c.Cert, &c.Key} {
+		if *path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+		*path = abs
+	}
+	if _, err := c.clientConfig(); err != nil {
+		return err
+	}
+	s.monitorTLS = &c
+	s.writeScript(s.id, s.dirBase)
+	return nil
+}
+
+// SetInsecureMonitor allows plaintext connections to the monitor addresses
+// (node or pod IPs), i.e., without port-forwarding or TLS (see SetMonitorTLS).
+// The wrapper script passes --insecure-monitor, so that later commands of the
+// session (e.g., done) can still reach the monitor.
+func (s *Session) SetInsecureMonitor() {
+	s.insecureMonitor = true
+	s.writeScript(s.id, s.dirBase)
+}
+
+// monitorCredentials returns the transport credentials of the connections to
+// the monitor: TLS if configured (see SetMonitorTLS), or nil for plaintext
+// connections, which are only allowed through port-forwards (tunneled
+// through the API server), or explicitly (see SetInsecureMonitor)
+func (s *Session) monitorCredentials() (credentials.TransportCredentials, error) {
+	if s.monitorTLS != nil {
+		conf, err := s.monitorTLS.clientConfig()
+		if err != nil {
+			return nil, err
+		}
+		return credentials.NewTLS(conf), nil
+	}
+	if s.portForward || s.insecureMonitor {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("connections to the monitor would not be encrypted: configure TLS (--monitor-tls-ca), use --port-forward, or allow plaintext connections with --insecure-monitor")
+}
+
+// CheckMonitorTransport returns an error if the connections to the monitor
+// would be plaintext without being allowed (see monitorCredentials), or if
+// the TLS configuration is invalid
+func (s *Session) CheckMonitorTransport() error {
+	_, err := s.monitorCredentials()
+	return err
+}
+
+// monitorTLSArgs returns the TLS arguments of the monitor server (see
+// SetMonitorTLS)
+func (s *Session) monitorTLSArgs() []string {
+	if s.monitorTLS == nil {
+		return nil
+	}
+	args := []string{
+		fmt.Sprintf("-tls-cert=%s/tls.crt", monitorTLSMountPath),
+		fmt.Sprintf("-tls-key=%s/tls.key", monitorTLSMountPath),
+	}
+	if s.monitorTLS.mTLS() {
+		args = append(args, fmt.Sprintf("-tls-client-ca=%s/ca.crt", monitorTLSMountPath))
+	}
+	return args
+}
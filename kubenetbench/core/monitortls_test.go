@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+// writeMonitorCerts writes a CA and a certificate (for both the monitor and
+// the client) signed by it, and returns their paths
+func writeMonitorCerts(t *testing.T) (*tlsCerts, MonitorTLS) {
+	certs, err := generateTLSCerts([]string{monitorTLSServerName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := MonitorTLS{
+		CA:   filepath.Join(dir, "ca.crt"),
+		Cert: filepath.Join(dir, "tls.crt"),
+		Key:  filepath.Join(dir, "tls.key"),
+	}
+	for fname, data := range map[string][]byte{c.CA: certs.ca, c.Cert: certs.cert, c.Key: certs.key} {
+		if err := os.WriteFile(fname, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certs, c
+}
+
+func TestMonitorCredentials(t *testing.T) {
+	// plaintext connections to node addresses must be allowed explicitly
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.monitorDialOptions(); err == nil || !strings.Contains(err.Error(), "--insecure-monitor") {
+		t.Errorf("expected an error for plaintext connections, got %v", err)
+	}
+	s.SetInsecureMonitor()
+	if creds, err := s.monitorCredentials(); creds != nil || err != nil {
+		t.Errorf("insecure: unexpected credentials: %v %v", creds, err)
+	}
+
+	// port-forwards are tunneled through the API server
+	s, err = NewSession("test-pf", t.TempDir(), true, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := s.monitorCredentials(); creds != nil || err != nil {
+		t.Errorf("port-forward: unexpected credentials: %v %v", creds, err)
+	}
+
+	_, c := writeMonitorCerts(t)
+	if err := s.SetMonitorTLS(c); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := s.monitorCredentials()
+	if err != nil || creds == nil || creds.Info().SecurityProtocol != "tls" {
+		t.Fatalf("TLS: unexpected credentials: %v %v", creds, err)
+	}
+	if opts, err := s.monitorDialOptions(); err != nil || len(opts) != 2 {
+		t.Errorf("TLS: unexpected dial options: %v %v", opts, err)
+	}
+	if args := strings.Join(s.monitorTLSArgs(), " "); !strings.Contains(args, "-tls-client-ca="+monitorTLSMountPath+"/ca.crt") {
+		t.Errorf("unexpected monitor arguments: %s", args)
+	}
+
+	for _, bad := range []MonitorTLS{
+		{},
+		{CA: c.CA, Cert: c.Cert},
+		{CA: c.Key},
+		{CA: filepath.Join(t.TempDir(), "missing.crt")},
+	} {
+		if err := s.SetMonitorTLS(bad); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
+
+func TestMonitorTLSYaml(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, c := writeMonitorCerts(t)
+	c.Cert, c.Key = "", ""
+	// relative paths are stored as absolute paths
+	abs := c.CA
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CA, err = filepath.Rel(wd, abs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMonitorTLS(c); err != nil {
+		t.Fatal(err)
+	}
+	yaml, _ := checkMonitorSession(t, s,
+		[]string{
+			`"-tls-cert=/etc/knb-monitor-tls/tls.crt", "-tls-key=/etc/knb-monitor-tls/tls.key"]`,
+			"mountPath: /etc/knb-monitor-tls",
+			"secretName: " + DefaultMonitorTLSSecret,
+		},
+		[]string{"--monitor-tls-ca=" + abs + " "})
+	if strings.Contains(yaml, "-tls-client-ca") {
+		t.Errorf("unexpected client CA without client certificate:\n%s", yaml)
+	}
+}
+
+func TestDialMonitorTLS(t *testing.T) {
+	certs, c := writeMonitorCerts(t)
+	cert, err := tls.X509KeyPair(certs.cert, certs.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	pb.RegisterKubebenchMonitorServer(srv, &pb.UnimplementedKubebenchMonitorServer{})
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	call := func(s *Session) error {
+		if err := s.SetMonitorDialTimeout(time.Second); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := s.dialMonitorAddr(context.Background(), l.Addr().String())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = pb.NewKubebenchMonitorClient(conn).GetNetStats(context.Background(), &pb.Empty{})
+		return err
+	}
+
+	// the call reaches the server (which does not implement it) over TLS
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMonitorTLS(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(s); status.Code(err) != codes.Unimplemented {
+		t.Errorf("TLS: unexpected error: %v", err)
+	}
+
+	// a plaintext client does not
+	if err := call(&Session{insecureMonitor: true}); err == nil || status.Code(err) == codes.Unimplemented {
+		t.Errorf("plaintext: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// NetemEndpoints are the endpoints whose node netem can be applied on
+var NetemEndpoints = []string{"srv", "cli"}
+
+// netemGrace is added to the benchmark duration for the removal of the
+// qdisc by the node itself, in case kubenetbench does not get to remove it
+// (e.g., it is killed)
+const netemGrace = 10 * time.Minute
+
+var (
+	// netem options (see tc-netem(8)) accepted by SetNetem
+	netemOptions = map[string]bool{
+		"limit": true, "delay": true, "distribution": true, "loss": true,
+		"corrupt": true, "duplicate": true, "reorder": true, "gap": true,
+		"rate": true, "slot": true, "ecn": true,
+	}
+	netemArgRe   = regexp.MustCompile(`^[a-zA-Z0-9.%_-]+$`)
+	netemIfaceRe = regexp.MustCompile(`^[a-zA-Z0-9._@-]{1,15}$`)
+	netemPIDRe   = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// NetemConf is a netem configuration, applied on the egress interface of the
+// node of an endpoint for the duration of the run
+type NetemConf struct {
+	Spec     string // netem options, e.g., "delay 20ms 5ms loss 0.1%"
+	Endpoint string // srv or cli
+	Iface    string // node interface (empty for the interface of the default route)
+}
+
+// netemTarget is an interface that netem was applied on
+type netemTarget struct {
+	node     string
+	pod      string // monitor pod of the node
+	iface    string
+	timerPID string // PID of the safety timer that removes the qdisc (empty if unknown)
+}
+
+// parseNetemSpec validates the netem options, and returns them as arguments.
+// Only the options of netemOptions, and their values, are accepted, since the
+// arguments are passed to a shell on the node.
+func parseNetemSpec(spec string) ([]string, error) {
+	args := strings.Fields(spec)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty netem spec")
+	}
+	if !netemOptions[args[0]] {
+		return nil, fmt.Errorf("invalid netem spec %q: unknown option %q", spec, args[0])
+	}
+	for _, a := range args {
+		if !netemArgRe.MatchString(a) {
+			return nil, fmt.Errorf("invalid netem spec %q: invalid argument %q", spec, a)
+		}
+	}
+	return args, nil
+}
+
+// SetNetem sets a netem qdisc (delay, jitter, loss, reordering) on the node
+// of an endpoint for the run (see applyNetem)
+func (r *RunBenchCtx) SetNetem(conf NetemConf) error {
+	args, err := parseNetemSpec(conf.Spec)
+	if err != nil {
+		return err
+	}
+	conf.Spec = strings.Join(args, " ")
+
+	valid := false
+	for _, e := range NetemEndpoints {
+		valid = valid || e == conf.Endpoint
+	}
+	if !valid {
+		return fmt.Errorf("invalid netem endpoint %q (available values: %s)", conf.Endpoint, strings.Join(NetemEndpoints, ","))
+	}
+	if conf.Iface != "" && !netemIfaceRe.MatchString(conf.Iface) {
+		return fmt.Errorf("invalid netem interface %q", conf.Iface)
+	}
+
+	r.netem = &conf
+	return nil
+}
+
+// netemNodes returns the nodes to apply netem on: the nodes of the server pods,
+// or the node the client is placed on (which must be known before the client
+// is created)
+func (r *RunBenchCtx) netemNodes(srvSelector string) ([]string, error) {
+	srvNodes := func() ([]string, error) {
+		cmd := fmt.Sprintf(
+			"kubectl get pod%s -l \"%s\" -o custom-columns=Node:.spec.nodeName --no-headers",
+			nsArg(r.srvSpec.Namespace), srvSelector,
+		)
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLines(cmd)
+		if err != nil {
+			return nil, fmt.Errorf("command %s failed: %w", cmd, err)
+		}
+		nodes := []string{}
+		for _, l := range lines {
+			l = strings.TrimSpace(l)
+			if l == "" || l == "<none>" {
+				continue
+			}
+			found := false
+			for _, n := range nodes {
+				found = found || n == l
+			}
+			if !found {
+				nodes = append(nodes, l)
+			}
+		}
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("no scheduled server pods")
+		}
+		sort.Strings(nodes)
+		return nodes, nil
+	}
+
+	if r.netem.Endpoint == "srv" {
+		return srvNodes()
+	}
+
+	switch aff := r.cliSpec.Affinity; {
+	case strings.HasPrefix(aff, "host="):
+		return []string{strings.TrimPrefix(aff, "host=")}, nil
+	case aff == "same":
+		logger().Warn("client runs on the server node: netem only affects traffic that leaves the node")
+		return srvNodes()
+	default:
+		return nil, fmt.Errorf("netem on the client node requires a known client node: use --client-affinity host=<node>")
+	}
+}
+
+// netemTimerScript returns the script of the safety timer that removes the
+// netem qdisc of iface after the given number of seconds. It runs in the
+// background, and the script prints its PID, so that removeNetem can stop it
+// (otherwise, it would remove the qdisc of a later run on the same node).
+func netemTimerScript(seconds int, iface string) string {
+	return fmt.Sprintf(
+		"nohup sh -c \"sleep %d; tc qdisc show dev %s root | grep -q netem && tc qdisc del dev %s root\" >/dev/null 2>&1 & echo $!",
+		seconds, iface, iface,
+	)
+}
+
+// netemRemoveScript returns the script that stops the safety timer (if its
+// PID is known, and it is still the timer) and removes the netem qdisc
+func netemRemoveScript(t netemTarget) string {
+	script := fmt.Sprintf("tc qdisc del dev %s root", t.iface)
+	if t.timerPID == "" {
+		return script
+	}
+	return fmt.Sprintf("if grep -q \"tc qdisc del dev %s\" /proc/%s/cmdline 2>/dev/null; then kill %s; fi; %s",
+		t.iface, t.timerPID, t.timerPID, script)
+}
+
+// netemExec executes a shell command in the monitor pod of a node (which runs
+// privileged, on the host network)
+func netemExec(ctx context.Context, pod string, script string) ([]string, error) {
+	cmd := fmt.Sprintf("kubectl exec %s -- sh -c '%s'", pod, script)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("command %s failed: %w", cmd, err)
+	}
+	return lines, nil
+}
+
+// applyNetem applies the netem configuration (if any) on the egress interface
+// of the endpoint's nodes, via their monitor pods. It is called once the
+// server is ready, and before the client is created. Every qdisc that was
+// added is removed by removeNetem (called by KubeCleanup). As a safety net,
+// the node removes it by itself after the benchmark duration plus netemGrace
+// (see netemTimerScript), unless removeNetem stopped the timer.
+func (r *RunBenchCtx) applyNetem(ctx context.Context, srvSelector string) error {
+	if r.netem == nil {
+		return nil
+	}
+	if !r.session.MonitorEnabled() || r.session.MonitorSidecar() {
+		return fmt.Errorf("netem requires the monitor daemonset (it is applied by the privileged monitor pods)")
+	}
+
+	nodes, err := r.netemNodes(srvSelector)
+	if err != nil {
+		return err
+	}
+
+	expire := time.Duration(r.benchmark.GetTimeout())*time.Second + netemGrace
+	for _, node := range nodes {
+		pod, err := r.session.KubeGetMonitorPodForNodeContext(ctx, node)
+		if err != nil {
+			return fmt.Errorf("no monitor pod on node %s: %w", node, err)
+		}
+
+		iface := r.netem.Iface
+		if iface == "" {
+			lines, err := netemExec(ctx, pod, `ip route show default | awk "{ for (i = 1; i < NF; i++) if (\$i == \"dev\") { print \$(i+1); exit } }"`)
+			if err != nil {
+				return err
+			}
+			if len(lines) == 0 || !netemIfaceRe.MatchString(strings.TrimSpace(lines[0])) {
+				return fmt.Errorf("no default route interface on node %s: use --netem-iface", node)
+			}
+			iface = strings.TrimSpace(lines[0])
+		}
+
+		// NB: add (rather than replace) fails if the interface already
+		// has a (non-default) root qdisc, which we would not restore
+		script := fmt.Sprintf("tc qdisc add dev %s root netem %s", iface, r.netem.Spec)
+		if _, err := netemExec(ctx, pod, script); err != nil {
+			return fmt.Errorf("adding netem qdisc on node %s failed: %w", node, err)
+		}
+		target := netemTarget{node: node, pod: pod, iface: iface}
+		logger().Info("netem applied", "node", node, "iface", iface, "netem", r.netem.Spec)
+
+		lines, err := netemExec(ctx, pod, netemTimerScript(int(expire.Seconds()), iface))
+		if err != nil {
+			logger().Warn("failed to schedule the removal of the netem qdisc on the node", "node", node, "error", err)
+		} else if len(lines) > 0 && netemPIDRe.MatchString(strings.TrimSpace(lines[0])) {
+			target.timerPID = strings.TrimSpace(lines[0])
+		}
+		r.netemTargets = append(r.netemTargets, target)
+	}
+
+	r.AddParam("NETEM", r.netem.Spec)
+	r.addMeta("NETEM_ENDPOINT", r.netem.Endpoint)
+	r.addMeta("NETEM_NODES", strings.Join(nodes, ","))
+	return nil
+}
+
+// removeNetem removes the netem qdiscs added by applyNetem. It is called on
+// cleanup regardless of --no-cleanup, since the qdiscs affect all the traffic
+// of the nodes.
+func (r *RunBenchCtx) removeNetem() {
+	for _, t := range r.netemTargets {
+		// the run context might be canceled: use a fresh one
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := netemExec(ctx, t.pod, netemRemoveScript(t))
+		cancel()
+		if err != nil {
+			logger().Error("failed to remove netem qdisc: remove it manually (tc qdisc del dev <iface> root)", "node", t.node, "iface", t.iface, "error", err)
+			continue
+		}
+		logger().Info("netem removed", "node", t.node, "iface", t.iface)
+	}
+	r.netemTargets = nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetemSpec(t *testing.T) {
+	valid := map[string]int{
+		"delay 20ms":                    2,
+		" delay 20ms 5ms  loss 0.1% ":   5,
+		"loss 1% reorder 25% 50% gap 5": 7,
+		"rate 100mbit":                  2,
+	}
+	for spec, n := range valid {
+		args, err := parseNetemSpec(spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", spec, err)
+		} else if len(args) != n {
+			t.Errorf("%q: expected %d arguments, got %v", spec, n, args)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"20ms",
+		"pfifo limit 10",
+		"delay 20ms; reboot",
+		"delay '20ms'",
+		"delay $(id)",
+	}
+	for _, spec := range invalid {
+		if _, err := parseNetemSpec(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestSetNetem(t *testing.T) {
+	r := &RunBenchCtx{}
+	if err := r.SetNetem(NetemConf{Spec: "delay 20ms", Endpoint: "node"}); err == nil {
+		t.Error("expected error for invalid endpoint")
+	}
+	if err := r.SetNetem(NetemConf{Spec: "delay 20ms", Endpoint: "srv", Iface: "eth0;ls"}); err == nil {
+		t.Error("expected error for invalid interface")
+	}
+	if err := r.SetNetem(NetemConf{Spec: " delay  20ms ", Endpoint: "cli", Iface: "eth0"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.netem.Spec != "delay 20ms" {
+		t.Errorf("unexpected spec: %q", r.netem.Spec)
+	}
+}
+
+func TestNetemTimer(t *testing.T) {
+	// the timer is checked (and its script stopped) through /proc
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc not available")
+	}
+	// NB: the interface does not exist, so tc (if installed) fails
+
+	// the timer prints its PID...
+	out, err := exec.Command("sh", "-c", netemTimerScript(60, "knbtest0")).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := strings.TrimSpace(string(out))
+	if !netemPIDRe.MatchString(pid) {
+		t.Fatalf("unexpected timer output: %q", out)
+	}
+	proc := filepath.Join("/proc", pid)
+	if _, err := os.Stat(proc); err != nil {
+		t.Fatalf("timer is not running: %v", err)
+	}
+
+	// ...and is stopped on removal
+	exec.Command("sh", "-c", netemRemoveScript(netemTarget{iface: "knbtest0", timerPID: pid})).Run()
+	for i := 0; i < 50; i++ {
+		if data, err := os.ReadFile(filepath.Join(proc, "stat")); err != nil || strings.Contains(string(data), ") Z ") {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("timer %s is still running", pid)
+}
@@ -16,6 +16,18 @@ type NetperfConf struct {
 	PreArgs       []string
 	MoreArgs      []string
 	MoreBenchArgs []string
+
+	// socket buffer sizes (SO_SNDBUF/SO_RCVBUF) of both ends, using netperf's
+	// size format (e.g., 4M). Empty values keep the system defaults.
+	SendBuf string
+	RecvBuf string
+
+	// TCP congestion control algorithm of both ends (empty for the system
+	// default)
+	CongControl string
+
+	// interval (seconds) of interim results (see ParseIntervals), 0 for none
+	Interval int
 }
 
 // NetperfConfDefault returns a NetperfConf with the default values
@@ -38,7 +50,7 @@ func (cnf *NetperfConf) GetTimeout() int {
 // WriteSrvContainerYaml writes the server yaml
 func (cnf *NetperfConf) WriteSrvContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
 	pw.AppendNewLineOrDie(`name: netperf-srv`)
-	pw.AppendNewLineOrDie(`image: cilium/kubenetbench`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, paramBenchImage(params)))
 	pw.AppendNewLineOrDie(`command: ["netserver"]`)
 	pw.AppendNewLineOrDie(`args : [`)
 	pw.PushPrefix("    ")
@@ -59,6 +71,82 @@ func (cnf *NetperfConf) WriteSrvPortsYaml(pw *utils.PrefixWriter, params map[str
 	pw.AppendNewLineOrDie(fmt.Sprintf(`  targetPort: %d`, cnf.DataPort))
 }
 
+// netperfSockBufFields are the output fields for the requested, initial, and
+// final (i.e., after autotuning) socket buffer sizes of both ends
+func netperfSockBufFields() []string {
+	return []string{
+		"LSS_SIZE_REQ",
+		"LSS_SIZE",
+		"LSS_SIZE_END",
+		"LSR_SIZE_REQ",
+		"LSR_SIZE",
+		"LSR_SIZE_END",
+		"RSS_SIZE_REQ",
+		"RSS_SIZE",
+		"RSS_SIZE_END",
+		"RSR_SIZE_REQ",
+		"RSR_SIZE",
+		"RSR_SIZE_END",
+	}
+}
+
+// writeSockBufArgs writes the test-specific args that set the socket buffer
+// sizes of the client (-s) and the server (-S)
+func (cnf *NetperfConf) writeSockBufArgs(pw *utils.PrefixWriter) {
+	if cnf.SendBuf == "" && cnf.RecvBuf == "" {
+		return
+	}
+	sizes := fmt.Sprintf("%s,%s", cnf.SendBuf, cnf.RecvBuf)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`"-s", "%s", # local socket buffers (send,recv)`, sizes))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`"-S", "%s", # remote socket buffers (send,recv)`, sizes))
+}
+
+// writeIntervalArgs writes the args that enable interim results (demo mode)
+func (cnf *NetperfConf) writeIntervalArgs(pw *utils.PrefixWriter) {
+	if cnf.Interval == 0 {
+		return
+	}
+	pw.AppendNewLineOrDie(fmt.Sprintf(`"-D", "%d", # interim results interval`, cnf.Interval))
+}
+
+// netperfCongControlFields are the output fields for the (effective)
+// congestion control algorithm of both ends
+func netperfCongControlFields() []string {
+	return []string{
+		"LOCAL_CONG_CONTROL",
+		"REMOTE_CONG_CONTROL",
+	}
+}
+
+// writeCongControlArgs writes the test-specific args that set the congestion
+// control algorithm of the client and the server
+func (cnf *NetperfConf) writeCongControlArgs(pw *utils.PrefixWriter) {
+	if cnf.CongControl == "" {
+		return
+	}
+	pw.AppendNewLineOrDie(fmt.Sprintf(`"-K", "%s,%s", # congestion control (local,remote)`, cnf.CongControl, cnf.CongControl))
+}
+
+// CheckResult checks that the requested congestion control algorithm was
+// used: netperf falls back to the default if it cannot set it (e.g., the
+// module is not loaded, or the algorithm is not allowed)
+func (cnf *NetperfConf) CheckResult(res *BenchResult) error {
+	if cnf.CongControl == "" {
+		return nil
+	}
+	for _, end := range []struct{ key, name string }{
+		{"LOCAL_CONG_CONTROL", "client"},
+		{"REMOTE_CONG_CONTROL", "server"},
+	} {
+		cc, ok := res.Values[end.key]
+		if ok && cc != cnf.CongControl {
+			return fmt.Errorf("congestion control %s is not available on the %s node (effective: %s): check net.ipv4.tcp_available_congestion_control and net.ipv4.tcp_allowed_congestion_control (e.g., modprobe tcp_%s)",
+				cnf.CongControl, end.name, cc, cnf.CongControl)
+		}
+	}
+	return nil
+}
+
 /**
  * RR
  */
@@ -79,7 +167,7 @@ type NetperfRRConf struct {
 //       This option controls the CPU, and probably by extension memory, affinity of netperf and/or netserver.
 
 func netperfOutFieldsCommon() []string {
-	return []string{
+	return append([]string{
 		"THROUGHPUT",
 		"THROUGHPUT_UNITS",
 		"THROUGHPUT_CONFID",
@@ -110,7 +198,7 @@ func netperfOutFieldsCommon() []string {
 		// "REMOTE_CPU_BIND",
 		"LOCAL_TRANSPORT_RETRANS",
 		"REMOTE_TRANSPORT_RETRANS",
-	}
+	}, append(netperfSockBufFields(), netperfCongControlFields()...)...)
 }
 
 // WriteCliContainerYaml writes the client yaml
@@ -134,7 +222,7 @@ func (cnf *NetperfRRConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params m
 	)
 
 	pw.AppendNewLineOrDie(`name: netperf-cli`)
-	pw.AppendNewLineOrDie(`image: cilium/kubenetbench`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, paramBenchImage(params)))
 	pw.AppendNewLineOrDie(fmt.Sprintf(`command: ["%s"]`, cnf.CliCommand))
 	pw.AppendNewLineOrDie(`args : [`)
 	pw.PushPrefix("    ")
@@ -146,6 +234,7 @@ func (cnf *NetperfRRConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params m
 	}
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-l", "%d", # timeout`, cnf.Timeout))
 	pw.AppendNewLineOrDie(`"-j", # enable additional statistics`)
+	cnf.writeIntervalArgs(pw)
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-H", "%v",`, serverIP))
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-t", "%s", # testname`, cnf.TestName))
 	if len(cnf.MoreArgs) > 0 {
@@ -161,6 +250,8 @@ func (cnf *NetperfRRConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params m
 	// -D seems to kill the performance for high queue depths, so don't use it
 	// pw.AppendNewLineOrDie(`"-D",# no delay`)
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-k", "%s",`, strings.Join(outputFields, ",")))
+	cnf.writeSockBufArgs(pw)
+	cnf.writeCongControlArgs(pw)
 	if len(cnf.MoreBenchArgs) > 0 {
 		pw.AppendNewLineOrDie("# Additional test-specific args")
 		for _, arg := range cnf.MoreBenchArgs {
@@ -225,8 +316,10 @@ func (cnf *NetperfStreamConf) WriteCliContainerYaml(pw *utils.PrefixWriter, para
 		"LOCAL_TRANSPORT_RETRANS",
 		"REMOTE_TRANSPORT_RETRANS",
 	}
+	outputFields = append(outputFields, netperfSockBufFields()...)
+	outputFields = append(outputFields, netperfCongControlFields()...)
 	pw.AppendNewLineOrDie(`name: netperf-cli`)
-	pw.AppendNewLineOrDie(`image: cilium/kubenetbench`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, paramBenchImage(params)))
 	pw.AppendNewLineOrDie(fmt.Sprintf(`command: ["%s"]`, cnf.CliCommand))
 	pw.AppendNewLineOrDie(`args : [`)
 	pw.PushPrefix("    ")
@@ -238,6 +331,7 @@ func (cnf *NetperfStreamConf) WriteCliContainerYaml(pw *utils.PrefixWriter, para
 	}
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-l", "%d", # timeout`, cnf.Timeout))
 	pw.AppendNewLineOrDie(`"-j", # enable additional statistics`)
+	cnf.writeIntervalArgs(pw)
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-H", "%v",`, serverIP))
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-t", "%s", # testname`, cnf.TestName))
 	if len(cnf.MoreArgs) > 0 {
@@ -253,6 +347,8 @@ func (cnf *NetperfStreamConf) WriteCliContainerYaml(pw *utils.PrefixWriter, para
 	// -D seems to kill the performance for high queue depths, so don't use it
 	// pw.AppendNewLineOrDie(`"-D",# no delay`)
 	pw.AppendNewLineOrDie(fmt.Sprintf(`"-k", "%s",`, strings.Join(outputFields, ",")))
+	cnf.writeSockBufArgs(pw)
+	cnf.writeCongControlArgs(pw)
 
 	// netperf seems to be setting SO_DONTROUTE for udp_stream, which might
 	// not work in many setups. -R 1 disables this.
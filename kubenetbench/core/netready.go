@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// NetReadySt is the state for a network readiness benchmark: it repeatedly
+// creates a client pod and measures the time from the client container
+// starting to the first successful connection to a (fixed) server.
+type NetReadySt struct {
+	RunBenchCtx *RunBenchCtx
+	Iterations  int
+}
+
+// port we connect to (netserver control port)
+const netReadyPort = 12865
+
+var netReadyCliTemplate = template.Must(template.New("netready").Parse(`apiVersion: v1
+kind: Pod
+metadata:
+  name: knb-netready-{{.iter}}
+  {{if .cliNamespace}}namespace: {{.cliNamespace}}{{end}}
+  labels : {
+     {{.runLabel}},
+     role: netready,
+     {{.iterLabel}}: "{{.iter}}",
+  }
+spec:
+  restartPolicy: Never
+  {{.cliHost}}
+  {{.cliSecurity}}
+  {{.cliAffinity}}
+  {{.cliTolerations}}
+  {{.cliVolumes}}
+  containers:
+  - name: netready
+    image: {{.benchImage}}
+    command: ["bash", "-c"]
+    args:
+    - |
+      t0=$(date +%s%N)
+      for i in $(seq 1 {{.attempts}}); do
+        if timeout 1 bash -c "</dev/tcp/{{.serverIP}}/{{.port}}" 2>/dev/null; then
+          t1=$(date +%s%N)
+          echo NETREADY_US=$(( (t1 - t0) / 1000 ))
+          exit 0
+        fi
+        sleep 0.01
+      done
+      echo "failed to connect to {{.serverIP}}:{{.port}}"
+      exit 1
+    {{.cliContainerSecurity}}
+    {{.cliVolumeMounts}}
+`))
+
+func (s *NetReadySt) genCliYaml(serverIP string, iter int) (string, error) {
+	r := s.RunBenchCtx
+	yaml := fmt.Sprintf("%s/netready-%d.yaml", r.getDir(), iter)
+	logger().Info("generating yaml", "file", yaml)
+	f, err := os.Create(yaml)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	vals := map[string]interface{}{
+		"runLabel":             r.getRunLabel(": "),
+		"cliNamespace":         r.cliSpec.Namespace,
+		"iter":                 iter,
+		"iterLabel":            r.session.labelKey(iterLabel),
+		"benchImage":           r.session.benchImageRef(),
+		"serverIP":             serverIP,
+		"port":                 netReadyPort,
+		"attempts":             3000,
+		"cliAffinity":          "{{template \"cliAffinity\"}}",
+		"cliHost":              "{{template \"cliHost\"}}",
+		"cliSecurity":          "{{template \"cliSecurity\"}}",
+		"cliContainerSecurity": "{{template \"cliContainerSecurity\"}}",
+		"cliVolumes":           "{{template \"cliVolumes\"}}",
+		"cliVolumeMounts":      "{{template \"cliVolumeMounts\"}}",
+		"cliTolerations":       "{{template \"cliTolerations\"}}",
+	}
+
+	templates := map[string]utils.PrefixRenderer{
+		"cliAffinity":          r.cliAffinityWrite,
+		"cliHost":              r.cliSpec.hostOptsWrite,
+		"cliSecurity":          r.cliSpec.podSecurityWrite,
+		"cliContainerSecurity": r.cliSpec.containerSecurityWrite,
+		"cliVolumes":           r.cliSpec.volumesWrite,
+		"cliVolumeMounts":      r.cliSpec.volumeMountsWrite,
+		"cliTolerations":       r.cliSpec.tolerationsWrite,
+	}
+
+	err = utils.RenderTemplate(netReadyCliTemplate, vals, templates, f)
+	return yaml, err
+}
+
+// runIteration creates a client pod and returns the measured readiness latency
+func (s *NetReadySt) runIteration(serverIP string, iter int) (float64, error) {
+	r := s.RunBenchCtx
+	yaml, err := s.genCliYaml(serverIP, iter)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.KubeApply(yaml)
+	if err != nil {
+		return 0, fmt.Errorf("failed to initiate client: %w", err)
+	}
+
+	selector := fmt.Sprintf("%s,role=netready,%s=%d", r.getRunLabel("="), r.session.labelKey(iterLabel), iter)
+	for {
+		phase, err := r.KubeGetPodPhase(r.cliSpec.Namespace, selector)
+		if err != nil {
+			return 0, err
+		}
+
+		if phase == "Failed" {
+			return 0, fmt.Errorf("client execution failed")
+		}
+		if phase == "Succeeded" {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+
+	logfile := fmt.Sprintf("%s/netready-%d.log", r.getDir(), iter)
+	err = r.KubeSaveLogs(r.cliSpec.Namespace, selector, logfile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save client logs: %w", err)
+	}
+
+	f, err := os.Open(logfile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	res, err := ParseBenchResult(r.runid, f)
+	if err != nil {
+		return 0, err
+	}
+
+	us, ok := res.Float("NETREADY_US")
+	if !ok {
+		return 0, fmt.Errorf("no NETREADY_US value in %s", logfile)
+	}
+
+	return us, nil
+}
+
+// Execute netready run
+func (s NetReadySt) Execute() error {
+	if s.Iterations < 1 {
+		return fmt.Errorf("invalid number of iterations: %d", s.Iterations)
+	}
+
+	// start server pod (netserver)
+	srv := Pod2PodSt{RunBenchCtx: s.RunBenchCtx}
+	srvYamlFname, err := srv.genSrvYaml()
+	if err != nil {
+		return err
+	}
+
+	err = s.RunBenchCtx.KubeApply(srvYamlFname)
+	if err != nil {
+		return err
+	}
+	defer s.RunBenchCtx.KubeCleanup()
+
+	srvSelector := fmt.Sprintf("%s,role=srv", s.RunBenchCtx.getRunLabel("="))
+	err = s.RunBenchCtx.waitForSrvReady(context.Background(), srvSelector)
+	if err != nil {
+		return err
+	}
+	time.Sleep(2 * time.Second)
+	srvIP, err := s.RunBenchCtx.KubeGetPodIP(s.RunBenchCtx.srvSpec.Namespace, srvSelector, 30, 2*time.Second)
+	if err != nil {
+		return err
+	}
+	logger().Info("server address", "server_ip", srvIP)
+
+	vals := make([]float64, 0, s.Iterations)
+	for i := 0; i < s.Iterations; i++ {
+		us, err := s.runIteration(srvIP, i)
+		if err != nil {
+			return fmt.Errorf("iteration %d failed: %w", i, err)
+		}
+		logger().Info("netready iteration", "iteration", i+1, "iterations", s.Iterations, "us", us)
+		vals = append(vals, us)
+	}
+
+	err = s.writeResults(vals)
+	if err != nil {
+		return err
+	}
+	return s.RunBenchCtx.pauseForInspection(context.Background())
+}
+
+// writeResults writes the distribution of the measurements in KEY=VALUE form
+// (see ParseBenchResult)
+func (s *NetReadySt) writeResults(vals []float64) error {
+	fname := fmt.Sprintf("%s/netready.log", s.RunBenchCtx.getDir())
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st := ComputeStats(vals)
+	fmt.Fprintf(f, "NETREADY_N=%d\n", st.N)
+	fmt.Fprintf(f, "NETREADY_MEAN_US=%.0f\n", st.Mean)
+	fmt.Fprintf(f, "NETREADY_STDDEV_US=%.0f\n", st.Stddev)
+	fmt.Fprintf(f, "NETREADY_MIN_US=%.0f\n", st.Min)
+	fmt.Fprintf(f, "NETREADY_P50_US=%.0f\n", Percentile(vals, 50))
+	fmt.Fprintf(f, "NETREADY_P90_US=%.0f\n", Percentile(vals, 90))
+	fmt.Fprintf(f, "NETREADY_P99_US=%.0f\n", Percentile(vals, 99))
+	fmt.Fprintf(f, "NETREADY_MAX_US=%.0f\n", st.Max)
+
+	logger().Info("netready results", "file", fname)
+	return nil
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+// interval for sampling conntrack entries during the run
+const netStatsSampleInterval = 10 * time.Second
+
+// nstat counters that are summarized in the results (nstat name -> result key)
+var netStatsKeyCounters = []struct{ counter, key string }{
+	{"TcpRetransSegs", "TCP_RETRANS_SEGS"},
+	{"TcpExtTCPLostRetransmit", "TCP_LOST_RETRANSMIT"},
+}
+
+// netStatsCollector keeps the state of network statistics collection
+type netStatsCollector struct {
+	nodes  []string
+	start  map[string]*pb.NetStats
+	mu     sync.Mutex
+	ctPeak map[string]int64 // conntrack peak per node
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// GetNetStatsNodeContext retrieves a network statistics snapshot from the monitor of a node
+func (s *Session) GetNetStatsNodeContext(ctx context.Context, node string) (*pb.NetStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, err := s.DialMonitor(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	cli := pb.NewKubebenchMonitorClient(conn)
+	return cli.GetNetStats(ctx, &pb.Empty{})
+}
+
+func (c *netStatsCollector) updatePeak(node string, st *pb.NetStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st.ConntrackCount > c.ctPeak[node] {
+		c.ctPeak[node] = st.ConntrackCount
+	}
+}
+
+func (r *RunBenchCtx) startNetStats(ctx context.Context) error {
+	nodes, err := r.monitorTargets()
+	if err != nil {
+		return err
+	}
+
+	c := &netStatsCollector{
+		start:  make(map[string]*pb.NetStats),
+		ctPeak: make(map[string]int64),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	for _, node := range nodes {
+		st, err := r.getNetStats(ctx, node)
+		if err != nil {
+			logger().Warn("retrieving network stats from monitor failed", "node", node, "error", err)
+			continue
+		}
+		c.nodes = append(c.nodes, node)
+		c.start[node] = st
+		c.updatePeak(node, st)
+	}
+
+	// sample conntrack entries to track the peak
+	go func() {
+		defer close(c.done)
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-time.After(netStatsSampleInterval):
+			}
+
+			for _, node := range c.nodes {
+				st, err := r.getNetStats(ctx, node)
+				if err == nil {
+					c.updatePeak(node, st)
+				}
+			}
+		}
+	}()
+
+	r.netStats = c
+	return nil
+}
+
+func (r *RunBenchCtx) endNetStats(ctx context.Context) error {
+	c := r.netStats
+	if c == nil {
+		return nil
+	}
+	close(c.stop)
+	<-c.done
+
+	summary := make(map[string]int64)
+	for _, node := range c.nodes {
+		end, err := r.getNetStats(ctx, node)
+		if err != nil {
+			logger().Warn("retrieving network stats from monitor failed", "node", node, "error", err)
+			continue
+		}
+		c.updatePeak(node, end)
+
+		deltas := netStatsDeltas(c.start[node], end)
+		fname := fmt.Sprintf("%s/netstats-%s.txt", r.getDir(), node)
+		err = writeNetStats(fname, deltas, end)
+		if err != nil {
+			logger().Warn("writing network stats failed", "node", node, "error", err)
+		}
+
+		for _, kc := range netStatsKeyCounters {
+			summary[kc.key] += deltas[kc.counter]
+		}
+		if c.ctPeak[node] > summary["CONNTRACK_PEAK"] {
+			summary["CONNTRACK_PEAK"] = c.ctPeak[node]
+		}
+		if end.TimeWait > summary["TIME_WAIT"] {
+			summary["TIME_WAIT"] = end.TimeWait
+		}
+	}
+
+	fname := fmt.Sprintf("%s/netstats.log", r.getDir())
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	keys := make([]string, 0, len(summary))
+	for k := range summary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(f, "%s=%d\n", k, summary[k])
+	}
+
+	logger().Info("network stats",
+		"retransmits", summary["TCP_RETRANS_SEGS"],
+		"lost_retransmits", summary["TCP_LOST_RETRANSMIT"],
+		"conntrack_peak", summary["CONNTRACK_PEAK"],
+		"time_wait", summary["TIME_WAIT"])
+	return nil
+}
+
+// netStatsDeltas computes the counter differences between two snapshots. The
+// counters of monitors that sample every network namespace of the node are
+// per namespace (<namespace>/<counter>), and their differences are summed:
+// the counters of namespaces created during the run start at zero, and those
+// of namespaces deleted during the run are not included.
+func netStatsDeltas(start, end *pb.NetStats) map[string]int64 {
+	ret := make(map[string]int64)
+	for k, v := range end.Counters {
+		counter := k
+		if i := strings.LastIndex(k, "/"); i >= 0 {
+			counter = k[i+1:]
+		}
+		ret[counter] += v - start.Counters[k]
+	}
+	return ret
+}
+
+func writeNetStats(fname string, deltas map[string]int64, end *pb.NetStats) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	keys := make([]string, 0, len(deltas))
+	for k, v := range deltas {
+		if v != 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(f, "# nstat counter deltas (non-zero)\n")
+	for _, k := range keys {
+		fmt.Fprintf(f, "%s %d\n", k, deltas[k])
+	}
+	fmt.Fprintf(f, "# ss -s (end of run)\n%s", end.SsSummary)
+	return nil
+}
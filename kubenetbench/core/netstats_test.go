@@ -0,0 +1,33 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+func TestNetStatsDeltas(t *testing.T) {
+	// a monitor that samples its own network namespace
+	start := &pb.NetStats{Counters: map[string]int64{"TcpRetransSegs": 10, "TcpInSegs": 100}}
+	end := &pb.NetStats{Counters: map[string]int64{"TcpRetransSegs": 15, "TcpInSegs": 100}}
+	expected := map[string]int64{"TcpRetransSegs": 5, "TcpInSegs": 0}
+	if deltas := netStatsDeltas(start, end); !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("unexpected deltas: %v", deltas)
+	}
+
+	// a monitor that samples every network namespace: the host's, one of a
+	// pod that was deleted, and one of a pod that was created during the run
+	start = &pb.NetStats{Counters: map[string]int64{
+		"net:[1]/TcpRetransSegs": 10,
+		"net:[2]/TcpRetransSegs": 50,
+	}}
+	end = &pb.NetStats{Counters: map[string]int64{
+		"net:[1]/TcpRetransSegs": 12,
+		"net:[3]/TcpRetransSegs": 7,
+	}}
+	expected = map[string]int64{"TcpRetransSegs": 9}
+	if deltas := netStatsDeltas(start, end); !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("unexpected deltas: %v", deltas)
+	}
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+const (
+	multusNetworksAnnotation = "k8s.v1.cni.cncf.io/networks"
+	multusStatusAnnotation   = "k8s.v1.cni.cncf.io/network-status"
+	// pod interface of the default (cluster) network
+	defaultPodIface = "eth0"
+)
+
+// annotationsWrite writes the pod annotations (if any)
+func (s *ContainerSpec) annotationsWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if s.NetworkAttachment == "" {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`annotations:`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  %s: %q`, multusNetworksAnnotation, s.NetworkAttachment))
+}
+
+// netStatus is an entry of the multus network-status annotation
+type netStatus struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface"`
+	IPs       []string `json:"ips"`
+}
+
+func parseNetStatus(data string, iface string) (string, error) {
+	var entries []netStatus
+	err := json.Unmarshal([]byte(data), &entries)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse network status: %w", err)
+	}
+
+	for _, e := range entries {
+		if e.Interface == iface && len(e.IPs) > 0 {
+			return e.IPs[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("interface %s not found in network status", iface)
+}
+
+// KubeGetPodIfaceIP returns the IP address of a pod's secondary interface
+// using the network-status annotation (set by multus)
+func (c *RunBenchCtx) KubeGetPodIfaceIP(
+	ns string,
+	selector string,
+	iface string,
+	retries uint,
+	st time.Duration,
+) (string, error) {
+
+	retriesOrig := retries
+	jsonpath := strings.ReplaceAll(multusStatusAnnotation, ".", `\.`)
+	cmd := fmt.Sprintf(
+		"kubectl get pod%s -l \"%s\" -o jsonpath='{.items[0].metadata.annotations.%s}'",
+		nsArg(ns), selector, jsonpath,
+	)
+	for {
+		logger().Debug("exec", "cmd", cmd, "remaining_retries", retries)
+		lines, err := utils.ExecCmdLines(cmd)
+		if err == nil && len(lines) > 0 {
+			var ip string
+			ip, err = parseNetStatus(strings.Join(lines, "\n"), iface)
+			if err == nil {
+				return ip, nil
+			}
+		}
+
+		if retries == 0 {
+			return "", fmt.Errorf("Error executing %s after %d retries (last error:%w)", cmd, retriesOrig, err)
+		}
+
+		retries--
+		time.Sleep(st)
+	}
+}
+
+// KubeGetPodIfaceDriver returns the driver of a pod's interface (via ethtool)
+func (c *RunBenchCtx) KubeGetPodIfaceDriver(ns string, selector string, iface string) (string, error) {
+	podname, err := c.KubeGetPodName(ns, selector)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get pod name: %w", err)
+	}
+
+	cmd := fmt.Sprintf("kubectl exec%s %s -- ethtool -i %s", nsArg(ns), podname, iface)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLines(cmd)
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %w", cmd, err)
+	}
+
+	for _, line := range lines {
+		if strings.HasPrefix(line, "driver:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "driver:")), nil
+		}
+	}
+
+	return "", fmt.Errorf("no driver information in the output of %s", cmd)
+}
+
+// hasNetworkAttachments returns true if any of the endpoints uses a multus
+// network attachment
+func (c *RunBenchCtx) hasNetworkAttachments() bool {
+	return c.cliSpec.NetworkAttachment != "" || c.srvSpec.NetworkAttachment != ""
+}
+
+// benchIface returns the interface of the benchmark traffic
+func (s *ContainerSpec) benchIface() string {
+	if s.NetworkAttachment == "" {
+		return defaultPodIface
+	}
+	return s.NetworkIface
+}
+
+// recordIface records the network of an endpoint (attachment, interface, and
+// interface driver) in the run metadata, as NET_<ROLE>_* keys. It returns the
+// interface and its driver (empty if it could not be determined).
+func (c *RunBenchCtx) recordIface(role string, spec *ContainerSpec, selector string) (string, string) {
+	attachment := spec.NetworkAttachment
+	if attachment == "" {
+		attachment = "default"
+	}
+	iface := spec.benchIface()
+	c.addMeta(fmt.Sprintf("NET_%s_ATTACHMENT", role), attachment)
+	c.addMeta(fmt.Sprintf("NET_%s_IFACE", role), iface)
+	driver, err := c.KubeGetPodIfaceDriver(spec.Namespace, selector, iface)
+	if err != nil {
+		logger().Warn("failed to get interface driver", "role", role, "iface", iface, "error", err)
+		return iface, ""
+	}
+	logger().Info("interface driver", "role", role, "attachment", attachment, "iface", iface, "driver", driver)
+	c.addMeta(fmt.Sprintf("NET_%s_IFACE_DRIVER", role), driver)
+	return iface, driver
+}
+
+// recordSrvIface records the server's network in the run metadata. The
+// NET_IFACE and NET_IFACE_DRIVER keys are kept for compatibility.
+func (c *RunBenchCtx) recordSrvIface(selector string) {
+	iface, driver := c.recordIface("SRV", c.srvSpec, selector)
+	c.addMeta("NET_IFACE", iface)
+	if driver != "" {
+		c.addMeta("NET_IFACE_DRIVER", driver)
+	}
+}
+
+// recordCliIface records the client's network in the run metadata (the client
+// needs to be running)
+func (c *RunBenchCtx) recordCliIface() {
+	selector := fmt.Sprintf("%s,role=cli", c.getRunLabel("="))
+	c.recordIface("CLI", c.cliSpec, selector)
+}
@@ -0,0 +1,311 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+const (
+	// nodeLabelsFname is the file (in the sysinfo directory of a node) that
+	// the Kubernetes labels of the node are stored in
+	nodeLabelsFname = "labels.txt"
+	// nodeEnvFname is the file (in the sysinfo directory of a node) that the
+	// environment of the node is stored in (see loadNodeEnv)
+	nodeEnvFname = "env.txt"
+	// nodeEnvDiffFname is the session file with the differences of the
+	// environments of the nodes (see CompareNodeEnvs)
+	nodeEnvDiffFname = "node-env.txt"
+)
+
+// nodeEnvIgnore are environment keys that differ across nodes without a
+// configuration difference (e.g., the host name, the root device, or the
+// kernel image path, whose release is kernel.release)
+var nodeEnvIgnore = map[string]struct{}{
+	"label.kubernetes.io/hostname": {},
+	"cmdline.root":                 {},
+	"cmdline.resume":               {},
+	"cmdline.BOOT_IMAGE":           {},
+}
+
+// sysInfoLines returns the lines of a sysinfo section, without the commands
+// of the script (set -x)
+func sysInfoLines(rd io.Reader) ([]string, error) {
+	ret := []string{}
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		if l := scanner.Text(); !strings.HasPrefix(l, "+") {
+			ret = append(ret, l)
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// parseNodeLabels returns the labels of the node (key=value lines)
+func parseNodeLabels(rd io.Reader) (map[string]string, error) {
+	lines, err := sysInfoLines(rd)
+	ret := make(map[string]string)
+	for _, l := range lines {
+		if k, v, ok := strings.Cut(l, "="); ok {
+			ret["label."+k] = v
+		}
+	}
+	return ret, err
+}
+
+// parseCmdline returns the kernel command line parameters (/proc/cmdline),
+// e.g., cmdline.isolcpus=2-7 (parameters without a value are "true")
+func parseCmdline(rd io.Reader) (map[string]string, error) {
+	lines, err := sysInfoLines(rd)
+	ret := make(map[string]string)
+	for _, l := range lines {
+		for _, p := range strings.Fields(l) {
+			k, v, ok := strings.Cut(p, "=")
+			if !ok {
+				v = "true"
+			}
+			ret["cmdline."+k] = v
+		}
+	}
+	return ret, err
+}
+
+// parseCPUModel returns the CPU model and the number of CPUs (/proc/cpuinfo)
+func parseCPUModel(rd io.Reader) (map[string]string, error) {
+	lines, err := sysInfoLines(rd)
+	ret := make(map[string]string)
+	cpus := 0
+	for _, l := range lines {
+		k, v, ok := strings.Cut(l, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(k) {
+		case "processor":
+			cpus++
+		case "model name":
+			ret["cpu.model"] = strings.Join(strings.Fields(v), " ")
+		}
+	}
+	if cpus > 0 {
+		ret["cpu.count"] = fmt.Sprintf("%d", cpus)
+	}
+	return ret, err
+}
+
+// parseNuma returns the NUMA topology: the number of NUMA nodes, and the CPUs
+// of each node
+func parseNuma(rd io.Reader) (map[string]string, error) {
+	lines, err := sysInfoLines(rd)
+	ret := make(map[string]string)
+	nodes := 0
+	for _, l := range lines {
+		// e.g., node0 cpus=0-15
+		fields := strings.Fields(l)
+		if len(fields) == 2 && strings.HasPrefix(fields[0], "node") && strings.HasPrefix(fields[1], "cpus=") {
+			ret["numa."+fields[0]+".cpus"] = strings.TrimPrefix(fields[1], "cpus=")
+			nodes++
+		}
+	}
+	if nodes > 0 {
+		ret["numa.nodes"] = fmt.Sprintf("%d", nodes)
+	}
+	return ret, err
+}
+
+// parseFirmware returns the system (DMI) and BIOS information, and the
+// driver and firmware versions of the physical NICs (ethtool -i). Since NIC
+// names may differ across identical nodes, NICs are numbered in the order of
+// their PCI address, e.g., nic.0.driver.
+func parseFirmware(rd io.Reader) (map[string]string, error) {
+	lines, err := sysInfoLines(rd)
+	ret := make(map[string]string)
+	type nic struct {
+		name, bus string
+		vals      map[string]string
+	}
+	var nics []*nic
+	for _, l := range lines {
+		if strings.HasPrefix(l, "# ") {
+			nics = append(nics, &nic{name: strings.TrimPrefix(l, "# "), vals: make(map[string]string)})
+			continue
+		}
+		if len(nics) == 0 {
+			if k, v, ok := strings.Cut(l, "="); ok && v != "" {
+				ret["dmi."+k] = strings.TrimSpace(v)
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(l, ": ")
+		if !ok {
+			continue
+		}
+		n := nics[len(nics)-1]
+		switch k {
+		case "driver", "version", "firmware-version":
+			n.vals[k] = strings.TrimSpace(v)
+		case "bus-info":
+			n.bus = strings.TrimSpace(v)
+		}
+	}
+
+	sort.SliceStable(nics, func(i, j int) bool {
+		if nics[i].bus != nics[j].bus {
+			return nics[i].bus < nics[j].bus
+		}
+		return nics[i].name < nics[j].name
+	})
+	for i, n := range nics {
+		for k, v := range n.vals {
+			ret[fmt.Sprintf("nic.%d.%s", i, k)] = v
+		}
+	}
+	return ret, err
+}
+
+// nodeEnvParsers are the sysinfo sections of the environment of a node, and
+// their parsers
+var nodeEnvParsers = map[string]func(io.Reader) (map[string]string, error){
+	"labels":   parseNodeLabels,
+	"kernel":   parseKernelRelease,
+	"cmdline":  parseCmdline,
+	"cpu":      parseCPUModel,
+	"numa":     parseNuma,
+	"firmware": parseFirmware,
+}
+
+// loadNodeEnv loads the environment of a node (its labels, kernel release and
+// command line, CPU model, NUMA topology, and BIOS and NIC firmware) from its
+// sysinfo directory
+func loadNodeEnv(dir string) (map[string]string, error) {
+	return loadSysInfoSections(dir, nodeEnvParsers)
+}
+
+// saveNodeLabels stores the Kubernetes labels of a node in its sysinfo
+// directory
+func saveNodeLabels(node, dir string) error {
+	cmd := fmt.Sprintf(
+		"kubectl get node %s -o go-template='{{range $k, $v := .metadata.labels}}{{$k}}={{$v}}{{\"\\n\"}}{{end}}'",
+		node,
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLines(cmd)
+	if err != nil {
+		return fmt.Errorf("command %s failed: %w", cmd, err)
+	}
+	data := strings.Join(lines, "\n") + "\n"
+	return os.WriteFile(filepath.Join(dir, nodeLabelsFname), []byte(data), 0644)
+}
+
+// writeKeyValueFile writes KEY=VALUE lines, sorted by key
+func writeKeyValueFile(fname string, kv map[string]string) error {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, kv[k])
+	}
+	return os.WriteFile(fname, []byte(b.String()), 0644)
+}
+
+// NodeEnvDiff is an environment key whose value differs across nodes
+type NodeEnvDiff struct {
+	Key    string
+	Values map[string]string // values by node (empty if missing)
+}
+
+func (d NodeEnvDiff) String() string {
+	nodes := make([]string, 0, len(d.Values))
+	for n := range d.Values {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	vals := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		vals = append(vals, fmt.Sprintf("%s=%q", n, d.Values[n]))
+	}
+	return fmt.Sprintf("%s: %s", d.Key, strings.Join(vals, " "))
+}
+
+// diffNodeEnvs returns the keys whose values differ across nodes (given the
+// environments by node), sorted by key
+func diffNodeEnvs(envs map[string]map[string]string) []NodeEnvDiff {
+	keys := make(map[string]struct{})
+	for _, env := range envs {
+		for k := range env {
+			keys[k] = struct{}{}
+		}
+	}
+
+	ret := []NodeEnvDiff{}
+	for k := range keys {
+		if _, ok := nodeEnvIgnore[k]; ok {
+			continue
+		}
+		d := NodeEnvDiff{Key: k, Values: make(map[string]string, len(envs))}
+		differs := false
+		first := true
+		var v0 string
+		for node, env := range envs {
+			v := env[k]
+			d.Values[node] = v
+			if first {
+				v0, first = v, false
+			}
+			differs = differs || v != v0
+		}
+		if differs {
+			ret = append(ret, d)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
+
+// CompareNodeEnvs stores the environment of each node of the session (see
+// loadNodeEnv) in its sysinfo directory (env.txt), and returns the keys whose
+// values differ across nodes (e.g., a different CPU model or NIC firmware),
+// which are also written to node-env.txt in the session directory
+func (s *Session) CompareNodeEnvs() ([]NodeEnvDiff, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := make(map[string]map[string]string)
+	for _, e := range entries {
+		dir := filepath.Join(s.dir, e.Name())
+		if !e.IsDir() || !isSysInfoDir(dir) {
+			continue
+		}
+		env, err := loadNodeEnv(dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKeyValueFile(filepath.Join(dir, nodeEnvFname), env); err != nil {
+			return nil, err
+		}
+		envs[e.Name()] = env
+	}
+
+	diffs := diffNodeEnvs(envs)
+	f, err := os.Create(filepath.Join(s.dir, nodeEnvDiffFname))
+	if err != nil {
+		return diffs, err
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "# environment keys that differ across the %d nodes (see <node>/%s)\n", len(envs), nodeEnvFname)
+	for _, d := range diffs {
+		fmt.Fprintln(f, d)
+	}
+	return diffs, nil
+}
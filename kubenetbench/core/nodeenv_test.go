@@ -0,0 +1,102 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFirmware(t *testing.T) {
+	out := `+ cat /sys/class/dmi/id/bios_version
+sys_vendor=Dell Inc.
+bios_version=2.14.1
+bios_date=
+# eth0
+driver: mlx5_core
+version: 5.15.0
+firmware-version: 16.35.2000 (MT_0000000012)
+bus-info: 0000:3b:00.0
+# eno1
+driver: ixgbe
+firmware-version: 0x800003e7
+bus-info: 0000:18:00.0
+`
+	got, err := parseFirmware(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"dmi.sys_vendor":         "Dell Inc.",
+		"dmi.bios_version":       "2.14.1",
+		"nic.0.driver":           "ixgbe",
+		"nic.0.firmware-version": "0x800003e7",
+		"nic.1.driver":           "mlx5_core",
+		"nic.1.version":          "5.15.0",
+		"nic.1.firmware-version": "16.35.2000 (MT_0000000012)",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v while expected %v", got, expected)
+	}
+}
+
+func TestParseCmdlineNuma(t *testing.T) {
+	cmdline, _ := parseCmdline(strings.NewReader("+ cat /proc/cmdline\nBOOT_IMAGE=/vmlinuz root=UUID=abc ro isolcpus=2-7\n"))
+	if cmdline["cmdline.isolcpus"] != "2-7" || cmdline["cmdline.ro"] != "true" || cmdline["cmdline.root"] != "UUID=abc" {
+		t.Errorf("got %v", cmdline)
+	}
+
+	numa, _ := parseNuma(strings.NewReader("+ cat /sys/devices/system/node/node0/cpulist\nnode0 cpus=0-15\nnode1 cpus=16-31\n"))
+	expected := map[string]string{"numa.nodes": "2", "numa.node0.cpus": "0-15", "numa.node1.cpus": "16-31"}
+	if !reflect.DeepEqual(numa, expected) {
+		t.Errorf("got %v while expected %v", numa, expected)
+	}
+}
+
+func TestCompareNodeEnvs(t *testing.T) {
+	dir := t.TempDir()
+	sess, err := NewSession("test", dir, false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(node, section, data string) {
+		nodeDir := filepath.Join(sess.Dir(), node)
+		if err := os.MkdirAll(nodeDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(nodeDir, section+".txt"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []string{"k8s1", "k8s2"} {
+		write(n, "kernel", "Linux "+n+" 6.1.0 #1 SMP x86_64 GNU/Linux\n")
+		write(n, "labels", "kubernetes.io/hostname="+n+"\npool=bench\n")
+	}
+	write("k8s1", "cpu", "processor\t: 0\nmodel name\t: Intel Xeon\n")
+	// same NIC and kernel, with different names
+	write("k8s1", "firmware", "# eth0\ndriver: ixgbe\nbus-info: 0000:18:00.0\n")
+	write("k8s2", "firmware", "# ens1f0\ndriver: ixgbe\nbus-info: 0000:18:00.0\n")
+	write("k8s1", "cmdline", "BOOT_IMAGE=/boot/vmlinuz-6.1.0\n")
+	write("k8s2", "cmdline", "BOOT_IMAGE=(hd0,gpt2)/vmlinuz-6.1.0\n")
+	write("k8s2", "cpu", "processor\t: 0\nmodel name\t: AMD EPYC\n")
+
+	diffs, err := sess.CompareNodeEnvs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Key != "cpu.model" {
+		t.Fatalf("got %v", diffs)
+	}
+	if diffs[0].Values["k8s2"] != "AMD EPYC" {
+		t.Errorf("got %v", diffs[0].Values)
+	}
+	env, err := os.ReadFile(filepath.Join(sess.Dir(), "k8s1", nodeEnvFname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "cmdline.BOOT_IMAGE=/boot/vmlinuz-6.1.0\ncpu.count=1\ncpu.model=Intel Xeon\nkernel.release=6.1.0\nlabel.kubernetes.io/hostname=k8s1\nlabel.pool=bench\nnic.0.driver=ixgbe\n"
+	if string(env) != expected {
+		t.Errorf("got %q while expected %q", env, expected)
+	}
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// ObserveConf is the benchmark of observe runs: no pods are created, and the
+// nodes are observed for the duration (see ObserveSt)
+type ObserveConf struct {
+	Timeout int
+}
+
+// GetTimeout returns the observation duration
+func (cnf *ObserveConf) GetTimeout() int {
+	return cnf.Timeout
+}
+
+// WriteSrvContainerYaml is a no-op: observe runs have no pods
+func (cnf *ObserveConf) WriteSrvContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+}
+
+// WriteCliContainerYaml is a no-op: observe runs have no pods
+func (cnf *ObserveConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+}
+
+// WriteSrvPortsYaml is a no-op: observe runs have no pods
+func (cnf *ObserveConf) WriteSrvPortsYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+}
+
+// ObserveSt is the state for an observe run: the monitor collects node data
+// (sysinfo, perf, packet captures, network stats, etc.) for a window during
+// which the traffic is generated by other workloads, e.g., a real application
+// under test. No benchmark pods are created.
+type ObserveSt struct {
+	RunBenchCtx *RunBenchCtx
+	Nodes       []string // nodes to observe (empty for all the nodes with a monitor)
+}
+
+// monitorNodes returns the nodes that run a monitor pod of the session
+func (s *Session) monitorNodes(ctx context.Context) ([]string, error) {
+	cmd := fmt.Sprintf(
+		"kubectl get pods -l \"%s,%s\" -o custom-columns=Node:.spec.nodeName --no-headers",
+		s.monitorLabel("="), monitorSelector,
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []string{}
+	for _, l := range lines {
+		if n := strings.TrimSpace(l); n != "" && n != "<none>" {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+// Execute observe run
+func (s ObserveSt) Execute() error {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the run, bounded by ctx
+func (s ObserveSt) ExecuteContext(ctx context.Context) error {
+	r := s.RunBenchCtx
+	sess := r.session
+	if !sess.MonitorEnabled() {
+		return fmt.Errorf("observe requires the monitor")
+	} else if sess.MonitorSidecar() {
+		return fmt.Errorf("observe requires the monitor daemonset: the monitor sidecar runs in benchmark pods")
+	}
+	if r.ss != nil || r.hubble {
+		return fmt.Errorf("socket samples and hubble flows select the benchmark traffic, and are not supported by observe")
+	}
+
+	nodes := s.Nodes
+	if len(nodes) == 0 {
+		var err error
+		nodes, err = sess.monitorNodes(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the monitor nodes: %w", err)
+		}
+		if len(nodes) == 0 {
+			return fmt.Errorf("no monitor pods found (see init or monitor deploy)")
+		}
+	}
+	r.observeNodes = nodes
+	r.addMeta("OBSERVE_NODES", strings.Join(nodes, ","))
+
+	// sysinfo at the start of the window
+	for _, node := range nodes {
+		dir := fmt.Sprintf("%s/sysinfo-%s", r.getDir(), node)
+		if err := sess.getSysInfoNodeDir(ctx, node, dir); err != nil {
+			logger().Warn("failed to retrieve sysinfo", "node", node, "error", err)
+		}
+	}
+
+	collect := r.collectPerf || r.pcap != nil || r.rdma || r.cpu
+	if collect {
+		r.startCollection(ctx)
+	}
+	if r.collectNetStats {
+		if err := r.startNetStats(ctx); err != nil {
+			logger().Warn("failed to start network stats collection", "error", err)
+		}
+	}
+
+	duration := time.Duration(r.benchmark.GetTimeout()) * time.Second
+	logger().Info("observing nodes", "nodes", strings.Join(nodes, ","), "duration", duration)
+	if err := sleepContext(ctx, duration); err != nil {
+		return err
+	}
+
+	if r.collectNetStats {
+		if err := r.endNetStats(ctx); err != nil {
+			logger().Warn("failed to end network stats collection", "error", err)
+		}
+	}
+
+	var err error
+	if collect {
+		err = r.endCollection(ctx)
+		r.processCollection()
+	}
+	logger().Info("observation done", "dir", r.getDir())
+	return err
+}
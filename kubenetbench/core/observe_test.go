@@ -0,0 +1,39 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObserve(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunBenchCtx(s, "observe", &ContainerSpec{}, &ContainerSpec{}, true, &ObserveConf{Timeout: 10}, false, false)
+	if err := r.MakeDir(); err != nil {
+		t.Fatal(err)
+	}
+	if spec := r.Spec(); spec.Benchmark != "observe" || spec.Duration != 10 {
+		t.Errorf("unexpected spec: %s %d", spec.Benchmark, spec.Duration)
+	}
+
+	// the observed nodes are the monitor targets, instead of the run nodes
+	r.observeNodes = []string{"k8s1", "k8s2"}
+	targets, err := r.monitorTargets()
+	if err != nil || strings.Join(targets, ",") != "k8s1,k8s2" {
+		t.Errorf("unexpected targets: %v (%v)", targets, err)
+	}
+
+	// pod-scoped collections are not supported
+	r.SetHubble()
+	err = ObserveSt{RunBenchCtx: r, Nodes: []string{"k8s1"}}.Execute()
+	if err == nil || !strings.Contains(err.Error(), "not supported by observe") {
+		t.Errorf("expected an error for hubble flows, got %v", err)
+	}
+
+	s.SetMonitorSidecar()
+	if err := (ObserveSt{RunBenchCtx: r}).Execute(); err == nil {
+		t.Errorf("expected an error with the monitor sidecar")
+	}
+}
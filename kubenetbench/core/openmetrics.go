@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openMetricsPrefix is the prefix of the exported metric names
+const openMetricsPrefix = "knb_"
+
+var (
+	openMetricsLabelRe      = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	openMetricsValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// openMetricsLabel returns a valid label name for a key
+func openMetricsLabel(key string) string {
+	ret := openMetricsLabelRe.ReplaceAllString(strings.ToLower(key), "_")
+	if ret == "" || (ret[0] >= '0' && ret[0] <= '9') {
+		ret = "_" + ret
+	}
+	return ret
+}
+
+// openMetricsLabels formats a label set, sorted by name
+func openMetricsLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, openMetricsValueEscaper.Replace(labels[k])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// WriteOpenMetrics writes the metrics in summaryMetrics of the runs of a
+// session in the OpenMetrics text format (e.g., for the node exporter's
+// textfile collector). Each metric is a gauge (knb_<metric>), labelled with the
+// session, the run parameters (see AddParam), and the run tags (see AddTag),
+// prefixed with "tag_". If several runs have the same labels, the latest one
+// (by run id) is written, so that the output tracks the latest results of each
+// configuration. If exemplars is true, each sample carries an exemplar whose
+// trace_id is the run id, which links the sample to the run directory (and its
+// perf archives). Since OpenMetrics only allows exemplars on counters (and
+// histograms), the metrics are then counters (knb_<metric>_total), whose
+// value is the result of the latest run, rather than gauges.
+func WriteOpenMetrics(sessDir string, w io.Writer, exemplars bool) (int, error) {
+	results, err := loadRunResults(sessDir)
+	if err != nil {
+		return 0, err
+	}
+
+	type sample struct {
+		labels string
+		value  string
+		runid  string
+	}
+	families := make(map[string][]*sample)
+	for _, res := range results {
+		labels := map[string]string{"session": filepath.Base(sessDir)}
+		for k, v := range res.Meta {
+			if strings.HasPrefix(k, paramPrefix) {
+				labels[openMetricsLabel(strings.TrimPrefix(k, paramPrefix))] = v
+			}
+		}
+		for k, v := range res.Tags {
+			labels[openMetricsLabel("tag_"+k)] = v
+		}
+		if units := res.Values["THROUGHPUT_UNITS"]; units != "" {
+			labels["throughput_units"] = units
+		}
+		lstr := openMetricsLabels(labels)
+
+		for _, m := range summaryMetrics {
+			v, ok := res.Values[m]
+			if !ok {
+				continue
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || (exemplars && f < 0) {
+				continue
+			}
+			s := &sample{labels: lstr, value: v, runid: res.RunID}
+			// results are ordered by run id: later runs replace earlier ones
+			replaced := false
+			for i, prev := range families[m] {
+				if prev.labels == lstr {
+					families[m][i], replaced = s, true
+					break
+				}
+			}
+			if !replaced {
+				families[m] = append(families[m], s)
+			}
+		}
+	}
+
+	metricType, sampleSuffix := "gauge", ""
+	if exemplars {
+		metricType, sampleSuffix = "counter", "_total"
+	}
+	for _, m := range summaryMetrics {
+		if len(families[m]) == 0 {
+			continue
+		}
+		name := openMetricsPrefix + strings.ToLower(m)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+		fmt.Fprintf(w, "# HELP %s kubenetbench %s result\n", name, strings.ToLower(m))
+		for _, s := range families[m] {
+			fmt.Fprintf(w, "%s%s%s %s", name, sampleSuffix, s.labels, s.value)
+			if exemplars {
+				fmt.Fprintf(w, " # %s %s", openMetricsLabels(map[string]string{"trace_id": s.runid}), s.value)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	_, err = fmt.Fprintln(w, "# EOF")
+	return len(results), err
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sess")
+	runs := []struct{ id, result, meta string }{
+		{"foo-1", "THROUGHPUT=100\nTHROUGHPUT_UNITS=10^6bits/s\n", "PARAM_MSG_SIZE=64\n"},
+		{"foo-2", "THROUGHPUT=200\nTHROUGHPUT_UNITS=10^6bits/s\nP50_LATENCY=10\n", "PARAM_MSG_SIZE=64\n"},
+		{"foo-3", "THROUGHPUT=300\nTHROUGHPUT_UNITS=10^6bits/s\n", "PARAM_MSG_SIZE=1024\n"},
+	}
+	for _, r := range runs {
+		rdir := filepath.Join(dir, r.id)
+		if err := os.MkdirAll(rdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(rdir, "result"), []byte(r.result), 0644)
+		os.WriteFile(filepath.Join(rdir, "meta"), []byte(r.meta), 0644)
+	}
+
+	var buf bytes.Buffer
+	n, err := WriteOpenMetrics(dir, &buf, true)
+	if err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("got %d runs while expected 3", n)
+	}
+
+	// exemplars are only allowed on counters
+	expected := `# TYPE knb_throughput counter
+# HELP knb_throughput kubenetbench throughput result
+knb_throughput_total{msg_size="64",session="sess",throughput_units="10^6bits/s"} 200 # {trace_id="foo-2"} 200
+knb_throughput_total{msg_size="1024",session="sess",throughput_units="10^6bits/s"} 300 # {trace_id="foo-3"} 300
+# TYPE knb_p50_latency counter
+# HELP knb_p50_latency kubenetbench p50_latency result
+knb_p50_latency_total{msg_size="64",session="sess",throughput_units="10^6bits/s"} 10 # {trace_id="foo-2"} 10
+# EOF
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if _, err := WriteOpenMetrics(dir, &buf, false); err != nil {
+		t.Fatalf("WriteOpenMetrics failed: %s", err)
+	}
+	expected = `# TYPE knb_throughput gauge
+# HELP knb_throughput kubenetbench throughput result
+knb_throughput{msg_size="64",session="sess",throughput_units="10^6bits/s"} 200
+knb_throughput{msg_size="1024",session="sess",throughput_units="10^6bits/s"} 300
+# TYPE knb_p50_latency gauge
+# HELP knb_p50_latency kubenetbench p50_latency result
+knb_p50_latency{msg_size="64",session="sess",throughput_units="10^6bits/s"} 10
+# EOF
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,394 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OrchestrationCommands are the commands that can be orchestrated (see
+// BenchSpec)
+var OrchestrationCommands = []string{"pod2pod", "host2pod", "service", "ingress", "selftest"}
+
+// orchestrationRunArgs are the run commands (and their arguments) of the
+// orchestration commands that are not run commands
+var orchestrationRunArgs = map[string][]string{
+	"host2pod": {"pod2pod", "--cli-on-host"},
+}
+
+// tags identifying the runs of an orchestration (see Session.Orchestrate)
+const (
+	orchestrationTag     = "orchestration"
+	orchestrationNameTag = "orchestration_name"
+)
+
+var benchSpecNameRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// orchestrationNamespaceFlags are the flags that the namespace of a benchmark
+// sets (see BenchSpec)
+var orchestrationNamespaceFlags = []string{"--client-namespace", "--server-namespace"}
+
+// BenchSpec is a benchmark of an orchestration: a run command (e.g., pod2pod)
+// and its arguments, run under its name as the run label. Since the pods of
+// the runs have fixed names (e.g., knb-cli), concurrent benchmarks run in
+// distinct namespaces (of both the client and the server).
+type BenchSpec struct {
+	Name      string   `yaml:"name"`
+	Command   string   `yaml:"command"`
+	Namespace string   `yaml:"namespace"`
+	Args      specArgs `yaml:"args"`
+}
+
+// specArgs are the arguments of a benchmark: a list, or a command line (see
+// splitArgs)
+type specArgs []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (a *specArgs) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		args, err := splitArgs(value.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", value.Line, err)
+		}
+		*a = args
+		return nil
+	}
+	var args []string
+	if err := value.Decode(&args); err != nil {
+		return err
+	}
+	*a = args
+	return nil
+}
+
+// splitArgs splits a command line into arguments, honoring single and double
+// quotes (without escapes)
+func splitArgs(s string) ([]string, error) {
+	ret := []string{}
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t':
+			if inArg {
+				ret = append(ret, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inArg {
+		ret = append(ret, cur.String())
+	}
+	return ret, nil
+}
+
+// ParseOrchestrationSpec parses an orchestration spec: a YAML list of
+// benchmarks with a name, a command, a namespace, and (optionally) the
+// arguments of the command, as a command line or a list:
+//
+//	benchmarks:
+//	- name: p2p
+//	  command: pod2pod
+//	  namespace: knb-p2p
+//	  args: --netperf-type tcp_rr --duration 60
+func ParseOrchestrationSpec(r io.Reader) ([]BenchSpec, error) {
+	var spec struct {
+		Benchmarks []BenchSpec `yaml:"benchmarks"`
+	}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	ret := spec.Benchmarks
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no benchmarks")
+	}
+	names := make(map[string]bool)
+	namespaces := make(map[string]string) // namespace -> benchmark
+	for i, b := range ret {
+		if !benchSpecNameRe.MatchString(b.Name) {
+			return nil, fmt.Errorf("benchmark %d: invalid name %q (it is used as the run label)", i+1, b.Name)
+		}
+		if names[b.Name] {
+			return nil, fmt.Errorf("benchmark %d: duplicate name %q", i+1, b.Name)
+		}
+		names[b.Name] = true
+		valid := false
+		for _, c := range OrchestrationCommands {
+			valid = valid || c == b.Command
+		}
+		if !valid {
+			return nil, fmt.Errorf("benchmark %s: invalid command %q (available values: %s)", b.Name, b.Command, strings.Join(OrchestrationCommands, ","))
+		}
+		for _, arg := range b.Args {
+			for _, f := range orchestrationNamespaceFlags {
+				if arg == f || strings.HasPrefix(arg, f+"=") {
+					return nil, fmt.Errorf("benchmark %s: %s is not supported: set the namespace of the benchmark", b.Name, f)
+				}
+			}
+		}
+
+		if b.Namespace != "" && !benchSpecNameRe.MatchString(b.Namespace) {
+			return nil, fmt.Errorf("benchmark %s: invalid namespace %q", b.Name, b.Namespace)
+		}
+		if len(ret) == 1 {
+			continue
+		}
+		if b.Namespace == "" {
+			return nil, fmt.Errorf("benchmark %s: no namespace: concurrent benchmarks run in distinct namespaces, since their pods (e.g., knb-cli, knb-srv) have the same names", b.Name)
+		}
+		if other, ok := namespaces[b.Namespace]; ok {
+			return nil, fmt.Errorf("benchmarks %s and %s run concurrently in the same namespace %q: their pods (e.g., knb-cli, knb-srv) would conflict", other, b.Name, b.Namespace)
+		}
+		namespaces[b.Namespace] = b.Name
+	}
+	return ret, nil
+}
+
+// orchestrationArgs returns the arguments of the wrapper script that runs a
+// benchmark of an orchestration (see Orchestrate)
+func orchestrationArgs(id string, b BenchSpec) []string {
+	ret := []string{b.Command}
+	if args, ok := orchestrationRunArgs[b.Command]; ok {
+		ret = append([]string{}, args...)
+	}
+	ret = append(ret,
+		"--run-label", b.Name,
+		"--tag", fmt.Sprintf("%s=%s", orchestrationTag, id),
+		"--tag", fmt.Sprintf("%s=%s", orchestrationNameTag, b.Name),
+	)
+	if b.Namespace != "" {
+		for _, f := range orchestrationNamespaceFlags {
+			ret = append(ret, f, b.Namespace)
+		}
+	}
+	// the CPU usage of the nodes is the contention data of the report (see
+	// WriteOrchestrationReport)
+	collectCPU := false
+	for _, arg := range b.Args {
+		collectCPU = collectCPU || arg == "--collect-cpu" || strings.HasPrefix(arg, "--collect-cpu=")
+	}
+	if !collectCPU {
+		ret = append(ret, "--collect-cpu")
+	}
+	return append(ret, b.Args...)
+}
+
+// Orchestrate runs the benchmarks concurrently, each as a separate invocation
+// of the session's wrapper script (see writeScript), so that each gets its own
+// run id, collection (including the CPU usage of its nodes), and results.
+// Their runs are tagged with the orchestration id (and their name), which
+// WriteOrchestrationReport uses to find them. The
+// output of each benchmark is written to <id>-<name>.log in the session
+// directory. It returns the error of each benchmark (nil if it succeeded).
+func (s *Session) Orchestrate(ctx context.Context, id string, specs []BenchSpec) []error {
+	script := filepath.Join(s.dir, "knb")
+	errs := make([]error, len(specs))
+	var wg sync.WaitGroup
+	for i, b := range specs {
+		args := orchestrationArgs(id, b)
+
+		logName := filepath.Join(s.dir, fmt.Sprintf("%s-%s.log", id, b.Name))
+		f, err := os.Create(logName)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		cmd := exec.CommandContext(ctx, script, args...)
+		cmd.Stdout, cmd.Stderr = f, f
+		logger().Debug("exec", "cmd", cmd.String())
+		if err := cmd.Start(); err != nil {
+			f.Close()
+			errs[i] = err
+			continue
+		}
+		logger().Info("started benchmark", "benchmark", b.Name, "command", b.Command, "log", logName)
+
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer f.Close()
+			if err := cmd.Wait(); err != nil {
+				errs[i] = fmt.Errorf("%w (see %s)", err, logName)
+				logger().Warn("benchmark failed", "benchmark", name, "error", err)
+				return
+			}
+			logger().Info("benchmark done", "benchmark", name)
+		}(i, b.Name)
+	}
+	wg.Wait()
+	return errs
+}
+
+// orchestrationReportMetrics are the metrics of the orchestration report
+var orchestrationReportMetrics = []string{
+	"THROUGHPUT",
+	"THROUGHPUT_UNITS",
+	"TRANSACTION_RATE",
+	"P99_LATENCY",
+	"TCP_RETRANS_SEGS",
+}
+
+// orchestrationNodeMetrics are the per-node CPU usage values (see
+// cpuUsageValues) of the orchestration report
+var orchestrationNodeMetrics = []string{
+	"CPU_CORES",
+	"CPU_SOFTIRQ_CORES",
+	"CPU_PODS_CORES",
+}
+
+// WriteOrchestrationReport writes the combined report of an orchestration
+// (see Orchestrate): the result of each benchmark, and, for each node, the
+// benchmarks that shared it, the CPU usage of the node during each benchmark,
+// and their (perf) collection archives. Since the benchmarks run concurrently,
+// the CPU usage of the node beyond the pods of a benchmark (OTHER_CORES) is
+// the contention of the other benchmarks (and the rest of the node).
+// errs are the errors of the benchmarks, as returned by Orchestrate.
+func WriteOrchestrationReport(sessDir, id string, specs []BenchSpec, errs []error, w io.Writer) error {
+	results, err := loadRunResults(sessDir)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*BenchResult)
+	for _, res := range results {
+		if res.Tags[orchestrationTag] == id {
+			byName[res.Tags[orchestrationNameTag]] = res
+		}
+	}
+
+	fmt.Fprintf(w, "orchestration %s: %d benchmarks\n\n", id, len(specs))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := []string{"BENCHMARK", "COMMAND", "RUN", "STATUS"}
+	header = append(header, orchestrationReportMetrics...)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	nodes := make(map[string][]string) // node -> benchmarks
+	for i, b := range specs {
+		res := byName[b.Name]
+		status := "ok"
+		if errs[i] != nil {
+			status = "failed"
+		} else if res == nil {
+			status = "no result"
+		}
+		row := []string{b.Name, b.Command, "-", status}
+		for _, m := range orchestrationReportMetrics {
+			v := "-"
+			if res != nil && res.Values[m] != "" {
+				v = res.Values[m]
+			}
+			row = append(row, v)
+		}
+		if res != nil {
+			row[2] = res.RunID
+			for _, n := range strings.Split(res.Meta["NODES"], ",") {
+				if n != "" {
+					nodes[n] = append(nodes[n], b.Name)
+				}
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	nodeNames := make([]string, 0, len(nodes))
+	for n := range nodes {
+		nodeNames = append(nodeNames, n)
+	}
+	sort.Strings(nodeNames)
+
+	fmt.Fprintf(w, "\nnodes:\n")
+	for _, n := range nodeNames {
+		shared := ""
+		if len(nodes[n]) > 1 {
+			shared = " (shared)"
+		}
+		fmt.Fprintf(w, "  %s%s: %s\n", n, shared, strings.Join(nodes[n], ", "))
+		if err := writeOrchestrationNodeCPU(w, n, nodes[n], byName); err != nil {
+			return err
+		}
+		for _, name := range nodes[n] {
+			archives, _ := filepath.Glob(filepath.Join(sessDir, byName[name].RunID, fmt.Sprintf("*-%s.tar.bz2", n)))
+			for _, a := range archives {
+				rel, _ := filepath.Rel(sessDir, a)
+				fmt.Fprintf(w, "    %s\n", rel)
+			}
+		}
+	}
+
+	for i, b := range specs {
+		if errs[i] != nil {
+			fmt.Fprintf(w, "\n%s failed: %s\n", b.Name, errs[i])
+		}
+	}
+	return nil
+}
+
+// writeOrchestrationNodeCPU writes the CPU usage of a node during each of the
+// given benchmarks, if any of them collected it (see --collect-cpu)
+func writeOrchestrationNodeCPU(w io.Writer, node string, names []string, byName map[string]*BenchResult) error {
+	prefix := "NODE_" + cpuNodeKey(node) + "_"
+	found := false
+	for _, name := range names {
+		found = found || byName[name].Values[prefix+"CPU_CORES"] != ""
+	}
+	if !found {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := []string{"    BENCHMARK"}
+	header = append(header, orchestrationNodeMetrics...)
+	header = append(header, "OTHER_CORES")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, name := range names {
+		values := byName[name].Values
+		row := []string{"    " + name}
+		for _, m := range orchestrationNodeMetrics {
+			v := "-"
+			if values[prefix+m] != "" {
+				v = values[prefix+m]
+			}
+			row = append(row, v)
+		}
+		other := "-"
+		busy, err1 := strconv.ParseFloat(values[prefix+"CPU_CORES"], 64)
+		pods, err2 := strconv.ParseFloat(values[prefix+"CPU_PODS_CORES"], 64)
+		if err1 == nil && err2 == nil {
+			other = fmt.Sprintf("%.3f", busy-pods)
+		}
+		row = append(row, other)
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const orchestrationSpecTest = `# mixed load
+benchmarks:
+- name: p2p
+  command: pod2pod
+  namespace: knb-p2p
+  args: --netperf-type tcp_rr --netem "delay 10ms"
+- name: h2p
+  command: host2pod
+  namespace: knb-h2p
+  args: [--netperf-type, tcp_stream]
+- name: svc
+  command: service
+  namespace: knb-svc
+`
+
+func TestParseOrchestrationSpec(t *testing.T) {
+	specs, err := ParseOrchestrationSpec(strings.NewReader(orchestrationSpecTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BenchSpec{
+		{Name: "p2p", Command: "pod2pod", Namespace: "knb-p2p", Args: specArgs{"--netperf-type", "tcp_rr", "--netem", "delay 10ms"}},
+		{Name: "h2p", Command: "host2pod", Namespace: "knb-h2p", Args: specArgs{"--netperf-type", "tcp_stream"}},
+		{Name: "svc", Command: "service", Namespace: "knb-svc"},
+	}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("unexpected specs: %+v", specs)
+	}
+
+	invalid := []string{
+		"",
+		"benchmarks:\n- name: a\n  command: pod2svc\n",
+		"benchmarks:\n- name: a\n  command: pod2pod\n  namespace: x\n- name: a\n  command: service\n  namespace: y\n",
+		"benchmarks:\n- name: A_1\n  command: pod2pod\n",
+		"benchmarks:\n- name: a\n  command: pod2pod\n  image: x\n",
+		"benchmarks:\n- name: a\n  command: pod2pod\n  args: --tag \"x=y\n",
+		"benchmarks:\n- name: a\n  command: pod2pod\n  namespace: Knb\n",
+		"benchmarks:\n- name: a\n  command: pod2pod\n  args: --client-namespace x\n",
+		// concurrent benchmarks in the same namespace
+		"benchmarks:\n- name: a\n  command: pod2pod\n- name: b\n  command: service\n",
+		"benchmarks:\n- name: a\n  command: pod2pod\n  namespace: x\n- name: b\n  command: service\n  namespace: x\n",
+	}
+	for _, s := range invalid {
+		if _, err := ParseOrchestrationSpec(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+
+	// a single benchmark may run in the namespace of the session
+	if _, err := ParseOrchestrationSpec(strings.NewReader("benchmarks:\n- name: a\n  command: pod2pod\n")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrchestrationArgs(t *testing.T) {
+	args := orchestrationArgs("orch-1", BenchSpec{Name: "h2p", Command: "host2pod", Namespace: "knb-h2p", Args: specArgs{"--duration", "10"}})
+	expected := []string{
+		"pod2pod", "--cli-on-host",
+		"--run-label", "h2p",
+		"--tag", "orchestration=orch-1",
+		"--tag", "orchestration_name=h2p",
+		"--client-namespace", "knb-h2p",
+		"--server-namespace", "knb-h2p",
+		"--collect-cpu",
+		"--duration", "10",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args: %q", args)
+	}
+
+	args = orchestrationArgs("orch-1", BenchSpec{Name: "p2p", Command: "pod2pod", Args: specArgs{"--collect-cpu=false"}})
+	for _, arg := range args {
+		if arg == "--collect-cpu" || arg == "--client-namespace" {
+			t.Errorf("unexpected %s in %q", arg, args)
+		}
+	}
+}
+
+func TestWriteOrchestrationReport(t *testing.T) {
+	dir := t.TempDir()
+	runs := []struct{ runid, name, nodes, result string }{
+		{"p2p-20260101000000", "p2p", "node-a,node-b", "THROUGHPUT=9000\nNODE_NODE_B_CPU_CORES=3.500\nNODE_NODE_B_CPU_SOFTIRQ_CORES=0.800\nNODE_NODE_B_CPU_PODS_CORES=1.250\n"},
+		{"svc-20260101000000", "svc", "node-b,node-c", "THROUGHPUT=4000\n"},
+	}
+	for _, r := range runs {
+		rdir := filepath.Join(dir, r.runid)
+		os.Mkdir(rdir, 0755)
+		os.WriteFile(filepath.Join(rdir, "result"), []byte(r.result), 0644)
+		os.WriteFile(filepath.Join(rdir, "meta"), []byte("NODES="+r.nodes+"\n"), 0644)
+		os.WriteFile(filepath.Join(rdir, "tags"), []byte("orchestration=orch-1\norchestration_name="+r.name+"\n"), 0644)
+	}
+	os.WriteFile(filepath.Join(dir, runs[0].runid, "perf-node-b.tar.bz2"), nil, 0644)
+
+	specs := []BenchSpec{{Name: "p2p", Command: "pod2pod"}, {Name: "svc", Command: "service"}, {Name: "ing", Command: "ingress"}}
+	errs := []error{nil, nil, errors.New("exit status 1")}
+	var out bytes.Buffer
+	if err := WriteOrchestrationReport(dir, "orch-1", specs, errs, &out); err != nil {
+		t.Fatal(err)
+	}
+	report := out.String()
+	for _, s := range []string{
+		"p2p-20260101000000",
+		"9000",
+		"node-b (shared): p2p, svc",
+		"node-a: p2p",
+		"p2p-20260101000000/perf-node-b.tar.bz2",
+		"OTHER_CORES",
+		"2.250",
+		"ing failed: exit status 1",
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report does not contain %q:\n%s", s, report)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetVerifyPath makes the run verify that the benchmark traffic took the path
+// of the requested placement (e.g., that it crossed nodes for a client on a
+// different node than the server, and was not short-circuited to a backend
+// on the client's node). The path is found from the socket samples of the
+// benchmark connections on the run nodes, so socket sampling is enabled (with
+// the default configuration, unless configured, see SetSsSampling).
+func (r *RunBenchCtx) SetVerifyPath() {
+	r.verifyPath = true
+	if r.ss == nil {
+		r.ss = &SsConf{Interval: DefaultSsInterval}
+	}
+}
+
+// dataPort returns the port of the benchmark data connections (0 if unknown)
+func (r *RunBenchCtx) dataPort() uint16 {
+	var port uint16
+	if p, ok := r.benchmark.(interface{ dataPort() uint16 }); ok {
+		port = p.dataPort()
+	} else if p, ok := r.benchmark.(SrvPorter); ok {
+		port, _ = p.SrvReadyPort()
+	}
+	return port
+}
+
+// addrPort returns the port of an ss address (e.g., 10.0.0.1:8000, or
+// [::ffff:10.0.0.1]:8000)
+func addrPort(addr string) string {
+	return addr[strings.LastIndex(addr, ":")+1:]
+}
+
+// pathNodes returns the nodes where the client side (the peer port is the
+// data port) and the server side (the local port is the data port) of the
+// benchmark connections were sampled, given the sampled connections
+// (local->peer) of each node
+func pathNodes(conns map[string][]string, port uint16) ([]string, []string) {
+	p := strconv.Itoa(int(port))
+	cli, srv := map[string]bool{}, map[string]bool{}
+	for node, cs := range conns {
+		for _, c := range cs {
+			local, peer, ok := strings.Cut(c, "->")
+			if !ok {
+				continue
+			}
+			if addrPort(peer) == p {
+				cli[node] = true
+			}
+			if addrPort(local) == p {
+				srv[node] = true
+			}
+		}
+	}
+	keys := func(m map[string]bool) []string {
+		ret := make([]string, 0, len(m))
+		for k := range m {
+			ret = append(ret, k)
+		}
+		sort.Strings(ret)
+		return ret
+	}
+	return keys(cli), keys(srv)
+}
+
+// trafficPath returns the path of the traffic, given the client and server
+// nodes of the connections: same-node, cross-node, or mixed (e.g., a service
+// whose connections went both to a backend on the client's node and to
+// others)
+func trafficPath(cli, srv []string) string {
+	local, remote := false, false
+	for _, s := range srv {
+		found := false
+		for _, c := range cli {
+			found = found || c == s
+		}
+		local, remote = local || found, remote || !found
+	}
+	switch {
+	case local && remote:
+		return "mixed"
+	case local:
+		return "same-node"
+	default:
+		return "cross-node"
+	}
+}
+
+// expectedPath returns the path that the placement of the run requires
+// (same-node or cross-node), or an empty string if it does not require one
+func (r *RunBenchCtx) expectedPath() string {
+	cli, srv := r.cliSpec.Affinity, r.srvSpec.Affinity
+	switch {
+	case r.cliSpec.ZonePlacement == "cross", cli == "different":
+		return "cross-node"
+	case cli == "same":
+		return "same-node"
+	case strings.HasPrefix(cli, "host=") && strings.HasPrefix(srv, "host="):
+		if cli == srv {
+			return "same-node"
+		}
+		return "cross-node"
+	}
+	return ""
+}
+
+// checkPath records the path of the traffic (PATH, PATH_CLI_NODES, and
+// PATH_SRV_NODES metadata), and flags runs whose path does not match the
+// placement (PATH_MISMATCH), given the sampled connections of each node (see
+// processSsSamples)
+func (r *RunBenchCtx) checkPath(conns map[string][]string) {
+	port := r.dataPort()
+	if port == 0 {
+		logger().Warn("benchmark has no known data port: path not verified")
+		return
+	}
+	cli, srv := pathNodes(conns, port)
+	if len(cli) == 0 || len(srv) == 0 {
+		logger().Warn("both ends of the benchmark connections were not sampled: path not verified", "client_nodes", cli, "server_nodes", srv)
+		r.addMeta("PATH", "unknown")
+		return
+	}
+
+	path := trafficPath(cli, srv)
+	r.addMeta("PATH", path)
+	r.addMeta("PATH_CLI_NODES", strings.Join(cli, ","))
+	r.addMeta("PATH_SRV_NODES", strings.Join(srv, ","))
+	if expected := r.expectedPath(); expected != "" && path != expected {
+		logger().Warn("traffic path does not match the placement: the run did not measure the requested path",
+			"expected", expected, "path", path, "client_nodes", cli, "server_nodes", srv)
+		r.addMeta("PATH_MISMATCH", "true")
+		return
+	}
+	logger().Info("traffic path", "path", path, "client_nodes", cli, "server_nodes", srv)
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathNodes(t *testing.T) {
+	conns := map[string][]string{
+		"node-a": {"10.0.0.5:41234->10.96.0.10:8000", "10.0.0.5:41236->10.96.0.10:8000"},
+		"node-b": {"10.0.1.7:8000->10.0.0.5:41234"},
+		"node-c": {"10.0.2.3:8000->10.0.0.5:41236", "[::ffff:10.0.2.3]:12865->[::ffff:10.0.0.5]:50000"},
+	}
+	cli, srv := pathNodes(conns, 8000)
+	if !reflect.DeepEqual(cli, []string{"node-a"}) {
+		t.Errorf("client nodes: got %v", cli)
+	}
+	if !reflect.DeepEqual(srv, []string{"node-b", "node-c"}) {
+		t.Errorf("server nodes: got %v", srv)
+	}
+}
+
+func TestTrafficPath(t *testing.T) {
+	tests := []struct {
+		cli, srv []string
+		path     string
+	}{
+		{[]string{"a"}, []string{"b"}, "cross-node"},
+		{[]string{"a"}, []string{"a"}, "same-node"},
+		{[]string{"a"}, []string{"a", "b"}, "mixed"},
+	}
+	for _, tt := range tests {
+		if path := trafficPath(tt.cli, tt.srv); path != tt.path {
+			t.Errorf("%v -> %v: got %s while expected %s", tt.cli, tt.srv, path, tt.path)
+		}
+	}
+}
+
+func TestExpectedPath(t *testing.T) {
+	tests := []struct {
+		cli, srv ContainerSpec
+		path     string
+	}{
+		{ContainerSpec{Affinity: "different"}, ContainerSpec{Affinity: "none"}, "cross-node"},
+		{ContainerSpec{Affinity: "same"}, ContainerSpec{Affinity: "none"}, "same-node"},
+		{ContainerSpec{Affinity: "none", ZonePlacement: "cross"}, ContainerSpec{Affinity: "none"}, "cross-node"},
+		{ContainerSpec{Affinity: "host=a"}, ContainerSpec{Affinity: "host=a"}, "same-node"},
+		{ContainerSpec{Affinity: "host=a"}, ContainerSpec{Affinity: "host=b"}, "cross-node"},
+		{ContainerSpec{Affinity: "none"}, ContainerSpec{Affinity: "none"}, ""},
+	}
+	for _, tt := range tests {
+		r := &RunBenchCtx{cliSpec: &tt.cli, srvSpec: &tt.srv}
+		if path := r.expectedPath(); path != tt.path {
+			t.Errorf("%+v, %+v: got %q while expected %q", tt.cli, tt.srv, path, tt.path)
+		}
+	}
+}
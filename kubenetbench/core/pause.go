@@ -0,0 +1,101 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+var (
+	stdinOnce  sync.Once
+	stdinEnter <-chan struct{}
+)
+
+// readEnters reads lines from rd in a goroutine, and returns a channel that
+// receives a value for each line (i.e., each time the user presses enter),
+// and is closed at the end of the input
+func readEnters(rd io.Reader) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		brd := bufio.NewReader(rd)
+		for {
+			if _, err := brd.ReadString('\n'); err != nil {
+				return
+			}
+			ch <- struct{}{}
+		}
+	}()
+	return ch
+}
+
+// waitEnter returns the channel of the enter presses on stdin (see
+// readEnters). Stdin is read by a single goroutine, so that pauses that time
+// out (or are cancelled) do not leave readers behind, which would consume the
+// input of later pauses.
+func waitEnter() <-chan struct{} {
+	stdinOnce.Do(func() {
+		stdinEnter = readEnters(os.Stdin)
+	})
+	return stdinEnter
+}
+
+// SetPause makes the run pause after the measurement (and collection), and
+// before cleanup, so that the user can inspect the pods. The run resumes when
+// the user presses enter, or after timeout (0 for no timeout).
+func (r *RunBenchCtx) SetPause(timeout time.Duration) {
+	r.pause = true
+	r.pauseTimeout = timeout
+}
+
+// pauseForInspection prints the resources of the run and waits for the user
+// (see SetPause)
+func (r *RunBenchCtx) pauseForInspection(ctx context.Context) error {
+	if !r.pause {
+		return nil
+	}
+
+	for _, ns := range r.namespaces() {
+		cmd := fmt.Sprintf("kubectl get%s pod,service,ingress -l \"%s\" -o wide", nsArg(ns), r.getRunLabel("="))
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+		if err != nil {
+			logger().Warn("failed to list run resources", "cmd", cmd, "error", err)
+			continue
+		}
+		fmt.Printf("$ %s\n%s\n", cmd, strings.Join(lines, "\n"))
+	}
+
+	var timeout <-chan time.Time
+	if r.pauseTimeout > 0 {
+		timeout = time.After(r.pauseTimeout)
+		fmt.Printf("Run %s paused: press enter to continue with cleanup (timeout: %s)\n", r.runid, r.pauseTimeout)
+	} else {
+		fmt.Printf("Run %s paused: press enter to continue with cleanup\n", r.runid)
+	}
+	logger().Info("run paused", "runid", r.runid, "timeout", r.pauseTimeout)
+
+	// discard a line entered before the pause (e.g., during a previous run)
+	enter := waitEnter()
+	select {
+	case <-enter:
+	default:
+	}
+
+	select {
+	case <-enter:
+		logger().Info("run resumed")
+	case <-timeout:
+		logger().Info("pause timed out")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
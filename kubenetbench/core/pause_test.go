@@ -0,0 +1,34 @@
+package core
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReadEnters(t *testing.T) {
+	rd, wr := io.Pipe()
+	enter := readEnters(rd)
+
+	for i := 0; i < 2; i++ {
+		go wr.Write([]byte("\n"))
+		select {
+		case _, ok := <-enter:
+			if !ok {
+				t.Fatalf("channel closed after %d lines", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("line %d not received", i)
+		}
+	}
+
+	wr.Close()
+	select {
+	case _, ok := <-enter:
+		if ok {
+			t.Errorf("unexpected line at the end of the input")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("channel not closed at the end of the input")
+	}
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+// PcapConf configures a packet capture (tcpdump) on the monitors of the run
+// nodes. The capture is included in the collection archive.
+type PcapConf struct {
+	Iface      string // interface to capture on ("any" for all)
+	Filter     string // tcpdump filter expression
+	Snaplen    int32  // bytes to capture per packet
+	MaxPackets int64  // maximum number of packets
+	MaxBytes   int64  // maximum size of the capture file
+}
+
+// SetPcap enables capturing packets on the run nodes for the benchmark duration
+func (r *RunBenchCtx) SetPcap(conf PcapConf) error {
+	if conf.MaxPackets <= 0 || conf.MaxBytes <= 0 {
+		return fmt.Errorf("packet capture requires positive packet and size limits")
+	}
+	r.pcap = &conf
+	return nil
+}
+
+func (c *PcapConf) toPb(duration int) *pb.PcapConf {
+	if c == nil {
+		return nil
+	}
+	return &pb.PcapConf{
+		Duration:   fmt.Sprintf("%d", duration),
+		Iface:      c.Iface,
+		Filter:     c.Filter,
+		Snaplen:    c.Snaplen,
+		MaxPackets: c.MaxPackets,
+		MaxBytes:   c.MaxBytes,
+	}
+}
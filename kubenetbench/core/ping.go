@@ -0,0 +1,302 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// PingModes are the modes of the pre-flight ping (see SetPing): tcp measures
+// the time to establish a connection to the server port, icmp uses ping(8)
+var PingModes = []string{"tcp", "icmp"}
+
+// pingTimeout bounds the pre-flight ping, including the pod startup
+const pingTimeout = 2 * time.Minute
+
+var pingCliTemplate = template.Must(template.New("ping").Parse(`apiVersion: v1
+kind: Pod
+metadata:
+  name: knb-ping
+  {{if .cliNamespace}}namespace: {{.cliNamespace}}{{end}}
+  labels : {
+     {{.runLabel}},
+     role: ping,
+  }
+spec:
+  restartPolicy: Never
+  {{.cliHost}}
+  {{.cliDNS}}
+  {{.cliSecurity}}
+  {{.cliAffinity}}
+  {{.cliTolerations}}
+  containers:
+  - name: ping
+    image: {{.image}}
+    command: ["bash", "-c"]
+    args:
+    - |
+{{- if eq .mode "icmp"}}
+      ping -c {{.count}} -i 0.2 -W 1 {{.serverIP}}
+      true
+{{- else}}
+      if ! timeout 2 bash -c "</dev/tcp/{{.serverIP}}/{{.port}}" 2>/dev/null; then
+        echo "failed to connect to {{.serverIP}}:{{.port}}"
+        exit 1
+      fi
+      for i in $(seq 1 {{.count}}); do
+        t0=$EPOCHREALTIME
+        if { exec 3<>/dev/tcp/{{.serverIP}}/{{.port}}; } 2>/dev/null; then
+          t1=$EPOCHREALTIME
+          exec 3>&-
+          echo "rtt_us $(( ${t1/./} - ${t0/./} ))"
+        else
+          echo "lost"
+        fi
+        sleep 0.2
+      done
+{{- end}}
+    {{.cliContainerSecurity}}
+`))
+
+var (
+	icmpPingSentRe = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (packets )?received`)
+	icmpPingRttRe  = regexp.MustCompile(`= ([0-9.]+)/([0-9.]+)/([0-9.]+)/[0-9.]+ ms`)
+)
+
+// PingConf is the configuration of the pre-flight ping
+type PingConf struct {
+	Mode  string // tcp or icmp
+	Count int    // number of probes
+}
+
+// pingResult is the result of the pre-flight ping
+type pingResult struct {
+	sent, received int
+	min, avg, max  float64 // RTTs in microseconds
+}
+
+func (p *pingResult) lossPct() float64 {
+	if p.sent == 0 {
+		return 0
+	}
+	return 100 * float64(p.sent-p.received) / float64(p.sent)
+}
+
+// parseICMPPing parses the summary of ping(8)
+func parseICMPPing(lines []string) (*pingResult, error) {
+	res := &pingResult{}
+	found := false
+	for _, l := range lines {
+		if m := icmpPingSentRe.FindStringSubmatch(l); m != nil {
+			res.sent, _ = strconv.Atoi(m[1])
+			res.received, _ = strconv.Atoi(m[2])
+			found = true
+		}
+		if m := icmpPingRttRe.FindStringSubmatch(l); m != nil {
+			vals := make([]float64, 3)
+			for i := range vals {
+				v, err := strconv.ParseFloat(m[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ping RTT %q: %w", l, err)
+				}
+				vals[i] = v * 1000
+			}
+			res.min, res.avg, res.max = vals[0], vals[1], vals[2]
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no ping summary")
+	}
+	return res, nil
+}
+
+// parseTCPPing parses the output of the TCP ping of pingCliTemplate:
+// "rtt_us <us>" lines for connections, and "lost" lines for failures
+func parseTCPPing(lines []string) (*pingResult, error) {
+	res := &pingResult{}
+	sum := 0.0
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		switch {
+		case len(fields) == 1 && fields[0] == "lost":
+			res.sent++
+		case len(fields) == 2 && fields[0] == "rtt_us":
+			v, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TCP ping RTT %q: %w", l, err)
+			}
+			if res.received == 0 || v < res.min {
+				res.min = v
+			}
+			if v > res.max {
+				res.max = v
+			}
+			sum += v
+			res.sent++
+			res.received++
+		}
+	}
+	if res.sent == 0 {
+		return nil, fmt.Errorf("no TCP ping samples")
+	}
+	if res.received > 0 {
+		res.avg = sum / float64(res.received)
+	}
+	return res, nil
+}
+
+// SetPing enables a pre-flight ping from the client placement to the server
+// (see preflightPing)
+func (r *RunBenchCtx) SetPing(conf PingConf) error {
+	valid := false
+	for _, m := range PingModes {
+		valid = valid || m == conf.Mode
+	}
+	if !valid {
+		return fmt.Errorf("invalid ping mode %q (available values: %s)", conf.Mode, strings.Join(PingModes, ","))
+	}
+	if conf.Count < 1 {
+		return fmt.Errorf("invalid ping count: %d", conf.Count)
+	}
+	r.ping = &conf
+	return nil
+}
+
+func (r *RunBenchCtx) genPingYaml(serverIP string, port uint16) (string, error) {
+	yaml := fmt.Sprintf("%s/ping.yaml", r.getDir())
+	logger().Info("generating yaml", "file", yaml)
+	f, err := os.Create(yaml)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	vals := map[string]interface{}{
+		"runLabel":             r.getRunLabel(": "),
+		"cliNamespace":         r.cliSpec.Namespace,
+		"image":                r.session.benchImageRef(),
+		"mode":                 r.ping.Mode,
+		"count":                r.ping.Count,
+		"serverIP":             serverIP,
+		"port":                 port,
+		"cliAffinity":          "{{template \"cliAffinity\"}}",
+		"cliHost":              "{{template \"cliHost\"}}",
+		"cliDNS":               "{{template \"cliDNS\"}}",
+		"cliSecurity":          "{{template \"cliSecurity\"}}",
+		"cliContainerSecurity": "{{template \"cliContainerSecurity\"}}",
+		"cliTolerations":       "{{template \"cliTolerations\"}}",
+	}
+
+	templates := map[string]utils.PrefixRenderer{
+		"cliAffinity":          r.cliAffinityWrite,
+		"cliHost":              r.cliSpec.hostOptsWrite,
+		"cliDNS":               r.cliSpec.dnsWrite,
+		"cliSecurity":          r.cliSpec.podSecurityWrite,
+		"cliContainerSecurity": r.cliSpec.containerSecurityWrite,
+		"cliTolerations":       r.cliSpec.tolerationsWrite,
+	}
+
+	err = utils.RenderTemplate(pingCliTemplate, vals, templates, f)
+	return yaml, err
+}
+
+// preflightPing (if enabled) runs a short ping from a pod placed like the
+// client to the server address (port is used by the tcp mode), before the
+// client is created. It fails if the server is unreachable, so that the run
+// is aborted before the benchmark. The RTTs and the loss are written to
+// ping.log, and included in the results (see GetResult).
+func (r *RunBenchCtx) preflightPing(ctx context.Context, serverIP string, port uint16) error {
+	if r.ping == nil {
+		return nil
+	}
+	if r.ping.Mode == "tcp" && port == 0 {
+		return fmt.Errorf("the server port of the benchmark is unknown: use the icmp ping mode")
+	}
+
+	yaml, err := r.genPingYaml(serverIP, port)
+	if err != nil {
+		return err
+	}
+	if err := r.KubeApply(yaml); err != nil {
+		return fmt.Errorf("failed to create the ping pod: %w", err)
+	}
+
+	selector := fmt.Sprintf("%s,role=ping", r.getRunLabel("="))
+	defer func() {
+		// the ping pod is not part of the benchmark (e.g., its node is not
+		// a run node)
+		cmd := fmt.Sprintf("kubectl delete pod%s -l \"%s\"", nsArg(r.cliSpec.Namespace), selector)
+		logger().Debug("exec", "cmd", cmd)
+		utils.ExecCmd(cmd)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	phase := ""
+	for phase != "Succeeded" && phase != "Failed" {
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return fmt.Errorf("ping did not complete: %w", err)
+		}
+		phase, err = r.KubeGetPodPhase(r.cliSpec.Namespace, selector)
+		if err != nil {
+			return err
+		}
+	}
+
+	logfile := fmt.Sprintf("%s/ping.txt", r.getDir())
+	if err := r.KubeSaveLogs(r.cliSpec.Namespace, selector, logfile); err != nil {
+		return fmt.Errorf("failed to save ping logs: %w", err)
+	}
+	data, err := os.ReadFile(logfile)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+
+	var res *pingResult
+	if phase == "Succeeded" {
+		if r.ping.Mode == "icmp" {
+			res, err = parseICMPPing(lines)
+		} else {
+			res, err = parseTCPPing(lines)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", logfile, err)
+		}
+	}
+	if res == nil || res.received == 0 {
+		hint := ""
+		if r.ping.Mode == "icmp" {
+			hint = " (ICMP might be filtered, or ping lacks the NET_RAW capability: try the tcp ping mode)"
+		}
+		return fmt.Errorf("server %s is unreachable from the client placement%s: see %s", serverIP, hint, logfile)
+	}
+
+	logger().Info("base RTT", "mode", r.ping.Mode,
+		"min_us", fmt.Sprintf("%.0f", res.min),
+		"avg_us", fmt.Sprintf("%.0f", res.avg),
+		"max_us", fmt.Sprintf("%.0f", res.max),
+		"loss_pct", fmt.Sprintf("%.1f", res.lossPct()))
+	if res.received < res.sent {
+		logger().Warn("packet loss to the server", "sent", res.sent, "received", res.received)
+	}
+	r.addMeta("PING_MODE", r.ping.Mode)
+
+	f, err := os.Create(fmt.Sprintf("%s/ping.log", r.getDir()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "BASE_RTT_MIN_US=%.0f\n", res.min)
+	fmt.Fprintf(f, "BASE_RTT_AVG_US=%.0f\n", res.avg)
+	fmt.Fprintf(f, "BASE_RTT_MAX_US=%.0f\n", res.max)
+	_, err = fmt.Fprintf(f, "BASE_RTT_LOSS_PCT=%.1f\n", res.lossPct())
+	return err
+}
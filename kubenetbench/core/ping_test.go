@@ -0,0 +1,77 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const icmpPingTest = `PING 10.0.1.7 (10.0.1.7) 56(84) bytes of data.
+64 bytes from 10.0.1.7: icmp_seq=1 ttl=63 time=0.412 ms
+
+--- 10.0.1.7 ping statistics ---
+10 packets transmitted, 9 received, 10% packet loss, time 1843ms
+rtt min/avg/max/mdev = 0.101/0.250/0.412/0.080 ms`
+
+func TestParsePing(t *testing.T) {
+	res, err := parseICMPPing(strings.Split(icmpPingTest, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.sent != 10 || res.received != 9 || res.min != 101 || res.avg != 250 || res.max != 412 {
+		t.Errorf("unexpected ICMP ping result: %+v", res)
+	}
+	if res.lossPct() != 10 {
+		t.Errorf("expected 10%% loss, got %f", res.lossPct())
+	}
+
+	res, err = parseTCPPing([]string{"rtt_us 300", "lost", "rtt_us 100", "rtt_us 200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.sent != 4 || res.received != 3 || res.min != 100 || res.avg != 200 || res.max != 300 {
+		t.Errorf("unexpected TCP ping result: %+v", res)
+	}
+
+	if _, err := parseTCPPing([]string{"failed to connect to 10.0.1.7:12865"}); err == nil {
+		t.Error("expected error without samples")
+	}
+}
+
+func TestGenPingYaml(t *testing.T) {
+	r := &RunBenchCtx{
+		session: &Session{dir: t.TempDir()},
+		runid:   "ping-test",
+		cliSpec: &ContainerSpec{Affinity: "host=node-a"},
+		srvSpec: &ContainerSpec{},
+	}
+	os.Mkdir(r.getDir(), 0755)
+	if err := r.SetPing(PingConf{Mode: "tcp", Count: 3}); err != nil {
+		t.Fatal(err)
+	}
+	fname, err := r.genPingYaml("10.0.1.7", 12865)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yaml := string(data)
+	for _, s := range []string{
+		"role: ping",
+		"kubernetes.io/hostname: node-a",
+		"\n      for i in $(seq 1 3); do\n",
+		`exec 3<>/dev/tcp/10.0.1.7/12865`,
+		`${t1/./}`,
+	} {
+		if !strings.Contains(yaml, s) {
+			t.Errorf("%s does not contain %q:\n%s", filepath.Base(fname), s, yaml)
+		}
+	}
+
+	if err := r.SetPing(PingConf{Mode: "udp", Count: 3}); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
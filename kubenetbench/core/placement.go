@@ -0,0 +1,152 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// Toleration is a pod toleration of a node taint
+type Toleration struct {
+	Key    string
+	Value  string // empty to tolerate any value
+	Effect string // empty to tolerate any effect
+}
+
+var (
+	nodeLabelKeyRe   = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]*[a-z0-9])?/)?[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+	nodeLabelValueRe = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?)?$`)
+	taintEffects     = []string{"NoSchedule", "PreferNoSchedule", "NoExecute"}
+)
+
+// ParseNodeLabel parses a key=value node label, used to select the nodes of
+// the benchmark pods (see ContainerSpec.NodeLabels)
+func ParseNodeLabel(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || !nodeLabelKeyRe.MatchString(key) || len(value) > 63 || !nodeLabelValueRe.MatchString(value) {
+		return "", "", fmt.Errorf("invalid node label %q (expected key=value)", s)
+	}
+	return key, value, nil
+}
+
+// ParseToleration parses a toleration: key[=value][:effect], e.g.,
+// dedicated=benchmark:NoSchedule. Without a value, any value of the taint is
+// tolerated, and without an effect, any effect.
+func ParseToleration(s string) (Toleration, error) {
+	spec, effect, _ := strings.Cut(s, ":")
+	key, value, _ := strings.Cut(spec, "=")
+	if !nodeLabelKeyRe.MatchString(key) || !nodeLabelValueRe.MatchString(value) {
+		return Toleration{}, fmt.Errorf("invalid toleration %q (expected key[=value][:effect])", s)
+	}
+	if effect != "" {
+		valid := false
+		for _, e := range taintEffects {
+			valid = valid || e == effect
+		}
+		if !valid {
+			return Toleration{}, fmt.Errorf("invalid toleration effect %q (available values: %s)", effect, strings.Join(taintEffects, ","))
+		}
+	}
+	return Toleration{Key: key, Value: value, Effect: effect}, nil
+}
+
+// controlPlaneNodeLabels are the labels of control-plane nodes (the master
+// label is used by older clusters)
+var controlPlaneNodeLabels = []string{
+	"node-role.kubernetes.io/control-plane",
+	"node-role.kubernetes.io/master",
+}
+
+// excludeControlPlane returns true if the pod must not run on control-plane
+// nodes: unless allowed (see ContainerSpec.AllowControlPlane) or the pod is
+// explicitly placed on a node
+func (s *ContainerSpec) excludeControlPlane(host string) bool {
+	return !s.AllowControlPlane && host == ""
+}
+
+// controlPlaneAntiAffinityWrite writes the node affinity (as an item of the
+// affinity) that excludes the control-plane nodes
+func controlPlaneAntiAffinityWrite(pw *utils.PrefixWriter) {
+	pw.AppendNewLineOrDie(`   nodeAffinity:`)
+	pw.AppendNewLineOrDie(`       requiredDuringSchedulingIgnoredDuringExecution:`)
+	pw.AppendNewLineOrDie(`         nodeSelectorTerms:`)
+	pw.AppendNewLineOrDie(`         - matchExpressions:`)
+	for _, l := range controlPlaneNodeLabels {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`           - key: %s`, l))
+		pw.AppendNewLineOrDie(`             operator: DoesNotExist`)
+	}
+}
+
+// nodeSelectorWrite writes the node selector of a pod: the node labels of the
+// spec, and, if not empty, the hostname of the node the pod is placed on
+func (s *ContainerSpec) nodeSelectorWrite(pw *utils.PrefixWriter, host string) {
+	if len(s.NodeLabels) == 0 && host == "" {
+		return
+	}
+
+	keys := make([]string, 0, len(s.NodeLabels))
+	for k := range s.NodeLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pw.AppendNewLineOrDie(`nodeSelector:`)
+	if host != "" {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`     kubernetes.io/hostname: %s`, host))
+	}
+	for _, k := range keys {
+		if k == "kubernetes.io/hostname" && host != "" {
+			continue
+		}
+		pw.AppendNewLineOrDie(fmt.Sprintf(`     %s: %q`, k, s.NodeLabels[k]))
+	}
+}
+
+// tolerationsWrite writes the tolerations of a pod
+func (s *ContainerSpec) tolerationsWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if len(s.Tolerations) == 0 {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`tolerations:`)
+	for _, t := range s.Tolerations {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`- key: %q`, t.Key))
+		if t.Value == "" {
+			pw.AppendNewLineOrDie(`  operator: Exists`)
+		} else {
+			pw.AppendNewLineOrDie(`  operator: Equal`)
+			pw.AppendNewLineOrDie(fmt.Sprintf(`  value: %q`, t.Value))
+		}
+		if t.Effect != "" {
+			pw.AppendNewLineOrDie(fmt.Sprintf(`  effect: %s`, t.Effect))
+		}
+	}
+}
+
+// SetMonitorNodeLabels restricts the monitor to the nodes with the given
+// labels (e.g., the nodes reserved for benchmarking, see
+// ContainerSpec.NodeLabels)
+func (s *Session) SetMonitorNodeLabels(labels map[string]string) {
+	s.monitorNodeLabels = labels
+}
+
+// SetMonitorTolerations sets the taints that the monitor tolerates, instead
+// of all taints (e.g., to keep it off nodes tainted for other workloads)
+func (s *Session) SetMonitorTolerations(tolerations []Toleration) {
+	s.monitorTolerations = tolerations
+}
+
+// monitorTolerationsWrite writes the tolerations of the monitor: all taints,
+// unless set (see SetMonitorTolerations)
+func (s *Session) monitorTolerationsWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if len(s.monitorTolerations) == 0 {
+		pw.AppendNewLineOrDie(`tolerations:`)
+		pw.AppendNewLineOrDie(`- operator: Exists`)
+		return
+	}
+	spec := ContainerSpec{Tolerations: s.monitorTolerations}
+	spec.tolerationsWrite(pw, params)
+}
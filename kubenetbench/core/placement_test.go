@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+func TestParseToleration(t *testing.T) {
+	tests := map[string]Toleration{
+		"dedicated=benchmark:NoSchedule": {Key: "dedicated", Value: "benchmark", Effect: "NoSchedule"},
+		"example.com/bench":              {Key: "example.com/bench"},
+		"bench:NoExecute":                {Key: "bench", Effect: "NoExecute"},
+	}
+	for s, expected := range tests {
+		tol, err := ParseToleration(s)
+		if err != nil {
+			t.Errorf("ParseToleration(%q) failed: %v", s, err)
+		} else if tol != expected {
+			t.Errorf("ParseToleration(%q): got %+v while expected %+v", s, tol, expected)
+		}
+	}
+
+	for _, s := range []string{"", "=x", "bench:Never", "a b=c"} {
+		if _, err := ParseToleration(s); err == nil {
+			t.Errorf("ParseToleration(%q) succeeded while expected to fail", s)
+		}
+	}
+}
+
+func TestNodeSelectorWrite(t *testing.T) {
+	spec := ContainerSpec{NodeLabels: map[string]string{"pool": "bench", "example.com/reserved": "true"}}
+
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	spec.nodeSelectorWrite(pw, "node-a")
+	pw.Done()
+
+	expected := "nodeSelector:\n" +
+		"     kubernetes.io/hostname: node-a\n" +
+		"     example.com/reserved: \"true\"\n" +
+		"     pool: \"bench\"\n"
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestControlPlaneExclusion(t *testing.T) {
+	render := func(cliAffinity string, allow bool) string {
+		r := &RunBenchCtx{
+			session: &Session{labelPrefix: DefaultLabelPrefix},
+			runid:   "r1",
+			cliSpec: &ContainerSpec{Affinity: cliAffinity, AllowControlPlane: allow},
+			srvSpec: &ContainerSpec{Affinity: "none"},
+		}
+		var buf bytes.Buffer
+		pw := utils.NewPrefixWriter(&buf, false)
+		r.cliAffinityWrite(pw, nil)
+		pw.Done()
+		return buf.String()
+	}
+
+	out := render("different", false)
+	if strings.Count(out, "affinity:") != 1 ||
+		!strings.Contains(out, "   nodeAffinity:\n") ||
+		!strings.Contains(out, "- key: node-role.kubernetes.io/control-plane\n             operator: DoesNotExist\n") ||
+		!strings.Contains(out, "   podAntiAffinity:\n") {
+		t.Errorf("unexpected affinity:\n%s", out)
+	}
+
+	if out := render("different", true); strings.Contains(out, "nodeAffinity") || !strings.Contains(out, "podAntiAffinity") {
+		t.Errorf("unexpected affinity with control-plane nodes allowed:\n%s", out)
+	}
+	if out := render("none", true); out != "" {
+		t.Errorf("unexpected affinity:\n%s", out)
+	}
+	// explicitly placed on a node
+	if out := render("host=node-a", false); out != "nodeSelector:\n     kubernetes.io/hostname: node-a\n" {
+		t.Errorf("unexpected affinity:\n%s", out)
+	}
+}
+
+func TestMonitorTolerations(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func() string {
+		fname, err := s.genMonitorYaml()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// all taints by default
+	if out := render(); !strings.Contains(out, "    spec:\n      tolerations:\n      - operator: Exists\n") {
+		t.Errorf("unexpected monitor yaml:\n%s", out)
+	}
+
+	s.SetMonitorNodeLabels(map[string]string{"pool": "bench"})
+	s.SetMonitorTolerations([]Toleration{{Key: "dedicated", Value: "benchmark", Effect: "NoSchedule"}})
+	out := render()
+	expected := "      tolerations:\n" +
+		"      - key: \"dedicated\"\n" +
+		"        operator: Equal\n" +
+		"        value: \"benchmark\"\n" +
+		"        effect: NoSchedule\n"
+	if !strings.Contains(out, expected) || strings.Contains(out, "operator: Exists") || !strings.Contains(out, "        pool: \"bench\"\n") {
+		t.Errorf("unexpected monitor yaml:\n%s", out)
+	}
+}
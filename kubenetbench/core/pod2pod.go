@@ -1,8 +1,8 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
 	"text/template"
 	"time"
@@ -20,32 +20,40 @@ var pod2podSrvTemplate = template.Must(template.New("srv").Parse(`apiVersion: v1
 kind: Pod
 metadata:
   name: knb-srv
+  {{if .srvNamespace}}namespace: {{.srvNamespace}}{{end}}
   labels : {
     {{.sessLabel}},
     {{.runLabel}},
     role: srv,
   }
+  {{.srvAnnotations}}
 spec:
   {{.srvSpec}}
   containers:
   - {{.srvContainer}}
+  {{.srvMonitor}}
 `))
 
 func (s *Pod2PodSt) genSrvYaml() (string, error) {
 	vals := map[string]interface{}{
-		"sessLabel":    s.RunBenchCtx.session.getSessionLabel(": "),
-		"runLabel":     s.RunBenchCtx.getRunLabel(": "),
-		"srvContainer": "{{template \"netperfContainer\"}}",
-		"srvSpec":      "{{template \"srvSpec\"}}",
+		"sessLabel":      s.RunBenchCtx.session.getSessionLabel(": "),
+		"runLabel":       s.RunBenchCtx.getRunLabel(": "),
+		"srvNamespace":   s.RunBenchCtx.srvSpec.Namespace,
+		"srvContainer":   "{{template \"netperfContainer\"}}",
+		"srvSpec":        "{{template \"srvSpec\"}}",
+		"srvAnnotations": "{{template \"srvAnnotations\"}}",
+		"srvMonitor":     "{{template \"srvMonitor\"}}",
 	}
 
 	templates := map[string]utils.PrefixRenderer{
-		"netperfContainer": s.RunBenchCtx.benchmark.WriteSrvContainerYaml,
+		"netperfContainer": s.RunBenchCtx.srvContainerWrite,
 		"srvSpec":          s.RunBenchCtx.srvPodSpecWrite,
+		"srvAnnotations":   s.RunBenchCtx.srvSpec.annotationsWrite,
+		"srvMonitor":       s.RunBenchCtx.srvSpec.monitorSidecarWrite(s.RunBenchCtx.session),
 	}
 
 	yaml := fmt.Sprintf("%s/netserv.yaml", s.RunBenchCtx.getDir())
-	log.Printf("Generating %s", yaml)
+	logger().Info("generating yaml", "file", yaml)
 	f, err := os.Create(yaml)
 	if err != nil {
 		return "", err
@@ -59,12 +67,14 @@ var pod2podPortPolicyTemplate = template.Must(template.New("policy").Parse(`apiV
 kind: NetworkPolicy
 metadata:
   name: kubenetbench-{{.runID}}-policy
+  {{if .srvNamespace}}namespace: {{.srvNamespace}}{{end}}
   labels : {
-     "kubenetbench-runid": {{.runID}},
+     {{.runLabel}},
   }
 spec:
   podSelector:
     matchLabels:
+      {{.runLabel}}
       role: srv
   policyTypes:
   - Ingress
@@ -81,14 +91,16 @@ spec:
 
 func (s *Pod2PodSt) genPortPolicyYaml() string {
 	m := map[string]interface{}{
-		"runID": s.RunBenchCtx.runid,
+		"runID":        s.RunBenchCtx.runid,
+		"runLabel":     s.RunBenchCtx.getRunLabel(": "),
+		"srvNamespace": s.RunBenchCtx.srvSpec.Namespace,
 	}
 
 	yaml := fmt.Sprintf("%s/port-policy.yaml", s.RunBenchCtx.getDir())
-	log.Printf("Generating %s", yaml)
+	logger().Info("generating yaml", "file", yaml)
 	f, err := os.Create(yaml)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to create yaml", "file", yaml, "error", err)
 	}
 	pod2podPortPolicyTemplate.Execute(f, m)
 	f.Close()
@@ -101,6 +113,16 @@ func (s *Pod2PodSt) genCliYaml(serverIP string) (string, error) {
 
 // Execute pod2pod command
 func (s Pod2PodSt) Execute() error {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the run, bounded by ctx
+func (s Pod2PodSt) ExecuteContext(ctx context.Context) error {
+	err := s.RunBenchCtx.prepareBenchmark()
+	if err != nil {
+		return err
+	}
+
 	// start server pod (netserver)
 	srvYamlFname, err := s.genSrvYaml()
 	if err != nil {
@@ -116,21 +138,37 @@ func (s Pod2PodSt) Execute() error {
 
 	defer func() {
 		// attempt to save server logs
-		s.RunBenchCtx.KubeSaveLogs(srvSelector, fmt.Sprintf("%s/srv.log", s.RunBenchCtx.getDir()))
+		s.RunBenchCtx.KubeSaveLogs(s.RunBenchCtx.srvSpec.Namespace, srvSelector, fmt.Sprintf("%s/srv.log", s.RunBenchCtx.getDir()))
 
 		// FIXME: this does not work because we call functions that
-		// call log.Fatal() which calls exit() which does not run the
+		// call fatal() which calls exit() which does not run the
 		// deferred operations
 		s.RunBenchCtx.KubeCleanup()
 	}()
 
+	// create the client only after the server listens
+	err = s.RunBenchCtx.waitForSrvReady(ctx, srvSelector)
+	if err != nil {
+		return err
+	}
+
 	// get server pod IP
 	time.Sleep(2 * time.Second)
-	srvIP, err := s.RunBenchCtx.KubeGetPodIP(srvSelector, 30, 2*time.Second)
+	srvIP, err := s.RunBenchCtx.getSrvIP(srvSelector)
+	if err != nil {
+		return err
+	}
+	logger().Info("server address", "server_ip", srvIP)
+
+	err = s.RunBenchCtx.applyNetem(ctx, srvSelector)
+	if err != nil {
+		return err
+	}
+
+	err = s.RunBenchCtx.preflightPing(ctx, srvIP, s.RunBenchCtx.benchmarkPort())
 	if err != nil {
 		return err
 	}
-	log.Printf("server_ip=%s", srvIP)
 
 	// start policy if specified
 	if s.Policy == "port" {
@@ -154,7 +192,7 @@ func (s Pod2PodSt) Execute() error {
 
 	cliSelector := fmt.Sprintf("%s,role=cli", s.RunBenchCtx.getRunLabel("="))
 	// attempt to save client logs
-	defer s.RunBenchCtx.KubeSaveLogs(cliSelector, fmt.Sprintf("%s/cli.log", s.RunBenchCtx.getDir()))
+	defer s.RunBenchCtx.KubeSaveLogs(s.RunBenchCtx.cliSpec.Namespace, cliSelector, fmt.Sprintf("%s/cli.log", s.RunBenchCtx.getDir()))
 
-	return s.RunBenchCtx.finalizeAndWait()
+	return s.RunBenchCtx.finalizeAndWait(ctx)
 }
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is the minimum interval between progress updates
+const progressInterval = 200 * time.Millisecond
+
+// progressMaxNodes is the maximum number of (in-progress) nodes shown
+const progressMaxNodes = 4
+
+// SetProgressOutput makes the session display the progress of collections
+// (bytes per node, nodes remaining, ETA) on w, which is expected to be a
+// terminal. nil disables the progress display.
+func (s *Session) SetProgressOutput(w io.Writer) {
+	s.progress = w
+}
+
+// IsTerminal returns true if f is a terminal
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// collectProgress is the combined progress of retrieving the collection
+// results of multiple nodes. A nil *collectProgress is valid, and does
+// nothing.
+type collectProgress struct {
+	mu     sync.Mutex
+	w      io.Writer
+	start  time.Time
+	last   time.Time // last update
+	nodes  []string
+	bytes  map[string]int64
+	done   map[string]bool
+	ndone  int
+	width  int // width of the last line (to clear it)
+	closed bool
+}
+
+func newCollectProgress(w io.Writer, nodes []string) *collectProgress {
+	if w == nil {
+		return nil
+	}
+	return &collectProgress{
+		w:     w,
+		start: time.Now(),
+		nodes: nodes,
+		bytes: make(map[string]int64),
+		done:  make(map[string]bool),
+	}
+}
+
+// add records n more bytes received from node
+func (p *collectProgress) add(node string, n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes[node] += n
+	if time.Since(p.last) >= progressInterval {
+		p.render()
+	}
+}
+
+// restart records that the data of node are received again from the start
+// (e.g., after a failed attempt)
+func (p *collectProgress) restart(node string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes[node] = 0
+}
+
+// nodeDone records that node has completed (successfully or not)
+func (p *collectProgress) nodeDone(node string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.done[node] {
+		p.done[node] = true
+		p.ndone++
+	}
+	p.render()
+}
+
+// finish clears the progress line
+func (p *collectProgress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.width > 0 {
+		fmt.Fprintf(p.w, "\r%s\r", strings.Repeat(" ", p.width))
+	}
+	p.closed = true
+}
+
+// render writes the progress line (p.mu is held)
+func (p *collectProgress) render() {
+	if p.closed {
+		return
+	}
+	p.last = time.Now()
+	line := p.line(p.last)
+	pad := ""
+	if len(line) < p.width {
+		pad = strings.Repeat(" ", p.width-len(line))
+	}
+	fmt.Fprintf(p.w, "\r%s%s", line, pad)
+	p.width = len(line)
+}
+
+// line returns the progress line at time now
+func (p *collectProgress) line(now time.Time) string {
+	var total int64
+	for _, n := range p.bytes {
+		total += n
+	}
+	elapsed := now.Sub(p.start)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "collecting: %d/%d nodes done, %s", p.ndone, len(p.nodes), formatBytes(total))
+	if secs := elapsed.Seconds(); secs > 0 {
+		fmt.Fprintf(&b, " (%s/s)", formatBytes(int64(float64(total)/secs)))
+	}
+	// the archive sizes are not known in advance, so the ETA is based on
+	// the time it took the completed nodes
+	if p.ndone > 0 && p.ndone < len(p.nodes) {
+		eta := elapsed / time.Duration(p.ndone) * time.Duration(len(p.nodes)-p.ndone)
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+
+	active := []string{}
+	for _, node := range p.nodes {
+		if _, ok := p.bytes[node]; ok && !p.done[node] {
+			active = append(active, node)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return p.bytes[active[i]] > p.bytes[active[j]] })
+	if len(active) > 0 {
+		b.WriteString(" [")
+		for i, node := range active {
+			if i == progressMaxNodes {
+				fmt.Fprintf(&b, " +%d", len(active)-i)
+				break
+			}
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "%s:%s", node, formatBytes(p.bytes[node]))
+		}
+		b.WriteString("]")
+	}
+	return b.String()
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
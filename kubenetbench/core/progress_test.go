@@ -0,0 +1,48 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	for n, s := range map[int64]string{
+		0:               "0B",
+		1023:            "1023B",
+		1024:            "1.0KiB",
+		3 * 1024 * 1024: "3.0MiB",
+	} {
+		if got := formatBytes(n); got != s {
+			t.Errorf("formatBytes(%d): got %q, expected %q", n, got, s)
+		}
+	}
+}
+
+func TestCollectProgressLine(t *testing.T) {
+	var buf bytes.Buffer
+	p := newCollectProgress(&buf, []string{"k8s1", "k8s2", "k8s3"})
+	p.add("k8s1", 1024)
+	p.add("k8s2", 2048)
+	p.nodeDone("k8s1")
+
+	line := p.line(p.start.Add(10 * time.Second))
+	for _, s := range []string{"1/3 nodes done", "3.0KiB", "ETA 20s", "[k8s2:2.0KiB]"} {
+		if !strings.Contains(line, s) {
+			t.Errorf("%q not in progress line: %q", s, line)
+		}
+	}
+
+	p.finish()
+	p.add("k8s2", 1024)
+	if strings.HasSuffix(buf.String(), "]") {
+		t.Errorf("progress rendered after finish: %q", buf.String())
+	}
+
+	// a nil progress does nothing
+	var np *collectProgress
+	np.add("k8s1", 1)
+	np.nodeDone("k8s1")
+	np.finish()
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// ProxyProtocolVersions are the supported PROXY protocol versions of the http
+// benchmark
+var ProxyProtocolVersions = []string{"v1", "v2"}
+
+// (local) port of the client's PROXY protocol proxy
+const proxyProtocolPort = 8081
+
+// ValidateProxyProtocol checks the PROXY protocol option of the benchmark
+func (cnf *HTTPConf) ValidateProxyProtocol() error {
+	if cnf.ProxyProtocol == "" {
+		return nil
+	}
+	for _, v := range ProxyProtocolVersions {
+		if v == cnf.ProxyProtocol {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid PROXY protocol version: %s (available values: v1,v2)", cnf.ProxyProtocol)
+}
+
+// proxyProtocolHeaderLen returns an estimate of the size of the PROXY
+// protocol header that the client's proxy prepends to each connection. It is
+// computed, not measured: the header carries the addresses of the proxy's
+// (IPv4 loopback) frontend connection, so v1 is text (e.g., "PROXY TCP4
+// 127.0.0.1 127.0.0.1 40000 8081\r\n", assuming a 5-digit ephemeral source
+// port), and v2 is a 16-byte binary header and 12 bytes of addresses.
+func proxyProtocolHeaderLen(version string) int {
+	switch version {
+	case "v1":
+		return len(fmt.Sprintf("PROXY TCP4 127.0.0.1 127.0.0.1 40000 %d\r\n", proxyProtocolPort))
+	case "v2":
+		return 16 + 12
+	}
+	return 0
+}
+
+// writeProxyProtocolProxy writes the client commands that start a local
+// (TCP) proxy that forwards connections to addr, prepending a PROXY protocol
+// header, as an L4 load balancer (e.g., HAProxy, envoy) in front of the
+// cluster would
+func writeProxyProtocolProxy(pw *utils.PrefixWriter, addr string, version string) {
+	sendProxy := "send-proxy"
+	if version == "v2" {
+		sendProxy = "send-proxy-v2"
+	}
+	pw.AppendNewLineOrDie(`cat > /tmp/haproxy.cfg <<'EOF'`)
+	pw.AppendNewLineOrDie(`global`)
+	pw.AppendNewLineOrDie(`  maxconn 4096`)
+	pw.AppendNewLineOrDie(`  pidfile /tmp/haproxy.pid`)
+	pw.AppendNewLineOrDie(`defaults`)
+	pw.AppendNewLineOrDie(`  mode tcp`)
+	pw.AppendNewLineOrDie(`  timeout connect 5s`)
+	pw.AppendNewLineOrDie(`  timeout client 1h`)
+	pw.AppendNewLineOrDie(`  timeout server 1h`)
+	pw.AppendNewLineOrDie(`listen knb`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  bind 127.0.0.1:%d`, proxyProtocolPort))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  server srv %s %s`, addr, sendProxy))
+	pw.AppendNewLineOrDie(`EOF`)
+	pw.AppendNewLineOrDie(`haproxy -D -f /tmp/haproxy.cfg || exit 1`)
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// QUICConf is a QUIC (HTTP/3) benchmark: the server is nginx serving HTTP/3
+// over QUIC, and the client uses h2load (built with HTTP/3 support) to
+// measure the throughput, the request rate, and the handshake latency.
+// Unlike the other benchmarks, the transport runs in userspace over UDP on
+// both ends, which stresses the datapath differently (per-packet processing,
+// and the interplay with UDP GSO/GRO offloads).
+//
+// The server also listens on TCP (HTTPS) on the same port, which is used to
+// wait until the server is reachable. The negotiated QUIC version is taken
+// from the qlog of a single request before the benchmark, since logging the
+// benchmark connections would slow them down.
+type QUICConf struct {
+	Timeout      int
+	Port         uint16 // server port (UDP for QUIC, and TCP)
+	Connections  int    // h2load clients (connections)
+	Threads      int    // h2load threads
+	Streams      int    // maximum concurrent streams (requests) per connection
+	ResponseSize int64  // size of the response body (bytes)
+	GSO          bool   // UDP generic segmentation offload on the server (quic_gso)
+	TLSSecret    string // kubernetes.io/tls secret to use (empty to generate one)
+}
+
+// QUICConfDefault returns a QUICConf with the default values
+func QUICConfDefault() QUICConf {
+	return QUICConf{
+		Timeout:      60,
+		Port:         8443,
+		Connections:  16,
+		Threads:      2,
+		Streams:      1,
+		ResponseSize: 1024 * 1024,
+	}
+}
+
+// directory of the qlog of the version probe of the client
+const quicQlogDir = "/tmp/qlog"
+
+// Validate checks the configuration of the benchmark
+func (cnf *QUICConf) Validate() error {
+	if cnf.Threads < 1 || cnf.Connections < cnf.Threads {
+		return fmt.Errorf("invalid quic benchmark configuration: %d connections, %d threads", cnf.Connections, cnf.Threads)
+	}
+	if cnf.Streams < 1 {
+		return fmt.Errorf("invalid quic benchmark configuration: %d streams per connection", cnf.Streams)
+	}
+	if cnf.ResponseSize < 0 {
+		return fmt.Errorf("invalid quic benchmark configuration: response size %d", cnf.ResponseSize)
+	}
+	return nil
+}
+
+// GetTimeout returns the benchmark timeout
+func (cnf *QUICConf) GetTimeout() int {
+	return cnf.Timeout
+}
+
+// Images returns the images of the QUIC benchmark
+func (cnf *QUICConf) Images() []string {
+	return []string{benchImage, tlsProxyImage}
+}
+
+// SrvReadyPort returns the server (TCP) port
+func (cnf *QUICConf) SrvReadyPort() (uint16, bool) {
+	return cnf.Port, true
+}
+
+// PrepareRun creates the TLS secret (unless one was provided) that QUIC
+// requires, and mounts it into the client and the server containers
+func (cnf *QUICConf) PrepareRun(r *RunBenchCtx) error {
+	if err := r.mountTLSSecret(cnf.TLSSecret); err != nil {
+		return err
+	}
+	r.addMeta("QUIC_GSO", strconv.FormatBool(cnf.GSO))
+	return nil
+}
+
+// WriteSrvContainerYaml writes the server yaml: nginx serving a response of
+// ResponseSize bytes over HTTP/3 (and HTTPS)
+func (cnf *QUICConf) WriteSrvContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	gso := "off"
+	if cnf.GSO {
+		gso = "on"
+	}
+
+	pw.AppendNewLineOrDie(`name: quic-srv`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, tlsProxyImage))
+	pw.AppendNewLineOrDie(`command: ["sh", "-c"]`)
+	pw.AppendNewLineOrDie(`args:`)
+	pw.AppendNewLineOrDie(`- |`)
+	pw.PushPrefix("  ")
+	pw.AppendNewLineOrDie(`mkdir -p /tmp/www`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`head -c %d /dev/zero > /tmp/www/index.html`, cnf.ResponseSize))
+	pw.AppendNewLineOrDie(`cat > /tmp/nginx.conf <<'EOF'`)
+	pw.AppendNewLineOrDie(`worker_processes auto;`)
+	pw.AppendNewLineOrDie(`pid /tmp/nginx.pid;`)
+	pw.AppendNewLineOrDie(`error_log stderr;`)
+	pw.AppendNewLineOrDie(`events { worker_connections 4096; }`)
+	pw.AppendNewLineOrDie(`http {`)
+	pw.AppendNewLineOrDie(`  access_log off;`)
+	pw.AppendNewLineOrDie(`  server {`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    listen %d quic reuseport;`, cnf.Port))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    listen %d ssl;`, cnf.Port))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    ssl_certificate %s/tls.crt;`, tlsMountPath))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    ssl_certificate_key %s/tls.key;`, tlsMountPath))
+	pw.AppendNewLineOrDie(`    ssl_protocols TLSv1.3;`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    quic_gso %s;`, gso))
+	pw.AppendNewLineOrDie(`    root /tmp/www;`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    add_header Alt-Svc 'h3=":%d"; ma=86400';`, cnf.Port))
+	pw.AppendNewLineOrDie(`  }`)
+	pw.AppendNewLineOrDie(`}`)
+	pw.AppendNewLineOrDie(`EOF`)
+	pw.AppendNewLineOrDie(`exec nginx -c /tmp/nginx.conf -g 'daemon off;'`)
+	pw.PopPrefix()
+}
+
+// WriteCliContainerYaml writes the client yaml
+func (cnf *QUICConf) WriteCliContainerYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	serverIP, ok := params["serverIP"]
+	if !ok {
+		panic("serverIP undefined")
+	}
+
+	pw.AppendNewLineOrDie(`name: quic-cli`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, paramBenchImage(params)))
+	pw.AppendNewLineOrDie(`command: ["bash", "-c"]`)
+	pw.AppendNewLineOrDie(`args:`)
+	pw.AppendNewLineOrDie(`- |`)
+	pw.PushPrefix("  ")
+	pw.AppendNewLineOrDie(fmt.Sprintf(`url=https://%v:%d/`, serverIP, cnf.Port))
+	// wait until the server is reachable (over TCP)
+	pw.AppendNewLineOrDie(`ready=0`)
+	pw.AppendNewLineOrDie(`for i in $(seq 1 60); do`)
+	pw.AppendNewLineOrDie(`  if curl -k -s -o /dev/null "$url"; then ready=1; break; fi`)
+	pw.AppendNewLineOrDie(`  sleep 1`)
+	pw.AppendNewLineOrDie(`done`)
+	pw.AppendNewLineOrDie(`if [ $ready = 0 ]; then echo "$url not reachable"; exit 1; fi`)
+	// a single request, logged, for the negotiated version (which also
+	// checks that the server is reachable over QUIC)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`mkdir -p %s`, quicQlogDir))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`if ! h2load --alpn-list=h3 -n 1 -c 1 --qlog-file-base=%s/probe "$url" > /tmp/probe.log; then`, quicQlogDir))
+	pw.AppendNewLineOrDie(`  cat /tmp/probe.log; echo "$url not reachable over QUIC (UDP)"; exit 1`)
+	pw.AppendNewLineOrDie(`fi`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`cat %s/* | grep -o -m 1 '"version":"[0-9a-fx]*"' | sed 's/.*:"\(.*\)"/QUIC_VERSION=\1/'`, quicQlogDir))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`h2load --alpn-list=h3 -D %d -c %d -t %d -m %d "$url"`, cnf.Timeout, cnf.Connections, cnf.Threads, cnf.Streams))
+	pw.PopPrefix()
+}
+
+// WriteSrvPortsYaml writes the ports part of yaml (e.g., for services)
+func (cnf *QUICConf) WriteSrvPortsYaml(pw *utils.PrefixWriter, params map[string]interface{}) {
+	pw.AppendNewLineOrDie(`- name: quic`)
+	pw.AppendNewLineOrDie(`  protocol: UDP`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  port: %d`, cnf.Port))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  targetPort: %d`, cnf.Port))
+	pw.AppendNewLineOrDie(`- name: https`)
+	pw.AppendNewLineOrDie(`  protocol: TCP`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  port: %d`, cnf.Port))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  targetPort: %d`, cnf.Port))
+}
+
+var (
+	h2loadFinishedRegEx = regexp.MustCompile(`^finished in ([\d.]+)s, ([\d.]+) req/s`)
+	h2loadRequestsRegEx = regexp.MustCompile(`^requests: (\d+) total, \d+ started, \d+ done, \d+ succeeded, (\d+) failed, (\d+) errored, (\d+) timeout`)
+	h2loadTrafficRegEx  = regexp.MustCompile(`^traffic: \S+ \((\d+)\) total`)
+	h2loadTimeRegEx     = regexp.MustCompile(`^time for (request|connect):\s+(\S+)\s+(\S+)\s+(\S+)`)
+	quicVersionRegEx    = regexp.MustCompile(`^QUIC_VERSION=(?:0x)?([0-9a-f]+)$`)
+)
+
+// quicVersions are the names of the QUIC versions (by their wire value)
+var quicVersions = map[uint64]string{
+	0x00000001: "v1",
+	0x6b3343cf: "v2",
+}
+
+// quicVersionName returns the name of a QUIC version (hex wire value), e.g.,
+// v1 for 00000001. Unknown (e.g., draft) versions are returned as 0x<value>.
+func quicVersionName(hex string) string {
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return hex
+	}
+	if name, ok := quicVersions[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", v)
+}
+
+// ParseResult parses the h2load output of the client. THROUGHPUT (in
+// 10^6bits/s) is computed from the total traffic, TRANSACTION_RATE is in
+// requests/sec, and latencies are in microseconds: the request latencies
+// (MIN/MEAN/MAX_LATENCY), and the handshake latencies, i.e., the time to
+// establish the QUIC connections (HANDSHAKE_MIN/MEAN/MAX_LATENCY).
+// QUIC_VERSION is the negotiated version (e.g., v1).
+func (cnf *QUICConf) ParseResult(runid string, rd io.Reader) (*BenchResult, error) {
+	res := &BenchResult{
+		RunID:  runid,
+		Values: make(map[string]string),
+		Meta:   make(map[string]string),
+		Tags:   make(map[string]string),
+	}
+
+	setUs := func(key, val string) {
+		us, err := wrkDurationUs(val)
+		if err == nil {
+			res.Values[key] = fmt.Sprintf("%.2f", us)
+		}
+	}
+
+	var secs float64
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := h2loadFinishedRegEx.FindStringSubmatch(line); m != nil {
+			secs, _ = strconv.ParseFloat(m[1], 64)
+			res.Values["TRANSACTION_RATE"] = m[2]
+		} else if m := h2loadRequestsRegEx.FindStringSubmatch(line); m != nil {
+			res.Values["HTTP_REQUESTS"] = m[1]
+			var errors uint64
+			for _, s := range m[2:] {
+				n, _ := strconv.ParseUint(s, 10, 64)
+				errors += n
+			}
+			res.Values["HTTP_ERRORS"] = fmt.Sprintf("%d", errors)
+		} else if m := h2loadTrafficRegEx.FindStringSubmatch(line); m != nil {
+			res.Values["TRAFFIC_BYTES"] = m[1]
+		} else if m := h2loadTimeRegEx.FindStringSubmatch(line); m != nil {
+			prefix := ""
+			if m[1] == "connect" {
+				prefix = "HANDSHAKE_"
+			}
+			setUs(prefix+"MIN_LATENCY", m[2])
+			setUs(prefix+"MAX_LATENCY", m[3])
+			setUs(prefix+"MEAN_LATENCY", m[4])
+		} else if m := quicVersionRegEx.FindStringSubmatch(line); m != nil {
+			res.Values["QUIC_VERSION"] = quicVersionName(m[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := res.Values["TRANSACTION_RATE"]; !ok {
+		return nil, fmt.Errorf("no h2load results found")
+	}
+	if bytes, ok := res.Float("TRAFFIC_BYTES"); ok && secs > 0 {
+		res.Values["THROUGHPUT"] = fmt.Sprintf("%.2f", bytes*8/secs/1e6)
+		res.Values["THROUGHPUT_UNITS"] = "10^6bits/s"
+	}
+	return res, nil
+}
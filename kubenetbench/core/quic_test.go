@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+var h2loadTestOutput = `QUIC_VERSION=00000001
+starting benchmark...
+spawning thread #0: 8 total client(s). Timing-based test with 0s of warm-up time and 30s of main duration for measurements.
+spawning thread #1: 8 total client(s). Timing-based test with 0s of warm-up time and 30s of main duration for measurements.
+Application protocol: h3
+
+finished in 30.00s, 1000.00 req/s, 1000.10MB/s
+requests: 30000 total, 30000 started, 30000 done, 29990 succeeded, 5 failed, 3 errored, 2 timeout
+status codes: 29990 2xx, 0 3xx, 0 4xx, 5 5xx
+traffic: 29.30GB (31460000000) total, 300.00KB (307200) headers (space savings 30.00%), 29.30GB (31457280000) data
+UDP datagram: 21000000 sent, 22000000 received
+                     min         max         mean         sd        +/- sd
+time for request:     2.00ms    250.00ms     15.50ms      5.00ms    90.00%
+time for connect:      800us      3.20ms      1.20ms     500us     80.00%
+time to 1st byte:     3.00ms     10.00ms      5.00ms      1.00ms    75.00%
+req/s           :      55.00       70.00       62.50        4.00    70.00%
+`
+
+func TestQUICParseResult(t *testing.T) {
+	cnf := QUICConfDefault()
+	res, err := cnf.ParseResult("test", strings.NewReader(h2loadTestOutput))
+	if err != nil {
+		t.Fatalf("ParseResult failed: %s", err)
+	}
+
+	for key, expected := range map[string]float64{
+		"TRANSACTION_RATE":       1000,
+		"HTTP_REQUESTS":          30000,
+		"HTTP_ERRORS":            10,
+		"THROUGHPUT":             8389.33,
+		"MIN_LATENCY":            2000,
+		"MAX_LATENCY":            250000,
+		"MEAN_LATENCY":           15500,
+		"HANDSHAKE_MIN_LATENCY":  800,
+		"HANDSHAKE_MAX_LATENCY":  3200,
+		"HANDSHAKE_MEAN_LATENCY": 1200,
+	} {
+		if v, ok := res.Float(key); !ok || v != expected {
+			t.Errorf("%s: got %s while expected %g", key, res.Values[key], expected)
+		}
+	}
+	if res.Values["QUIC_VERSION"] != "v1" {
+		t.Errorf("unexpected QUIC version: %q", res.Values["QUIC_VERSION"])
+	}
+
+	if _, err := cnf.ParseResult("test", strings.NewReader("QUIC_VERSION=00000001\n")); err == nil {
+		t.Errorf("no results: expected error")
+	}
+}
+
+func TestQUICVersionName(t *testing.T) {
+	for hex, expected := range map[string]string{
+		"00000001": "v1",
+		"6b3343cf": "v2",
+		"ff00001d": "0xff00001d",
+	} {
+		if name := quicVersionName(hex); name != expected {
+			t.Errorf("%s: got %s while expected %s", hex, name, expected)
+		}
+	}
+}
+
+func TestQUICSrvPortsYaml(t *testing.T) {
+	cnf := QUICConfDefault()
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	cnf.WriteSrvPortsYaml(pw, nil)
+	pw.Done()
+	expected := `- name: quic
+  protocol: UDP
+  port: 8443
+  targetPort: 8443
+- name: https
+  protocol: TCP
+  port: 8443
+  targetPort: 8443
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestQUICValidate(t *testing.T) {
+	cnf := QUICConfDefault()
+	if err := cnf.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cnf.Threads = cnf.Connections + 1
+	if err := cnf.Validate(); err == nil {
+		t.Errorf("more threads than connections: expected error")
+	}
+	cnf = QUICConfDefault()
+	cnf.Streams = 0
+	if err := cnf.Validate(); err == nil {
+		t.Errorf("no streams: expected error")
+	}
+}
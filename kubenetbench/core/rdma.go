@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+// SetRdmaCounters enables collecting the RDMA device counters (e.g., of RoCE
+// NICs) of the run nodes before and after the benchmark
+func (r *RunBenchCtx) SetRdmaCounters() {
+	r.rdma = true
+}
+
+// rdmaConfPb sets the RDMA counters collection of a collection (if enabled)
+func (r *RunBenchCtx) rdmaConfPb(conf *pb.CollectionConf) {
+	if !r.rdma {
+		return
+	}
+	conf.RdmaDuration = fmt.Sprintf("%d", r.collectSeconds())
+}
+
+// rdmaSummaryCounters are the counters summarized in rdma.log, and their
+// multipliers: the data counters of the standard port counters are in units of
+// 4 bytes. Driver-specific counters (e.g., the RoCE congestion notification
+// packets of mlx5) are summed if present.
+var rdmaSummaryCounters = map[string]struct {
+	counter string
+	mult    int64
+}{
+	"RDMA_TX_BYTES":        {"port_xmit_data", 4},
+	"RDMA_RX_BYTES":        {"port_rcv_data", 4},
+	"RDMA_TX_PACKETS":      {"port_xmit_packets", 1},
+	"RDMA_RX_PACKETS":      {"port_rcv_packets", 1},
+	"RDMA_TX_DISCARDS":     {"port_xmit_discards", 1},
+	"RDMA_RX_ERRORS":       {"port_rcv_errors", 1},
+	"RDMA_CNP_SENT":        {"np_cnp_sent", 1},
+	"RDMA_CNP_HANDLED":     {"rp_cnp_handled", 1},
+	"RDMA_OUT_OF_SEQUENCE": {"out_of_sequence", 1},
+}
+
+// rdmaDelta is the change of an RDMA counter during the benchmark
+type rdmaDelta struct {
+	Counter string // <device>/<port>/<counter>
+	Delta   int64
+}
+
+// parseRdmaDeltas parses the output of scripts/rdma-counters.sh:
+// "<device>/<port>/<counter> <before> <after> <delta>" lines
+func parseRdmaDeltas(r io.Reader) ([]rdmaDelta, error) {
+	ret := []rdmaDelta{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid RDMA counters line: %q", line)
+		}
+		// NB: awk may print large values in exponent notation
+		delta, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RDMA counter delta %q: %w", line, err)
+		}
+		ret = append(ret, rdmaDelta{Counter: fields[0], Delta: int64(delta)})
+	}
+	return ret, scanner.Err()
+}
+
+// rdmaSummary sums the deltas of the counters in rdmaSummaryCounters across
+// the devices and ports
+func rdmaSummary(deltas []rdmaDelta) map[string]string {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	sums := make(map[string]int64)
+	for _, d := range deltas {
+		name := d.Counter[strings.LastIndex(d.Counter, "/")+1:]
+		for key, c := range rdmaSummaryCounters {
+			if name == c.counter {
+				sums[key] += d.Delta * c.mult
+			}
+		}
+	}
+
+	ret := make(map[string]string, len(sums))
+	for k, v := range sums {
+		ret[k] = strconv.FormatInt(v, 10)
+	}
+	return ret
+}
+
+// processRdmaCounters extracts the RDMA counter deltas from the collection
+// archives of the run (which also include the raw before/after counters and
+// the ibstat output), and writes their summary in rdma.log (see GetResult)
+func (r *RunBenchCtx) processRdmaCounters() error {
+	all := []rdmaDelta{}
+	for _, node := range r.collectNodes {
+		archive := fmt.Sprintf("%s/%s-%s.tar.bz2", r.getDir(), r.collectionName(), node)
+		data, err := readFromArchive(archive, r.runid+"-rdma.txt")
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errNotInArchive) {
+			continue
+		} else if err != nil {
+			logger().Warn("reading RDMA counters failed", "node", node, "error", err)
+			continue
+		}
+
+		deltas, err := parseRdmaDeltas(strings.NewReader(string(data)))
+		if err != nil {
+			logger().Warn("parsing RDMA counters failed", "node", node, "error", err)
+			continue
+		}
+		if len(deltas) == 0 {
+			logger().Info("no RDMA devices", "node", node)
+		}
+		all = append(all, deltas...)
+	}
+
+	summary := rdmaSummary(all)
+	if summary == nil {
+		return nil
+	}
+
+	f, err := os.Create(fmt.Sprintf("%s/rdma.log", r.getDir()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	keys := make([]string, 0, len(summary))
+	for k := range summary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(f, "%s=%s\n", k, summary[k])
+	}
+
+	logger().Info("RDMA counters",
+		"tx_bytes", summary["RDMA_TX_BYTES"],
+		"rx_bytes", summary["RDMA_RX_BYTES"],
+		"cnp_sent", summary["RDMA_CNP_SENT"])
+	return nil
+}
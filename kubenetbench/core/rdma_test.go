@@ -0,0 +1,44 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+const rdmaDeltasTest = `mlx5_0/1/port_xmit_data 1000 26000 25000
+mlx5_0/1/port_rcv_data 500 1500 1000
+mlx5_0/1/port_xmit_packets 10 110 100
+mlx5_0/1/np_cnp_sent 0 7 7
+mlx5_1/1/port_xmit_data 0 1e+10 1e+10
+mlx5_1/1/link_downed 0 0 0
+`
+
+func TestRdmaSummary(t *testing.T) {
+	deltas, err := parseRdmaDeltas(strings.NewReader(rdmaDeltasTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) != 6 {
+		t.Fatalf("expected 6 deltas, got %d", len(deltas))
+	}
+
+	summary := rdmaSummary(deltas)
+	expected := map[string]string{
+		"RDMA_TX_BYTES":   "40000100000",
+		"RDMA_RX_BYTES":   "4000",
+		"RDMA_TX_PACKETS": "100",
+		"RDMA_CNP_SENT":   "7",
+	}
+	if len(summary) != len(expected) {
+		t.Errorf("unexpected summary: %v", summary)
+	}
+	for k, v := range expected {
+		if summary[k] != v {
+			t.Errorf("%s: expected %s, got %s", k, v, summary[k])
+		}
+	}
+
+	if deltas, err := parseRdmaDeltas(strings.NewReader("# no RDMA devices\n")); err != nil || rdmaSummary(deltas) != nil {
+		t.Errorf("expected no summary without RDMA devices")
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// srvReadyTimeout is the time the server has to start listening (see
+// waitForSrvReady)
+const srvReadyTimeout = 2 * time.Minute
+
+// SrvPorter is an optional interface for benchmarks whose server listens on a
+// known TCP port once it is ready. It is used for the server's readiness probe.
+type SrvPorter interface {
+	SrvReadyPort() (uint16, bool)
+}
+
+// SrvReadyPort returns the netserver control port
+func (cnf *NetperfConf) SrvReadyPort() (uint16, bool) {
+	return 12865, true
+}
+
+// SrvReadyPort returns the http server port
+func (cnf *HTTPConf) SrvReadyPort() (uint16, bool) {
+	return cnf.Port, true
+}
+
+// SrvReadyPort returns the first server port (if any)
+func (cnf *CustomConf) SrvReadyPort() (uint16, bool) {
+	if len(cnf.Ports) == 0 {
+		return 0, false
+	}
+	return cnf.Ports[0], true
+}
+
+// ReadyProbe is a readiness probe of the server: a TCP connect, or an HTTP(S)
+// GET of a path, to a port of the server pod
+type ReadyProbe struct {
+	Scheme string // tcp, http, or https
+	Port   uint16
+	Path   string // path of http(s) probes
+}
+
+// ParseReadyProbe parses a readiness probe URL: tcp://:<port>, or
+// http(s)://:<port>[/<path>] (e.g., http://:8080/healthz). The host is empty:
+// the probe targets the server pod.
+func ParseReadyProbe(s string) (*ReadyProbe, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server readiness probe %q: %w", s, err)
+	}
+	if u.Hostname() != "" {
+		return nil, fmt.Errorf("invalid server readiness probe %q: the host must be empty (the probe targets the server pod, e.g., tcp://:8080)", s)
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil || port == 0 {
+		return nil, fmt.Errorf("invalid server readiness probe %q: a port is required (e.g., tcp://:8080)", s)
+	}
+
+	p := &ReadyProbe{Scheme: u.Scheme, Port: uint16(port)}
+	switch u.Scheme {
+	case "tcp":
+		if u.Path != "" {
+			return nil, fmt.Errorf("invalid server readiness probe %q: tcp probes have no path", s)
+		}
+	case "http", "https":
+		p.Path = u.RequestURI()
+	default:
+		return nil, fmt.Errorf("invalid server readiness probe %q: the scheme must be tcp, http, or https", s)
+	}
+	return p, nil
+}
+
+func (p *ReadyProbe) String() string {
+	if p.Scheme == "tcp" {
+		return fmt.Sprintf("tcp://:%d", p.Port)
+	}
+	return fmt.Sprintf("%s://:%d%s", p.Scheme, p.Port, p.Path)
+}
+
+// SetNoWaitServer makes the run create the client without waiting for the
+// server to be ready (see waitForSrvReady)
+func (r *RunBenchCtx) SetNoWaitServer() {
+	r.noWaitSrv = true
+}
+
+// SetSrvReadyProbe sets the readiness probe of the server, which the client
+// waits for (see waitForSrvReady), e.g., for custom servers that listen long
+// before they are ready. By default, the server is probed with a TCP connect
+// to the port it listens on (see SrvPorter).
+func (r *RunBenchCtx) SetSrvReadyProbe(p *ReadyProbe) error {
+	if r.noWaitSrv {
+		return fmt.Errorf("a server readiness probe cannot be used without waiting for the server")
+	}
+	r.srvProbe = p
+	return nil
+}
+
+// srvReadyProbe returns the server's readiness probe (nil for none)
+func (r *RunBenchCtx) srvReadyProbe() *ReadyProbe {
+	if r.noWaitSrv {
+		return nil
+	}
+	if r.srvProbe != nil {
+		return r.srvProbe
+	}
+	if p, ok := r.benchmark.(SrvPorter); ok {
+		if port, ok := p.SrvReadyPort(); ok {
+			return &ReadyProbe{Scheme: "tcp", Port: port}
+		}
+	}
+	return nil
+}
+
+// benchmarkPort returns the port the server listens on (0 if unknown)
+func (r *RunBenchCtx) benchmarkPort() uint16 {
+	if p, ok := r.benchmark.(SrvPorter); ok {
+		if port, ok := p.SrvReadyPort(); ok {
+			return port
+		}
+	}
+	return 0
+}
+
+// srvReadinessProbeWrite writes the server's readiness probe (by default, a
+// TCP check of the port the server listens on)
+func (r *RunBenchCtx) srvReadinessProbeWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if p := r.srvReadyProbe(); p != nil {
+		writeProbe(pw, "readinessProbe", p, 1)
+	}
+}
+
+// writeProbe writes a probe (e.g., readinessProbe) that runs every second
+func writeProbe(pw *utils.PrefixWriter, kind string, p *ReadyProbe, failureThreshold int) {
+	pw.AppendNewLineOrDie(fmt.Sprintf(`%s:`, kind))
+	if p.Scheme == "tcp" {
+		pw.AppendNewLineOrDie(`  tcpSocket:`)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    port: %d`, p.Port))
+	} else {
+		pw.AppendNewLineOrDie(`  httpGet:`)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    path: %q`, p.Path))
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    port: %d`, p.Port))
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    scheme: %s`, strings.ToUpper(p.Scheme)))
+	}
+	pw.AppendNewLineOrDie(`  periodSeconds: 1`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  failureThreshold: %d`, failureThreshold))
+}
+
+// waitForSrvReady waits until the server pod is ready, i.e., (if the port is
+// known) it listens on its port, so that the client is created after the
+// server. It is a no-op if SetNoWaitServer was called.
+func (r *RunBenchCtx) waitForSrvReady(ctx context.Context, srvSelector string) error {
+	if r.noWaitSrv {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(
+		"kubectl wait%s pod -l \"%s\" --for=condition=Ready --timeout=%s",
+		nsArg(r.srvSpec.Namespace), srvSelector, srvReadyTimeout,
+	)
+	start := time.Now()
+	// the pod might not exist yet, in which case kubectl wait fails
+	for {
+		logger().Debug("exec", "cmd", cmd)
+		err := utils.ExecCmdContext(ctx, cmd)
+		if err == nil {
+			logger().Info("server ready", "duration", time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// a rejected pod never becomes ready
+		if err := r.checkSysctlForbidden(); err != nil {
+			return err
+		}
+		if time.Since(start) > srvReadyTimeout {
+			if p := r.srvReadyProbe(); p != nil && p.Scheme == "tcp" {
+				return fmt.Errorf("server never started listening on port %d (waited %s): check the server logs (srv.log), or use --no-wait-server", p.Port, srvReadyTimeout)
+			} else if p != nil {
+				return fmt.Errorf("server readiness probe %s never succeeded (waited %s): check the server logs (srv.log), or use --no-wait-server", p, srvReadyTimeout)
+			}
+			return fmt.Errorf("server never became ready (waited %s): check the server logs (srv.log), or use --no-wait-server", srvReadyTimeout)
+		}
+		if err := sleepContext(ctx, 2*time.Second); err != nil {
+			return err
+		}
+	}
+}
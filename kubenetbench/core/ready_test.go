@@ -0,0 +1,50 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+func TestParseReadyProbe(t *testing.T) {
+	tests := []struct {
+		s     string
+		probe ReadyProbe
+	}{
+		{"tcp://:8080", ReadyProbe{Scheme: "tcp", Port: 8080}},
+		{"http://:8080/healthz", ReadyProbe{Scheme: "http", Port: 8080, Path: "/healthz"}},
+		{"https://:8443", ReadyProbe{Scheme: "https", Port: 8443, Path: "/"}},
+		{"http://:8080/ready?full=1", ReadyProbe{Scheme: "http", Port: 8080, Path: "/ready?full=1"}},
+	}
+	for _, tt := range tests {
+		p, err := ParseReadyProbe(tt.s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.s, err)
+			continue
+		}
+		if *p != tt.probe {
+			t.Errorf("%s: got %+v while expected %+v", tt.s, *p, tt.probe)
+		}
+	}
+
+	for _, s := range []string{"tcp://srv:8080", "tcp://:8080/x", "udp://:53", "http://", "8080"} {
+		if _, err := ParseReadyProbe(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestWriteProbe(t *testing.T) {
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	writeProbe(pw, "readinessProbe", &ReadyProbe{Scheme: "http", Port: 8080, Path: "/healthz"}, 1)
+	pw.Flush()
+
+	for _, l := range []string{"httpGet:", `path: "/healthz"`, "port: 8080", "scheme: HTTP"} {
+		if !strings.Contains(buf.String(), l) {
+			t.Errorf("probe does not contain %q:\n%s", l, buf.String())
+		}
+	}
+}
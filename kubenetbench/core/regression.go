@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// regressionIgnoredParams are the parameters (see AddParam) that may differ
+// between a run and its baseline
+var regressionIgnoredParams = map[string]struct{}{
+	paramPrefix + "REPEAT":            {},
+	paramPrefix + configRevisionParam: {},
+}
+
+// RegressionCheck is the comparison of the key metric (see keyMetric) of a
+// run with a baseline run
+type RegressionCheck struct {
+	Metric   string
+	Baseline string  // run id of the baseline
+	BaseVal  float64 // value of the baseline
+	CurVal   float64 // value of the current run(s) (the mean for repeats)
+	Delta    float64 // relative change, in percent
+	MaxPct   float64 // maximum allowed regression, in percent
+}
+
+// Regressed returns true if the regression exceeds the threshold
+func (c *RegressionCheck) Regressed() bool {
+	return -c.Delta > c.MaxPct
+}
+
+func (c *RegressionCheck) String() string {
+	verdict := "OK"
+	if c.Regressed() {
+		verdict = "REGRESSION"
+	}
+	return fmt.Sprintf("%s: %s %.3f -> %.3f (%+.2f%%, baseline: %s, max regression: %.2f%%)",
+		verdict, c.Metric, c.BaseVal, c.CurVal, c.Delta, c.Baseline, c.MaxPct)
+}
+
+// keyMetric returns the metric that regressions are checked on: the
+// throughput, or the transaction rate (higher is better for both)
+func keyMetric(res *BenchResult) (string, float64, bool) {
+	for _, key := range []string{"AGGREGATE_THROUGHPUT", "THROUGHPUT", "TRANSACTION_RATE"} {
+		if f, ok := res.Float(key); ok {
+			return key, f, true
+		}
+	}
+	return "", 0, false
+}
+
+// runStart returns the start time of a run, as recorded in its metadata (see
+// MakeDir), or, for runs that predate it, the date suffix of its default id
+// (see NewRunBenchCtx). Runs with neither (e.g., older runs with a --run-id)
+// have no start time.
+func runStart(res *BenchResult) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, res.Meta[startTimeMeta]); err == nil {
+		return t, true
+	}
+	datestr := res.RunID[strings.LastIndex(res.RunID, "-")+1:]
+	if t, err := time.ParseInLocation("20060102150405", datestr, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// sameParams returns true if two runs have the same parameters, excluding
+// regressionIgnoredParams
+func sameParams(a, b *BenchResult) bool {
+	params := func(res *BenchResult) map[string]string {
+		ret := make(map[string]string)
+		for k, v := range res.Meta {
+			if _, ok := regressionIgnoredParams[k]; !ok && strings.HasPrefix(k, paramPrefix) {
+				ret[k] = v
+			}
+		}
+		return ret
+	}
+	pa, pb := params(a), params(b)
+	if len(pa) != len(pb) {
+		return false
+	}
+	for k, v := range pa {
+		if pb[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FindBaseline returns the baseline to check the given (current) runs
+// against: the run named baseline, or, if empty, the most recent earlier run
+// of the session with the same parameters. It returns nil (and no error) if
+// there is no earlier run.
+func FindBaseline(sessDir string, current []*BenchResult, baseline string) (*BenchResult, error) {
+	if len(current) == 0 {
+		return nil, fmt.Errorf("no runs to compare")
+	}
+
+	if baseline != "" {
+		results, err := loadRunResults(sessDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range results {
+			if res.RunID == baseline {
+				return res, nil
+			}
+		}
+		if _, err := os.Stat(filepath.Join(sessDir, baseline)); err == nil {
+			return nil, fmt.Errorf("baseline run %s has no saved result", baseline)
+		}
+		return nil, fmt.Errorf("baseline run %s not found in %s", baseline, sessDir)
+	}
+
+	results, err := loadRunResults(sessDir)
+	if err != nil {
+		return nil, err
+	}
+	first, ok := runStart(current[0])
+	if !ok {
+		return nil, fmt.Errorf("run %s has no start time", current[0].RunID)
+	}
+	type candidate struct {
+		res   *BenchResult
+		start time.Time
+	}
+	candidates := []candidate{}
+	for _, res := range results {
+		start, ok := runStart(res)
+		if ok && start.Before(first) && sameParams(res, current[0]) {
+			candidates = append(candidates, candidate{res, start})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].start.Before(candidates[j].start)
+	})
+	return candidates[len(candidates)-1].res, nil
+}
+
+// CheckRegression compares the key metric of the current runs (their mean,
+// for repeats) with the baseline. maxPct is the maximum allowed regression,
+// in percent.
+func CheckRegression(baseline *BenchResult, current []*BenchResult, maxPct float64) (*RegressionCheck, error) {
+	metric, baseVal, ok := keyMetric(baseline)
+	if !ok {
+		return nil, fmt.Errorf("baseline run %s has no throughput or transaction rate", baseline.RunID)
+	}
+	if baseVal == 0 {
+		return nil, fmt.Errorf("baseline run %s has a zero %s", baseline.RunID, metric)
+	}
+
+	vals := make([]float64, 0, len(current))
+	for _, res := range current {
+		v, ok := res.Float(metric)
+		if !ok {
+			return nil, fmt.Errorf("run %s has no %s (as baseline %s)", res.RunID, metric, baseline.RunID)
+		}
+		vals = append(vals, v)
+	}
+	curVal := ComputeStats(vals).Mean
+
+	return &RegressionCheck{
+		Metric:   metric,
+		Baseline: baseline.RunID,
+		BaseVal:  baseVal,
+		CurVal:   curVal,
+		Delta:    (curVal - baseVal) / baseVal * 100,
+		MaxPct:   maxPct,
+	}, nil
+}
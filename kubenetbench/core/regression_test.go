@@ -0,0 +1,97 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegression(t *testing.T) {
+	dir := t.TempDir()
+	runs := []struct{ id, result, meta string }{
+		{"pod2pod-20240101000000", "THROUGHPUT=100\n", "PARAM_NETPERF_TYPE=tcp_stream\nPARAM_CONFIG_REVISION=aaaaaaa\n"},
+		{"pod2pod-20240102000000", "THROUGHPUT=110\n", "PARAM_NETPERF_TYPE=tcp_stream\nPARAM_CONFIG_REVISION=bbbbbbb\n"},
+		{"pod2pod-20240103000000", "TRANSACTION_RATE=5000\n", "PARAM_NETPERF_TYPE=tcp_rr\n"},
+		{"pod2pod-20240104000000", "THROUGHPUT=90\n", "PARAM_NETPERF_TYPE=tcp_stream\nPARAM_CONFIG_REVISION=ccccccc\n"},
+	}
+	for _, r := range runs {
+		rdir := filepath.Join(dir, r.id)
+		if err := os.Mkdir(rdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(rdir, "result"), []byte(r.result), 0644)
+		os.WriteFile(filepath.Join(rdir, "meta"), []byte(r.meta), 0644)
+	}
+	results, err := loadRunResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := results[3:]
+
+	baseline, err := FindBaseline(dir, current, "")
+	if err != nil || baseline == nil || baseline.RunID != "pod2pod-20240102000000" {
+		t.Fatalf("unexpected baseline: %v %v", baseline, err)
+	}
+
+	check, err := CheckRegression(baseline, current, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Metric != "THROUGHPUT" || !check.Regressed() {
+		t.Errorf("expected a throughput regression: %s", check)
+	}
+
+	baseline, err = FindBaseline(dir, current, "pod2pod-20240101000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check, err = CheckRegression(baseline, current, 15); err != nil || check.Regressed() {
+		t.Errorf("unexpected regression: %s %v", check, err)
+	}
+
+	if baseline, err = FindBaseline(dir, results[:1], ""); err != nil || baseline != nil {
+		t.Errorf("unexpected baseline for the first run: %v %v", baseline, err)
+	}
+	if _, err = FindBaseline(dir, current, "nosuchrun"); err == nil {
+		t.Errorf("expected error for a missing baseline")
+	}
+}
+
+func TestRegressionRunID(t *testing.T) {
+	dir := t.TempDir()
+	// run ids without a date (--run-id), whose order is not the order of
+	// their start times
+	runs := []struct{ id, result, meta string }{
+		{"ci-900", "THROUGHPUT=100\n", "START_TIME=2024-01-01T00:00:00Z\n"},
+		{"ci-1000", "THROUGHPUT=110\n", "START_TIME=2024-01-02T00:00:00Z\n"},
+		{"ci-1100", "THROUGHPUT=90\n", "START_TIME=2024-01-03T00:00:00Z\n"},
+		{"ci-old", "THROUGHPUT=120\n", ""},
+	}
+	for _, r := range runs {
+		rdir := filepath.Join(dir, r.id)
+		if err := os.Mkdir(rdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(rdir, "result"), []byte(r.result), 0644)
+		os.WriteFile(filepath.Join(rdir, "meta"), []byte(r.meta), 0644)
+	}
+	results, err := loadRunResults(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]*BenchResult)
+	for _, res := range results {
+		byID[res.RunID] = res
+	}
+
+	baseline, err := FindBaseline(dir, []*BenchResult{byID["ci-1100"]}, "")
+	if err != nil || baseline == nil || baseline.RunID != "ci-1000" {
+		t.Fatalf("unexpected baseline: %v %v", baseline, err)
+	}
+	if baseline, err = FindBaseline(dir, []*BenchResult{byID["ci-900"]}, ""); err != nil || baseline != nil {
+		t.Errorf("unexpected baseline for the first run: %v %v", baseline, err)
+	}
+	if _, err = FindBaseline(dir, []*BenchResult{byID["ci-old"]}, ""); err == nil {
+		t.Errorf("expected error for a run without a start time")
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// reproducerFname is the name of the reproducer script in the run directory
+const reproducerFname = "reproduce.sh"
+
+// shellQuote quotes a string for sh (if needed)
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_=./:,@%+", c))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Reproducer returns a shell script that runs kubenetbench (this program)
+// with args, e.g., the command and the effective value of every flag of a run.
+// It runs in the current directory, so that relative paths (e.g., of the
+// session) are the same. Arguments of the script are appended (e.g., to
+// override the run id).
+func Reproducer(args []string) (string, error) {
+	prog, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		return "", err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "#!/bin/sh")
+	fmt.Fprintf(&b, "# kubenetbench reproducer, written on %s\n", time.Now().Format(time.RFC3339))
+	cmd := "kubectl config current-context"
+	logger().Debug("exec", "cmd", cmd)
+	if lines, err := utils.ExecCmdLines(cmd); err == nil && len(lines) > 0 {
+		fmt.Fprintf(&b, "# kubectl context: %s (the script uses the current context)\n", strings.TrimSpace(lines[0]))
+	}
+	fmt.Fprintf(&b, "cd %s || exit 1\n", shellQuote(cwd))
+	fmt.Fprintf(&b, "exec %s", shellQuote(prog))
+	for _, a := range args {
+		fmt.Fprintf(&b, " \\\n    %s", shellQuote(a))
+	}
+	fmt.Fprintln(&b, ` \`+"\n    \"$@\"")
+	return b.String(), nil
+}
+
+// SaveReproducer stores a reproducer script (see Reproducer) in the run
+// directory
+func (r *RunBenchCtx) SaveReproducer(script string) error {
+	return os.WriteFile(fmt.Sprintf("%s/%s", r.getDir(), reproducerFname), []byte(script), 0755)
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReproducer(t *testing.T) {
+	for in, expected := range map[string]string{
+		"--duration=30":      "--duration=30",
+		"--tag=a=b c":        "'--tag=a=b c'",
+		"--netem=delay 20ms": "'--netem=delay 20ms'",
+		"--ss-filter=":       "--ss-filter=",
+		"it's":               `'it'\''s'`,
+		"":                   "''",
+	} {
+		if got := shellQuote(in); got != expected {
+			t.Errorf("%q: expected %s, got %s", in, expected, got)
+		}
+	}
+
+	script, err := Reproducer([]string{"pod2pod", "--duration=30", "--tag=a=b c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(script, "#!/bin/sh\n") || !strings.Contains(script, "    pod2pod \\\n    --duration=30 \\\n    '--tag=a=b c' \\\n    \"$@\"\n") {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+
+	// the script is valid sh
+	fname := filepath.Join(t.TempDir(), "reproduce.sh")
+	if err := os.WriteFile(fname, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("sh", "-n", fname).CombinedOutput(); err != nil {
+		t.Errorf("invalid script: %s: %s", err, out)
+	}
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// netperf -k output lines are of the form KEY=VALUE
+var resultLineRegEx = regexp.MustCompile(`^([A-Z][A-Z0-9_]*)=(.*)$`)
+
+// BenchResult holds the (parsed) result of a benchmark run
+type BenchResult struct {
+	RunID  string
+	Values map[string]string // raw KEY=VALUE pairs from the client output
+	Meta   map[string]string // run metadata (see addMeta())
+	Tags   map[string]string // user-provided tags (see AddTag())
+
+	Intervals []ResultInterval // per-interval stats (see IntervalParser)
+}
+
+// ParseBenchResult parses the output of the benchmark client
+func ParseBenchResult(runid string, rd io.Reader) (*BenchResult, error) {
+	res := &BenchResult{
+		RunID:  runid,
+		Values: make(map[string]string),
+		Meta:   make(map[string]string),
+		Tags:   make(map[string]string),
+	}
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		m := resultLineRegEx.FindStringSubmatch(scanner.Text())
+		if len(m) != 3 {
+			continue
+		}
+		res.Values[m[1]] = m[2]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Float returns the value of a key as a float
+func (b *BenchResult) Float(key string) (float64, bool) {
+	v, ok := b.Values[key]
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// Throughput returns the throughput of the run.
+// NB: for multiple streams (duper_netperf), this is the aggregate throughput.
+func (b *BenchResult) Throughput() (float64, bool) {
+	if f, ok := b.Float("AGGREGATE_THROUGHPUT"); ok {
+		return f, true
+	}
+	return b.Float("THROUGHPUT")
+}
+
+// transferRate returns the rate at which the run transferred data: the
+// throughput, or the transaction rate (e.g., for http)
+func (b *BenchResult) transferRate() (float64, bool) {
+	if f, ok := b.Throughput(); ok {
+		return f, true
+	}
+	return b.Float("TRANSACTION_RATE")
+}
+
+// NumericKeys returns the (sorted) keys that have a numeric value
+func (b *BenchResult) NumericKeys() []string {
+	ret := []string{}
+	for k := range b.Values {
+		if _, ok := b.Float(k); ok {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// paramPrefix is the metadata key prefix for run parameters (see AddParam)
+const paramPrefix = "PARAM_"
+
+// AddParam records a parameter of the run (e.g., the message size of a sweep)
+// in the run metadata. Parameters are columns in the session summary (see
+// Summarize).
+func (r *RunBenchCtx) AddParam(key, value string) {
+	r.addMeta(paramPrefix+key, value)
+}
+
+// ErrNoTransfer is returned (wrapped) by SaveResult for runs that completed
+// without transferring any data (see SetAllowZero)
+var ErrNoTransfer = errors.New("no data transferred")
+
+// ErrInvalidResult is returned (wrapped) by SaveResult for runs whose results
+// fail the benchmark's check (see ResultChecker)
+var ErrInvalidResult = errors.New("invalid result")
+
+// zeroTransferRate is the transfer rate under which a run is considered to
+// have transferred no data
+const zeroTransferRate = 0.01
+
+// SetAllowZero allows runs that transfer no data (e.g., when testing a
+// deny policy). By default, such runs are an error (see SaveResult).
+func (r *RunBenchCtx) SetAllowZero() {
+	r.allowZero = true
+}
+
+// checkTransfer returns an error if the run transferred (essentially) no data,
+// unless allowed. Results without a known transfer rate are not checked.
+func (r *RunBenchCtx) checkTransfer(res *BenchResult) error {
+	rate, ok := res.transferRate()
+	if !ok || rate >= zeroTransferRate || r.allowZero {
+		return nil
+	}
+
+	r.addMeta("ZERO_TRANSFER", "true")
+	return fmt.Errorf("%w in run %s (rate: %g): check the connectivity between client and server (e.g., network policies, server listening address), or use --allow-zero if this is expected",
+		ErrNoTransfer, r.runid, rate)
+}
+
+func (r *RunBenchCtx) resultFname() string {
+	return fmt.Sprintf("%s/result", r.getDir())
+}
+
+// SaveResult parses the results of the run (see GetResult) and stores them as
+// KEY=VALUE lines in the result file of the run directory. Runs that
+// transferred no data are not saved, and return ErrNoTransfer (see
+// SetAllowZero). Neither are runs that fail the benchmark's check, which
+// return ErrInvalidResult (see ResultChecker).
+func (r *RunBenchCtx) SaveResult() (*BenchResult, error) {
+	res, err := r.GetResult()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkTransfer(res); err != nil {
+		return nil, err
+	}
+	if c, ok := r.benchmark.(ResultChecker); ok {
+		if err := c.CheckResult(res); err != nil {
+			r.addMeta("INVALID_RESULT", "true")
+			return nil, fmt.Errorf("%w in run %s: %w", ErrInvalidResult, r.runid, err)
+		}
+	}
+
+	f, err := os.Create(r.resultFname())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := make([]string, 0, len(res.Values))
+	for k := range res.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(f, "%s=%s\n", k, res.Values[k])
+	}
+
+	if len(res.Intervals) > 0 {
+		fname := fmt.Sprintf("%s/%s", r.getDir(), intervalsFname)
+		if err := writeIntervals(fname, res.Intervals); err != nil {
+			logger().Warn("failed to write interval stats", "file", fname, "error", err)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *RunBenchCtx) metaFname() string {
+	return fmt.Sprintf("%s/meta", r.getDir())
+}
+
+// addMeta records a KEY=VALUE metadata pair for the run
+func (r *RunBenchCtx) addMeta(key, value string) {
+	f, err := os.OpenFile(r.metaFname(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger().Warn("failed to record run metadata", "key", key, "error", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s=%s\n", key, value)
+}
+
+// GetResult parses the client log (and metadata) of the run
+func (r *RunBenchCtx) GetResult() (*BenchResult, error) {
+	fname := fmt.Sprintf("%s/cli.log", r.getDir())
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res *BenchResult
+	if parser, ok := r.benchmark.(ResultParser); ok {
+		res, err = parser.ParseResult(r.runid, f)
+	} else {
+		res, err = ParseBenchResult(r.runid, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if parser, ok := r.benchmark.(IntervalParser); ok {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		res.Intervals, err = parser.ParseIntervals(f)
+		if err != nil {
+			logger().Warn("failed to parse interval stats", "run", r.runid, "error", err)
+		}
+		// with a measurement window, the results are those of the window
+		// (see SetMeasureWindow)
+		intervals := res.Intervals
+		if r.window != nil {
+			intervals = windowIntervals(res.Intervals, *r.window)
+			wv, err := windowValues(res.Values, intervals, *r.window)
+			if err != nil {
+				return nil, err
+			}
+			delete(res.Values, "AGGREGATE_THROUGHPUT")
+			for k, v := range wv {
+				res.Values[k] = v
+			}
+		}
+		for k, v := range intervalValues(intervals) {
+			res.Values[k] = v
+		}
+	}
+
+	// network stats, socket samples, RDMA counters, hubble flows summaries,
+	// CPU usage, and base RTT (see endNetStats(), processSsSamples(),
+	// processRdmaCounters(), processHubbleFlows(), processCPUUsage(), and
+	// preflightPing())
+	for _, log := range []string{"netstats.log", "ss.log", "rdma.log", "hubble.log", "cpu.log", "ping.log"} {
+		nf, err := os.Open(fmt.Sprintf("%s/%s", r.getDir(), log))
+		if err != nil {
+			continue
+		}
+		ns, err := ParseBenchResult(r.runid, nf)
+		nf.Close()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ns.Values {
+			res.Values[k] = v
+		}
+	}
+	addCPUPerGbps(res.Values)
+
+	res.Tags, err = readTagsFile(r.tagsFname())
+	if err != nil {
+		return nil, err
+	}
+
+	mf, err := os.Open(r.metaFname())
+	if os.IsNotExist(err) {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer mf.Close()
+
+	meta, err := ParseBenchResult(r.runid, mf)
+	if err != nil {
+		return nil, err
+	}
+	res.Meta = meta.Values
+	return res, nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckTransfer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "foo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := &RunBenchCtx{session: &Session{dir: dir}, runid: "foo"}
+
+	for _, vals := range []map[string]string{
+		{"THROUGHPUT": "0.00"},
+		{"TRANSACTION_RATE": "0"},
+	} {
+		err := r.checkTransfer(&BenchResult{Values: vals})
+		if !errors.Is(err, ErrNoTransfer) {
+			t.Errorf("%v: expected ErrNoTransfer, got %v", vals, err)
+		}
+	}
+
+	for _, vals := range []map[string]string{
+		{"THROUGHPUT": "941.2"},
+		{"NETREADY_US": "0"}, // no transfer rate
+	} {
+		if err := r.checkTransfer(&BenchResult{Values: vals}); err != nil {
+			t.Errorf("%v: unexpected error: %v", vals, err)
+		}
+	}
+
+	r.SetAllowZero()
+	if err := r.checkTransfer(&BenchResult{Values: map[string]string{"THROUGHPUT": "0"}}); err != nil {
+		t.Errorf("unexpected error with allowZero: %v", err)
+	}
+}
+
+func TestNetperfCheckCongControl(t *testing.T) {
+	cnf := NetperfConfDefault("tcp_stream", nil, nil)
+	res := &BenchResult{Values: map[string]string{
+		"LOCAL_CONG_CONTROL":  "bbr",
+		"REMOTE_CONG_CONTROL": "cubic",
+	}}
+
+	if err := cnf.CheckResult(res); err != nil {
+		t.Errorf("unexpected error without a requested algorithm: %v", err)
+	}
+
+	cnf.CongControl = "bbr"
+	if err := cnf.CheckResult(res); err == nil {
+		t.Errorf("expected an error for the server's fallback to cubic")
+	}
+
+	res.Values["REMOTE_CONG_CONTROL"] = "bbr"
+	if err := cnf.CheckResult(res); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBenchResultWriteJSON(t *testing.T) {
+	res := &BenchResult{
+		RunID:  "r1",
+		Values: map[string]string{"THROUGHPUT": "9000.00"},
+		Meta:   map[string]string{"NODES": "a,b"},
+		Tags:   map[string]string{},
+	}
+	var buf strings.Builder
+	if err := res.WriteJSON(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.RunID = "r2"
+	res.WriteJSON(&buf)
+
+	expected := `{"schemaVersion":1,"runId":"r1","throughput":{"value":9000},"values":{"THROUGHPUT":"9000.00"},"meta":{"NODES":"a,b"}}
+{"schemaVersion":1,"runId":"r2","throughput":{"value":9000},"values":{"THROUGHPUT":"9000.00"},"meta":{"NODES":"a,b"}}
+`
+	if buf.String() != expected {
+		t.Errorf("got %q while expected %q", buf.String(), expected)
+	}
+}
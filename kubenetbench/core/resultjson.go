@@ -0,0 +1,187 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ResultSchemaVersion is the version of the schema of the JSON results (see
+// Result). Fields may be added without changing it: it is only incremented
+// when fields are removed, renamed, or change meaning (or units).
+const ResultSchemaVersion = 1
+
+// ResultsJSONFname is the file of the session directory with the JSON results
+// of all its runs (see WriteResultsJSON)
+const ResultsJSONFname = "results.json"
+
+// metadata keys of the benchmark and topology of a run (see Result)
+const (
+	benchmarkMeta = "BENCHMARK"
+	topologyMeta  = "TOPOLOGY"
+)
+
+// Result is the structured result of a run, as written by WriteJSON. Unlike
+// the raw values (which depend on the benchmark), the typed fields are the
+// same for all benchmarks, and are omitted if unknown.
+type Result struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	RunID         string `json:"runId"`
+	Benchmark     string `json:"benchmark,omitempty"` // e.g., netperf (as in --benchmark)
+	Topology      string `json:"topology,omitempty"`  // e.g., pod2pod (the run command)
+	Protocol      string `json:"protocol,omitempty"`  // e.g., TCP, UDP, HTTP
+
+	Throughput      *ResultThroughput `json:"throughput,omitempty"`
+	TransactionRate *float64          `json:"transactionRate,omitempty"` // transactions (or requests) per second
+	Latency         *ResultLatency    `json:"latency,omitempty"`
+
+	Values map[string]string `json:"values"`
+	Meta   map[string]string `json:"meta"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// ResultThroughput is the data throughput of a run. For multiple streams
+// (duper_netperf), it is the aggregate throughput.
+type ResultThroughput struct {
+	Value float64  `json:"value"`
+	Units string   `json:"units,omitempty"` // netperf units, e.g., 10^6bits/s
+	Gbps  *float64 `json:"gbps,omitempty"`  // in Gbit/s (if the units are known)
+}
+
+// ResultLatency are the latency statistics of a run, in microseconds
+type ResultLatency struct {
+	Min    *float64 `json:"min,omitempty"`
+	Mean   *float64 `json:"mean,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Stddev *float64 `json:"stddev,omitempty"`
+	P50    *float64 `json:"p50,omitempty"`
+	P90    *float64 `json:"p90,omitempty"`
+	P99    *float64 `json:"p99,omitempty"`
+}
+
+// benchmarkProtocols are the protocols of the benchmarks whose output does not
+// include one (netperf outputs PROTOCOL)
+var benchmarkProtocols = map[string]string{
+	"http": "HTTP",
+	"quic": "QUIC",
+}
+
+// netperfTransUnits are the THROUGHPUT_UNITS of the request/response tests,
+// whose THROUGHPUT is a transaction rate
+const netperfTransUnits = "Trans/s"
+
+// Result returns the structured result of the run
+func (b *BenchResult) Result() *Result {
+	ret := &Result{
+		SchemaVersion: ResultSchemaVersion,
+		RunID:         b.RunID,
+		Benchmark:     b.Meta[benchmarkMeta],
+		Topology:      b.Meta[topologyMeta],
+		Protocol:      b.Values["PROTOCOL"],
+		Values:        b.Values,
+		Meta:          b.Meta,
+		Tags:          b.Tags,
+	}
+	if ret.Protocol == "" {
+		ret.Protocol = benchmarkProtocols[ret.Benchmark]
+	}
+
+	units := b.Values["THROUGHPUT_UNITS"]
+	if f, ok := b.Float("TRANSACTION_RATE"); ok {
+		ret.TransactionRate = &f
+	}
+	if f, ok := b.Throughput(); ok {
+		if units == netperfTransUnits {
+			if ret.TransactionRate == nil {
+				ret.TransactionRate = &f
+			}
+		} else {
+			ret.Throughput = &ResultThroughput{Value: f, Units: units}
+			if gbps, ok := rateGbps(f, units); ok {
+				ret.Throughput.Gbps = &gbps
+			}
+		}
+	}
+
+	lat := &ResultLatency{}
+	for key, dst := range map[string]**float64{
+		"MIN_LATENCY":    &lat.Min,
+		"MEAN_LATENCY":   &lat.Mean,
+		"MAX_LATENCY":    &lat.Max,
+		"STDEV_LATENCY":  &lat.Stddev, // netperf
+		"STDDEV_LATENCY": &lat.Stddev, // http
+		"P50_LATENCY":    &lat.P50,
+		"P90_LATENCY":    &lat.P90,
+		"P99_LATENCY":    &lat.P99,
+	} {
+		if f, ok := b.Float(key); ok {
+			*dst = &f
+		}
+	}
+	if *lat != (ResultLatency{}) {
+		ret.Latency = lat
+	}
+
+	return ret
+}
+
+// WriteJSON writes the structured result (see Result) as a JSON object on a
+// single line, so that the results of multiple runs are JSON lines
+func (b *BenchResult) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(b.Result())
+}
+
+// SetTopology records the topology of the run (the run command, e.g., pod2pod
+// or service) and its benchmark in the run metadata (see Result)
+func (r *RunBenchCtx) SetTopology(topology string) {
+	r.addMeta(benchmarkMeta, benchmarkName(r.benchmark))
+	r.addMeta(topologyMeta, topology)
+}
+
+// WriteResultsJSON writes the structured results (see Result) of all the runs
+// of the session to the results.json file of the session directory, and
+// returns its name
+func (s *Session) WriteResultsJSON() (string, error) {
+	results, err := loadRunResults(s.dir)
+	if err != nil {
+		return "", err
+	}
+
+	doc := struct {
+		SchemaVersion int       `json:"schemaVersion"`
+		Session       string    `json:"session"`
+		Results       []*Result `json:"results"`
+	}{ResultSchemaVersion, s.id, make([]*Result, 0, len(results))}
+	for _, res := range results {
+		doc.Results = append(doc.Results, res.Result())
+	}
+
+	// written to a temporary file first, so that readers never see a
+	// partial file, which is unique, since concurrent processes (e.g.,
+	// orchestrated benchmarks) write the file of the same session
+	fname := filepath.Join(s.dir, ResultsJSONFname)
+	f, err := os.CreateTemp(s.dir, "results-*.json")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return fname, os.Rename(tmp, fname)
+}
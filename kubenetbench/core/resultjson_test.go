@@ -0,0 +1,148 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// netperfRROutput is the output of a netperf TCP_RR client (-k)
+const netperfRROutput = `MIGRATED TCP REQUEST/RESPONSE TEST from 0.0.0.0 (0.0.0.0) port 0 AF_INET to 10.0.1.12 () port 0 AF_INET : first burst 0
+THROUGHPUT=21325.56
+THROUGHPUT_UNITS=Trans/s
+THROUGHPUT_CONFID=-1.000
+PROTOCOL=TCP
+ELAPSED_TIME=60.00
+TRANSACTION_RATE=21325.560
+P50_LATENCY=45
+P90_LATENCY=52
+RT_LATENCY=46.892
+MEAN_LATENCY=46.79
+STDEV_LATENCY=12.09
+MIN_LATENCY=31
+MAX_LATENCY=5113
+P99_LATENCY=79
+`
+
+// netperfStreamOutput is the output of a netperf TCP_STREAM client (-k)
+const netperfStreamOutput = `MIGRATED TCP STREAM TEST from 0.0.0.0 (0.0.0.0) port 0 AF_INET to 10.0.1.12 () port 0 AF_INET
+THROUGHPUT=9412.33
+THROUGHPUT_UNITS=10^6bits/s
+THROUGHPUT_CONFID=-1.000
+PROTOCOL=TCP
+ELAPSED_TIME=60.00
+`
+
+func ptr(f float64) *float64 {
+	return &f
+}
+
+func TestResultNetperf(t *testing.T) {
+	res, err := ParseBenchResult("pod2pod-rr", strings.NewReader(netperfRROutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Meta = map[string]string{benchmarkMeta: "netperf", topologyMeta: "pod2pod"}
+	got := res.Result()
+	got.Values, got.Meta = nil, nil
+	expected := &Result{
+		SchemaVersion:   ResultSchemaVersion,
+		RunID:           "pod2pod-rr",
+		Benchmark:       "netperf",
+		Topology:        "pod2pod",
+		Protocol:        "TCP",
+		TransactionRate: ptr(21325.56),
+		Latency: &ResultLatency{
+			Min: ptr(31), Mean: ptr(46.79), Max: ptr(5113), Stddev: ptr(12.09),
+			P50: ptr(45), P90: ptr(52), P99: ptr(79),
+		},
+		Tags: map[string]string{},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		g, _ := json.Marshal(got)
+		e, _ := json.Marshal(expected)
+		t.Errorf("got %s while expected %s", g, e)
+	}
+
+	res, err = ParseBenchResult("pod2pod-stream", strings.NewReader(netperfStreamOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = res.Result()
+	if got.TransactionRate != nil || got.Latency != nil || got.Protocol != "TCP" {
+		t.Errorf("unexpected result: %+v", got)
+	}
+	if tp := got.Throughput; tp == nil || tp.Value != 9412.33 || tp.Units != "10^6bits/s" || tp.Gbps == nil || *tp.Gbps < 9.41 || *tp.Gbps > 9.42 {
+		t.Errorf("unexpected throughput: %+v", tp)
+	}
+}
+
+func TestWriteResultsJSON(t *testing.T) {
+	s := &Session{id: "test", dir: t.TempDir()}
+	for runid, output := range map[string]string{"pod2pod-1": netperfStreamOutput, "service-1": netperfRROutput} {
+		dir := filepath.Join(s.dir, runid)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		r := &RunBenchCtx{session: s, runid: runid, benchmark: &NetperfRRConf{}}
+		r.SetTopology(strings.Split(runid, "-")[0])
+		if err := os.WriteFile(filepath.Join(dir, "cli.log"), []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.SaveResult(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fname, err := s.WriteResultsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		SchemaVersion int
+		Session       string
+		Results       []Result
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid %s: %v\n%s", fname, err, data)
+	}
+	if doc.SchemaVersion != ResultSchemaVersion || doc.Session != "test" || len(doc.Results) != 2 {
+		t.Fatalf("unexpected results:\n%s", data)
+	}
+	first, second := doc.Results[0], doc.Results[1]
+	if first.RunID != "pod2pod-1" || first.Topology != "pod2pod" || first.Benchmark != "netperf" || first.Throughput == nil {
+		t.Errorf("unexpected result: %+v", first)
+	}
+	if second.RunID != "service-1" || second.Topology != "service" || second.TransactionRate == nil || *second.TransactionRate != 21325.56 {
+		t.Errorf("unexpected result: %+v", second)
+	}
+
+	// concurrent writers (e.g., orchestrated benchmarks) use distinct
+	// temporary files
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.WriteResultsJSON()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(s.dir, "results-*.json")); len(tmps) > 0 {
+		t.Errorf("temporary files left: %v", tmps)
+	}
+}
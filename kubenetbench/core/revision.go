@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// configRevisionParam is the parameter (see AddParam) of the config revision
+const configRevisionParam = "CONFIG_REVISION"
+
+// configRevisionRe matches git revisions (abbreviated or not), optionally
+// marked as dirty (see GitRevision)
+var configRevisionRe = regexp.MustCompile(`^[0-9a-f]{7,64}(-dirty)?$`)
+
+// GitRevision returns the commit (HEAD) of the git repository that path (a
+// file or a directory) is in. If the repository has uncommitted changes, the
+// revision is suffixed with -dirty.
+func GitRevision(path string) (string, error) {
+	dir := path
+	if fi, err := os.Stat(path); err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		dir = filepath.Dir(path)
+	}
+
+	lines, err := gitLines(dir, "rev-parse", "HEAD")
+	if err != nil || len(lines) != 1 {
+		return "", fmt.Errorf("failed to get git revision of %s: not in a git repository? (%v)", path, err)
+	}
+	rev := lines[0]
+
+	lines, err = gitLines(dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return "", fmt.Errorf("failed to get git status of %s: %w", path, err)
+	}
+	if len(lines) > 0 {
+		rev += "-dirty"
+	}
+	return rev, nil
+}
+
+// gitLines executes git in dir (without a shell, since dir may contain any
+// character) and returns the lines of its output
+func gitLines(dir string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	logger().Debug("exec", "cmd", cmd.String())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimRight(string(out), "\n")
+	if s == "" {
+		return nil, nil
+	}
+	return strings.Split(s, "\n"), nil
+}
+
+// SetConfigRevision records the revision (e.g., git commit) of the
+// configuration that the run was created from. It is a parameter of the run
+// (see AddParam), so it is included in the session summary and in exported
+// results.
+func (r *RunBenchCtx) SetConfigRevision(rev string) error {
+	if !configRevisionRe.MatchString(rev) {
+		return fmt.Errorf("invalid config revision %q: expecting a git commit hash", rev)
+	}
+	r.AddParam(configRevisionParam, rev)
+	return nil
+}
+
+// ConfigRevision returns the revision of the configuration of the run (empty
+// if unknown, see SetConfigRevision)
+func (b *BenchResult) ConfigRevision() string {
+	return b.Meta[paramPrefix+configRevisionParam]
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	// the directory is not interpreted by a shell
+	dir := filepath.Join(t.TempDir(), `cfg "$(false)" $HOME`)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GitRevision(dir); err == nil {
+		t.Errorf("expected error outside of a git repository")
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=knb", "-c", "user.email=knb@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s: %s", args, err, out)
+		}
+	}
+
+	rev, err := GitRevision(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !configRevisionRe.MatchString(rev) || strings.HasSuffix(rev, "-dirty") {
+		t.Errorf("unexpected revision: %q", rev)
+	}
+}
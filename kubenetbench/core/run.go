@@ -1,9 +1,10 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"text/template"
 	"time"
 
@@ -12,13 +13,38 @@ import (
 
 // ContainerSpec holds configurable options for setting the container spec
 //
-// NB: for now, we just include host options.
+// NB: for now, we just include host, network, and security options.
 type ContainerSpec struct {
-	Affinity string
+	Affinity  string
+	Namespace string // namespace of the pod (empty for the default namespace)
 
 	HostNetwork bool
 	HostIPC     bool
 	HostPID     bool
+
+	NetworkAttachment string // multus network attachment(s) (empty for none)
+	NetworkIface      string // interface to use for the benchmark traffic
+
+	Restricted bool     // comply with the restricted Pod Security Standard
+	RunAsUser  int64    // user to run as (if restricted)
+	CapAdd     []string // capabilities to add to the container
+
+	DNSPolicy      string   // pod DNS policy (empty for the default)
+	DNSNameservers []string // pod DNS nameservers
+	DNSSearches    []string // pod DNS search domains
+
+	Volumes []Volume // extra volumes to mount into the container
+
+	NodeLabels  map[string]string // labels of the nodes the pod may run on (e.g., nodes reserved for benchmarking)
+	Tolerations []Toleration      // taints that the pod tolerates
+
+	AllowControlPlane bool // allow the pod on control-plane nodes (excluded by default, unless placed on a node)
+
+	ZonePlacement string // zone of the client relative to the server: same, cross (empty for any, see ValidateZonePlacement)
+
+	RuntimeClass string // runtime class of the pod, e.g., gvisor (empty for the default)
+
+	Sysctls []Sysctl // sysctls of the pod (see ParseSysctl)
 }
 
 func (s *ContainerSpec) SetHostAll() {
@@ -29,14 +55,58 @@ func (s *ContainerSpec) SetHostAll() {
 
 // RunBenchCtx is the context for a benchmark run
 type RunBenchCtx struct {
-	session      *Session       // session
-	runid        string         //
-	cliSpec      *ContainerSpec // client security context
-	srvSpec      *ContainerSpec // server security context
-	cleanup      bool           // perform cleanup: remove k8s entitites (pods, policies, etc.)
-	benchmark    Benchmark      // underlying benchmark interface
-	collectPerf  bool           // collect perf results
-	collectNodes []string
+	session       *Session       // session
+	runid         string         //
+	cliSpec       *ContainerSpec // client security context
+	srvSpec       *ContainerSpec // server security context
+	cleanup       bool           // perform cleanup: remove k8s entitites (pods, policies, etc.)
+	benchmark     Benchmark      // underlying benchmark interface
+	collectPerf   bool           // collect perf results
+	perfOutput    string         // perf output (see SetPerfOutput)
+	collectNodes  []string
+	collectFailed []string // nodes where retrieving the collection results failed
+
+	collectMu       sync.Mutex       // protects collectFailed and collectTooLarge
+	collectProgress *collectProgress // progress of retrieving collection results (nil for none)
+
+	sidecars map[string]sidecarPod // pods with monitor sidecars, by name (see monitorTargets)
+
+	observeNodes []string // nodes observed without benchmark pods (see ObserveSt)
+
+	collectDuration      int            // collection duration in seconds (0 for the default)
+	collectDurationNodes map[string]int // per-node collection durations (see SetCollectionDuration)
+
+	maxCollectionSize int64    // per-node collection archive size limit (0 for no limit)
+	collectTooLarge   []string // nodes whose collection archive exceeded maxCollectionSize
+	collectRetries    int      // retries of retrieving the collection results (see SetCollectionRetries)
+
+	collectNetStats bool               // collect network stats (nstat, conntrack, ss)
+	netStats        *netStatsCollector // network stats collection state
+	pcap            *PcapConf          // packet capture configuration (nil for no capture)
+	ss              *SsConf            // socket sampling configuration (nil for no sampling)
+	verifyPath      bool               // verify the path of the traffic (see SetVerifyPath)
+	rdma            bool               // collect RDMA device counters (see SetRdmaCounters)
+	hubble          bool               // record hubble flows (see SetHubble)
+	cpu             bool               // collect CPU usage (see SetCPUUsage)
+
+	netem        *NetemConf    // netem configuration (nil for none, see SetNetem)
+	netemTargets []netemTarget // interfaces netem was applied on (see removeNetem)
+
+	ping *PingConf // pre-flight ping configuration (nil for none, see SetPing)
+
+	topologyDot string // DOT topology output file (see SetTopologyDot)
+
+	allowZero bool        // allow runs that transfer no data (see SetAllowZero)
+	noWaitSrv bool        // do not wait for the server before creating the client
+	srvProbe  *ReadyProbe // readiness probe of the server (nil for the default, see SetSrvReadyProbe)
+
+	keepYaml string   // manifest retention policy (see SetKeepYaml)
+	yamls    []string // manifests applied by the run
+
+	pause        bool          // pause before cleanup (see SetPause)
+	pauseTimeout time.Duration // maximum pause duration (0 for no limit)
+
+	window *MeasureWindow // measurement window (nil for the whole traffic, see SetMeasureWindow)
 }
 
 func NewRunBenchCtx(
@@ -47,6 +117,7 @@ func NewRunBenchCtx(
 	cleanup bool,
 	benchmark Benchmark,
 	collectPerf bool,
+	collectNetStats bool,
 ) *RunBenchCtx {
 	datestr := time.Now().Format("20060102150405")
 	runid := fmt.Sprintf("%s-%s", runLabel, datestr)
@@ -58,58 +129,138 @@ func NewRunBenchCtx(
 		cleanup:     cleanup,
 		benchmark:   benchmark,
 		collectPerf: collectPerf,
+
+		collectNetStats: collectNetStats,
+		collectRetries:  DefaultCollectionRetries,
 	}
 }
 
+// ValidateRunID checks that a run id can be used as a label value (it selects
+// the run resources), and as the name of the run directory
+func ValidateRunID(id string) error {
+	if len(id) > 63 || !labelNameRegEx.MatchString(id) {
+		return fmt.Errorf("invalid run id %q: it must be a valid label value (at most 63 alphanumeric, '-', '_', or '.' characters, starting and ending with an alphanumeric)", id)
+	}
+	if id == "latest" {
+		return fmt.Errorf("invalid run id %q: it is reserved for the latest run", id)
+	}
+	return nil
+}
+
+// SetRunID sets the run id, instead of the generated one (<label>-<date>),
+// e.g., to correlate the run with a CI job
+func (r *RunBenchCtx) SetRunID(id string) error {
+	if err := ValidateRunID(id); err != nil {
+		return err
+	}
+	r.runid = id
+	return nil
+}
+
+// RunID returns the run id. It identifies the run directory in the session,
+// the run resources (label), and the monitor collection.
+func (r *RunBenchCtx) RunID() string {
+	return r.runid
+}
+
 func (r *RunBenchCtx) getRunLabel(sep string) string {
-	return fmt.Sprintf("%s%s%s", runIdLabel, sep, r.runid)
+	return fmt.Sprintf("%s%s%s", r.session.labelKey(runIdLabel), sep, r.runid)
+}
+
+// namespaces returns the (unique) namespaces that the run uses
+func (r *RunBenchCtx) namespaces() []string {
+	if r.cliSpec.Namespace == r.srvSpec.Namespace {
+		return []string{r.srvSpec.Namespace}
+	}
+	return []string{r.cliSpec.Namespace, r.srvSpec.Namespace}
 }
 
 func (r *RunBenchCtx) getDir() string {
 	return fmt.Sprintf("%s/%s", r.session.dir, r.runid)
 }
 
+// startTimeMeta is the metadata key of the start time of a run (see MakeDir)
+const startTimeMeta = "START_TIME"
+
 func (r *RunBenchCtx) MakeDir() error {
 	d := r.getDir()
-	return os.Mkdir(d, 0755)
+	err := os.Mkdir(d, 0755)
+	if os.IsExist(err) {
+		return fmt.Errorf("run %s already exists in the session: run ids must be unique", r.runid)
+	} else if err != nil {
+		return err
+	}
+
+	// run ids given by --run-id have no date (see runStart)
+	r.addMeta(startTimeMeta, time.Now().UTC().Format(time.RFC3339Nano))
+	r.session.updateLatest(r.runid)
+	return nil
 }
 
 var runctxCliTemplate = template.Must(template.New("cli").Parse(`apiVersion: v1
 kind: Pod
 metadata:
   name: knb-cli
+  {{if .cliNamespace}}namespace: {{.cliNamespace}}{{end}}
   labels : {
      {{.runLabel}},
      role: cli,
   }
+  {{.cliAnnotations}}
 spec:
   restartPolicy: Never
   {{.cliHost}}
+  {{.cliDNS}}
+  {{.cliSecurity}}
   {{.cliAffinity}}
+  {{.cliTolerations}}
+  {{.cliVolumes}}
   containers:
   - {{.cliContainer}}
+  {{.cliMonitor}}
 `))
 
 func (r *RunBenchCtx) genCliYaml(serverIP string) (string, error) {
+	return r.genCliYamlParams(map[string]interface{}{"serverIP": serverIP})
+}
+
+// genCliYamlParams generates the client yaml. params are passed to the
+// benchmark's client container renderer (serverIP is required).
+func (r *RunBenchCtx) genCliYamlParams(params map[string]interface{}) (string, error) {
 	yaml := fmt.Sprintf("%s/client.yaml", r.getDir())
-	log.Printf("Generating %s", yaml)
+	logger().Info("generating yaml", "file", yaml)
 	f, err := os.Create(yaml)
 	if err != nil {
 		return "", err
 	}
 
 	vals := map[string]interface{}{
-		"runLabel":     r.getRunLabel(": "),
-		"serverIP":     serverIP,
-		"cliContainer": "{{template \"netperfContainer\"}}",
-		"cliAffinity":  "{{template \"cliAffinity\"}}",
-		"cliHost":      "{{template \"cliHost\"}}",
+		"runLabel":       r.getRunLabel(": "),
+		"cliNamespace":   r.cliSpec.Namespace,
+		"cliContainer":   "{{template \"netperfContainer\"}}",
+		"cliAffinity":    "{{template \"cliAffinity\"}}",
+		"cliHost":        "{{template \"cliHost\"}}",
+		"cliDNS":         "{{template \"cliDNS\"}}",
+		"cliSecurity":    "{{template \"cliSecurity\"}}",
+		"cliAnnotations": "{{template \"cliAnnotations\"}}",
+		"cliVolumes":     "{{template \"cliVolumes\"}}",
+		"cliMonitor":     "{{template \"cliMonitor\"}}",
+		"cliTolerations": "{{template \"cliTolerations\"}}",
+	}
+	for k, v := range params {
+		vals[k] = v
 	}
 
 	templates := map[string]utils.PrefixRenderer{
-		"netperfContainer": r.benchmark.WriteCliContainerYaml,
+		"netperfContainer": r.cliContainerWrite,
 		"cliAffinity":      r.cliAffinityWrite,
 		"cliHost":          r.cliSpec.hostOptsWrite,
+		"cliDNS":           r.cliSpec.dnsWrite,
+		"cliSecurity":      r.cliSpec.podSecurityWrite,
+		"cliAnnotations":   r.cliSpec.annotationsWrite,
+		"cliVolumes":       r.cliSpec.volumesWrite,
+		"cliMonitor":       r.cliSpec.monitorSidecarWrite(r.session),
+		"cliTolerations":   r.cliSpec.tolerationsWrite,
 	}
 
 	utils.RenderTemplate(runctxCliTemplate, vals, templates, f)
@@ -118,51 +269,218 @@ func (r *RunBenchCtx) genCliYaml(serverIP string) (string, error) {
 }
 
 // NB: limitation: we assume that there is only a single client.
-func (r *RunBenchCtx) waitForClient() error {
+func (r *RunBenchCtx) waitForClient(ctx context.Context) error {
 	cliSelector := fmt.Sprintf("%s,role=cli", r.getRunLabel("="))
 	for {
-		cliPhase, err := r.KubeGetPodPhase(cliSelector)
+		var cliPhase string
+		var err error
+		if r.session.MonitorSidecar() {
+			cliPhase, err = r.cliContainerPhase(cliSelector)
+		} else {
+			cliPhase, err = r.KubeGetPodPhase(r.cliSpec.Namespace, cliSelector)
+		}
 		if err != nil {
 			return err
 		}
-		log.Printf("client phase: %s", cliPhase)
+		logger().Debug("client phase", "phase", cliPhase)
 
 		if cliPhase == "Succeeded" {
 			return nil
 		}
 		if cliPhase == "Failed" {
+			if err := r.checkSysctlForbidden(); err != nil {
+				return err
+			}
 			return fmt.Errorf("client execution failed")
 		}
-		time.Sleep(10 * time.Second)
+		if err := sleepContext(ctx, 10*time.Second); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext sleeps for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
 	}
 }
 
-func (r *RunBenchCtx) finalizeAndWait() error {
+func (r *RunBenchCtx) finalizeAndWait(ctx context.Context) error {
 
 	// Wait until things settle down.
 	// We might want something more precise here eventually
-	time.Sleep(time.Duration(5 * time.Second))
+	if err := sleepContext(ctx, settleTime); err != nil {
+		return err
+	}
 
-	// print pods
+	// record where the pods ended up
+	r.recordNodes()
+	r.recordZones()
+	if err := r.saveTopologyDot(); err != nil {
+		logger().Warn("failed to write run topology", "file", r.topologyDot, "error", err)
+	}
 
-	if r.collectPerf {
-		r.startCollection()
+	if r.hasNetworkAttachments() {
+		r.recordCliIface()
 	}
 
-	// sleep the duration of the benchmark
-	time.Sleep(time.Duration(r.benchmark.GetTimeout()) * time.Second)
+	if r.hubble && r.session.MonitorEnabled() {
+		if reason := hubbleUnavailable(); reason != "" {
+			logger().Warn("hubble is not available: not recording flows", "reason", reason)
+			r.addMeta("HUBBLE_UNAVAILABLE", reason)
+			r.hubble = false
+		}
+	}
 
-	// start wait loop
-	err := r.waitForClient()
+	// without the monitor, no node-level data (perf, network stats) are
+	// collected. Record this so that results are not misinterpreted.
+	collect := r.collectPerf || r.pcap != nil || r.ss != nil || r.rdma || r.hubble || r.cpu
+	collectNetStats := r.collectNetStats
+	if !r.session.MonitorEnabled() {
+		if collect || collectNetStats {
+			logger().Warn("monitor is disabled: not collecting perf data, packet captures, socket samples, RDMA counters, hubble flows, CPU usage, or network stats")
+		}
+		collect, collectNetStats = false, false
+		r.addMeta("NODE_DATA", "none")
+	} else if r.session.MonitorSidecar() {
+		// the sidecar is not privileged, and can only collect pod-scoped data
+		if r.collectPerf {
+			logger().Warn("monitor runs as a sidecar: not collecting perf data")
+		}
+		if r.rdma {
+			logger().Warn("monitor runs as a sidecar: not collecting RDMA counters")
+		}
+		if r.hubble {
+			logger().Warn("monitor runs as a sidecar: not recording hubble flows")
+		}
+		if r.cpu {
+			logger().Warn("monitor runs as a sidecar: not collecting CPU usage")
+		}
+		r.collectPerf, r.rdma, r.hubble, r.cpu = false, false, false, false
+		collect = r.pcap != nil || r.ss != nil
+		r.addMeta("NODE_DATA", "pod")
+	}
 
-	if r.collectPerf {
-		r.endCollection()
+	// abort the measurement if the benchmark pods are evicted (e.g., their
+	// node is drained), instead of reporting partial results
+	measureCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	stopWatch := r.watchEvictions(abort)
+
+	// with a measurement window, node data are collected during the window
+	// only (see SetMeasureWindow)
+	delay, collectTime := r.windowTimes()
+	err := sleepContext(measureCtx, delay)
+	started := err == nil
+	if started {
+		if collect {
+			r.startCollection(ctx)
+		}
+		if collectNetStats {
+			errNs := r.startNetStats(ctx)
+			if errNs != nil {
+				logger().Warn("failed to start network stats collection", "error", errNs)
+			}
+		}
+		err = sleepContext(measureCtx, collectTime)
+	}
+	endNetStats := func() {
+		if started && collectNetStats {
+			errNs := r.endNetStats(ctx)
+			if errNs != nil {
+				logger().Warn("failed to end network stats collection", "error", errNs)
+			}
+			collectNetStats = false
+		}
+	}
+	if r.window != nil {
+		endNetStats()
+	}
+
+	// sleep the rest of the benchmark, and start wait loop
+	if err == nil {
+		traffic := time.Duration(r.benchmark.GetTimeout()) * time.Second
+		err = sleepContext(measureCtx, traffic-delay-collectTime)
+	}
+	if err == nil {
+		err = r.waitForClient(measureCtx)
+	}
+	if errEvict := stopWatch(); errEvict != nil {
+		err = errEvict
+	} else if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	endNetStats()
+	if started && collect {
+		r.endCollection(ctx)
+		r.processCollection()
+	}
+
+	if errPause := r.pauseForInspection(ctx); errPause != nil && err == nil {
+		err = errPause
 	}
 
 	return err
 }
 
+// processCollection processes the data of the collection archives (socket
+// samples, RDMA counters, etc.). Failures are logged.
+func (r *RunBenchCtx) processCollection() {
+	if r.ss != nil {
+		if errSs := r.processSsSamples(); errSs != nil {
+			logger().Warn("failed to process socket samples", "error", errSs)
+		}
+	}
+	if r.rdma {
+		if errRdma := r.processRdmaCounters(); errRdma != nil {
+			logger().Warn("failed to process RDMA counters", "error", errRdma)
+		}
+	}
+	if r.hubble {
+		if errHubble := r.processHubbleFlows(); errHubble != nil {
+			logger().Warn("failed to process hubble flows", "error", errHubble)
+		}
+	}
+	if r.cpu {
+		if errCPU := r.processCPUUsage(); errCPU != nil {
+			logger().Warn("failed to process CPU usage", "error", errCPU)
+		}
+	}
+}
+
+// getSrvIP returns the IP that the client should use to reach the server pod
+// (on the server's network, which might be different than the client's)
+func (c *RunBenchCtx) getSrvIP(srvSelector string) (string, error) {
+	var srvIP string
+	var err error
+	if c.srvSpec.NetworkAttachment == "" {
+		srvIP, err = c.KubeGetPodIP(c.srvSpec.Namespace, srvSelector, 30, 2*time.Second)
+	} else {
+		srvIP, err = c.KubeGetPodIfaceIP(c.srvSpec.Namespace, srvSelector, c.srvSpec.NetworkIface, 30, 2*time.Second)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if c.hasNetworkAttachments() {
+		c.recordSrvIface(srvSelector)
+		if c.cliSpec.NetworkAttachment != c.srvSpec.NetworkAttachment {
+			logger().Info("client and server are on different networks: traffic is routed between them",
+				"client_network", c.cliSpec.NetworkAttachment, "server_network", c.srvSpec.NetworkAttachment)
+		}
+	}
+	return srvIP, nil
+}
+
 func (c *RunBenchCtx) srvPodSpecWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
 	c.srvAffinityWrite(pw, params)
+	c.srvSpec.tolerationsWrite(pw, params)
 	c.srvSpec.hostOptsWrite(pw, params)
+	c.srvSpec.podSecurityWrite(pw, params)
+	c.srvSpec.volumesWrite(pw, params)
 }
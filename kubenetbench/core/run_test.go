@@ -0,0 +1,19 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRunID(t *testing.T) {
+	for _, id := range []string{"ci-48213", "pod2pod-20260101000000", "a", "job_1.r2"} {
+		if err := ValidateRunID(id); err != nil {
+			t.Errorf("%q: unexpected error: %s", id, err)
+		}
+	}
+	for _, id := range []string{"", "-ci", "ci/1", "ci 1", "latest", "../x", strings.Repeat("a", 64)} {
+		if err := ValidateRunID(id); err == nil {
+			t.Errorf("%q: expected error", id)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// ValidateRuntimeClass checks the name of a RuntimeClass (e.g., gvisor, or
+// kata), which is a DNS subdomain
+func ValidateRuntimeClass(name string) error {
+	if len(name) > 253 || !labelDomainRegEx.MatchString(name) {
+		return fmt.Errorf("invalid runtime class %q", name)
+	}
+	return nil
+}
+
+// KubeGetRuntimeClassHandler returns the handler of a RuntimeClass (e.g.,
+// runsc for gVisor, or kata-qemu), checking that it exists
+func KubeGetRuntimeClassHandler(ctx context.Context, name string) (string, error) {
+	if err := ValidateRuntimeClass(name); err != nil {
+		return "", err
+	}
+	cmd := fmt.Sprintf("kubectl get runtimeclass %s -o jsonpath={.handler}", name)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("runtime class %q not found (see kubectl get runtimeclass): %w", name, err)
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.TrimSpace(lines[0]), nil
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+func TestRuntimeClass(t *testing.T) {
+	for _, name := range []string{"gvisor", "kata-qemu", "runsc.example.com"} {
+		if err := ValidateRuntimeClass(name); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "gVisor", "kata qemu", "-kata"} {
+		if err := ValidateRuntimeClass(name); err == nil {
+			t.Errorf("%q: expected invalid runtime class", name)
+		}
+	}
+
+	spec := &ContainerSpec{RuntimeClass: "gvisor", HostNetwork: true}
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	spec.hostOptsWrite(pw, nil)
+	pw.Done()
+	expected := "runtimeClassName: gvisor\nhostNetwork: true\n"
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// DefaultRunAsUser is the (non-root) user that restricted pods run as
+const DefaultRunAsUser = 65534
+
+// podSecurityWrite writes the pod-level security context, and sysctls.
+// If the spec is restricted, the settings comply with the "restricted" Pod
+// Security Standard.
+func (s *ContainerSpec) podSecurityWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if !s.Restricted && len(s.Sysctls) == 0 {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`securityContext:`)
+	if s.Restricted {
+		pw.AppendNewLineOrDie(`  runAsNonRoot: true`)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  runAsUser: %d`, s.RunAsUser))
+		pw.AppendNewLineOrDie(`  seccompProfile:`)
+		pw.AppendNewLineOrDie(`    type: RuntimeDefault`)
+	}
+	if len(s.Sysctls) > 0 {
+		pw.AppendNewLineOrDie(`  sysctls:`)
+		for _, sc := range s.Sysctls {
+			pw.AppendNewLineOrDie(fmt.Sprintf(`  - name: %s`, sc.Name))
+			pw.AppendNewLineOrDie(fmt.Sprintf(`    value: %q`, sc.Value))
+		}
+	}
+}
+
+// containerSecurityWrite writes the container-level security context
+func (s *ContainerSpec) containerSecurityWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if !s.Restricted && len(s.CapAdd) == 0 {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`securityContext:`)
+	if s.Restricted {
+		pw.AppendNewLineOrDie(`  allowPrivilegeEscalation: false`)
+	}
+	pw.AppendNewLineOrDie(`  capabilities:`)
+	if s.Restricted {
+		pw.AppendNewLineOrDie(`    drop: ["ALL"]`)
+	}
+	if len(s.CapAdd) > 0 {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    add: ["%s"]`, strings.Join(s.CapAdd, `", "`)))
+	}
+}
+
+// cliContainerWrite writes the client container yaml (benchmark + security context + volume mounts)
+func (r *RunBenchCtx) cliContainerWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	r.benchmark.WriteCliContainerYaml(pw, r.withBenchImage(params))
+	r.cliSpec.containerSecurityWrite(pw, params)
+	r.cliSpec.volumeMountsWrite(pw, params)
+}
+
+// srvContainerWrite writes the server container yaml (benchmark + security context + volume mounts)
+func (r *RunBenchCtx) srvContainerWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	r.benchmark.WriteSrvContainerYaml(pw, r.withBenchImage(params))
+	r.srvReadinessProbeWrite(pw, params)
+	r.srvSpec.containerSecurityWrite(pw, params)
+	r.srvSpec.volumeMountsWrite(pw, params)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"text/template"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// SelfTestSt is the state for a loopback (self-test) run: the client and the
+// server run in the same pod, and the traffic goes over 127.0.0.1. It
+// measures the ceiling of the generator (and the node's CPU), independently
+// of the network.
+type SelfTestSt struct {
+	RunBenchCtx *RunBenchCtx
+}
+
+// loopback address the client connects to
+const selfTestServerIP = "127.0.0.1"
+
+// The server is a (native) sidecar container, so that the pod completes when
+// the client does, and the client starts after the server listens (see
+// srvSidecarWrite).
+var selfTestTemplate = template.Must(template.New("selftest").Parse(`apiVersion: v1
+kind: Pod
+metadata:
+  name: knb-selftest
+  {{if .cliNamespace}}namespace: {{.cliNamespace}}{{end}}
+  labels : {
+     {{.runLabel}},
+     role: cli,
+  }
+  {{.cliAnnotations}}
+spec:
+  restartPolicy: Never
+  {{.cliHost}}
+  {{.cliDNS}}
+  {{.cliSecurity}}
+  {{.cliAffinity}}
+  {{.cliTolerations}}
+  {{.cliVolumes}}
+  initContainers:
+  - {{.srvContainer}}
+  containers:
+  - {{.cliContainer}}
+`))
+
+// srvSidecarWrite writes the server container as a sidecar, which is started
+// before the client
+func (s *SelfTestSt) srvSidecarWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	r := s.RunBenchCtx
+	r.srvContainerWrite(pw, params)
+	if p := r.srvReadyProbe(); p != nil {
+		writeProbe(pw, "startupProbe", p, 120)
+	}
+	pw.AppendNewLineOrDie(`restartPolicy: Always`)
+}
+
+func (s *SelfTestSt) genYaml() (string, error) {
+	r := s.RunBenchCtx
+	vals := map[string]interface{}{
+		"runLabel":       r.getRunLabel(": "),
+		"cliNamespace":   r.cliSpec.Namespace,
+		"serverIP":       selfTestServerIP,
+		"srvContainer":   "{{template \"srvContainer\"}}",
+		"cliContainer":   "{{template \"cliContainer\"}}",
+		"cliAffinity":    "{{template \"cliAffinity\"}}",
+		"cliHost":        "{{template \"cliHost\"}}",
+		"cliDNS":         "{{template \"cliDNS\"}}",
+		"cliSecurity":    "{{template \"cliSecurity\"}}",
+		"cliAnnotations": "{{template \"cliAnnotations\"}}",
+		"cliVolumes":     "{{template \"cliVolumes\"}}",
+		"cliTolerations": "{{template \"cliTolerations\"}}",
+	}
+
+	templates := map[string]utils.PrefixRenderer{
+		"srvContainer":   s.srvSidecarWrite,
+		"cliContainer":   r.cliContainerWrite,
+		"cliAffinity":    r.cliAffinityWrite,
+		"cliHost":        r.cliSpec.hostOptsWrite,
+		"cliDNS":         r.cliSpec.dnsWrite,
+		"cliSecurity":    r.cliSpec.podSecurityWrite,
+		"cliAnnotations": r.cliSpec.annotationsWrite,
+		"cliVolumes":     r.cliSpec.volumesWrite,
+		"cliTolerations": r.cliSpec.tolerationsWrite,
+	}
+
+	yaml := fmt.Sprintf("%s/selftest.yaml", r.getDir())
+	logger().Info("generating yaml", "file", yaml)
+	f, err := os.Create(yaml)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = utils.RenderTemplate(selfTestTemplate, vals, templates, f)
+	return yaml, err
+}
+
+// Execute self-test run
+func (s SelfTestSt) Execute() error {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the run, bounded by ctx
+func (s SelfTestSt) ExecuteContext(ctx context.Context) error {
+	r := s.RunBenchCtx
+
+	// the pod's volumes are the client's, so the server cannot have others
+	if len(r.srvSpec.Volumes) > 0 && !reflect.DeepEqual(r.srvSpec.Volumes, r.cliSpec.Volumes) {
+		return fmt.Errorf("server volumes are not supported by the self-test (use client volumes)")
+	}
+
+	err := r.prepareBenchmark()
+	if err != nil {
+		return err
+	}
+
+	yaml, err := s.genYaml()
+	if err != nil {
+		return err
+	}
+
+	err = r.KubeApply(yaml)
+	if err != nil {
+		return fmt.Errorf("failed to create self-test pod: %w", err)
+	}
+	r.addMeta("SELFTEST", "loopback")
+
+	cliSelector := fmt.Sprintf("%s,role=cli", r.getRunLabel("="))
+	defer func() {
+		// the default container of the pod is the client
+		r.KubeSaveLogs(r.cliSpec.Namespace, cliSelector, fmt.Sprintf("%s/cli.log", r.getDir()))
+		r.KubeCleanup()
+	}()
+
+	return r.finalizeAndWait(ctx)
+}
@@ -1,9 +1,12 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -14,17 +17,49 @@ import (
 type ServiceSt struct {
 	RunBenchCtx *RunBenchCtx
 	ServiceType string
+	// Colocate places the client on the node of the (single) backend, so
+	// that the service traffic takes the same-node path (e.g., hairpin and
+	// SNAT handling of kube-proxy) instead of the cross-node one
+	Colocate bool
+	// Replicas is the number of backends (0 for one)
+	Replicas int
+	// SessionAffinity is the session affinity of the service (None or
+	// ClientIP, empty for the default), and SessionAffinityTimeout its
+	// ClientIP timeout in seconds (0 for the default)
+	SessionAffinity        string
+	SessionAffinityTimeout int
 }
 
+// ServiceTypes are the supported service types. For Headless, the server is a
+// StatefulSet behind a headless service, and the client connects to the DNS
+// name of the server pod, bypassing kube-proxy.
+var ServiceTypes = []string{"ClusterIP", "Headless"}
+
+// ServiceSessionAffinities are the supported service session affinities. With
+// ClientIP, kube-proxy pins the connections of a client to a single backend.
+var ServiceSessionAffinities = []string{"None", "ClientIP"}
+
+// backendTrafficShare is the share of the service traffic above which a backend
+// is considered to have served the run (the remaining traffic is, e.g., that of
+// the readiness probes)
+const backendTrafficShare = 0.01
+
+// name of the server StatefulSet (for headless services)
+const headlessSrvName = "knb-srv"
+
 var serviceYamlTemplate = template.Must(template.New("service").Parse(`apiVersion: apps/v1
-kind: Deployment
+{{if .headless}}kind: StatefulSet
+metadata:
+  name: {{.headlessSrvName}}{{else}}kind: Deployment
 metadata:
-  name: knb-deployment
+  name: knb-deployment{{end}}
+  {{if .srvNamespace}}namespace: {{.srvNamespace}}{{end}}
   labels:
     {{.runLabel}}
     role: srv
 spec:
-  replicas: 1
+  replicas: {{.replicas}}
+  {{if .headless}}serviceName: knb-service{{end}}
   selector:
     matchLabels:
       {{.runLabel}}
@@ -38,15 +73,23 @@ spec:
       {{.srvSpec}}
       containers:
       - {{.srvContainer}}
+      {{.srvMonitor}}
 ---
 apiVersion: v1
 kind: Service
 metadata:
   name: knb-service
+  {{if .srvNamespace}}namespace: {{.srvNamespace}}{{end}}
   labels: 
     {{.runLabel}}
     role: srv
 spec:
+  {{if .headless}}clusterIP: None
+  publishNotReadyAddresses: true{{end}}
+  {{if .sessionAffinity}}sessionAffinity: {{.sessionAffinity}}{{end}}
+  {{if .sessionAffinityTimeout}}sessionAffinityConfig:
+    clientIP:
+      timeoutSeconds: {{.sessionAffinityTimeout}}{{end}}
   selector:
     {{.runLabel}}
     role: srv
@@ -54,22 +97,37 @@ spec:
     {{.srvPorts}}
 `))
 
+func (s *ServiceSt) replicas() int {
+	if s.Replicas == 0 {
+		return 1
+	}
+	return s.Replicas
+}
+
 func (s *ServiceSt) genSrvYaml() (string, error) {
 	vals := map[string]interface{}{
-		"runLabel":     s.RunBenchCtx.getRunLabel(": "),
-		"srvContainer": "{{template \"netperfContainer\"}}",
-		"srvPorts":     "{{template \"netperfPorts\"}}",
-		"srvSpec":      "{{template \"srvSpec\"}}",
+		"replicas":               s.replicas(),
+		"sessionAffinity":        s.SessionAffinity,
+		"sessionAffinityTimeout": s.SessionAffinityTimeout,
+		"runLabel":               s.RunBenchCtx.getRunLabel(": "),
+		"srvNamespace":           s.RunBenchCtx.srvSpec.Namespace,
+		"srvContainer":           "{{template \"netperfContainer\"}}",
+		"srvPorts":               "{{template \"netperfPorts\"}}",
+		"srvSpec":                "{{template \"srvSpec\"}}",
+		"headless":               s.ServiceType == "Headless",
+		"headlessSrvName":        headlessSrvName,
+		"srvMonitor":             "{{template \"srvMonitor\"}}",
 	}
 
 	templates := map[string]utils.PrefixRenderer{
-		"netperfContainer": s.RunBenchCtx.benchmark.WriteSrvContainerYaml,
+		"netperfContainer": s.RunBenchCtx.srvContainerWrite,
 		"netperfPorts":     s.RunBenchCtx.benchmark.WriteSrvPortsYaml,
 		"srvSpec":          s.RunBenchCtx.srvPodSpecWrite,
+		"srvMonitor":       s.RunBenchCtx.srvSpec.monitorSidecarWrite(s.RunBenchCtx.session),
 	}
 
 	yaml := fmt.Sprintf("%s/netserv.yaml", s.RunBenchCtx.getDir())
-	log.Printf("Generating %s", yaml)
+	logger().Info("generating yaml", "file", yaml)
 	f, err := os.Create(yaml)
 	if err != nil {
 		return "", err
@@ -83,8 +141,189 @@ func (s *ServiceSt) genCliYaml(serverIP string) (string, error) {
 	return s.RunBenchCtx.genCliYaml(serverIP)
 }
 
+// cluster DNS domain
+const clusterDomain = "cluster.local"
+
+// serviceFQDN returns the fully-qualified DNS name of a service
+func serviceFQDN(name, ns string) string {
+	return fmt.Sprintf("%s.%s.svc.%s", name, ns, clusterDomain)
+}
+
+// headlessPodName returns the DNS name of the (single) server pod
+func (s *ServiceSt) headlessPodName(ctx context.Context, srvSelector string) (string, error) {
+	ns := s.RunBenchCtx.srvSpec.Namespace
+	if ns == "" {
+		// kubectl's current namespace
+		cmd := fmt.Sprintf("kubectl get pod -l '%s' -o jsonpath='{.items[0].metadata.namespace}'", srvSelector)
+		var err error
+		ns, err = waitForOutput(ctx, cmd, func(out string) bool { return out != "" }, 10, 2*time.Second)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s-0.%s", headlessSrvName, serviceFQDN("knb-service", ns)), nil
+}
+
+// recordColocation records whether the client and the backend ran on the same
+// node, as the SERVICE_COLOCATION parameter (same-node or cross-node)
+func (s *ServiceSt) recordColocation() {
+	podsinfo, err := s.RunBenchCtx.KubeGetPods__([]string{".metadata.labels.role", PodNodeName})
+	if err != nil {
+		logger().Warn("failed to get the nodes of the run pods", "error", err)
+		return
+	}
+
+	var cliNode, srvNode string
+	for _, a := range podsinfo {
+		if len(a) != 2 || a[1] == "<none>" {
+			continue
+		}
+		switch a[0] {
+		case "cli":
+			cliNode = a[1]
+		case "srv":
+			srvNode = a[1]
+		}
+	}
+	if cliNode == "" || srvNode == "" {
+		logger().Warn("failed to determine the nodes of the client and the backend", "client_node", cliNode, "server_node", srvNode)
+		return
+	}
+
+	colocation := "cross-node"
+	if cliNode == srvNode {
+		colocation = "same-node"
+	}
+	s.RunBenchCtx.AddParam("SERVICE_COLOCATION", colocation)
+	if s.Colocate && colocation != "same-node" {
+		logger().Warn("client and backend are not co-located", "client_node", cliNode, "server_node", srvNode)
+	}
+}
+
+// parseInOctets returns the IpExt InOctets counter of /proc/net/netstat
+func parseInOctets(lines []string) (int64, error) {
+	for i := 0; i+1 < len(lines); i++ {
+		names, values := strings.Fields(lines[i]), strings.Fields(lines[i+1])
+		if len(names) == 0 || names[0] != "IpExt:" || len(names) != len(values) {
+			continue
+		}
+		for j, n := range names {
+			if n == "InOctets" {
+				return strconv.ParseInt(values[j], 10, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("no IpExt InOctets counter")
+}
+
+// backendInOctets returns the bytes received by each backend (its network
+// namespace) so far, by pod name
+func (s *ServiceSt) backendInOctets(ctx context.Context, srvSelector string) (map[string]int64, error) {
+	ns := s.RunBenchCtx.srvSpec.Namespace
+	cmd := fmt.Sprintf("kubectl get pod%s -l \"%s\" -o custom-columns=Name:.metadata.name --no-headers", nsArg(ns), srvSelector)
+	logger().Debug("exec", "cmd", cmd)
+	pods, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("command %s failed: %w", cmd, err)
+	}
+
+	ret := make(map[string]int64, len(pods))
+	for _, pod := range pods {
+		cmd := fmt.Sprintf("kubectl exec%s %s -- cat /proc/net/netstat", nsArg(ns), pod)
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("command %s failed: %w", cmd, err)
+		}
+		ret[pod], err = parseInOctets(lines)
+		if err != nil {
+			return nil, fmt.Errorf("pod %s: %w", pod, err)
+		}
+	}
+	return ret, nil
+}
+
+// servedBackends returns the backends whose share of the received bytes
+// (between the before and after counters) exceeds backendTrafficShare
+func servedBackends(before, after map[string]int64) []string {
+	total := int64(0)
+	for pod, v := range after {
+		total += v - before[pod]
+	}
+	ret := []string{}
+	if total <= 0 {
+		return ret
+	}
+	for pod, v := range after {
+		if float64(v-before[pod]) > backendTrafficShare*float64(total) {
+			ret = append(ret, pod)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// recordBackends records how many backends served the run (see
+// servedBackends), as SERVICE_BACKENDS_SERVED, and, for ClientIP session
+// affinity, whether the traffic was pinned to a single backend, as
+// SERVICE_AFFINITY_PINNED
+func (s *ServiceSt) recordBackends(ctx context.Context, srvSelector string, before map[string]int64) {
+	if before == nil {
+		return
+	}
+	after, err := s.backendInOctets(ctx, srvSelector)
+	if err != nil {
+		logger().Warn("failed to get the traffic of the backends", "error", err)
+		return
+	}
+
+	served := servedBackends(before, after)
+	s.RunBenchCtx.addMeta("SERVICE_BACKENDS_SERVED", strconv.Itoa(len(served)))
+	logger().Info("service backends", "backends", len(after), "served", strings.Join(served, ","))
+	if s.SessionAffinity == "ClientIP" {
+		pinned := len(served) == 1
+		s.RunBenchCtx.addMeta("SERVICE_AFFINITY_PINNED", strconv.FormatBool(pinned))
+		if !pinned {
+			logger().Warn("ClientIP session affinity did not pin the traffic to a single backend", "served", strings.Join(served, ","))
+		}
+	}
+}
+
 // Execute service run
 func (s ServiceSt) Execute() error {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the run, bounded by ctx
+func (s ServiceSt) ExecuteContext(ctx context.Context) error {
+	if s.ServiceType == "Headless" && s.SessionAffinity != "" {
+		return fmt.Errorf("session affinity is not supported for headless services (the client connects to a pod)")
+	}
+	if (s.Colocate || s.ServiceType == "Headless") && s.replicas() > 1 {
+		return fmt.Errorf("multiple backends are not supported for co-located or headless services")
+	}
+	// the control and the data connections of netperf must reach the same
+	// backend (netserver)
+	if benchmarkName(s.RunBenchCtx.benchmark) == "netperf" && s.replicas() > 1 {
+		switch s.SessionAffinity {
+		case "":
+			s.SessionAffinity = "ClientIP"
+			logger().Info("multiple backends: using ClientIP session affinity, so that the connections of netperf reach the same backend")
+		case "None":
+			return fmt.Errorf("multiple backends with session affinity None are not supported for netperf: its control and data connections may reach different backends (use ClientIP)")
+		}
+	}
+
+	if s.Colocate {
+		// the client follows the backend (see cliAffinitySame)
+		s.RunBenchCtx.cliSpec.Affinity = "same"
+	}
+
+	err := s.RunBenchCtx.prepareBenchmark()
+	if err != nil {
+		return err
+	}
+
 	// start server pod (netserver)
 	srvYamlFname, err := s.genSrvYaml()
 	if err != nil {
@@ -99,21 +338,82 @@ func (s ServiceSt) Execute() error {
 
 	defer func() {
 		// attempt to save server logs
-		s.RunBenchCtx.KubeSaveLogs(srvSelector, fmt.Sprintf("%s/srv.log", s.RunBenchCtx.getDir()))
+		s.RunBenchCtx.KubeSaveLogs(s.RunBenchCtx.srvSpec.Namespace, srvSelector, fmt.Sprintf("%s/srv.log", s.RunBenchCtx.getDir()))
 
 		// FIXME: this does not work because we call functions that
-		// call log.Fatal() which calls exit() which does not run the
+		// call fatal() which calls exit() which does not run the
 		// deferred operations
 		s.RunBenchCtx.KubeCleanup()
 	}()
 
+	// create the client only after the server listens
+	err = s.RunBenchCtx.waitForSrvReady(ctx, srvSelector)
+	if err != nil {
+		return err
+	}
+
 	// get service IP
 	time.Sleep(2 * time.Second)
-	srvIP, err := s.RunBenchCtx.KubeGetServiceIP(srvSelector, 10, 2*time.Second)
+	srvIP, err := s.RunBenchCtx.KubeGetServiceIP(s.RunBenchCtx.srvSpec.Namespace, srvSelector, 10, 2*time.Second)
+	if err != nil {
+		return err
+	}
+	logger().Info("server address", "server_ip", srvIP)
+	s.RunBenchCtx.addMeta("SERVICE_TYPE", s.ServiceType)
+	s.RunBenchCtx.addMeta("SERVICE_CLUSTER_IP", srvIP)
+
+	if s.ServiceType == "Headless" {
+		// a headless service has no virtual IP: its DNS records point
+		// directly to the pods, so kube-proxy is not involved
+		if srvIP != "None" {
+			return fmt.Errorf("service is not headless (cluster IP: %s)", srvIP)
+		}
+		podIP, err := s.RunBenchCtx.KubeGetPodIP(s.RunBenchCtx.srvSpec.Namespace, srvSelector, 30, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		srvIP, err = s.headlessPodName(ctx, srvSelector)
+		if err != nil {
+			return err
+		}
+		logger().Info("server name", "server_name", srvIP, "server_pod_ip", podIP)
+		s.RunBenchCtx.addMeta("SERVER_POD_IP", podIP)
+		s.RunBenchCtx.addMeta("KUBE_PROXY_BYPASS", "true")
+	} else {
+		s.RunBenchCtx.addMeta("KUBE_PROXY_BYPASS", "false")
+		// if the server is on a specific namespace, use the service's DNS name
+		if ns := s.RunBenchCtx.srvSpec.Namespace; ns != "" {
+			srvIP = serviceFQDN("knb-service", ns)
+			logger().Info("server name", "server_name", srvIP)
+		}
+	}
+
+	err = s.RunBenchCtx.applyNetem(ctx, srvSelector)
 	if err != nil {
 		return err
 	}
-	log.Printf("server_ip=%s", srvIP)
+
+	err = s.RunBenchCtx.preflightPing(ctx, srvIP, s.RunBenchCtx.benchmarkPort())
+	if err != nil {
+		return err
+	}
+
+	if s.SessionAffinity != "" {
+		s.RunBenchCtx.AddParam("SERVICE_SESSION_AFFINITY", s.SessionAffinity)
+	}
+	if s.replicas() > 1 {
+		s.RunBenchCtx.AddParam("SERVICE_REPLICAS", strconv.Itoa(s.replicas()))
+	}
+
+	// the traffic of the backends tells which ones served the run (with a
+	// host-network server, it would include that of the node)
+	var backendsBefore map[string]int64
+	if !s.RunBenchCtx.srvSpec.HostNetwork && (s.replicas() > 1 || s.SessionAffinity != "") {
+		backendsBefore, err = s.backendInOctets(ctx, srvSelector)
+		if err != nil {
+			logger().Warn("failed to get the traffic of the backends", "error", err)
+		}
+	}
 
 	// start netperf client (netperf)
 	cliYamlFname, err := s.genCliYaml(srvIP)
@@ -128,7 +428,10 @@ func (s ServiceSt) Execute() error {
 
 	cliSelector := fmt.Sprintf("%s,role=cli", s.RunBenchCtx.getRunLabel("="))
 	// attempt to save client logs
-	defer s.RunBenchCtx.KubeSaveLogs(cliSelector, fmt.Sprintf("%s/cli.log", s.RunBenchCtx.getDir()))
+	defer s.RunBenchCtx.KubeSaveLogs(s.RunBenchCtx.cliSpec.Namespace, cliSelector, fmt.Sprintf("%s/cli.log", s.RunBenchCtx.getDir()))
 
-	return s.RunBenchCtx.finalizeAndWait()
+	err = s.RunBenchCtx.finalizeAndWait(ctx)
+	s.recordColocation()
+	s.recordBackends(ctx, srvSelector, backendsBefore)
+	return err
 }
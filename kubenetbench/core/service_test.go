@@ -0,0 +1,52 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInOctets(t *testing.T) {
+	lines := []string{
+		"TcpExt: SyncookiesSent SyncookiesRecv",
+		"TcpExt: 0 0",
+		"IpExt: InNoRoutes InTruncatedPkts InMcastPkts OutMcastPkts InBcastPkts OutBcastPkts InOctets OutOctets",
+		"IpExt: 0 0 0 0 0 0 123456789 4567",
+	}
+	v, err := parseInOctets(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 123456789 {
+		t.Errorf("expected 123456789, got %d", v)
+	}
+
+	if _, err := parseInOctets(lines[:2]); err == nil {
+		t.Error("expected error without IpExt")
+	}
+}
+
+func TestServedBackends(t *testing.T) {
+	before := map[string]int64{"srv-a": 1000, "srv-b": 1000, "srv-c": 1000}
+	after := map[string]int64{"srv-a": 2000, "srv-b": 50001000, "srv-c": 20001000}
+	served := servedBackends(before, after)
+	if !reflect.DeepEqual(served, []string{"srv-b", "srv-c"}) {
+		t.Errorf("unexpected served backends: %v", served)
+	}
+
+	if served := servedBackends(before, before); len(served) != 0 {
+		t.Errorf("unexpected served backends without traffic: %v", served)
+	}
+}
+
+func TestServiceNetperfReplicasAffinity(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunBenchCtx(s, "service", &ContainerSpec{}, &ContainerSpec{}, true, &NetperfStreamConf{}, false, false)
+	st := ServiceSt{RunBenchCtx: r, ServiceType: "ClusterIP", Replicas: 3, SessionAffinity: "None"}
+	if err := st.Execute(); err == nil || !strings.Contains(err.Error(), "ClientIP") {
+		t.Errorf("expected error for netperf with session affinity None, got %v", err)
+	}
+}
@@ -1,17 +1,74 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
 )
 
 // SessionCtx is the context for a session run
 type Session struct {
 	id          string // id identifies the run
 	dir         string // directory to store results/etc.
+	dirBase     string // base directory of dir
 	portForward bool   // use kubectl port-forward to connect to the monitor
+	noMonitor   bool   // do not deploy (or use) the monitor daemonset
+	labelPrefix string // prefix of the label keys (see labelKey)
+
+	writeSem chan struct{} // bounds concurrent writers of monitor streams (nil for no limit)
+
+	sysInfoParallelism int           // nodes whose sysinfo is retrieved concurrently (0 for no limit)
+	sysInfoRetries     int           // retries of the sysinfo of a node (see SetSysInfoRetries)
+	sysInfoBackoff     time.Duration // initial delay between the retries of the sysinfo of a node
+
+	nodeAddrType string // node address type to connect to the monitor (if not port-forwarding)
+	nodeIPFamily int    // node address IP family (4, 6, or 0 for any)
+
+	monitorProxy proxy.ContextDialer // proxy to connect to the monitor (nil for none)
+
+	monitorTLS      *MonitorTLS // TLS of the monitor connections (nil for none, see SetMonitorTLS)
+	insecureMonitor bool        // allow plaintext connections to monitor addresses (see SetInsecureMonitor)
+
+	monitorToken       string // bearer token of the monitor calls (empty for none, see SetMonitorToken)
+	monitorTokenSecret string // secret of the token of the monitor
+
+	monitorSidecar bool // run the monitor as a sidecar of the benchmark pods (see SetMonitorSidecar)
+
+	existingMonitor bool // use the shared monitor daemonset (see SetUseExistingMonitor)
+
+	progress io.Writer // collection progress output (nil for none)
+
+	grpcMaxMsgSize int // maximum gRPC message size of monitor streams (0 for the default)
+
+	port int // port of the monitor (0 for the default, see SetMonitorPort)
+
+	monitorImageName string // image of the monitor (empty for the default, see SetMonitorImage)
+	monitorImageTag  string
+	benchImageName   string // image of the benchmark pods (empty for the default, see SetBenchImage)
+	benchImageTag    string
+
+	streamCompression bool // gzip-compress the monitor streams (see SetStreamCompression)
+
+	dialTimeout      time.Duration // timeout to connect to the monitor (0 for none, see SetMonitorDialTimeout)
+	keepaliveTime    time.Duration // keepalive ping interval of monitor connections (0 for none)
+	keepaliveTimeout time.Duration // time to wait for a keepalive ping ack
+
+	imageCheck      string // image check before creating resources (see SetImageCheck)
+	imagePullSecret string // pull secret for registry image checks
+
+	monitorNodeLabels  map[string]string // labels of the nodes to run the monitor on (nil for all nodes)
+	monitorTolerations []Toleration      // taints that the monitor tolerates (nil for all taints)
+
+	manifestMu sync.Mutex // serializes the writes to the integrity manifest (see recordSha256)
 }
 
 // NewRunCtx creates a new RunCtx
@@ -19,12 +76,31 @@ func NewSession(
 	sessId string,
 	sessDirBase string,
 	sessPortForward bool,
+	sessNoMonitor bool,
+	sessLabelPrefix string,
 ) (*Session, error) {
 
+	if err := ValidateLabelPrefix(sessLabelPrefix); err != nil {
+		return nil, err
+	}
+
 	sess := &Session{
 		id:          sessId,
 		dir:         fmt.Sprintf("%s/%s", sessDirBase, sessId),
+		dirBase:     sessDirBase,
 		portForward: sessPortForward,
+		noMonitor:   sessNoMonitor,
+		labelPrefix: sessLabelPrefix,
+
+		nodeAddrType:     DefaultNodeAddressType,
+		imageCheck:       "syntax",
+		dialTimeout:      DefaultMonitorDialTimeout,
+		keepaliveTime:    DefaultMonitorKeepaliveTime,
+		keepaliveTimeout: DefaultMonitorKeepaliveTimeout,
+
+		sysInfoParallelism: DefaultSysInfoParallelism,
+		sysInfoRetries:     DefaultSysInfoRetries,
+		sysInfoBackoff:     DefaultSysInfoBackoff,
 	}
 
 	info, err_stat := os.Stat(sess.dir)
@@ -40,7 +116,7 @@ func NewSession(
 		sess.writeScript(sessId, sessDirBase)
 		return sess, nil
 	} else {
-		return nil, fmt.Errorf("failed to initialize session using directory %d", sess.dir)
+		return nil, fmt.Errorf("failed to initialize session using directory %s", sess.dir)
 	}
 }
 
@@ -48,12 +124,31 @@ func InitSession(
 	sessId string,
 	sessDirBase string,
 	sessPortForward bool,
+	sessNoMonitor bool,
+	sessLabelPrefix string,
 ) (*Session, error) {
 
+	if err := ValidateLabelPrefix(sessLabelPrefix); err != nil {
+		return nil, err
+	}
+
 	sess := &Session{
 		id:          sessId,
 		dir:         fmt.Sprintf("%s/%s", sessDirBase, sessId),
+		dirBase:     sessDirBase,
 		portForward: sessPortForward,
+		noMonitor:   sessNoMonitor,
+		labelPrefix: sessLabelPrefix,
+
+		nodeAddrType:     DefaultNodeAddressType,
+		imageCheck:       "syntax",
+		dialTimeout:      DefaultMonitorDialTimeout,
+		keepaliveTime:    DefaultMonitorKeepaliveTime,
+		keepaliveTimeout: DefaultMonitorKeepaliveTimeout,
+
+		sysInfoParallelism: DefaultSysInfoParallelism,
+		sysInfoRetries:     DefaultSysInfoRetries,
+		sysInfoBackoff:     DefaultSysInfoBackoff,
 	}
 
 	info, err_stat := os.Stat(sess.dir)
@@ -72,8 +167,276 @@ func InitSession(
 	}
 }
 
+// SetMaxConcurrentWrites bounds the number of monitor streams (sysinfo, perf
+// data) that are received and written to disk concurrently. Streams that
+// wait for a slot are not opened, so the monitors do not send any data for
+// them. n <= 0 means no limit.
+func (s *Session) SetMaxConcurrentWrites(n int) {
+	if n <= 0 {
+		s.writeSem = nil
+		return
+	}
+	s.writeSem = make(chan struct{}, n)
+}
+
+// DefaultSysInfoParallelism is the default number of nodes whose sysinfo is
+// retrieved concurrently
+const DefaultSysInfoParallelism = 8
+
+// SetSysInfoParallelism bounds the number of nodes whose sysinfo is retrieved
+// concurrently (see GetSysInfoNodes). Unlike SetMaxConcurrentWrites, it also
+// bounds the nodes that are being retried, so that the other nodes are not
+// all dialed at once. n <= 0 means no limit.
+func (s *Session) SetSysInfoParallelism(n int) {
+	s.sysInfoParallelism = max(n, 0)
+}
+
+// default retries of the sysinfo of a node, and initial delay between them
+const (
+	DefaultSysInfoRetries = 10
+	DefaultSysInfoBackoff = 2 * time.Second
+)
+
+// sysInfoMaxBackoff is the maximum delay between the retries of the sysinfo
+// of a node
+const sysInfoMaxBackoff = 30 * time.Second
+
+// SetSysInfoRetries sets the number of times that retrieving the sysinfo of a
+// node is retried (e.g., while its monitor is starting), and the delay before
+// the first retry, which is doubled on every retry (up to 30s). Failures that
+// retrying does not fix (e.g., the node does not exist) are not retried.
+func (s *Session) SetSysInfoRetries(retries int, backoff time.Duration) error {
+	if retries < 0 {
+		return fmt.Errorf("invalid number of sysinfo retries: %d", retries)
+	}
+	if backoff <= 0 {
+		return fmt.Errorf("invalid sysinfo retry backoff: %s", backoff)
+	}
+	s.sysInfoRetries = retries
+	s.sysInfoBackoff = backoff
+	return nil
+}
+
+// acquireWrite waits for a slot to write a monitor stream
+func (s *Session) acquireWrite(ctx context.Context) error {
+	if s.writeSem == nil {
+		return nil
+	}
+	select {
+	case s.writeSem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseWrite releases a slot acquired by acquireWrite
+func (s *Session) releaseWrite() {
+	if s.writeSem == nil {
+		return
+	}
+	<-s.writeSem
+}
+
+// DefaultMaxMsgSize is the default maximum size of the gRPC messages between
+// the monitor and kubenetbench (gRPC's own default receive limit is 4MiB)
+const DefaultMaxMsgSize = 64 * 1024 * 1024
+
+// SetMaxMsgSize sets the maximum size of the gRPC messages received from the
+// monitor (e.g., large collection or sysinfo chunks). The monitor daemonset
+// (and sidecar) is configured with the same limit.
+func (s *Session) SetMaxMsgSize(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid maximum gRPC message size: %d", n)
+	}
+	s.grpcMaxMsgSize = n
+	return nil
+}
+
+// maxMsgSize returns the maximum gRPC message size (see SetMaxMsgSize)
+func (s *Session) maxMsgSize() int {
+	if s.grpcMaxMsgSize > 0 {
+		return s.grpcMaxMsgSize
+	}
+	return DefaultMaxMsgSize
+}
+
+// monitorMaxMsgSizeArgs returns the arguments of the monitor server that set
+// the maximum gRPC message size, if it is not the default, which is also the
+// monitor's (monitor images that predate the flag reject it)
+func (s *Session) monitorMaxMsgSizeArgs() []string {
+	if s.maxMsgSize() == DefaultMaxMsgSize {
+		return nil
+	}
+	return []string{fmt.Sprintf("-max-msg-size=%d", s.maxMsgSize())}
+}
+
+// DefaultMonitorPort is the default port of the monitor
+const DefaultMonitorPort = 8451
+
+// SetMonitorPort sets the port of the monitor, e.g., if another agent uses the
+// default port on the nodes (the monitor daemonset uses the host network). The
+// monitor daemonset (and sidecar) is configured with the same port, and the
+// wrapper script passes it to the later commands of the session, which connect
+// to the monitor.
+func (s *Session) SetMonitorPort(port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid monitor port: %d", port)
+	}
+	s.port = port
+	s.writeScript(s.id, s.dirBase)
+	return nil
+}
+
+// monitorPort returns the port of the monitor (see SetMonitorPort)
+func (s *Session) monitorPort() int {
+	if s.port > 0 {
+		return s.port
+	}
+	return DefaultMonitorPort
+}
+
+// SetStreamCompression enables (or disables) the gzip compression of the
+// monitor streams (sysinfo, and collection results). Sysinfo compresses well,
+// but collection archives are already compressed, so compressing them again
+// mostly costs CPU on the nodes: it is disabled by default.
+func (s *Session) SetStreamCompression(enable bool) {
+	s.streamCompression = enable
+}
+
+// streamCallOptions returns the call options of the monitor streams: the
+// client requests compression, and the monitor compresses its responses with
+// the same compressor
+func (s *Session) streamCallOptions() []grpc.CallOption {
+	if !s.streamCompression {
+		return nil
+	}
+	return []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+}
+
+// Defaults of the monitor connection parameters (see SetMonitorDialTimeout and
+// SetMonitorKeepalive). Keepalive is off by default: monitors older than its
+// support close connections that ping more often than every 5m (GOAWAY
+// too_many_pings).
+const (
+	DefaultMonitorDialTimeout      = 10 * time.Second
+	DefaultMonitorKeepaliveTime    = 0 * time.Second
+	DefaultMonitorKeepaliveTimeout = 20 * time.Second
+)
+
+// SetMonitorDialTimeout sets how long connecting to a monitor may take. With a
+// timeout, connections are established before they are used, so an
+// unresponsive monitor fails at once instead of blocking its first request.
+// Zero disables the timeout (connections are established lazily).
+func (s *Session) SetMonitorDialTimeout(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("invalid monitor dial timeout: %s", d)
+	}
+	s.dialTimeout = d
+	return nil
+}
+
+// SetMonitorKeepalive sets the keepalive pings of monitor connections: a ping
+// is sent after interval without activity (zero disables keepalive), and the
+// connection is closed if the ping is not acknowledged within timeout. This
+// keeps idle connections (e.g., through port-forwards) open during long
+// collections, and detects dead ones. gRPC does not ping more often than
+// every 10s, and monitors that predate keepalive support not more often than
+// every 5m.
+func (s *Session) SetMonitorKeepalive(interval, timeout time.Duration) error {
+	if interval < 0 || timeout < 0 || (interval > 0 && timeout == 0) {
+		return fmt.Errorf("invalid monitor keepalive: interval %s, timeout %s", interval, timeout)
+	}
+	s.keepaliveTime = interval
+	s.keepaliveTimeout = timeout
+	return nil
+}
+
+// DefaultNodeAddressType is the node address type used to connect to the monitor
+const DefaultNodeAddressType = "InternalIP"
+
+// SetNodeAddress configures which node address is used to directly connect to
+// the monitor (i.e., when not port-forwarding): the first address of the given
+// type (e.g., InternalIP, ExternalIP) and IP family (4, 6, or 0 for any).
+func (s *Session) SetNodeAddress(addrType string, family int) error {
+	if family != 0 && family != 4 && family != 6 {
+		return fmt.Errorf("invalid IP family: %d", family)
+	}
+	s.nodeAddrType = addrType
+	s.nodeIPFamily = family
+	return nil
+}
+
+// SetMonitorProxy configures a SOCKS5 proxy (socks5://[user:password@]host:port)
+// to connect to the monitor through, e.g., a bastion host. It is an
+// alternative to port-forwarding when node addresses are not directly
+// reachable.
+func (s *Session) SetMonitorProxy(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid monitor proxy %q: %w", proxyURL, err)
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return fmt.Errorf("invalid monitor proxy %q: unsupported scheme (available values: socks5,socks5h)", proxyURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid monitor proxy %q: no host", proxyURL)
+	}
+	if s.portForward {
+		return fmt.Errorf("a monitor proxy cannot be used with port-forwarding")
+	}
+
+	dialer, err := proxy.FromURL(u, proxy.Direct)
+	if err != nil {
+		return fmt.Errorf("invalid monitor proxy %q: %w", proxyURL, err)
+	}
+	cdialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return fmt.Errorf("invalid monitor proxy %q: dialer does not support contexts", proxyURL)
+	}
+	s.monitorProxy = cdialer
+	return nil
+}
+
+// MonitorEnabled returns true if the session uses the monitor daemonset
+func (s *Session) MonitorEnabled() bool {
+	return !s.noMonitor
+}
+
+// updateLatest (atomically) points the latest symlink of the session directory
+// to the given run directory. If symlinks are not supported, the run directory
+// is written in latest.txt instead.
+func (s *Session) updateLatest(runid string) {
+	latest := filepath.Join(s.dir, "latest")
+	tmp := filepath.Join(s.dir, ".latest.tmp")
+	os.Remove(tmp)
+
+	err := os.Symlink(runid, tmp)
+	if err == nil {
+		err = os.Rename(tmp, latest)
+		if err == nil {
+			return
+		}
+		os.Remove(tmp)
+	}
+	logger().Debug("failed to update latest symlink, using latest.txt", "error", err)
+
+	err = os.WriteFile(tmp, []byte(filepath.Join(s.dir, runid)+"\n"), 0644)
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(s.dir, "latest.txt"))
+	}
+	if err != nil {
+		logger().Warn("failed to record latest run", "runid", runid, "error", err)
+	}
+}
+
+// Dir returns the session directory
+func (s *Session) Dir() string {
+	return s.dir
+}
+
 func (s *Session) getSessionLabel(sep string) string {
-	return fmt.Sprintf("%s%s%s", sessIdLabel, sep, s.id)
+	return fmt.Sprintf("%s%s%s", s.labelKey(sessIdLabel), sep, s.id)
 }
 
 func (s *Session) writeScript(sid, sdbase string) {
@@ -89,16 +452,40 @@ func (s *Session) writeScript(sid, sdbase string) {
 		return
 	}
 
+	monitorArgs := ""
+	if s.port > 0 && s.port != DefaultMonitorPort {
+		monitorArgs += fmt.Sprintf(" --monitor-port=%d", s.port)
+	}
+	if s.monitorImageName != "" {
+		monitorArgs += fmt.Sprintf(" --monitor-image=%s --monitor-image-tag=%s", s.monitorImageName, s.monitorImageTag)
+	}
+	if s.benchImageName != "" {
+		monitorArgs += fmt.Sprintf(" --bench-image=%s --bench-image-tag=%s", s.benchImageName, s.benchImageTag)
+	}
+	if c := s.monitorTLS; c != nil {
+		monitorArgs += fmt.Sprintf(" --monitor-tls-ca=%s --monitor-tls-secret=%s", c.CA, c.Secret)
+		if c.mTLS() {
+			monitorArgs += fmt.Sprintf(" --monitor-tls-cert=%s --monitor-tls-key=%s", c.Cert, c.Key)
+		}
+	}
+	if s.insecureMonitor {
+		monitorArgs += " --insecure-monitor"
+	}
+	if s.monitorToken != "" {
+		// NB: the token itself is read from the environment
+		monitorArgs += fmt.Sprintf(" --monitor-token-secret=%s", s.monitorTokenSecret)
+	}
+
 	fmt.Fprintln(f, "#!/bin/sh")
 	fmt.Fprintln(f, "# wrapper script for kubenetbench")
-	fmt.Fprintf(f, "%s --session-id=%s --session-base-dir=%s --port-forward=%t \"$@\"\n", prog, sid, sdbase, s.portForward)
+	fmt.Fprintf(f, "%s --session-id=%s --session-base-dir=%s --port-forward=%t --no-monitor=%t --monitor-sidecar=%t --use-existing-monitor=%t --label-prefix=%s%s \"$@\"\n", prog, sid, sdbase, s.portForward, s.noMonitor, s.monitorSidecar, s.existingMonitor, s.labelPrefix, monitorArgs)
 
 	err = os.Chmod(fname, 0755)
 	if err != nil {
 		return
 	}
 
-	log.Printf("================> wrote wrapper script: you may use: %s\n", fname)
+	logger().Info("================> wrote wrapper script", "script", fname)
 }
 
 func (s *Session) OpenLog() (*os.File, error) {
@@ -107,14 +494,28 @@ func (s *Session) OpenLog() (*os.File, error) {
 }
 
 func (s *Session) StartMonitor() error {
+	return s.StartMonitorContext(context.Background())
+}
+
+// StartMonitorContext deploys the monitor daemonset
+func (s *Session) StartMonitorContext(ctx context.Context) error {
+	if err := s.checkImages(ctx, []string{s.monitorImageRef()}); err != nil {
+		return err
+	}
+
 	monitorYamlFname, err := s.genMonitorYaml()
 	if err != nil {
 		return err
 	}
 
-	return s.KubeApply(monitorYamlFname)
+	return s.KubeApplyContext(ctx, monitorYamlFname)
 }
 
 func (s *Session) StopMonitor() error {
-	return s.KubeCleanup()
+	return s.StopMonitorContext(context.Background())
+}
+
+// StopMonitorContext removes the monitor daemonset
+func (s *Session) StopMonitorContext(ctx context.Context) error {
+	return s.KubeCleanupContext(ctx)
 }
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// sharedMonitorName is the name of the shared monitor daemonset
+	sharedMonitorName = "knb-shared-monitor"
+	// sharedMonitorValue is the value of the monitor label (see labelKey) of
+	// the shared monitor, which identifies it instead of the session label
+	sharedMonitorValue = "shared"
+)
+
+// SetUseExistingMonitor makes the session use the shared monitor daemonset
+// (deployed with the monitor deploy command), instead of deploying its own.
+// The shared monitor is identified by a stable label rather than the session
+// label, so that it outlives the sessions that use it: it is not removed when
+// the session is done. The wrapper script passes --use-existing-monitor, so
+// that later commands of the session neither deploy nor remove a monitor.
+func (s *Session) SetUseExistingMonitor() {
+	s.existingMonitor = true
+	s.writeScript(s.id, s.dirBase)
+}
+
+// UseExistingMonitor returns true if the session uses the shared monitor
+// daemonset (see SetUseExistingMonitor)
+func (s *Session) UseExistingMonitor() bool {
+	return s.MonitorEnabled() && !s.monitorSidecar && s.existingMonitor
+}
+
+// monitorLabel returns the label that identifies the monitor daemonset (and
+// its pods) of the session: the session label, or the shared monitor label
+func (s *Session) monitorLabel(sep string) string {
+	if s.UseExistingMonitor() {
+		return fmt.Sprintf("%s%s%s", s.labelKey("monitor"), sep, sharedMonitorValue)
+	}
+	return s.getSessionLabel(sep)
+}
+
+// monitorDaemonset returns the name of the monitor daemonset of the session
+func (s *Session) monitorDaemonset() string {
+	if s.UseExistingMonitor() {
+		return sharedMonitorName
+	}
+	return monitorName
+}
+
+// KubeGetMonitorPodForNodeContext returns the monitor pod of the session on
+// the given node
+func (s *Session) KubeGetMonitorPodForNodeContext(ctx context.Context, node string) (string, error) {
+	return kubeGetPodForNode(ctx, node, s.monitorLabel("=")+","+monitorSelector)
+}
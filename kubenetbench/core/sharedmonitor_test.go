@@ -0,0 +1,43 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSharedMonitor(t *testing.T) {
+	s, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.monitorLabel("="); got != "knb-sessid=test" {
+		t.Errorf("session monitor label: got %s", got)
+	}
+
+	s.SetUseExistingMonitor()
+	if got := s.monitorLabel("="); got != "knb-monitor=shared" {
+		t.Errorf("shared monitor label: got %s", got)
+	}
+	if got := s.monitorDaemonset(); got != sharedMonitorName {
+		t.Errorf("shared monitor daemonset: got %s", got)
+	}
+
+	yaml, err := s.genMonitorYaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "name: knb-shared-monitor") || strings.Contains(string(data), "sessid") {
+		t.Errorf("shared monitor manifest:\n%s", data)
+	}
+
+	// the shared monitor is not used without the daemonset
+	s.SetMonitorSidecar()
+	if s.UseExistingMonitor() || s.monitorDaemonset() != monitorName {
+		t.Errorf("shared monitor used with the sidecar")
+	}
+}
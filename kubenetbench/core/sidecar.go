@@ -0,0 +1,205 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// monitorSidecarName is the name of the monitor container in sidecar mode
+const monitorSidecarName = "knb-monitor"
+
+// sidecarPod is a benchmark pod with a monitor sidecar
+type sidecarPod struct {
+	Name, Namespace, IP string
+}
+
+// SetMonitorSidecar makes the session run the monitor as a sidecar container
+// in the benchmark pods, instead of a (privileged) daemonset. The sidecar is
+// not privileged and shares the network namespace of the pod, so only
+// pod-scoped data are collected (packet captures, network stats), and not
+// node-level data (sysinfo, perf). The wrapper script passes
+// --monitor-sidecar, so that the later runs of the session get a sidecar too.
+func (s *Session) SetMonitorSidecar() {
+	s.monitorSidecar = true
+	s.writeScript(s.id, s.dirBase)
+}
+
+// MonitorSidecar returns true if the monitor runs as a sidecar in the benchmark
+// pods (see SetMonitorSidecar)
+func (s *Session) MonitorSidecar() bool {
+	return !s.noMonitor && s.monitorSidecar
+}
+
+// monitorSidecarWrite writes the monitor sidecar container of a benchmark pod
+// (as an item of the pod's containers), if the session uses a sidecar. It is
+// placed after the benchmark container, so that the latter is the default
+// container (e.g., for kubectl logs).
+func (s *ContainerSpec) monitorSidecarWrite(sess *Session) utils.PrefixRenderer {
+	return func(pw *utils.PrefixWriter, params map[string]interface{}) {
+		if !sess.MonitorSidecar() {
+			return
+		}
+		pw.AppendNewLineOrDie(fmt.Sprintf(`- name: %s`, monitorSidecarName))
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  image: %s`, sess.monitorImageRef()))
+		command := fmt.Sprintf(`"/monitor-srv", "-p=%d"`, sess.monitorPort())
+		for _, arg := range sess.monitorMaxMsgSizeArgs() {
+			command += fmt.Sprintf(`, "%s"`, arg)
+		}
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  command: [%s]`, command))
+		pw.AppendNewLineOrDie(`  securityContext:`)
+		if s.Restricted {
+			// NB: packet captures are not possible without NET_RAW
+			pw.AppendNewLineOrDie(`    allowPrivilegeEscalation: false`)
+			pw.AppendNewLineOrDie(`    capabilities:`)
+			pw.AppendNewLineOrDie(`      drop: ["ALL"]`)
+		} else {
+			pw.AppendNewLineOrDie(`    capabilities:`)
+			pw.AppendNewLineOrDie(`      add: ["NET_RAW"] # packet captures`)
+		}
+		pw.AppendNewLineOrDie(`  ports:`)
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  - containerPort: %d`, sess.monitorPort()))
+	}
+}
+
+// getSidecarPods returns the pods of the run that have a monitor sidecar
+func (r *RunBenchCtx) getSidecarPods() ([]sidecarPod, error) {
+	podsinfo, err := r.KubeGetPods__([]string{PodName, ".metadata.namespace", ".status.podIP", ".spec.containers[*].name"})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []sidecarPod{}
+	for _, a := range podsinfo {
+		if len(a) != 4 {
+			continue
+		}
+		for _, c := range strings.Split(a[3], ",") {
+			if c == monitorSidecarName {
+				ret = append(ret, sidecarPod{Name: a[0], Namespace: a[1], IP: a[2]})
+				break
+			}
+		}
+	}
+	return ret, nil
+}
+
+// monitorTargets returns the monitors of the run: the nodes of its pods (or
+// the observed nodes), or, in sidecar mode, its pods (see dialMonitor)
+func (r *RunBenchCtx) monitorTargets() ([]string, error) {
+	if r.observeNodes != nil {
+		return r.observeNodes, nil
+	}
+	if !r.session.MonitorSidecar() {
+		return r.getRunNodes()
+	}
+
+	pods, err := r.getSidecarPods()
+	if err != nil {
+		return nil, err
+	}
+	r.sidecars = make(map[string]sidecarPod)
+	targets := make([]string, 0, len(pods))
+	for _, p := range pods {
+		r.sidecars[p.Name] = p
+		targets = append(targets, p.Name)
+	}
+	if len(targets) == 0 {
+		logger().Warn("no monitor sidecars in the run pods")
+	}
+	return targets, nil
+}
+
+// dialMonitor connects to the monitor of a target (see monitorTargets)
+func (r *RunBenchCtx) dialMonitor(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	if !r.session.MonitorSidecar() {
+		return r.session.DialMonitor(ctx, target)
+	}
+
+	pod, ok := r.sidecars[target]
+	if !ok {
+		return nil, fmt.Errorf("no monitor sidecar in pod %s", target)
+	}
+
+	var srvAddr string
+	if r.session.portForward {
+		fwdTarget := "pod/" + pod.Name
+		if pod.Namespace != "" {
+			fwdTarget = fmt.Sprintf("-n %s %s", pod.Namespace, fwdTarget)
+		}
+		port, err := KubePortForward(ctx, fwdTarget, strconv.Itoa(r.session.monitorPort()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain monitor address of pod %s: %w", pod.Name, err)
+		}
+		srvAddr = net.JoinHostPort("localhost", port)
+	} else {
+		if pod.IP == "" || pod.IP == "<none>" {
+			return nil, fmt.Errorf("pod %s has no IP", pod.Name)
+		}
+		srvAddr = net.JoinHostPort(pod.IP, strconv.Itoa(r.session.monitorPort()))
+	}
+	return r.session.dialMonitorAddr(ctx, srvAddr)
+}
+
+// getNetStats retrieves a network statistics snapshot from the monitor of a
+// target (see monitorTargets)
+func (r *RunBenchCtx) getNetStats(ctx context.Context, target string) (*pb.NetStats, error) {
+	if !r.session.MonitorSidecar() {
+		return r.session.GetNetStatsNodeContext(ctx, target)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conn, err := r.dialMonitor(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	cli := pb.NewKubebenchMonitorClient(conn)
+	return cli.GetNetStats(ctx, &pb.Empty{})
+}
+
+// cliContainerPhase returns the phase of the client container (Running,
+// Succeeded, or Failed). In sidecar mode, the client pod does not complete
+// when the client does, because the monitor container keeps running.
+func (r *RunBenchCtx) cliContainerPhase(selector string) (string, error) {
+	cmd := fmt.Sprintf(
+		`kubectl get pod%s -l "%s" -o jsonpath='{range .items[0].status.containerStatuses[*]}{.name} {.state.terminated.exitCode}{"\n"}{end}'`,
+		nsArg(r.cliSpec.Namespace), selector,
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLines(cmd)
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %w", cmd, err)
+	}
+	return containersPhase(lines), nil
+}
+
+// containersPhase returns the phase of the (non-monitor) containers, given
+// their (name, exit code) lines
+func containersPhase(lines []string) string {
+	phase := "Running"
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == monitorSidecarName {
+			continue
+		}
+		if len(fields) < 2 {
+			return "Running"
+		}
+		if fields[1] != "0" {
+			return "Failed"
+		}
+		phase = "Succeeded"
+	}
+	return phase
+}
@@ -0,0 +1,20 @@
+package core
+
+import "testing"
+
+func TestContainersPhase(t *testing.T) {
+	for _, tc := range []struct {
+		lines []string
+		phase string
+	}{
+		{[]string{"knb-monitor ", "netperf-cli "}, "Running"},
+		{[]string{"knb-monitor ", "netperf-cli 0"}, "Succeeded"},
+		{[]string{"knb-monitor ", "netperf-cli 1"}, "Failed"},
+		{[]string{"knb-monitor 0"}, "Running"},
+		{[]string{}, "Running"},
+	} {
+		if got := containersPhase(tc.lines); got != tc.phase {
+			t.Errorf("containersPhase(%q): got %s, expected %s", tc.lines, got, tc.phase)
+		}
+	}
+}
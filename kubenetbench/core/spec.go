@@ -0,0 +1,163 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// RunSpec is the effective configuration of a run: the flags and their
+// defaults, resolved into the values the run uses (see Spec)
+type RunSpec struct {
+	RunID      string            `json:"runId"`
+	Session    string            `json:"session"`
+	SessionDir string            `json:"sessionDir"`
+	Labels     map[string]string `json:"labels"` // labels selecting the run resources
+
+	Benchmark       string      `json:"benchmark"`
+	BenchmarkConfig interface{} `json:"benchmarkConfig"`
+	Duration        int         `json:"duration"`
+	MeasureWindow   string      `json:"measureWindow,omitempty"`
+	Images          []string    `json:"images"`
+
+	Client *ContainerSpec `json:"client"`
+	Server *ContainerSpec `json:"server"`
+
+	Monitor    RunSpecMonitor    `json:"monitor"`
+	Collection RunSpecCollection `json:"collection"`
+
+	Netem *NetemConf `json:"netem,omitempty"`
+	Ping  *PingConf  `json:"ping,omitempty"`
+
+	Cleanup      bool   `json:"cleanup"`
+	KeepYaml     string `json:"keepYaml"`
+	Pause        bool   `json:"pause"`
+	WaitServer   bool   `json:"waitServer"`
+	ServerProbe  string `json:"serverReadyProbe,omitempty"`
+	AllowZero    bool   `json:"allowZero"`
+	VerifyPath   bool   `json:"verifyPath"`
+	TopologyDot  string `json:"topologyDot,omitempty"`
+	ImageCheck   string `json:"imageCheck"`
+	PortForward  bool   `json:"portForward"`
+	NodeAddrType string `json:"nodeAddressType,omitempty"`
+}
+
+// RunSpecMonitor is the monitor configuration of a RunSpec
+type RunSpecMonitor struct {
+	Enabled     bool              `json:"enabled"`
+	Sidecar     bool              `json:"sidecar"`
+	Shared      bool              `json:"shared"`
+	Image       string            `json:"image,omitempty"`
+	NodeLabels  map[string]string `json:"nodeLabels,omitempty"`
+	Tolerations []Toleration      `json:"tolerations,omitempty"`
+}
+
+// RunSpecCollection is the node-level data collection of a RunSpec
+type RunSpecCollection struct {
+	Perf              bool           `json:"perf"`
+	PerfOutput        string         `json:"perfOutput,omitempty"`
+	PerfDuration      int            `json:"perfDuration,omitempty"`
+	PerfDurationNodes map[string]int `json:"perfDurationNodes,omitempty"`
+	NetStats          bool           `json:"netStats"`
+	Pcap              *PcapConf      `json:"pcap,omitempty"`
+	Ss                *SsConf        `json:"ss,omitempty"`
+	Rdma              bool           `json:"rdma"`
+	Hubble            bool           `json:"hubble"`
+	CPU               bool           `json:"cpu"`
+	MaxSize           int64          `json:"maxSize,omitempty"`
+}
+
+// benchmarkName returns the name of a benchmark (as in the --benchmark flag)
+func benchmarkName(b Benchmark) string {
+	switch b.(type) {
+	case *NetperfRRConf, *NetperfStreamConf:
+		return "netperf"
+	case *HTTPConf:
+		return "http"
+	case *QUICConf:
+		return "quic"
+	case *CustomConf:
+		return "custom"
+	case *ObserveConf:
+		return "observe"
+	}
+	return "unknown"
+}
+
+// Spec returns the effective configuration of the run. It does not query the
+// cluster, and can be used before MakeDir (e.g., for --print-spec).
+func (r *RunBenchCtx) Spec() *RunSpec {
+	s := r.session
+	spec := &RunSpec{
+		RunID:      r.runid,
+		Session:    s.id,
+		SessionDir: s.dir,
+		Labels: map[string]string{
+			s.labelKey(sessIdLabel): s.id,
+			s.labelKey(runIdLabel):  r.runid,
+		},
+		Benchmark:       benchmarkName(r.benchmark),
+		BenchmarkConfig: r.benchmark,
+		Duration:        r.benchmark.GetTimeout(),
+		Images:          r.images(),
+		Client:          r.cliSpec,
+		Server:          r.srvSpec,
+		Monitor: RunSpecMonitor{
+			Enabled:     s.MonitorEnabled(),
+			Sidecar:     s.MonitorSidecar(),
+			Shared:      s.UseExistingMonitor(),
+			NodeLabels:  s.monitorNodeLabels,
+			Tolerations: s.monitorTolerations,
+		},
+		Collection: RunSpecCollection{
+			Perf:     r.collectPerf,
+			NetStats: r.collectNetStats,
+			Pcap:     r.pcap,
+			Ss:       r.ss,
+			Rdma:     r.rdma,
+			Hubble:   r.hubble,
+			CPU:      r.cpu,
+			MaxSize:  r.maxCollectionSize,
+		},
+		Netem:        r.netem,
+		Ping:         r.ping,
+		Cleanup:      r.cleanup,
+		KeepYaml:     r.keepYaml,
+		Pause:        r.pause,
+		WaitServer:   !r.noWaitSrv,
+		AllowZero:    r.allowZero,
+		VerifyPath:   r.verifyPath,
+		TopologyDot:  r.topologyDot,
+		ImageCheck:   s.imageCheck,
+		PortForward:  s.portForward,
+		NodeAddrType: s.nodeAddrType,
+	}
+	if spec.Monitor.Enabled {
+		spec.Monitor.Image = s.monitorImageRef()
+	}
+	if p := r.srvReadyProbe(); p != nil {
+		spec.ServerProbe = p.String()
+	}
+	if r.window != nil {
+		spec.MeasureWindow = r.window.String()
+	}
+	if r.collectPerf {
+		spec.Collection.PerfOutput = r.perfOutput
+		if spec.Collection.PerfOutput == "" {
+			spec.Collection.PerfOutput = "perfdata"
+		}
+		spec.Collection.PerfDuration = r.collectionDuration("")
+		spec.Collection.PerfDurationNodes = r.collectDurationNodes
+	}
+	if spec.KeepYaml == "" {
+		spec.KeepYaml = "always"
+	}
+	return spec
+}
+
+// WriteSpec writes the effective configuration of the run (see Spec) as
+// (indented) JSON, which is also valid YAML
+func (r *RunBenchCtx) WriteSpec(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Spec())
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRunSpec(t *testing.T) {
+	r := &RunBenchCtx{
+		session:   &Session{id: "s1", dir: "/tmp/s1", labelPrefix: "example.com/bench", noMonitor: true},
+		runid:     "p2p-1",
+		cliSpec:   &ContainerSpec{Affinity: "different"},
+		srvSpec:   &ContainerSpec{Affinity: "none"},
+		benchmark: &NetperfStreamConf{NetperfConf: NetperfConf{Timeout: 60, TestName: "tcp_stream"}},
+		cleanup:   true,
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteSpec(&buf); err != nil {
+		t.Fatal(err)
+	}
+	spec := RunSpec{}
+	if err := json.Unmarshal(buf.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, buf.String())
+	}
+
+	if spec.Benchmark != "netperf" || spec.Duration != 60 {
+		t.Errorf("unexpected benchmark: %s (%d)", spec.Benchmark, spec.Duration)
+	}
+	if spec.Labels["example.com/bench-runid"] != "p2p-1" || spec.Labels["example.com/bench-sessid"] != "s1" {
+		t.Errorf("unexpected labels: %v", spec.Labels)
+	}
+	if spec.Monitor.Enabled || spec.Monitor.Image != "" {
+		t.Errorf("unexpected monitor: %+v", spec.Monitor)
+	}
+	if spec.KeepYaml != "always" || !spec.WaitServer {
+		t.Errorf("unexpected defaults: keepYaml=%s waitServer=%t", spec.KeepYaml, spec.WaitServer)
+	}
+	if len(spec.Images) != 1 || spec.Images[0] != benchImage {
+		t.Errorf("unexpected images: %v", spec.Images)
+	}
+}
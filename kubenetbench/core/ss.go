@@ -0,0 +1,300 @@
+package core
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/cilium/kubenetbench/benchmonitor/api"
+)
+
+// DefaultSsInterval is the default interval for sampling the benchmark
+// sockets (see SetSsSampling)
+const DefaultSsInterval = time.Second
+
+// SsConf configures sampling the benchmark sockets (ss -tin) on the monitors
+// of the run nodes. The samples are included in the collection archive.
+type SsConf struct {
+	Interval time.Duration // sampling interval
+	Filter   string        // ss filter expression (empty for the benchmark data port)
+}
+
+// SetSsSampling enables sampling the TCP state (cwnd, rtt, retransmits) of the
+// benchmark connections on the run nodes for the benchmark duration
+func (r *RunBenchCtx) SetSsSampling(conf SsConf) error {
+	if conf.Interval < 100*time.Millisecond {
+		return fmt.Errorf("invalid ss sampling interval %s: minimum is 100ms", conf.Interval)
+	}
+	r.ss = &conf
+	return nil
+}
+
+// dataPort returns the netperf data connection port
+func (cnf *NetperfConf) dataPort() uint16 {
+	return cnf.DataPort
+}
+
+// ssFilter returns the ss filter expression: the configured one, or the
+// connections of the benchmark data port
+func (r *RunBenchCtx) ssFilter() string {
+	if r.ss.Filter != "" {
+		return r.ss.Filter
+	}
+
+	port := r.dataPort()
+	if port == 0 {
+		logger().Warn("benchmark has no known data port: sampling all sockets")
+		return ""
+	}
+	return fmt.Sprintf("( sport = :%d or dport = :%d )", port, port)
+}
+
+// ssConfPb sets the ss sampling configuration of a collection (if enabled)
+func (r *RunBenchCtx) ssConfPb(conf *pb.CollectionConf, filter string) {
+	if r.ss == nil {
+		return
+	}
+	conf.SsDuration = fmt.Sprintf("%d", r.collectSeconds())
+	conf.SsIntervalMs = int32(r.ss.Interval / time.Millisecond)
+	conf.SsFilter = filter
+}
+
+// ssSample is a sample of a connection's TCP state
+type ssSample struct {
+	T             float64 // seconds since the first sample
+	Conn          string  // local->peer
+	Cwnd          int64   // congestion window (segments)
+	Rtt           float64 // smoothed rtt (ms)
+	Retrans       int64   // total retransmits
+	BytesAcked    int64
+	BytesReceived int64
+}
+
+// parseSsSamples parses the output of scripts/ss-sample.sh: "# t=<uptime>"
+// lines, each followed by the output of ss -tinH, where the TCP info of a
+// connection is on the (indented) line after it
+func parseSsSamples(r io.Reader) ([]ssSample, error) {
+	ret := []ssSample{}
+	t0, t := -1.0, 0.0
+	conn := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "# t=") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, "# t="), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ss sample time %q: %w", line, err)
+			}
+			if t0 < 0 {
+				t0 = v
+			}
+			t, conn = v-t0, ""
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			// connection line: [State] Recv-Q Send-Q Local Peer
+			addrs := []string{}
+			for _, f := range strings.Fields(line) {
+				if strings.Contains(f, ":") {
+					addrs = append(addrs, f)
+				}
+			}
+			conn = ""
+			if len(addrs) >= 2 {
+				conn = addrs[0] + "->" + addrs[1]
+			}
+			continue
+		}
+
+		if conn == "" {
+			continue
+		}
+		s := ssSample{T: t, Conn: conn}
+		for _, f := range strings.Fields(line) {
+			k, v, ok := strings.Cut(f, ":")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "cwnd":
+				s.Cwnd, _ = strconv.ParseInt(v, 10, 64)
+			case "rtt":
+				rtt, _, _ := strings.Cut(v, "/")
+				s.Rtt, _ = strconv.ParseFloat(rtt, 64)
+			case "retrans":
+				// retrans:<unrecovered>/<total>
+				_, total, _ := strings.Cut(v, "/")
+				s.Retrans, _ = strconv.ParseInt(total, 10, 64)
+			case "bytes_acked":
+				s.BytesAcked, _ = strconv.ParseInt(v, 10, 64)
+			case "bytes_received":
+				s.BytesReceived, _ = strconv.ParseInt(v, 10, 64)
+			}
+		}
+		ret = append(ret, s)
+		conn = ""
+	}
+	return ret, scanner.Err()
+}
+
+func writeSsCSV(fname string, samples []ssSample) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, "time,connection,cwnd,rtt_ms,retrans")
+	for _, s := range samples {
+		fmt.Fprintf(f, "%.2f,%s,%d,%.3f,%d\n", s.T, s.Conn, s.Cwnd, s.Rtt, s.Retrans)
+	}
+	return nil
+}
+
+// ssSummary summarizes the samples of the sending side of the connections
+// (where cwnd matters): the connections that were acked at least as many bytes
+// as they received. Retransmits are the sum of the connections' totals.
+func ssSummary(samples []ssSample) map[string]string {
+	acked := make(map[string]int64)
+	received := make(map[string]int64)
+	retrans := make(map[string]int64)
+	for _, s := range samples {
+		acked[s.Conn] = max(acked[s.Conn], s.BytesAcked)
+		received[s.Conn] = max(received[s.Conn], s.BytesReceived)
+		retrans[s.Conn] = max(retrans[s.Conn], s.Retrans)
+	}
+
+	cwnd, rtt := []float64{}, []float64{}
+	var nretrans int64
+	senders := make(map[string]struct{})
+	for _, s := range samples {
+		if acked[s.Conn] < received[s.Conn] {
+			continue
+		}
+		senders[s.Conn] = struct{}{}
+		cwnd = append(cwnd, float64(s.Cwnd))
+		rtt = append(rtt, s.Rtt)
+	}
+	if len(cwnd) == 0 {
+		return nil
+	}
+	for c := range senders {
+		nretrans += retrans[c]
+	}
+
+	cs, rs := ComputeStats(cwnd), ComputeStats(rtt)
+	return map[string]string{
+		"SS_CONNECTIONS": strconv.Itoa(len(senders)),
+		"SS_CWND_MIN":    strconv.FormatFloat(cs.Min, 'f', 0, 64),
+		"SS_CWND_MEAN":   strconv.FormatFloat(cs.Mean, 'f', 1, 64),
+		"SS_CWND_MAX":    strconv.FormatFloat(cs.Max, 'f', 0, 64),
+		"SS_RTT_MEAN":    strconv.FormatFloat(rs.Mean, 'f', 3, 64),
+		"SS_RTT_MAX":     strconv.FormatFloat(rs.Max, 'f', 3, 64),
+		"SS_RETRANS":     strconv.FormatInt(nretrans, 10),
+	}
+}
+
+// errNotInArchive is returned by readFromArchive if the file is not found
+var errNotInArchive = errors.New("file not in archive")
+
+// readFromArchive returns the contents of a file (by name) in a tar.bz2
+// collection archive
+func readFromArchive(fname, name string) ([]byte, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(bzip2.NewReader(f))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errNotInArchive
+		} else if err != nil {
+			return nil, fmt.Errorf("reading %s failed: %w", fname, err)
+		}
+		if path.Base(hdr.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// processSsSamples extracts the ss samples from the collection archives of
+// the run, writes them as a (per-node) time-series (ss-<node>.csv), and their
+// summary in ss.log (see GetResult)
+func (r *RunBenchCtx) processSsSamples() error {
+	all := []ssSample{}
+	conns := map[string][]string{}
+	for _, node := range r.collectNodes {
+		archive := fmt.Sprintf("%s/%s-%s.tar.bz2", r.getDir(), r.collectionName(), node)
+		data, err := readFromArchive(archive, r.runid+"-ss.txt")
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errNotInArchive) {
+			continue
+		} else if err != nil {
+			logger().Warn("reading ss samples failed", "node", node, "error", err)
+			continue
+		}
+
+		samples, err := parseSsSamples(strings.NewReader(string(data)))
+		if err != nil {
+			logger().Warn("parsing ss samples failed", "node", node, "error", err)
+			continue
+		}
+		fname := fmt.Sprintf("%s/ss-%s.csv", r.getDir(), node)
+		if err := writeSsCSV(fname, samples); err != nil {
+			logger().Warn("writing ss samples failed", "node", node, "error", err)
+		}
+		for i := range samples {
+			conns[node] = append(conns[node], samples[i].Conn)
+			samples[i].Conn = node + "/" + samples[i].Conn
+		}
+		all = append(all, samples...)
+	}
+
+	if r.verifyPath {
+		r.checkPath(conns)
+	}
+
+	summary := ssSummary(all)
+	if summary == nil {
+		logger().Warn("no ss samples of the benchmark connections")
+		return nil
+	}
+
+	f, err := os.Create(fmt.Sprintf("%s/ss.log", r.getDir()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	keys := make([]string, 0, len(summary))
+	for k := range summary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(f, "%s=%s\n", k, summary[k])
+	}
+
+	logger().Info("socket stats",
+		"connections", summary["SS_CONNECTIONS"],
+		"cwnd_mean", summary["SS_CWND_MEAN"],
+		"rtt_mean_ms", summary["SS_RTT_MEAN"],
+		"retransmits", summary["SS_RETRANS"])
+	return nil
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+const ssSamplesTest = `# t=100.50
+0      0      10.0.0.1:40000 10.0.0.2:8000
+	 cubic wscale:7,7 rto:204 rtt:0.5/0.25 mss:1448 cwnd:10 bytes_sent:1000 bytes_acked:1000 bytes_received:1
+0      0      10.0.0.2:8000 10.0.0.1:40000
+	 cubic wscale:7,7 rto:204 rtt:0.1/0.05 mss:1448 cwnd:10 bytes_acked:1 bytes_received:1000
+# t=101.50
+0      0      10.0.0.1:40000 10.0.0.2:8000
+	 cubic wscale:7,7 rto:204 rtt:1.5/0.25 mss:1448 cwnd:30 bytes_sent:9000 bytes_acked:8000 bytes_received:1 retrans:1/3
+0      0      10.0.0.2:8000 10.0.0.1:40000
+	 cubic wscale:7,7 rto:204 rtt:0.1/0.05 mss:1448 cwnd:10 bytes_acked:1 bytes_received:8000
+`
+
+func TestParseSsSamples(t *testing.T) {
+	samples, err := parseSsSamples(strings.NewReader(ssSamplesTest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(samples))
+	}
+
+	s := samples[2]
+	if s.T != 1 || s.Conn != "10.0.0.1:40000->10.0.0.2:8000" || s.Cwnd != 30 || s.Rtt != 1.5 || s.Retrans != 3 {
+		t.Fatalf("unexpected sample: %+v", s)
+	}
+
+	summary := ssSummary(samples)
+	expected := map[string]string{
+		"SS_CONNECTIONS": "1",
+		"SS_CWND_MIN":    "10",
+		"SS_CWND_MEAN":   "20.0",
+		"SS_CWND_MAX":    "30",
+		"SS_RTT_MEAN":    "1.000",
+		"SS_RTT_MAX":     "1.500",
+		"SS_RETRANS":     "3",
+	}
+	for k, v := range expected {
+		if summary[k] != v {
+			t.Errorf("%s: expected %s, got %s", k, v, summary[k])
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// summaryMetrics are the metric columns of the session summary. The list is
+// fixed, so that summaries of different sessions have the same columns.
+var summaryMetrics = []string{
+	"THROUGHPUT",
+	"THROUGHPUT_UNITS",
+	"AGGREGATE_THROUGHPUT",
+	"TX_THROUGHPUT",
+	"RX_THROUGHPUT",
+	"TRANSACTION_RATE",
+	"MEAN_LATENCY",
+	"P50_LATENCY",
+	"P90_LATENCY",
+	"P99_LATENCY",
+	"TCP_RETRANS_SEGS",
+	"TCP_LOST_RETRANSMIT",
+}
+
+// readKeyValueFile parses a file with KEY=VALUE lines
+func readKeyValueFile(fname string) (map[string]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res, err := ParseBenchResult("", f)
+	if err != nil {
+		return nil, err
+	}
+	return res.Values, nil
+}
+
+// loadRunResults loads the saved results (see SaveResult) of all runs in a
+// session directory, ordered by run id
+func loadRunResults(sessDir string) ([]*BenchResult, error) {
+	fnames, err := filepath.Glob(filepath.Join(sessDir, "*", "result"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(fnames)
+
+	ret := make([]*BenchResult, 0, len(fnames))
+	for _, fname := range fnames {
+		dir := filepath.Dir(fname)
+		// skip the latest symlink (see updateLatest)
+		if fi, err := os.Lstat(dir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+
+		res, err := loadRunResult(dir)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, res)
+	}
+
+	return ret, nil
+}
+
+// loadRunResult loads the saved result (see SaveResult) of the run in dir
+func loadRunResult(dir string) (*BenchResult, error) {
+	fname := filepath.Join(dir, "result")
+	vals, err := readKeyValueFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fname, err)
+	}
+
+	meta, err := readKeyValueFile(filepath.Join(dir, "meta"))
+	if os.IsNotExist(err) {
+		meta = map[string]string{}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of %s: %w", dir, err)
+	}
+
+	tags, err := readTagsFile(filepath.Join(dir, "tags"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags of %s: %w", dir, err)
+	}
+
+	return &BenchResult{
+		RunID:  filepath.Base(dir),
+		Values: vals,
+		Meta:   meta,
+		Tags:   tags,
+	}, nil
+}
+
+// sortedKeys returns the sorted union of the keys of a set of maps
+func sortedKeys(ms []map[string]string, filter func(string) bool) []string {
+	keysMap := make(map[string]struct{})
+	for _, m := range ms {
+		for k := range m {
+			if filter(k) {
+				keysMap[k] = struct{}{}
+			}
+		}
+	}
+	keys := make([]string, 0, len(keysMap))
+	for k := range keysMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Summarize writes a CSV summary of all the runs of a session, one row per
+// run. Columns are: the run id, the run parameters (see AddParam) sorted by
+// name, the run tags (see AddTag) sorted by key and prefixed with "tag_", and
+// the metrics in summaryMetrics.
+func Summarize(sessDir string, w io.Writer) (int, error) {
+	results, err := loadRunResults(sessDir)
+	if err != nil {
+		return 0, err
+	}
+
+	metas := make([]map[string]string, 0, len(results))
+	tagsList := make([]map[string]string, 0, len(results))
+	for _, res := range results {
+		metas = append(metas, res.Meta)
+		tagsList = append(tagsList, res.Tags)
+	}
+	params := sortedKeys(metas, func(k string) bool { return strings.HasPrefix(k, paramPrefix) })
+	tags := sortedKeys(tagsList, func(string) bool { return true })
+
+	cw := csv.NewWriter(w)
+	header := []string{"runid"}
+	for _, p := range params {
+		header = append(header, strings.ToLower(strings.TrimPrefix(p, paramPrefix)))
+	}
+	for _, t := range tags {
+		header = append(header, "tag_"+t)
+	}
+	for _, m := range summaryMetrics {
+		header = append(header, strings.ToLower(m))
+	}
+	cw.Write(header)
+
+	for _, res := range results {
+		row := []string{res.RunID}
+		for _, p := range params {
+			row = append(row, res.Meta[p])
+		}
+		for _, t := range tags {
+			row = append(row, res.Tags[t])
+		}
+		for _, m := range summaryMetrics {
+			row = append(row, res.Values[m])
+		}
+		cw.Write(row)
+	}
+
+	cw.Flush()
+	return len(results), cw.Error()
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	dir := t.TempDir()
+	runs := []struct{ id, result, meta string }{
+		{"foo-r2", "THROUGHPUT=200\nTCP_RETRANS_SEGS=3\n", "PARAM_REPEAT=2\nNET_IFACE=net1\n"},
+		{"foo-r1", "THROUGHPUT=100\nP50_LATENCY=10\n", "PARAM_REPEAT=1\nPARAM_MSG_SIZE=64\n"},
+		{"bar", "", ""}, // no saved result
+	}
+	for _, r := range runs {
+		rdir := filepath.Join(dir, r.id)
+		if err := os.Mkdir(rdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if r.result == "" {
+			continue
+		}
+		os.WriteFile(filepath.Join(rdir, "result"), []byte(r.result), 0644)
+		os.WriteFile(filepath.Join(rdir, "meta"), []byte(r.meta), 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "foo-r1", "tags"), []byte("kernel=5.15\ntuning=a=b\n"), 0644)
+
+	sess := &Session{dir: dir}
+	sess.updateLatest("foo-r2")
+
+	var buf bytes.Buffer
+	n, err := Summarize(dir, &buf)
+	if err != nil {
+		t.Fatalf("Summarize failed: %s", err)
+	}
+	if n != 2 {
+		t.Errorf("got %d runs while expected 2", n)
+	}
+
+	expected := "runid,msg_size,repeat,tag_kernel,tag_tuning,throughput,throughput_units,aggregate_throughput,tx_throughput,rx_throughput,transaction_rate,mean_latency,p50_latency,p90_latency,p99_latency,tcp_retrans_segs,tcp_lost_retransmit\n" +
+		"foo-r1,64,1,5.15,a=b,100,,,,,,,10,,,,\n" +
+		"foo-r2,,2,,,200,,,,,,,,,,3,\n"
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+}
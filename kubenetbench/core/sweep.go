@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SweepProgress records the completed iterations of a sweep (e.g., the
+// repeats of a benchmark) in the session, with their run ids, so that a sweep
+// that failed (e.g., on a transient cluster error, or because the CLI was
+// killed) can be resumed from where it failed.
+//
+// A sweep is identified by its arguments (the command and the effective
+// value of every flag, see the reproducer): the progress file of a sweep is
+// sweep-<hash of the arguments>.progress, with a line per completed
+// iteration: <iteration> <run id>.
+type SweepProgress struct {
+	fname string
+	done  map[string]string // run ids of the completed iterations
+}
+
+// sweepKey returns the key (short hash) of the arguments of a sweep
+func sweepKey(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+// SweepProgress returns the progress of the sweep with the given arguments.
+// If resume is false, the progress of earlier executions of the sweep is
+// discarded, and the sweep starts from scratch.
+func (s *Session) SweepProgress(args []string, resume bool) (*SweepProgress, error) {
+	p := &SweepProgress{
+		fname: filepath.Join(s.dir, fmt.Sprintf("sweep-%s.progress", sweepKey(args))),
+		done:  map[string]string{},
+	}
+	if !resume {
+		f, err := os.Create(p.fname)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		_, err = fmt.Fprintf(f, "# %s\n", strings.Join(args, " "))
+		return p, err
+	}
+
+	f, err := os.Open(p.fname)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no progress of the sweep to resume in the session (the arguments must be the same)")
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		p.done[fields[0]] = fields[1]
+	}
+	return p, scanner.Err()
+}
+
+// Completed returns the result of an iteration of the sweep, if it was
+// completed (and its result is still in the session)
+func (p *SweepProgress) Completed(iter string) (*BenchResult, bool) {
+	runid, ok := p.done[iter]
+	if !ok {
+		return nil, false
+	}
+	res, err := loadRunResult(filepath.Join(filepath.Dir(p.fname), runid))
+	if err != nil {
+		logger().Warn("result of a completed sweep iteration not found: running it again", "iteration", iter, "run", runid, "error", err)
+		return nil, false
+	}
+	return res, true
+}
+
+// DiscardIncomplete removes the run directory of an iteration of the sweep
+// that did not complete (e.g., it failed), if it exists, so that the iteration
+// can be run again with the same (fixed) run id
+func (p *SweepProgress) DiscardIncomplete(iter, runid string) error {
+	if err := ValidateRunID(runid); err != nil {
+		return err
+	}
+	if _, ok := p.Completed(iter); ok {
+		return fmt.Errorf("iteration %s of the sweep was completed", iter)
+	}
+	dir := filepath.Join(filepath.Dir(p.fname), runid)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	logger().Info("removing the incomplete run of the sweep", "iteration", iter, "run", runid)
+	return os.RemoveAll(dir)
+}
+
+// MarkDone records that an iteration of the sweep was completed by a run
+func (p *SweepProgress) MarkDone(iter string, runid string) error {
+	f, err := os.OpenFile(p.fname, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p.done[iter] = runid
+	_, err = fmt.Fprintf(f, "%s %s\n", iter, runid)
+	return err
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSweepProgress(t *testing.T) {
+	sess, err := NewSession("test", t.TempDir(), false, false, DefaultLabelPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(sess.Dir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"pod2pod", "--repeat=3", "--netperf-type=tcp_stream"}
+
+	if _, err := sess.SweepProgress(args, true); err == nil {
+		t.Errorf("expected no progress to resume")
+	}
+
+	p, err := sess.SweepProgress(args, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range []string{"pod2pod-1-r1", "pod2pod-1-r2"} {
+		dir := filepath.Join(sess.Dir(), run)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "result"), []byte("THROUGHPUT=9000\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.MarkDone("r1", "pod2pod-1-r1"); err != nil {
+		t.Fatal(err)
+	}
+	// r2 completed, but its result was removed
+	if err := p.MarkDone("r2", "pod2pod-1-r2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(sess.Dir(), "pod2pod-1-r2", "result")); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = sess.SweepProgress(args, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, ok := p.Completed("r1"); !ok || res.RunID != "pod2pod-1-r1" || res.Values["THROUGHPUT"] != "9000" {
+		t.Errorf("expected r1 to be completed, got %v", res)
+	}
+	for _, iter := range []string{"r2", "r3"} {
+		if _, ok := p.Completed(iter); ok {
+			t.Errorf("%s: unexpected completed iteration", iter)
+		}
+	}
+
+	// the directories of incomplete iterations are removed on resume
+	if err := p.DiscardIncomplete("r1", "pod2pod-1-r1"); err == nil {
+		t.Errorf("expected error discarding a completed iteration")
+	}
+	if err := p.DiscardIncomplete("r2", "pod2pod-1-r2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(sess.Dir(), "pod2pod-1-r2")); !os.IsNotExist(err) {
+		t.Errorf("expected the incomplete run to be removed: %v", err)
+	}
+	if err := p.DiscardIncomplete("r3", "pod2pod-1-r3"); err != nil {
+		t.Error(err)
+	}
+
+	// other arguments are another sweep
+	if _, err := sess.SweepProgress(append(args, "--socket-buffer=4M"), true); err == nil {
+		t.Errorf("expected no progress to resume for other arguments")
+	}
+
+	// starting the sweep again discards its progress
+	if _, err := sess.SweepProgress(args, false); err != nil {
+		t.Fatal(err)
+	}
+	p, err = sess.SweepProgress(args, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Completed("r1"); ok {
+		t.Errorf("unexpected completed iteration")
+	}
+}
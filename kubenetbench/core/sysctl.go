@@ -0,0 +1,130 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Sysctl is a sysctl set in a pod (securityContext.sysctls)
+type Sysctl struct {
+	Name  string // e.g., net.ipv4.tcp_rmem
+	Value string // e.g., 4096 131072 6291456
+}
+
+func (s Sysctl) String() string {
+	return s.Name + "=" + s.Value
+}
+
+// safeSysctls are the sysctls that the kubelet allows by default. Other
+// (unsafe) sysctls must be allowed by the kubelet of the node
+// (--allowed-unsafe-sysctls, or allowedUnsafeSysctls in its configuration).
+var safeSysctls = map[string]struct{}{
+	"kernel.shm_rmid_forced":              {},
+	"net.ipv4.ip_local_port_range":        {},
+	"net.ipv4.ip_local_reserved_ports":    {},
+	"net.ipv4.ip_unprivileged_port_start": {},
+	"net.ipv4.ping_group_range":           {},
+	"net.ipv4.tcp_syncookies":             {},
+	"net.ipv4.tcp_keepalive_time":         {},
+	"net.ipv4.tcp_fin_timeout":            {},
+	"net.ipv4.tcp_keepalive_intvl":        {},
+	"net.ipv4.tcp_keepalive_probes":       {},
+}
+
+// namespacedSysctlPrefixes are the prefixes of the sysctls that can be set
+// per pod, i.e., that are namespaced (IPC and network namespaces)
+var namespacedSysctlPrefixes = []string{"kernel.shm", "kernel.msg", "kernel.sem", "fs.mqueue.", "net."}
+
+// e.g., net.ipv4.conf.eth0.rp_filter
+var sysctlNameRegEx = regexp.MustCompile(`^([a-z0-9]([-_a-z0-9]*[a-z0-9])?\.)*[a-z0-9]([-_a-z0-9]*[a-z0-9])?$`)
+
+// ParseSysctl parses a pod sysctl: <name>=<value> (e.g.,
+// net.ipv4.tcp_rmem=4096 131072 6291456). Only namespaced sysctls can be set
+// per pod.
+func ParseSysctl(s string) (Sysctl, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return Sysctl{}, fmt.Errorf("invalid sysctl %q: expecting <name>=<value>", s)
+	}
+	name = strings.TrimSpace(name)
+	if len(name) > 253 || !sysctlNameRegEx.MatchString(name) {
+		return Sysctl{}, fmt.Errorf("invalid sysctl name %q", name)
+	}
+	namespaced := false
+	for _, p := range namespacedSysctlPrefixes {
+		namespaced = namespaced || strings.HasPrefix(name, p)
+	}
+	if !namespaced {
+		return Sysctl{}, fmt.Errorf("sysctl %s is not namespaced: it cannot be set per pod (namespaced sysctls: %s*)", name, strings.Join(namespacedSysctlPrefixes, "*, "))
+	}
+	return Sysctl{Name: name, Value: strings.TrimSpace(value)}, nil
+}
+
+// ValidateSysctls checks the sysctls of the spec. Sysctls of the network
+// namespace cannot be set in pods on the host network.
+func (s *ContainerSpec) ValidateSysctls() error {
+	seen := map[string]bool{}
+	for _, sc := range s.Sysctls {
+		if seen[sc.Name] {
+			return fmt.Errorf("sysctl %s is set more than once", sc.Name)
+		}
+		seen[sc.Name] = true
+		if s.HostNetwork && strings.HasPrefix(sc.Name, "net.") {
+			return fmt.Errorf("sysctl %s cannot be set in a pod on the host network", sc.Name)
+		}
+	}
+	return nil
+}
+
+// UnsafeSysctls returns the (sorted) names of the sysctls of the spec that
+// the kubelet does not allow by default (see safeSysctls)
+func (s *ContainerSpec) UnsafeSysctls() []string {
+	ret := []string{}
+	for _, sc := range s.Sysctls {
+		if _, ok := safeSysctls[sc.Name]; !ok {
+			ret = append(ret, sc.Name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sysctlForbiddenReason is the reason of pods that the kubelet rejected
+// because of sysctls that it does not allow
+const sysctlForbiddenReason = "SysctlForbidden"
+
+// sysctlForbidden returns an error for the first pod that was rejected by the
+// kubelet of its node because of its sysctls, given the (name, node, role,
+// reason) of the pods of the run, with the sysctls that the kubelet needs to
+// allow
+func sysctlForbidden(pods [][]string, cli, srv *ContainerSpec) error {
+	for _, p := range pods {
+		if len(p) != 4 || p[3] != sysctlForbiddenReason {
+			continue
+		}
+		spec := srv
+		if p[2] == "cli" {
+			spec = cli
+		}
+		return fmt.Errorf("pod %s was rejected by the kubelet of node %s (%s): the kubelet must allow its unsafe sysctls, e.g., with --allowed-unsafe-sysctls=%s (allowedUnsafeSysctls in the kubelet configuration)",
+			p[0], p[1], sysctlForbiddenReason, strings.Join(spec.UnsafeSysctls(), ","))
+	}
+	return nil
+}
+
+// checkSysctlForbidden returns an error if a pod of the run was rejected by
+// the kubelet of its node because of its sysctls (see sysctlForbidden). It is
+// a no-op if the pods have no sysctls.
+func (r *RunBenchCtx) checkSysctlForbidden() error {
+	if len(r.cliSpec.Sysctls) == 0 && len(r.srvSpec.Sysctls) == 0 {
+		return nil
+	}
+	podsinfo, err := r.KubeGetPods__([]string{PodName, PodNodeName, PodRole, PodReason})
+	if err != nil {
+		logger().Warn("failed to get run pods", "error", err)
+		return nil
+	}
+	return sysctlForbidden(podsinfo, r.cliSpec, r.srvSpec)
+}
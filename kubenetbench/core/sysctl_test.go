@@ -0,0 +1,101 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+func TestParseSysctl(t *testing.T) {
+	sc, err := ParseSysctl("net.ipv4.tcp_rmem=4096 131072 6291456")
+	if err != nil || sc.Name != "net.ipv4.tcp_rmem" || sc.Value != "4096 131072 6291456" {
+		t.Errorf("unexpected result: %+v %v", sc, err)
+	}
+
+	for _, arg := range []string{
+		"net.ipv4.tcp_rmem",
+		"net.ipv4.tcp_rmem=",
+		"net..core=1",
+		"Net.core.somaxconn=1",
+		"vm.swappiness=10", // not namespaced
+		"kernel.pid_max=100000",
+	} {
+		if _, err := ParseSysctl(arg); err == nil {
+			t.Errorf("%q: expected error", arg)
+		}
+	}
+}
+
+func TestValidateSysctls(t *testing.T) {
+	rmem := Sysctl{Name: "net.ipv4.tcp_rmem", Value: "4096 131072 6291456"}
+	shm := Sysctl{Name: "kernel.shm_rmid_forced", Value: "1"}
+
+	spec := &ContainerSpec{Sysctls: []Sysctl{rmem, shm}}
+	if err := spec.ValidateSysctls(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if unsafe := spec.UnsafeSysctls(); len(unsafe) != 1 || unsafe[0] != rmem.Name {
+		t.Errorf("unexpected unsafe sysctls: %v", unsafe)
+	}
+
+	spec = &ContainerSpec{Sysctls: []Sysctl{rmem, rmem}}
+	if err := spec.ValidateSysctls(); err == nil {
+		t.Errorf("duplicate sysctl: expected error")
+	}
+	spec = &ContainerSpec{Sysctls: []Sysctl{rmem}, HostNetwork: true}
+	if err := spec.ValidateSysctls(); err == nil {
+		t.Errorf("net sysctl on the host network: expected error")
+	}
+	spec = &ContainerSpec{Sysctls: []Sysctl{shm}, HostNetwork: true}
+	if err := spec.ValidateSysctls(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPodSecurityWriteSysctls(t *testing.T) {
+	spec := &ContainerSpec{
+		Restricted: true,
+		RunAsUser:  DefaultRunAsUser,
+		Sysctls:    []Sysctl{{Name: "net.ipv4.tcp_rmem", Value: "4096 131072 6291456"}},
+	}
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	spec.podSecurityWrite(pw, nil)
+	pw.Done()
+	expected := `securityContext:
+  runAsNonRoot: true
+  runAsUser: 65534
+  seccompProfile:
+    type: RuntimeDefault
+  sysctls:
+  - name: net.ipv4.tcp_rmem
+    value: "4096 131072 6291456"
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwhile expected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestSysctlForbidden(t *testing.T) {
+	cli := &ContainerSpec{Sysctls: []Sysctl{{Name: "net.core.somaxconn", Value: "4096"}}}
+	srv := &ContainerSpec{Sysctls: []Sysctl{
+		{Name: "net.ipv4.tcp_wmem", Value: "4096 16384 4194304"},
+		{Name: "net.ipv4.tcp_syncookies", Value: "0"}, // safe
+	}}
+
+	pods := [][]string{
+		{"knb-cli", "k8s1", "cli", "<none>"},
+		{"knb-srv", "k8s2", "srv", "<none>"},
+	}
+	if err := sysctlForbidden(pods, cli, srv); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	pods[1][3] = sysctlForbiddenReason
+	err := sysctlForbidden(pods, cli, srv)
+	if err == nil || !strings.Contains(err.Error(), "k8s2") || !strings.Contains(err.Error(), "--allowed-unsafe-sysctls=net.ipv4.tcp_wmem ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ParseTag parses a key=value tag. Tags are descriptive metadata (e.g.,
+// kernel=5.15) that are stored verbatim with the run results.
+func ParseTag(s string) (string, string, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", fmt.Errorf("invalid tag %q (expected key=value)", s)
+	}
+	if strings.ContainsAny(s, "\n\r") {
+		return "", "", fmt.Errorf("invalid tag %q (newlines are not allowed)", s)
+	}
+	return kv[0], kv[1], nil
+}
+
+func (r *RunBenchCtx) tagsFname() string {
+	return fmt.Sprintf("%s/tags", r.getDir())
+}
+
+// AddTag records a tag of the run (see ParseTag). Tags do not affect the run,
+// they are included in its results (BenchResult.Tags) and in the session
+// summary (see Summarize).
+func (r *RunBenchCtx) AddTag(key, value string) error {
+	f, err := os.OpenFile(r.tagsFname(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s=%s\n", key, value)
+	return err
+}
+
+// readTagsFile reads a tags file (see AddTag). A missing file means no tags.
+func readTagsFile(fname string) (map[string]string, error) {
+	tags := make(map[string]string)
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return tags, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, err := ParseTag(scanner.Text())
+		if err != nil {
+			continue
+		}
+		tags[key] = value
+	}
+	return tags, scanner.Err()
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// TargetSt is the state of a benchmark against an existing server: a Service
+// or a Pod (in the server namespace) that kubenetbench does not deploy. Only
+// the client is deployed, and it connects to the address of the target on a
+// port given by number or by name (e.g., http), which is resolved from the
+// spec of the target, since its number may differ across environments.
+type TargetSt struct {
+	RunBenchCtx *RunBenchCtx
+	Target      string // service/<name> or pod/<name>
+	Port        string // port number or name
+}
+
+// target kinds (see ParseTarget)
+const (
+	targetService = "service"
+	targetPod     = "pod"
+)
+
+// ParseTarget parses a target of the form service/<name> or pod/<name>, and
+// returns its kind and name. The name is a DNS subdomain, since it is part of
+// the kubectl command that resolves the target.
+func ParseTarget(target string) (string, string, error) {
+	kind, name, ok := strings.Cut(target, "/")
+	switch {
+	case !ok || name == "":
+		return "", "", fmt.Errorf("invalid target %q: expecting service/<name> or pod/<name>", target)
+	case kind == "svc":
+		kind = targetService
+	case kind != targetService && kind != targetPod:
+		return "", "", fmt.Errorf("invalid target kind %q: expecting service or pod", kind)
+	}
+	if len(name) > 253 || !labelDomainRegEx.MatchString(name) {
+		return "", "", fmt.Errorf("invalid target name %q", name)
+	}
+	return kind, name, nil
+}
+
+// targetSpec is the part of a Service or a Pod (as printed by kubectl get -o
+// json) that the address and the ports of a target are resolved from
+type targetSpec struct {
+	Spec struct {
+		ClusterIP string `json:"clusterIP"`
+		Ports     []struct {
+			Name string `json:"name"`
+			Port uint16 `json:"port"`
+		} `json:"ports"`
+		Containers []struct {
+			Ports []struct {
+				Name          string `json:"name"`
+				ContainerPort uint16 `json:"containerPort"`
+			} `json:"ports"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		PodIP string `json:"podIP"`
+	} `json:"status"`
+}
+
+// resolveTarget returns the address and the port of a target, given the JSON
+// of its Service or Pod. Named ports are the ports of the Service (the port
+// clients connect to, not its targetPort), or the container ports of the Pod.
+func resolveTarget(kind, name string, data []byte, port string) (string, uint16, error) {
+	var obj targetSpec
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", 0, fmt.Errorf("failed to parse %s %s: %w", kind, name, err)
+	}
+
+	ip := obj.Status.PodIP
+	ports := map[string]uint16{}
+	if kind == targetService {
+		ip = obj.Spec.ClusterIP
+		for _, p := range obj.Spec.Ports {
+			if p.Name != "" {
+				ports[p.Name] = p.Port
+			}
+		}
+	} else {
+		for _, c := range obj.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name != "" {
+					ports[p.Name] = p.ContainerPort
+				}
+			}
+		}
+	}
+	if ip == "" || ip == "None" {
+		return "", 0, fmt.Errorf("%s %s has no address (headless services are not supported: use pod/<name>)", kind, name)
+	}
+
+	if n, err := strconv.ParseUint(port, 10, 16); err == nil && n > 0 {
+		return ip, uint16(n), nil
+	}
+	if n, ok := ports[port]; ok {
+		return ip, n, nil
+	}
+	names := make([]string, 0, len(ports))
+	for n := range ports {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return "", 0, fmt.Errorf("%s %s has no port named %q (named ports: %s)", kind, name, port, strings.Join(names, ", "))
+}
+
+// resolve returns the address and the port of the target
+func (s *TargetSt) resolve(ctx context.Context) (string, uint16, error) {
+	kind, name, err := ParseTarget(s.Target)
+	if err != nil {
+		return "", 0, err
+	}
+	cmd := fmt.Sprintf("kubectl get %s%s %s -o json", kind, nsArg(s.RunBenchCtx.srvSpec.Namespace), name)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLinesContext(ctx, cmd)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get target %s: %w", s.Target, err)
+	}
+	return resolveTarget(kind, name, []byte(strings.Join(lines, "\n")), s.Port)
+}
+
+// Execute target command
+func (s TargetSt) Execute() error {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the run, bounded by ctx
+func (s TargetSt) ExecuteContext(ctx context.Context) error {
+	r := s.RunBenchCtx
+	if _, ok := r.benchmark.(*CustomConf); !ok {
+		return fmt.Errorf("only the custom benchmark can target an existing server")
+	}
+
+	srvIP, srvPort, err := s.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	logger().Info("target address", "target", s.Target, "server_ip", srvIP, "server_port", srvPort)
+	r.addMeta("TARGET", s.Target)
+	r.addMeta("TARGET_PORT", strconv.Itoa(int(srvPort)))
+
+	if err := r.prepareBenchmark(); err != nil {
+		return err
+	}
+	if err := r.preflightPing(ctx, srvIP, srvPort); err != nil {
+		return err
+	}
+
+	cliYamlFname, err := r.genCliYamlParams(map[string]interface{}{"serverIP": srvIP, "serverPort": srvPort})
+	if err != nil {
+		return err
+	}
+	if err := r.KubeApply(cliYamlFname); err != nil {
+		return fmt.Errorf("failed to initiate client: %w", err)
+	}
+
+	cliSelector := fmt.Sprintf("%s,role=cli", r.getRunLabel("="))
+	defer func() {
+		r.KubeSaveLogs(r.cliSpec.Namespace, cliSelector, fmt.Sprintf("%s/cli.log", r.getDir()))
+		r.KubeCleanup()
+	}()
+
+	return r.finalizeAndWait(ctx)
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+const targetServiceJSON = `{
+  "kind": "Service",
+  "spec": {
+    "clusterIP": "10.96.12.34",
+    "ports": [
+      {"name": "http", "port": 80, "targetPort": 8080},
+      {"name": "metrics", "port": 9090, "targetPort": "metrics"}
+    ]
+  }
+}`
+
+const targetPodJSON = `{
+  "kind": "Pod",
+  "spec": {
+    "containers": [
+      {"name": "app", "ports": [{"name": "http", "containerPort": 8080}]},
+      {"name": "sidecar", "ports": [{"name": "admin", "containerPort": 15000}]}
+    ]
+  },
+  "status": {"podIP": "10.0.1.7"}
+}`
+
+func TestResolveTarget(t *testing.T) {
+	for _, tt := range []struct {
+		kind, data, port string
+		ip               string
+		n                uint16
+	}{
+		{targetService, targetServiceJSON, "http", "10.96.12.34", 80},
+		{targetService, targetServiceJSON, "metrics", "10.96.12.34", 9090},
+		{targetService, targetServiceJSON, "8443", "10.96.12.34", 8443},
+		{targetPod, targetPodJSON, "http", "10.0.1.7", 8080},
+		{targetPod, targetPodJSON, "admin", "10.0.1.7", 15000},
+	} {
+		ip, n, err := resolveTarget(tt.kind, "app", []byte(tt.data), tt.port)
+		if err != nil || ip != tt.ip || n != tt.n {
+			t.Errorf("%s %s: got %s:%d (%v) while expected %s:%d", tt.kind, tt.port, ip, n, err, tt.ip, tt.n)
+		}
+	}
+
+	_, _, err := resolveTarget(targetService, "app", []byte(targetServiceJSON), "grpc")
+	if err == nil || !strings.Contains(err.Error(), `no port named "grpc" (named ports: http, metrics)`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	headless := strings.Replace(targetServiceJSON, "10.96.12.34", "None", 1)
+	if _, _, err := resolveTarget(targetService, "app", []byte(headless), "http"); err == nil {
+		t.Errorf("expected error for a headless service")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	if kind, name, err := ParseTarget("svc/web"); err != nil || kind != targetService || name != "web" {
+		t.Errorf("unexpected target: %s %s %v", kind, name, err)
+	}
+	for _, target := range []string{"web", "pod/", "deployment/web", "pod/Web", "svc/web;id", "svc/$(id)", "pod/web -o yaml"} {
+		if _, _, err := ParseTarget(target); err == nil {
+			t.Errorf("%s: expected error", target)
+		}
+	}
+}
+
+func TestCustomServerPortEnv(t *testing.T) {
+	var buf bytes.Buffer
+	pw := utils.NewPrefixWriter(&buf, false)
+	(&CustomConf{Image: "busybox", CliCmd: "true"}).WriteCliContainerYaml(pw, map[string]interface{}{"serverIP": "10.0.1.7", "serverPort": uint16(8080)})
+	pw.Done()
+	if !strings.Contains(buf.String(), "- name: KNB_SERVER_PORT\n  value: \"8080\"\n") {
+		t.Errorf("unexpected client container:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// TLSModes are the supported TLS modes of the http benchmark
+var TLSModes = []string{"tls", "mtls"}
+
+const (
+	// name of the generated TLS secret
+	tlsSecretName = "knb-tls"
+	// mount path of the TLS secret in the benchmark containers
+	tlsMountPath = "/etc/knb-tls"
+	// validity of the generated certificates
+	tlsCertValidity = 7 * 24 * time.Hour
+	// (local) port of the client's mTLS proxy
+	mtlsProxyPort = 8080
+)
+
+// ValidateTLS checks the TLS options of the benchmark
+func (cnf *HTTPConf) ValidateTLS() error {
+	if cnf.TLS == "" {
+		if cnf.TLSSecret != "" {
+			return fmt.Errorf("a TLS secret requires a TLS mode")
+		}
+		return nil
+	}
+
+	for _, m := range TLSModes {
+		if m == cnf.TLS {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid TLS mode: %s (available values: tls,mtls)", cnf.TLS)
+}
+
+// tlsCerts holds PEM-encoded certificates and key
+type tlsCerts struct {
+	cert, key, ca []byte
+}
+
+// generateTLSCerts generates a self-signed CA, and a certificate signed by it
+// that is used both by the server and (for mTLS) by the client
+func generateTLSCerts(hosts []string) (*tlsCerts, error) {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(tlsCertValidity)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubenetbench CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caTmpl, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsCerts{
+		cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		ca:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}),
+	}, nil
+}
+
+var tlsSecretYamlTemplate = template.Must(template.New("tls-secret").Parse(`{{range .namespaces}}---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{$.name}}
+  {{if .}}namespace: {{.}}{{end}}
+  labels:
+    {{$.sessLabel}}
+    {{$.runLabel}}
+type: kubernetes.io/tls
+data:
+  tls.crt: {{$.cert}}
+  tls.key: {{$.key}}
+  ca.crt: {{$.ca}}
+{{end}}`))
+
+// genTLSSecretYaml generates a TLS secret (in all the namespaces of the run)
+// with a self-signed certificate
+func (r *RunBenchCtx) genTLSSecretYaml() (string, error) {
+	hosts := []string{"knb-service"}
+	for _, ns := range r.namespaces() {
+		if ns != "" {
+			hosts = append(hosts, serviceFQDN("knb-service", ns))
+		}
+	}
+	certs, err := generateTLSCerts(hosts)
+	if err != nil {
+		return "", err
+	}
+
+	b64 := base64.StdEncoding.EncodeToString
+	vals := map[string]interface{}{
+		"name":       tlsSecretName,
+		"namespaces": r.namespaces(),
+		"sessLabel":  r.session.getSessionLabel(": "),
+		"runLabel":   r.getRunLabel(": "),
+		"cert":       b64(certs.cert),
+		"key":        b64(certs.key),
+		"ca":         b64(certs.ca),
+	}
+
+	yaml := fmt.Sprintf("%s/tls-secret.yaml", r.getDir())
+	logger().Info("generating yaml", "file", yaml)
+	f, err := os.OpenFile(yaml, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = tlsSecretYamlTemplate.Execute(f, vals)
+	return yaml, err
+}
+
+// PrepareRun creates the TLS secret (unless one was provided), and mounts it
+// into the client and the server containers
+func (cnf *HTTPConf) PrepareRun(r *RunBenchCtx) error {
+	if cnf.ProxyProtocol != "" {
+		r.addMeta("PROXY_PROTOCOL", cnf.ProxyProtocol)
+	}
+	if cnf.TLS == "" {
+		return nil
+	}
+
+	if err := r.mountTLSSecret(cnf.TLSSecret); err != nil {
+		return err
+	}
+	r.addMeta("TLS_MODE", cnf.TLS)
+	return nil
+}
+
+// mountTLSSecret creates a TLS secret (unless secret, the name of an existing
+// one, is not empty), and mounts it into the client and the server containers
+func (r *RunBenchCtx) mountTLSSecret(secret string) error {
+	if secret == "" {
+		yaml, err := r.genTLSSecretYaml()
+		if err != nil {
+			return fmt.Errorf("failed to generate TLS secret: %w", err)
+		}
+		err = r.KubeApply(yaml)
+		if err != nil {
+			return fmt.Errorf("failed to create TLS secret: %w", err)
+		}
+		secret = tlsSecretName
+	}
+
+	vol := Volume{Type: "secret", Source: secret, Target: tlsMountPath, ReadOnly: true}
+	r.cliSpec.Volumes = append(r.cliSpec.Volumes, vol)
+	r.srvSpec.Volumes = append(r.srvSpec.Volumes, vol)
+	r.addMeta("TLS_SECRET", secret)
+	return nil
+}
+
+// writeNginxSrvContainerYaml writes the server container: nginx terminating
+// TLS (and verifying client certificates for mTLS), and expecting a PROXY
+// protocol header if enabled
+func (cnf *HTTPConf) writeNginxSrvContainerYaml(pw *utils.PrefixWriter) {
+	listen := fmt.Sprintf("%d", cnf.Port)
+	if cnf.TLS != "" {
+		listen += " ssl"
+	}
+	if cnf.ProxyProtocol != "" {
+		// NB: nginx accepts both v1 and v2 headers
+		listen += " proxy_protocol"
+	}
+
+	pw.AppendNewLineOrDie(`name: http-srv`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`image: %s`, tlsProxyImage))
+	pw.AppendNewLineOrDie(`command: ["sh", "-c"]`)
+	pw.AppendNewLineOrDie(`args:`)
+	pw.AppendNewLineOrDie(`- |`)
+	pw.PushPrefix("  ")
+	pw.AppendNewLineOrDie(`cat > /tmp/nginx.conf <<'EOF'`)
+	pw.AppendNewLineOrDie(`worker_processes auto;`)
+	pw.AppendNewLineOrDie(`pid /tmp/nginx.pid;`)
+	pw.AppendNewLineOrDie(`error_log stderr;`)
+	pw.AppendNewLineOrDie(`events { worker_connections 4096; }`)
+	pw.AppendNewLineOrDie(`http {`)
+	pw.AppendNewLineOrDie(`  access_log off;`)
+	pw.AppendNewLineOrDie(`  server {`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    listen %s;`, listen))
+	if cnf.TLS != "" {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    ssl_certificate %s/tls.crt;`, tlsMountPath))
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    ssl_certificate_key %s/tls.key;`, tlsMountPath))
+		pw.AppendNewLineOrDie(`    ssl_protocols TLSv1.2 TLSv1.3;`)
+	}
+	if cnf.TLS == "mtls" {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`    ssl_client_certificate %s/ca.crt;`, tlsMountPath))
+		pw.AppendNewLineOrDie(`    ssl_verify_client on;`)
+	}
+	pw.AppendNewLineOrDie(`    location / { return 200 "kubenetbench\n"; }`)
+	pw.AppendNewLineOrDie(`  }`)
+	pw.AppendNewLineOrDie(`}`)
+	pw.AppendNewLineOrDie(`EOF`)
+	pw.AppendNewLineOrDie(`exec nginx -c /tmp/nginx.conf -g 'daemon off;'`)
+	pw.PopPrefix()
+}
+
+// writeMTLSProxy writes the client commands that start a local (plaintext)
+// proxy that forwards requests to addr using mTLS
+func writeMTLSProxy(pw *utils.PrefixWriter, addr string) {
+	pw.AppendNewLineOrDie(`cat > /tmp/proxy.conf <<'EOF'`)
+	pw.AppendNewLineOrDie(`worker_processes auto;`)
+	pw.AppendNewLineOrDie(`pid /tmp/proxy.pid;`)
+	pw.AppendNewLineOrDie(`error_log stderr;`)
+	pw.AppendNewLineOrDie(`events { worker_connections 4096; }`)
+	pw.AppendNewLineOrDie(`http {`)
+	pw.AppendNewLineOrDie(`  access_log off;`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`  upstream knb { server %s; keepalive 1024; }`, addr))
+	pw.AppendNewLineOrDie(`  server {`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`    listen 127.0.0.1:%d;`, mtlsProxyPort))
+	pw.AppendNewLineOrDie(`    location / {`)
+	pw.AppendNewLineOrDie(`      proxy_pass https://knb;`)
+	pw.AppendNewLineOrDie(`      proxy_http_version 1.1;`)
+	pw.AppendNewLineOrDie(`      proxy_set_header Connection "";`)
+	pw.AppendNewLineOrDie(fmt.Sprintf(`      proxy_ssl_certificate %s/tls.crt;`, tlsMountPath))
+	pw.AppendNewLineOrDie(fmt.Sprintf(`      proxy_ssl_certificate_key %s/tls.key;`, tlsMountPath))
+	pw.AppendNewLineOrDie(`      proxy_ssl_protocols TLSv1.2 TLSv1.3;`)
+	pw.AppendNewLineOrDie(`      proxy_ssl_session_reuse on;`)
+	pw.AppendNewLineOrDie(`    }`)
+	pw.AppendNewLineOrDie(`  }`)
+	pw.AppendNewLineOrDie(`}`)
+	pw.AppendNewLineOrDie(`EOF`)
+	pw.AppendNewLineOrDie(`nginx -c /tmp/proxy.conf || exit 1`)
+}
+
+// writeTLSInfo writes the client commands that print the negotiated TLS
+// version and cipher suite as TLS_VERSION=... and TLS_CIPHER=... lines
+func writeTLSInfo(pw *utils.PrefixWriter, addr string, mtls bool) {
+	certArgs := ""
+	if mtls {
+		certArgs = fmt.Sprintf(" -cert %s/tls.crt -key %s/tls.key", tlsMountPath, tlsMountPath)
+	}
+	pw.AppendNewLineOrDie(fmt.Sprintf(
+		`openssl s_client -connect %s -brief%s </dev/null 2>&1 | tr -d '\r' | sed -n -e 's/^Protocol version: */TLS_VERSION=/p' -e 's/^Ciphersuite: */TLS_CIPHER=/p'`,
+		addr, certArgs,
+	))
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// topoPod is a pod in the run topology
+type topoPod struct {
+	Name, Node, Role, IP string
+}
+
+// topoService is a service in the run topology
+type topoService struct {
+	Name, IP string
+}
+
+// SetTopologyDot makes the run write its topology (pods per node, services,
+// monitor pods, and traffic) as a Graphviz DOT graph to the given file
+func (r *RunBenchCtx) SetTopologyDot(fname string) {
+	r.topologyDot = fname
+}
+
+// writeTopologyDot writes the topology as a DOT graph. Pods are grouped by
+// node, and the traffic edges go from the clients to the services (if any)
+// and then to the servers.
+func writeTopologyDot(w io.Writer, name string, pods []topoPod, svcs []topoService) error {
+	q := func(s string) string { return fmt.Sprintf("%q", s) }
+
+	nodes := make(map[string][]topoPod)
+	for _, p := range pods {
+		nodes[p.Node] = append(nodes[p.Node], p)
+	}
+	nodeNames := make([]string, 0, len(nodes))
+	for n := range nodes {
+		nodeNames = append(nodeNames, n)
+	}
+	sort.Strings(nodeNames)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", q(name))
+	fmt.Fprintf(&b, "  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  node [shape=box, style=rounded];\n")
+	for i, n := range nodeNames {
+		label := n
+		if label == "" || label == "<none>" {
+			label = "(unscheduled)"
+		}
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&b, "    label=%s;\n", q("node: "+label))
+		for _, p := range nodes[n] {
+			attrs := ""
+			if p.Role == "monitor" {
+				attrs = ", style=dashed"
+			}
+			fmt.Fprintf(&b, "    %s [label=%s%s];\n", q("pod/"+p.Name), q(fmt.Sprintf("%s\\n%s\\n%s", p.Name, p.Role, p.IP)), attrs)
+		}
+		fmt.Fprintf(&b, "  }\n")
+	}
+
+	for _, s := range svcs {
+		fmt.Fprintf(&b, "  %s [shape=ellipse, label=%s];\n", q("svc/"+s.Name), q(fmt.Sprintf("%s\\n%s", s.Name, s.IP)))
+	}
+
+	var clients, servers []topoPod
+	for _, p := range pods {
+		switch p.Role {
+		case "cli", "netready":
+			clients = append(clients, p)
+		case "srv":
+			servers = append(servers, p)
+		}
+	}
+	for _, c := range clients {
+		if len(svcs) == 0 {
+			for _, s := range servers {
+				fmt.Fprintf(&b, "  %s -> %s [label=\"traffic\"];\n", q("pod/"+c.Name), q("pod/"+s.Name))
+			}
+			continue
+		}
+		for _, svc := range svcs {
+			fmt.Fprintf(&b, "  %s -> %s [label=\"traffic\"];\n", q("pod/"+c.Name), q("svc/"+svc.Name))
+		}
+	}
+	for _, svc := range svcs {
+		for _, s := range servers {
+			fmt.Fprintf(&b, "  %s -> %s;\n", q("svc/"+svc.Name), q("pod/"+s.Name))
+		}
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// getTopology returns the pods (including the monitor pods) and services of
+// the run
+func (r *RunBenchCtx) getTopology() ([]topoPod, []topoService, error) {
+	podsinfo, err := r.KubeGetPods__([]string{PodName, PodNodeName, ".metadata.labels.role", ".status.podIP"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods := []topoPod{}
+	for _, a := range podsinfo {
+		if len(a) != 4 {
+			continue
+		}
+		pods = append(pods, topoPod{Name: a[0], Node: a[1], Role: a[2], IP: a[3]})
+	}
+
+	if r.session.MonitorEnabled() {
+		cmd := fmt.Sprintf(
+			"kubectl get pod -l \"%s,%s\" -o custom-columns=Name:.metadata.name,Node:.spec.nodeName,IP:.status.podIP --no-headers",
+			r.session.monitorLabel("="), monitorSelector,
+		)
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLines(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			pods = append(pods, topoPod{Name: fields[0], Node: fields[1], Role: "monitor", IP: fields[2]})
+		}
+	}
+
+	svcs := []topoService{}
+	for _, ns := range r.namespaces() {
+		cmd := fmt.Sprintf(
+			"kubectl get service%s -l \"%s\" -o custom-columns=Name:.metadata.name,IP:.spec.clusterIP --no-headers",
+			nsArg(ns), r.getRunLabel("="),
+		)
+		logger().Debug("exec", "cmd", cmd)
+		lines, err := utils.ExecCmdLines(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			svcs = append(svcs, topoService{Name: fields[0], IP: fields[1]})
+		}
+	}
+
+	return pods, svcs, nil
+}
+
+// saveTopologyDot writes the run topology (see SetTopologyDot)
+func (r *RunBenchCtx) saveTopologyDot() error {
+	if r.topologyDot == "" {
+		return nil
+	}
+
+	pods, svcs, err := r.getTopology()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(r.topologyDot)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = writeTopologyDot(f, r.runid, pods, svcs)
+	if err != nil {
+		return err
+	}
+	logger().Info("run topology", "file", r.topologyDot)
+	return nil
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTopologyDot(t *testing.T) {
+	pods := []topoPod{
+		{Name: "knb-cli", Node: "k8s2", Role: "cli", IP: "10.0.1.5"},
+		{Name: "knb-srv-abc", Node: "k8s1", Role: "srv", IP: "10.0.0.7"},
+		{Name: "knb-monitor-x", Node: "k8s1", Role: "monitor", IP: "192.168.1.1"},
+	}
+
+	var b strings.Builder
+	if err := writeTopologyDot(&b, "foo", pods, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, s := range []string{
+		`digraph "foo" {`,
+		`label="node: k8s1";`,
+		`"pod/knb-monitor-x" [label="knb-monitor-x\\nmonitor\\n192.168.1.1", style=dashed];`,
+		`"pod/knb-cli" -> "pod/knb-srv-abc" [label="traffic"];`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in:\n%s", s, out)
+		}
+	}
+
+	b.Reset()
+	svcs := []topoService{{Name: "knb-service", IP: "10.96.0.10"}}
+	if err := writeTopologyDot(&b, "foo", pods, svcs); err != nil {
+		t.Fatal(err)
+	}
+	out = b.String()
+	for _, s := range []string{
+		`"pod/knb-cli" -> "svc/knb-service" [label="traffic"];`,
+		`"svc/knb-service" -> "pod/knb-srv-abc";`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in:\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, `"pod/knb-cli" -> "pod/knb-srv-abc"`) {
+		t.Errorf("unexpected direct edge with a service:\n%s", out)
+	}
+}
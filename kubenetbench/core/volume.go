@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+// VolumeTypes are the supported volume types
+var VolumeTypes = []string{"configmap", "secret", "emptydir", "hostpath"}
+
+// Volume is an extra volume mounted into a benchmark container
+type Volume struct {
+	Type     string // one of VolumeTypes
+	Source   string // configmap/secret name, or host path (empty for emptydir)
+	Target   string // mount path in the container
+	ReadOnly bool
+}
+
+// ParseVolume parses a volume specification of the form:
+// type=TYPE,source=SOURCE,target=PATH[,readonly]
+func ParseVolume(s string) (Volume, error) {
+	var v Volume
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		val := ""
+		if len(kv) == 2 {
+			val = strings.TrimSpace(kv[1])
+		}
+
+		switch key {
+		case "type":
+			v.Type = strings.ToLower(val)
+		case "source", "src":
+			v.Source = val
+		case "target", "dst":
+			v.Target = val
+		case "readonly", "ro":
+			v.ReadOnly = val == "" || val == "true"
+		default:
+			return v, fmt.Errorf("invalid volume option %q in %q", key, s)
+		}
+	}
+
+	valid := false
+	for _, t := range VolumeTypes {
+		valid = valid || t == v.Type
+	}
+	if !valid {
+		return v, fmt.Errorf("invalid volume type %q in %q (available values: %s)", v.Type, s, strings.Join(VolumeTypes, ","))
+	}
+
+	if v.Target == "" || !strings.HasPrefix(v.Target, "/") {
+		return v, fmt.Errorf("volume target must be an absolute path in %q", s)
+	}
+
+	switch {
+	case v.Type == "emptydir" && v.Source != "":
+		return v, fmt.Errorf("emptydir volumes have no source in %q", s)
+	case v.Type != "emptydir" && v.Source == "":
+		return v, fmt.Errorf("%s volumes require a source in %q", v.Type, s)
+	}
+
+	return v, nil
+}
+
+// volumeName returns the name of the i-th volume of the spec
+func volumeName(i int) string {
+	return fmt.Sprintf("knb-vol-%d", i)
+}
+
+// volumesWrite writes the pod's volumes (if any)
+func (s *ContainerSpec) volumesWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if len(s.Volumes) == 0 {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`volumes:`)
+	for i, v := range s.Volumes {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`- name: %s`, volumeName(i)))
+		switch v.Type {
+		case "configmap":
+			pw.AppendNewLineOrDie(`  configMap:`)
+			pw.AppendNewLineOrDie(fmt.Sprintf(`    name: %s`, v.Source))
+		case "secret":
+			pw.AppendNewLineOrDie(`  secret:`)
+			pw.AppendNewLineOrDie(fmt.Sprintf(`    secretName: %s`, v.Source))
+		case "emptydir":
+			pw.AppendNewLineOrDie(`  emptyDir: {}`)
+		case "hostpath":
+			pw.AppendNewLineOrDie(`  hostPath:`)
+			pw.AppendNewLineOrDie(fmt.Sprintf(`    path: %s`, v.Source))
+		}
+	}
+}
+
+// volumeMountsWrite writes the container's volume mounts (if any)
+func (s *ContainerSpec) volumeMountsWrite(pw *utils.PrefixWriter, params map[string]interface{}) {
+	if len(s.Volumes) == 0 {
+		return
+	}
+
+	pw.AppendNewLineOrDie(`volumeMounts:`)
+	for i, v := range s.Volumes {
+		pw.AppendNewLineOrDie(fmt.Sprintf(`- name: %s`, volumeName(i)))
+		pw.AppendNewLineOrDie(fmt.Sprintf(`  mountPath: %s`, v.Target))
+		if v.ReadOnly {
+			pw.AppendNewLineOrDie(`  readOnly: true`)
+		}
+	}
+}
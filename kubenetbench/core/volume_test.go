@@ -0,0 +1,35 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestParseVolume(t *testing.T) {
+	v, err := ParseVolume("type=configmap,source=cfg,target=/etc/gen,readonly")
+	if err != nil {
+		t.Fatalf("ParseVolume failed: %v", err)
+	}
+	if v != (Volume{Type: "configmap", Source: "cfg", Target: "/etc/gen", ReadOnly: true}) {
+		t.Errorf("unexpected volume: %+v", v)
+	}
+
+	v, err = ParseVolume("type=emptyDir,target=/shared")
+	if err != nil {
+		t.Fatalf("ParseVolume failed: %v", err)
+	}
+	if v.Type != "emptydir" || v.ReadOnly {
+		t.Errorf("unexpected volume: %+v", v)
+	}
+
+	for _, s := range []string{
+		"type=nfs,source=x,target=/x",
+		"type=secret,target=/x",
+		"type=emptydir,source=x,target=/x",
+		"type=hostpath,source=/x,target=x",
+		"type=hostpath,source=/x,target=/x,foo=bar",
+	} {
+		if _, err := ParseVolume(s); err == nil {
+			t.Errorf("ParseVolume(%q) succeeded while expected to fail", s)
+		}
+	}
+}
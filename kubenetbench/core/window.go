@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// settleTime is the time between the creation of the client and the start of
+// the measurement (see finalizeAndWait)
+const settleTime = 5 * time.Second
+
+// MeasureWindow is a slice of the traffic of a run: the results of the run
+// are computed over the window only (e.g., to exclude the ramp-up and
+// ramp-down of the traffic), and node data are collected during the window.
+type MeasureWindow struct {
+	Start  time.Duration // start of the window, since the start of the traffic
+	Length time.Duration
+}
+
+// ParseMeasureWindow parses a measurement window: <length>@<start> (e.g.,
+// 30s@45s for the 30 seconds starting 45 seconds into the traffic)
+func ParseMeasureWindow(s string) (MeasureWindow, error) {
+	var w MeasureWindow
+	length, start, ok := strings.Cut(s, "@")
+	if !ok {
+		return w, fmt.Errorf("invalid measurement window %q: expecting <length>@<start> (e.g., 30s@45s)", s)
+	}
+	var err error
+	if w.Length, err = time.ParseDuration(length); err != nil {
+		return w, fmt.Errorf("invalid measurement window length: %w", err)
+	}
+	if w.Start, err = time.ParseDuration(start); err != nil {
+		return w, fmt.Errorf("invalid measurement window start: %w", err)
+	}
+	if w.Length <= 0 || w.Start < 0 {
+		return w, fmt.Errorf("invalid measurement window %q: the length must be positive, and the start not negative", s)
+	}
+	return w, nil
+}
+
+func (w MeasureWindow) String() string {
+	return fmt.Sprintf("%s@%s", w.Length, w.Start)
+}
+
+// SetMeasureWindow sets the measurement window of the run. The window must be
+// within the traffic (the benchmark duration), and the benchmark must report
+// per-interval stats (see IntervalParser), which the results are computed
+// from.
+func (r *RunBenchCtx) SetMeasureWindow(w MeasureWindow) error {
+	traffic := time.Duration(r.benchmark.GetTimeout()) * time.Second
+	if w.Start+w.Length > traffic {
+		return fmt.Errorf("measurement window %s ends after the traffic (%s)", w, traffic)
+	}
+	if p, ok := r.benchmark.(IntervalParser); !ok || !p.HasIntervals() {
+		return fmt.Errorf("a measurement window requires per-interval stats (netperf stream benchmarks with a single stream, or custom benchmarks with --custom-intervals)")
+	}
+	r.window = &w
+	return nil
+}
+
+// windowTimes returns the time to wait, after the measurement starts, before
+// the node data collection, and the duration of the collection: the window,
+// or the whole traffic without a window. The traffic starts with the client,
+// about settleTime before the measurement, so the alignment is approximate.
+func (r *RunBenchCtx) windowTimes() (time.Duration, time.Duration) {
+	traffic := time.Duration(r.benchmark.GetTimeout()) * time.Second
+	if r.window == nil {
+		return 0, traffic
+	}
+	return max(r.window.Start-settleTime, 0), r.window.Length
+}
+
+// collectSeconds returns the duration (seconds) of the node data collection
+// (packet captures, socket samples, etc.)
+func (r *RunBenchCtx) collectSeconds() int {
+	_, d := r.windowTimes()
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// windowIntervals returns the intervals within a measurement window: the
+// intervals whose midpoint is in the window
+func windowIntervals(intervals []ResultInterval, w MeasureWindow) []ResultInterval {
+	start, end := w.Start.Seconds(), (w.Start + w.Length).Seconds()
+	ret := []ResultInterval{}
+	for _, intv := range intervals {
+		mid := intv.Start + intv.Seconds/2
+		if mid >= start && mid < end {
+			ret = append(ret, intv)
+		}
+	}
+	return ret
+}
+
+// windowValues returns the result values of a measurement window: the
+// throughput (THROUGHPUT, in 10^6bits/s) over the intervals of the window.
+// The throughput of the whole traffic is kept as TRAFFIC_THROUGHPUT (and
+// TRAFFIC_THROUGHPUT_UNITS).
+func windowValues(values map[string]string, intervals []ResultInterval, w MeasureWindow) (map[string]string, error) {
+	if len(intervals) == 0 {
+		return nil, fmt.Errorf("%w in the measurement window %s", errNoIntervals, w)
+	}
+	var bytes int64
+	var secs float64
+	for _, intv := range intervals {
+		bytes += intv.Bytes
+		secs += intv.Seconds
+	}
+
+	ret := map[string]string{}
+	for _, k := range []string{"THROUGHPUT", "THROUGHPUT_UNITS", "AGGREGATE_THROUGHPUT"} {
+		if v, ok := values[k]; ok {
+			ret["TRAFFIC_"+k] = v
+		}
+	}
+	ret["THROUGHPUT"] = fmt.Sprintf("%.2f", float64(bytes)*8/secs/1e6)
+	ret["THROUGHPUT_UNITS"] = "10^6bits/s"
+	ret["WINDOW_SECONDS"] = fmt.Sprintf("%.3f", secs)
+	return ret, nil
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseMeasureWindow(t *testing.T) {
+	w, err := ParseMeasureWindow("30s@45s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Length != 30*time.Second || w.Start != 45*time.Second {
+		t.Errorf("got %+v", w)
+	}
+	for _, s := range []string{"30s", "30@45s", "0s@10s", "10s@-1s"} {
+		if _, err := ParseMeasureWindow(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestWindowValues(t *testing.T) {
+	intervals := []ResultInterval{}
+	for i := 0; i < 10; i++ {
+		mbps := 1000.0
+		if i < 2 || i > 7 {
+			// ramp-up and ramp-down
+			mbps = 100
+		}
+		intervals = append(intervals, ResultInterval{
+			Index:   i,
+			Start:   float64(i),
+			Seconds: 1,
+			Bytes:   int64(mbps * 1e6 / 8),
+			Mbps:    mbps,
+		})
+	}
+
+	w := MeasureWindow{Start: 2 * time.Second, Length: 6 * time.Second}
+	windowed := windowIntervals(intervals, w)
+	if len(windowed) != 6 || windowed[0].Index != 2 {
+		t.Fatalf("got %+v", windowed)
+	}
+	values, err := windowValues(map[string]string{"THROUGHPUT": "820.00", "THROUGHPUT_UNITS": "10^6bits/s"}, windowed, w)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"THROUGHPUT":               "1000.00",
+		"THROUGHPUT_UNITS":         "10^6bits/s",
+		"TRAFFIC_THROUGHPUT":       "820.00",
+		"TRAFFIC_THROUGHPUT_UNITS": "10^6bits/s",
+		"WINDOW_SECONDS":           "6.000",
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("%s: got %q while expected %q", k, values[k], v)
+		}
+	}
+
+	_, err = windowValues(nil, windowIntervals(intervals, MeasureWindow{Start: 20 * time.Second, Length: time.Second}), w)
+	if !errors.Is(err, errNoIntervals) {
+		t.Errorf("expected errNoIntervals, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+const (
+	// topology keys of pod (anti-)affinities
+	nodeTopologyKey = "kubernetes.io/hostname"
+	zoneTopologyKey = "topology.kubernetes.io/zone"
+)
+
+// ZonePlacements are the supported zone placements of the client (see
+// ContainerSpec.ZonePlacement)
+var ZonePlacements = []string{"same", "cross"}
+
+// ValidateZonePlacement checks the zone placement of the client: in the same
+// zone as the server, or in a different (cross) zone, using the
+// topology.kubernetes.io/zone node label
+func (s *ContainerSpec) ValidateZonePlacement() error {
+	if s.ZonePlacement == "" {
+		return nil
+	}
+	valid := false
+	for _, p := range ZonePlacements {
+		valid = valid || p == s.ZonePlacement
+	}
+	if !valid {
+		return fmt.Errorf("invalid zone placement: %s (available values: %s)", s.ZonePlacement, strings.Join(ZonePlacements, ","))
+	}
+	if s.ZonePlacement == "cross" && s.Affinity == "same" {
+		return fmt.Errorf("cross-zone placement requires the client on a different node than the server")
+	}
+	return nil
+}
+
+// nodeZones returns the zones of the nodes (by node name), from the
+// topology.kubernetes.io/zone label. Nodes without the label are not
+// included.
+func nodeZones() (map[string]string, error) {
+	cmd := fmt.Sprintf(
+		"kubectl get nodes -o custom-columns=Name:.metadata.name,Zone:.metadata.labels.%s --no-headers",
+		strings.ReplaceAll(zoneTopologyKey, ".", `\.`),
+	)
+	logger().Debug("exec", "cmd", cmd)
+	lines, err := utils.ExecCmdLines(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseNodeZones(lines), nil
+}
+
+// parseNodeZones parses the (node, zone) lines of nodeZones
+func parseNodeZones(lines []string) map[string]string {
+	ret := map[string]string{}
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		if len(fields) == 2 && fields[1] != "<none>" {
+			ret[fields[0]] = fields[1]
+		}
+	}
+	return ret
+}
+
+// endpointZones returns the zones of the client and server endpoints, given
+// the (role, node) of the run pods and the zones of the nodes. With multiple
+// servers (e.g., service backends), their zones are comma-separated.
+func endpointZones(pods [][]string, zones map[string]string) (string, string) {
+	cli, srv := map[string]bool{}, map[string]bool{}
+	for _, p := range pods {
+		if len(p) != 2 {
+			continue
+		}
+		zone, ok := zones[p[1]]
+		if !ok {
+			continue
+		}
+		switch p[0] {
+		case "cli":
+			cli[zone] = true
+		case "srv":
+			srv[zone] = true
+		}
+	}
+	join := func(m map[string]bool) string {
+		ret := make([]string, 0, len(m))
+		for z := range m {
+			ret = append(ret, z)
+		}
+		sort.Strings(ret)
+		return strings.Join(ret, ",")
+	}
+	return join(cli), join(srv)
+}
+
+// recordZones records the zones of the client and the server, as the CLI_ZONE
+// and SRV_ZONE metadata, and whether the traffic crosses zones (CROSS_ZONE).
+// Nothing is recorded on clusters without zone labels.
+func (c *RunBenchCtx) recordZones() {
+	zones, err := nodeZones()
+	if err != nil {
+		logger().Warn("failed to get the zones of the nodes", "error", err)
+		return
+	}
+	pods, err := c.KubeGetPods__([]string{PodRole, PodNodeName})
+	if err != nil {
+		logger().Warn("failed to get the nodes of the run pods", "error", err)
+		return
+	}
+
+	cliZone, srvZone := endpointZones(pods, zones)
+	if cliZone == "" || srvZone == "" {
+		if c.cliSpec.ZonePlacement != "" {
+			logger().Warn("zone of the client or server is unknown", "label", zoneTopologyKey)
+		}
+		return
+	}
+	c.addMeta("CLI_ZONE", cliZone)
+	c.addMeta("SRV_ZONE", srvZone)
+	c.addMeta("CROSS_ZONE", fmt.Sprintf("%t", cliZone != srvZone))
+}
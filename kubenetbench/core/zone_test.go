@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cilium/kubenetbench/utils"
+)
+
+func TestZonePlacement(t *testing.T) {
+	render := func(cliAffinity string, zone string) string {
+		spec := &ContainerSpec{Affinity: cliAffinity, ZonePlacement: zone, AllowControlPlane: true}
+		if err := spec.ValidateZonePlacement(); err != nil {
+			t.Fatal(err)
+		}
+		r := &RunBenchCtx{
+			session: &Session{labelPrefix: DefaultLabelPrefix},
+			runid:   "r1",
+			cliSpec: spec,
+			srvSpec: &ContainerSpec{Affinity: "none"},
+		}
+		var buf bytes.Buffer
+		pw := utils.NewPrefixWriter(&buf, false)
+		r.cliAffinityWrite(pw, nil)
+		pw.Done()
+		return buf.String()
+	}
+
+	// cross zone implies a different node
+	out := render("different", "cross")
+	if !strings.Contains(out, "podAntiAffinity") || strings.Contains(out, "podAffinity") ||
+		!strings.Contains(out, `topologyKey: "topology.kubernetes.io/zone"`) || strings.Contains(out, "kubernetes.io/hostname") {
+		t.Errorf("unexpected cross-zone affinity:\n%s", out)
+	}
+
+	// same zone, different node
+	out = render("different", "same")
+	if !strings.Contains(out, "   podAffinity:\n") || !strings.Contains(out, "   podAntiAffinity:\n") ||
+		strings.Index(out, "topology.kubernetes.io/zone") > strings.Index(out, "kubernetes.io/hostname") {
+		t.Errorf("unexpected same-zone affinity:\n%s", out)
+	}
+
+	// same node implies the same zone
+	if out := render("same", "same"); strings.Contains(out, "topology.kubernetes.io/zone") {
+		t.Errorf("unexpected same-node affinity:\n%s", out)
+	}
+	if out := render("none", "same"); !strings.Contains(out, "podAffinity") || !strings.Contains(out, "topology.kubernetes.io/zone") {
+		t.Errorf("unexpected same-zone affinity:\n%s", out)
+	}
+
+	for _, spec := range []ContainerSpec{
+		{Affinity: "same", ZonePlacement: "cross"},
+		{Affinity: "different", ZonePlacement: "region"},
+	} {
+		if err := spec.ValidateZonePlacement(); err == nil {
+			t.Errorf("expected invalid zone placement: %+v", spec)
+		}
+	}
+}
+
+func TestEndpointZones(t *testing.T) {
+	zones := parseNodeZones([]string{"node-a   us-east-1a", "node-b   us-east-1b", "node-c   <none>", "node-d   us-east-1a"})
+	if len(zones) != 3 {
+		t.Fatalf("unexpected zones: %v", zones)
+	}
+
+	pods := [][]string{{"cli", "node-a"}, {"srv", "node-b"}, {"srv", "node-d"}, {"srv", "node-b"}}
+	cli, srv := endpointZones(pods, zones)
+	if cli != "us-east-1a" || srv != "us-east-1a,us-east-1b" {
+		t.Errorf("unexpected zones: client %q, server %q", cli, srv)
+	}
+
+	// unlabeled node
+	if cli, _ := endpointZones([][]string{{"cli", "node-c"}}, zones); cli != "" {
+		t.Errorf("unexpected client zone: %q", cli)
+	}
+}
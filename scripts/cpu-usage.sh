@@ -0,0 +1,75 @@
+#!/bin/sh
+
+timeout=$1
+xid=$2
+pods=$3
+
+if [ -z $xid ]; then
+    echo "Usage: $0 <timeout> <xid> [<pod>=<uid>,...]"
+    exit 1
+fi
+
+# the monitor mounts the host root at /host: use the host cgroup hierarchy
+# (/proc/stat is not namespaced)
+cgdir=/sys/fs/cgroup
+if [ -d /host$cgdir ]; then
+    cgdir=/host$cgdir
+fi
+
+hz=$(getconf CLK_TCK 2>/dev/null || echo 100)
+
+# find the (pod-level) cgroup of a pod by its uid: the directory name contains
+# the uid, with dashes (cgroupfs) or underscores (systemd)
+pod_cgroup() {
+    uid=$1
+    uid_=$(echo $uid | tr - _)
+    find $2 -maxdepth 6 -type d \( -name "*pod$uid" -o -name "*pod$uid_.slice" \) 2>/dev/null | awk '{ print length, $0 }' | sort -n | head -1 | cut -d' ' -f2-
+}
+
+# print <scope>/<counter> <usec> lines: the host CPU time (/proc/stat) by
+# category, the elapsed time (/proc/uptime), and the CPU time of the pods
+snapshot() {
+    awk -v hz=$hz '$1 == "cpu" {
+        f = 1000000 / hz
+        printf "host/user %.0f\n", ($2 + $3) * f
+        printf "host/system %.0f\n", $4 * f
+        printf "host/idle %.0f\n", ($5 + $6) * f
+        printf "host/irq %.0f\n", $7 * f
+        printf "host/softirq %.0f\n", $8 * f
+        printf "host/steal %.0f\n", $9 * f
+    }' /proc/stat
+    awk '{ printf "host/elapsed %.0f\n", $1 * 1000000 }' /proc/uptime
+    grep -c '^cpu[0-9]' /proc/stat | awk '{ print "host/ncpus", $1 }'
+
+    for p in $(echo $pods | tr , ' '); do
+        name=${p%%=*}
+        uid=${p#*=}
+        if [ -f $cgdir/cgroup.controllers ]; then
+            # cgroup v2
+            cg=$(pod_cgroup $uid $cgdir)
+            [ -n "$cg" ] && [ -f $cg/cpu.stat ] || continue
+            awk -v p=pod/$name '$1 == "usage_usec" { print p "/usage", $2 }
+                                $1 == "user_usec" { print p "/user", $2 }
+                                $1 == "system_usec" { print p "/system", $2 }' $cg/cpu.stat
+        else
+            # cgroup v1
+            for d in $cgdir/cpuacct $cgdir/cpu,cpuacct; do
+                [ -d $d ] && break
+            done
+            cg=$(pod_cgroup $uid $d)
+            [ -n "$cg" ] && [ -f $cg/cpuacct.usage ] || continue
+            awk -v p=pod/$name '{ printf "%s/usage %.0f\n", p, $1 / 1000 }' $cg/cpuacct.usage
+            awk -v p=pod/$name -v hz=$hz '{ printf "%s/%s %.0f\n", p, $1, $2 * 1000000 / hz }' $cg/cpuacct.stat
+        fi
+    done
+}
+
+snapshot > /tmp/$xid-cpu-before.txt
+sleep $timeout
+snapshot > /tmp/$xid-cpu-after.txt
+
+# <counter> <before> <after> <delta>
+awk 'NR == FNR { before[$1] = $2; next }
+     ($1 in before) { print $1, before[$1], $2, $2 - before[$1] }' \
+    /tmp/$xid-cpu-before.txt /tmp/$xid-cpu-after.txt > /tmp/$xid-cpu.txt
+exit 0
@@ -0,0 +1,37 @@
+#!/bin/sh
+
+timeout=$1
+xid=$2
+label=$3
+
+if [ -z $label ]; then
+    echo "Usage: $0 <timeout> <xid> <label>"
+    exit 1
+fi
+
+# the monitor mounts the host root at /host, and the cilium agent serves the
+# (node-local) hubble API on a unix socket
+sock=/var/run/cilium/hubble.sock
+if [ ! -S $sock ] && [ -S /host$sock ]; then
+    sock=/host$sock
+fi
+
+out=/tmp/$xid-hubble.json
+if ! command -v hubble >/dev/null; then
+    echo "# hubble CLI not available" > $out
+    exit 0
+fi
+if [ ! -S $sock ]; then
+    echo "# hubble not available on the node (no $sock)" > $out
+    exit 0
+fi
+
+# flows from or to the benchmark pods, one JSON object per line
+timeout $timeout hubble observe --server unix://$sock --follow --label "$label" -o jsonpb > $out 2>/tmp/$xid-hubble.err
+rc=$?
+# timeout(1) exits with 124 when it stops hubble
+if [ $rc -ne 0 ] && [ $rc -ne 124 ]; then
+    echo "# hubble observe failed: $(cat /tmp/$xid-hubble.err)" >> $out
+fi
+rm -f /tmp/$xid-hubble.err
+exit 0
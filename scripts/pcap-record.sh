@@ -0,0 +1,19 @@
+#!/bin/sh
+
+timeout=$1
+xid=$2
+iface=$3
+snaplen=$4
+maxpkts=$5
+maxbytes=$6
+filter=$7
+
+if [ -z $maxbytes ]; then
+    echo "Usage: $0 <timeout> <xid> <iface> <snaplen> <max packets> <max bytes> [filter]"
+    exit 1
+fi
+
+set -x
+# NB: the capture is truncated to maxbytes so that a busy node does not fill the disk
+timeout $timeout tcpdump -i $iface -s $snaplen -c $maxpkts -U -w - $filter | head -c $maxbytes > /tmp/$xid.pcap
+exit 0
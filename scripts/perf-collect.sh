@@ -1,17 +1,44 @@
 #!/bin/sh
 
 xid=$1
+output=${2:-perfdata}
 
 
 if [ -z $xid ]; then
-    echo "Usage: $0 <xid>"
+    echo "Usage: $0 <xid> [perfdata|folded|flamegraph]"
     exit 1
 fi
 
+scripts=$(cd $(dirname $0) && pwd)
 xdir=$(mktemp -d /tmp/perf-collect.XXXXXXX)
 echo $xdir
 cd $xdir
-cp /tmp/$xid-perf.data .
-$(dirname $0)/perf-archive.sh $xid-perf.data >log.out 2>log.err
+if [ -f /tmp/$xid-perf.data ]; then
+    case $output in
+    folded|flamegraph)
+        # process on the node, where the symbols match
+        perf script -i /tmp/$xid-perf.data 2>log.err | stackcollapse-perf.pl > $xid.folded
+        if [ $output = flamegraph ]; then
+            flamegraph.pl --title $xid $xid.folded > $xid.svg
+        fi
+        ;;
+    *)
+        cp /tmp/$xid-perf.data .
+        $scripts/perf-archive.sh $xid-perf.data >log.out 2>log.err
+        ;;
+    esac
+fi
+if [ -f /tmp/$xid.pcap ]; then
+    mv /tmp/$xid.pcap .
+fi
+if [ -f /tmp/$xid-ss.txt ]; then
+    mv /tmp/$xid-ss.txt .
+fi
+for f in /tmp/$xid-rdma.txt /tmp/$xid-rdma-before.txt /tmp/$xid-rdma-after.txt /tmp/$xid-ibstat.txt /tmp/$xid-hubble.json \
+         /tmp/$xid-cpu.txt /tmp/$xid-cpu-before.txt /tmp/$xid-cpu-after.txt; do
+    if [ -f $f ]; then
+        mv $f .
+    fi
+done
 
 tar cjf /tmp/$xid-perf.data.tar.bz2 .
@@ -0,0 +1,46 @@
+#!/bin/sh
+
+timeout=$1
+xid=$2
+
+if [ -z $xid ]; then
+    echo "Usage: $0 <timeout> <xid>"
+    exit 1
+fi
+
+# the monitor mounts the host root at /host
+ibdir=/sys/class/infiniband
+if [ ! -d $ibdir ] && [ -d /host$ibdir ]; then
+    ibdir=/host$ibdir
+fi
+
+out=/tmp/$xid-rdma.txt
+if [ ! -d $ibdir ] || [ -z "$(ls $ibdir)" ]; then
+    echo "# no RDMA devices" > $out
+    sleep $timeout
+    exit 0
+fi
+
+# print <device>/<port>/<counter> <value> lines, for the standard
+# (counters) and the driver-specific (hw_counters, e.g., RoCE CNPs) counters
+snapshot() {
+    for f in $ibdir/*/ports/*/counters/* $ibdir/*/ports/*/hw_counters/*; do
+        [ -f $f ] || continue
+        v=$(cat $f 2>/dev/null) || continue
+        p=${f#$ibdir/}
+        echo "${p%%/*}/$(echo $p | cut -d/ -f3)/${f##*/} $v"
+    done
+}
+
+snapshot > /tmp/$xid-rdma-before.txt
+if command -v ibstat >/dev/null; then
+    ibstat > /tmp/$xid-ibstat.txt 2>&1
+fi
+sleep $timeout
+snapshot > /tmp/$xid-rdma-after.txt
+
+# <counter> <before> <after> <delta>
+awk 'NR == FNR { before[$1] = $2; next }
+     ($1 in before) { print $1, before[$1], $2, $2 - before[$1] }' \
+    /tmp/$xid-rdma-before.txt /tmp/$xid-rdma-after.txt > $out
+exit 0
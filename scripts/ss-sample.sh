@@ -0,0 +1,45 @@
+#!/bin/sh
+
+timeout=$1
+xid=$2
+interval_ms=$3
+filter=$4
+
+if [ -z $interval_ms ]; then
+    echo "Usage: $0 <timeout> <xid> <interval (ms)> [filter]"
+    exit 1
+fi
+
+# the benchmark sockets are in the network namespaces of the pods, so sample
+# every namespace (one process per namespace) if we can enter them (i.e., the
+# monitor daemonset). Otherwise (e.g., the monitor sidecar), sample our own.
+pids=""
+if nsenter -t $$ -n true 2>/dev/null; then
+    seen=""
+    for p in /proc/[0-9]*; do
+        ns=$(readlink $p/ns/net 2>/dev/null) || continue
+        case "$seen" in
+        *"$ns"*) continue ;;
+        esac
+        seen="$seen $ns"
+        pids="$pids ${p#/proc/}"
+    done
+fi
+
+interval=$(awk "BEGIN { print $interval_ms / 1000 }")
+end=$(( $(date +%s) + timeout ))
+out=/tmp/$xid-ss.txt
+: > $out
+while [ $(date +%s) -lt $end ]; do
+    # NB: uptime (seconds), as busybox date has no sub-second precision
+    echo "# t=$(cut -d' ' -f1 /proc/uptime)" >> $out
+    if [ -n "$pids" ]; then
+        for pid in $pids; do
+            nsenter -t $pid -n ss -tinH state established $filter >> $out 2>/dev/null
+        done
+    else
+        ss -tinH state established $filter >> $out 2>/dev/null
+    fi
+    sleep $interval
+done
+exit 0
@@ -1,18 +1,64 @@
 #!/bin/sh
+# usage: system_info.sh <section>
 
 set -x
 set -o pipefail
 
-uname -a
-
-cat /host/boot/config-$(uname -r)
-cat /host/etc/lsb-release
-
-cat /proc/cpuinfo
-
-(ip -j link  2>/dev/null | jq) || ip link
-(ip -j addr  2>/dev/null | jq) || ip addr
-(ip -j route 2>/dev/null | jq) || ip route
+case "$1" in
+kernel)
+	uname -a
+	cat /host/boot/config-$(uname -r)
+	cat /host/etc/lsb-release
+	;;
+cpu)
+	cat /proc/cpuinfo
+	;;
+sysctls)
+	sysctl -a 2>/dev/null
+	;;
+interfaces)
+	(ip -j link  2>/dev/null | jq) || ip link
+	(ip -j addr  2>/dev/null | jq) || ip addr
+	for dev in $(ls /sys/class/net); do
+		ethtool -i $dev
+	done
+	;;
+offloads)
+	for dev in $(ls /sys/class/net); do
+		ethtool -k $dev
+	done
+	;;
+routes)
+	(ip -j route 2>/dev/null | jq) || ip route
+	;;
+lsmod)
+	lsmod
+	;;
+cmdline)
+	cat /proc/cmdline
+	;;
+numa)
+	# util-linux (lscpu) is not in the monitor image
+	for n in /sys/devices/system/node/node[0-9]*; do
+		echo "$(basename $n) cpus=$(cat $n/cpulist)"
+	done
+	;;
+firmware)
+	for f in sys_vendor product_name bios_vendor bios_version bios_date; do
+		echo "$f=$(cat /sys/class/dmi/id/$f 2>/dev/null)"
+	done
+	# physical NICs only (virtual devices have no driver firmware)
+	for dev in $(ls /sys/class/net); do
+		[ -e /sys/class/net/$dev/device ] || continue
+		echo "# $dev"
+		ethtool -i $dev
+	done
+	;;
+*)
+	echo "Usage: $0 <kernel|cpu|sysctls|interfaces|offloads|routes|lsmod|cmdline|numa|firmware>"
+	exit 1
+	;;
+esac
 
 # ignore errors
 exit 0
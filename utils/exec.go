@@ -2,31 +2,78 @@ package utils
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"os/exec"
+	"sync/atomic"
 	"time"
 )
 
 // global command timeout parameter
 const cmdTimeout = 90 * time.Second
 
+// CmdHook observes the commands executed by the package: Rewrite returns the
+// command to execute (e.g., with additional flags), and Done is called with
+// the standard error of the command once it exits.
+type CmdHook interface {
+	Rewrite(argcmd string) string
+	Done(argcmd string, stderr []byte)
+}
+
+var cmdHook atomic.Pointer[CmdHook]
+
+// SetCmdHook sets the hook of the executed commands (nil to remove it)
+func SetCmdHook(h CmdHook) {
+	if h == nil {
+		cmdHook.Store(nil)
+		return
+	}
+	cmdHook.Store(&h)
+}
+
+// hookCmd returns the command to execute, and sets up the hook (if any) to
+// get its standard error. The returned function must be called once the
+// command exits.
+func hookCmd(ctx context.Context, argcmd string) (*exec.Cmd, func()) {
+	h := cmdHook.Load()
+	if h == nil {
+		return exec.CommandContext(ctx, "sh", []string{"-c", argcmd}...), func() {}
+	}
+	rewritten := (*h).Rewrite(argcmd)
+	cmd := exec.CommandContext(ctx, "sh", []string{"-c", rewritten}...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	return cmd, func() { (*h).Done(rewritten, stderr.Bytes()) }
+}
+
 // ExecCmd executes a command using the shell
 func ExecCmd(argcmd string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+	return ExecCmdContext(context.Background(), argcmd)
+}
+
+// ExecCmdContext executes a command using the shell, bounded by ctx
+func ExecCmdContext(ctx context.Context, argcmd string) error {
+	ctx, cancel := context.WithTimeout(ctx, cmdTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "sh", []string{"-c", argcmd}...)
+	cmd, done := hookCmd(ctx, argcmd)
 	err := cmd.Run()
+	done()
 	return err
 }
 
 // ExecCmdLines executes a command using the shell, and return the output lines or an error
 func ExecCmdLines(argcmd string) ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+	return ExecCmdLinesContext(context.Background(), argcmd)
+}
+
+// ExecCmdLinesContext is ExecCmdLines bounded by ctx
+func ExecCmdLinesContext(ctx context.Context, argcmd string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cmdTimeout)
 	defer cancel()
 	var ret []string
 
-	cmd := exec.CommandContext(ctx, "sh", []string{"-c", argcmd}...)
+	cmd, done := hookCmd(ctx, argcmd)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return ret, err
@@ -46,5 +93,6 @@ func ExecCmdLines(argcmd string) ([]string, error) {
 	}
 
 	err = cmd.Wait()
+	done()
 	return ret, err
 }